@@ -0,0 +1,140 @@
+// Command mockim is a local stand-in for the Feishu, DingTalk and WeCom
+// group bot webhooks, for trying out IM notifications without a real
+// chat group. It checks signatures like the platforms do, answers in
+// their response formats and prints every message it receives.
+//
+//	go run ./cmd/mockim -addr :8090 -secret SEC123
+//
+// and in config.yaml, one of:
+//
+//	notification:
+//	  enable: true
+//	  im:
+//	    provider: "feishu"       # webhook: "http://localhost:8090/feishu/hook"
+//	    provider: "dingtalk"     # webhook: "http://localhost:8090/dingtalk?access_token=x"
+//	    provider: "wechat_work"  # webhook: "http://localhost:8090/wecom?key=x"
+//	    webhook: "..."
+//	    secret: "SEC123"
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSkew is how far a signed timestamp may be from now
+const maxSkew = time.Hour
+
+var secret string
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	flag.StringVar(&secret, "secret", "", "signing secret, empty accepts unsigned messages")
+	flag.Parse()
+
+	http.HandleFunc("/feishu/", feishu)
+	http.HandleFunc("/dingtalk", dingtalk)
+	http.HandleFunc("/wecom", wecom)
+
+	log.Printf("mockim listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// feishu answers {"code":0,"msg":"success"}, 19021 on a bad signature
+func feishu(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if !decode(w, r, &body) {
+		return
+	}
+	if secret != "" {
+		timestamp, _ := body["timestamp"].(string)
+		sign, _ := body["sign"].(string)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+		if !fresh(timestamp, time.Second) || !hmac.Equal([]byte(sign), []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))) {
+			reply(w, map[string]interface{}{"code": 19021, "msg": "sign match fail or timestamp is not within one hour from current time"})
+			return
+		}
+	}
+	if body["msg_type"] == nil {
+		reply(w, map[string]interface{}{"code": 19002, "msg": "params error, msg_type need"})
+		return
+	}
+	show("feishu", body)
+	reply(w, map[string]interface{}{"code": 0, "msg": "success", "data": map[string]interface{}{}})
+}
+
+// dingtalk answers {"errcode":0,"errmsg":"ok"}, 310000 on a bad signature
+func dingtalk(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if !decode(w, r, &body) {
+		return
+	}
+	if secret != "" {
+		timestamp, sign := r.URL.Query().Get("timestamp"), r.URL.Query().Get("sign")
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "\n" + secret))
+		if !fresh(timestamp, time.Millisecond) || !hmac.Equal([]byte(sign), []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))) {
+			reply(w, map[string]interface{}{"errcode": 310000, "errmsg": "sign not match"})
+			return
+		}
+	}
+	show("dingtalk", body)
+	reply(w, map[string]interface{}{"errcode": 0, "errmsg": "ok"})
+}
+
+// wecom answers {"errcode":0,"errmsg":"ok"}, 93000 without a key
+func wecom(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if !decode(w, r, &body) {
+		return
+	}
+	if r.URL.Query().Get("key") == "" {
+		reply(w, map[string]interface{}{"errcode": 93000, "errmsg": "invalid webhook url"})
+		return
+	}
+	show("wecom", body)
+	reply(w, map[string]interface{}{"errcode": 0, "errmsg": "ok"})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v); err != nil {
+		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// fresh reports whether timestamp, counted in unit since the epoch, is
+// within maxSkew of now
+func fresh(timestamp string, unit time.Duration) bool {
+	n, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	d := time.Since(time.Unix(0, n*int64(unit)))
+	return d < maxSkew && d > -maxSkew
+}
+
+func show(provider string, body map[string]interface{}) {
+	delete(body, "sign")
+	out, _ := json.MarshalIndent(body, "", "  ")
+	log.Printf("%s message:\n%s", provider, strings.TrimSpace(string(out)))
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
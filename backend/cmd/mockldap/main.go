@@ -0,0 +1,118 @@
+// Command mockldap is an in-memory LDAP directory for trying out the LDAP
+// authenticator locally. It serves a few fixture users, or the entries of
+// a JSON file which is reloaded on SIGHUP.
+//
+//	go run ./cmd/mockldap -addr :3890
+//
+// and in config.yaml:
+//
+//	auth:
+//	  authenticators: ["local", "ldap"]
+//	  ldap:
+//	    url: "ldap://localhost:3890"
+//	    bind_dn: "cn=svc,dc=example,dc=com"
+//	    bind_password: "svc"
+//	    base_dn: "dc=example,dc=com"
+//
+// Users alice and bob sign in with their username as password; alice is
+// in the itam-admins group.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"itam-backend/internal/ldap"
+)
+
+// fixtures maps DNs to attributes, the same shape as the -data file
+var fixtures = map[string]map[string][]string{
+	"cn=svc,dc=example,dc=com": {
+		"objectClass":  {"applicationProcess"},
+		"cn":           {"svc"},
+		"userPassword": {"svc"},
+	},
+	"uid=alice,ou=people,dc=example,dc=com": {
+		"objectClass":  {"person", "inetOrgPerson"},
+		"uid":          {"alice"},
+		"displayName":  {"Alice Liddell"},
+		"mail":         {"alice@example.com"},
+		"memberOf":     {"cn=itam-admins,ou=groups,dc=example,dc=com"},
+		"userPassword": {"alice"},
+	},
+	"uid=bob,ou=people,dc=example,dc=com": {
+		"objectClass":  {"person", "inetOrgPerson"},
+		"uid":          {"bob"},
+		"displayName":  {"Bob Builder"},
+		"mail":         {"bob@example.com"},
+		"memberOf":     {"cn=staff,ou=groups,dc=example,dc=com"},
+		"userPassword": {"bob"},
+	},
+}
+
+func main() {
+	addr := flag.String("addr", ":3890", "listen address")
+	dataFile := flag.String("data", "", "JSON file of entries as {dn: {attribute: [values]}}, reloaded on SIGHUP")
+	flag.Parse()
+
+	entries, err := load(*dataFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := ldap.NewMemoryServer(entries)
+
+	if *dataFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				entries, err := load(*dataFile)
+				if err != nil {
+					log.Printf("Reload failed: %v", err)
+					continue
+				}
+				srv.SetEntries(entries)
+				log.Printf("Reloaded %d entries", len(entries))
+			}
+		}()
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Mock LDAP directory with %d entries listening on %s", len(entries), *addr)
+	log.Fatal(srv.Serve(l))
+}
+
+func load(path string) ([]*ldap.Entry, error) {
+	raw := fixtures
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		raw = nil
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []*ldap.Entry
+	for dn, attrs := range raw {
+		e := &ldap.Entry{DN: dn}
+		for name, values := range attrs {
+			e.Attributes = append(e.Attributes, ldap.Attribute{Name: name, Values: values})
+		}
+		sort.Slice(e.Attributes, func(i, j int) bool { return e.Attributes[i].Name < e.Attributes[j].Name })
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DN < entries[j].DN })
+	return entries, nil
+}
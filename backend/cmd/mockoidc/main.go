@@ -0,0 +1,174 @@
+// Command mockoidc is a minimal OpenID Connect provider for trying out
+// single sign-on locally. It approves every authorization request as the
+// user given by the flags (or the login_hint parameter) without asking.
+//
+//	go run ./cmd/mockoidc -addr :9000 -user alice -groups itam-admins
+//
+// and in config.yaml:
+//
+//	auth:
+//	  oidc:
+//	    enable: true
+//	    issuer: "http://localhost:9000"
+//	    client_id: "itam"
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type grant struct {
+	clientID, redirectURI, challenge, nonce, user string
+	expires                                       time.Time
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, must match the relying party configuration")
+	clientID := flag.String("client-id", "itam", "accepted client_id")
+	user := flag.String("user", "alice", "default username when no login_hint is given")
+	groups := flag.String("groups", "", "comma separated groups claim")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	const kid = "mock-1"
+
+	var mu sync.Mutex
+	grants := map[string]*grant{}
+
+	http.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                *issuer,
+			"authorization_endpoint":                *issuer + "/authorize",
+			"token_endpoint":                        *issuer + "/token",
+			"jwks_uri":                              *issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	http.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": kid,
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	http.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != *clientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+			return
+		}
+		name := q.Get("login_hint")
+		if name == "" {
+			name = *user
+		}
+
+		code := randomString()
+		mu.Lock()
+		grants[code] = &grant{
+			clientID:    q.Get("client_id"),
+			redirectURI: q.Get("redirect_uri"),
+			challenge:   q.Get("code_challenge"),
+			nonce:       q.Get("nonce"),
+			user:        name,
+			expires:     time.Now().Add(time.Minute),
+		}
+		mu.Unlock()
+
+		back, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		bq := back.Query()
+		bq.Set("code", code)
+		bq.Set("state", q.Get("state"))
+		back.RawQuery = bq.Encode()
+		http.Redirect(w, r, back.String(), http.StatusFound)
+	})
+
+	http.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		g := grants[r.PostForm.Get("code")]
+		delete(grants, r.PostForm.Get("code"))
+		mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		switch {
+		case g == nil || time.Now().After(g.expires):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		case r.PostForm.Get("client_id") != g.clientID || r.PostForm.Get("redirect_uri") != g.redirectURI:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+			return
+		case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":                *issuer,
+			"aud":                g.clientID,
+			"sub":                "mock|" + g.user,
+			"preferred_username": g.user,
+			"name":               "Mock user " + g.user,
+			"email":              g.user + "@example.com",
+			"nonce":              g.nonce,
+			"iat":                time.Now().Unix(),
+			"exp":                time.Now().Add(5 * time.Minute).Unix(),
+		}
+		if *groups != "" {
+			claims["groups"] = strings.Split(*groups, ",")
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": randomString(),
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+
+	log.Printf("Mock OIDC provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,126 @@
+// Command mocks3 is an in-memory stand-in for an S3-compatible object
+// store, for trying out the s3 storage driver locally. It checks request
+// signatures and serves PUT, GET and DELETE on path-style object URLs.
+//
+//	go run ./cmd/mocks3 -addr :9000
+//
+// and in config.yaml:
+//
+//	storage:
+//	  driver: "s3"
+//	  s3:
+//	    endpoint: "http://localhost:9000"
+//	    bucket: "itam"
+//	    access_key: "minio"
+//	    secret_key: "minio123"
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"itam-backend/internal/storage"
+)
+
+type server struct {
+	accessKey, secretKey, region string
+	objects                      *storage.MemoryStorage
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	s := &server{objects: storage.NewMemoryStorage()}
+	flag.StringVar(&s.accessKey, "access-key", "minio", "access key clients sign with")
+	flag.StringVar(&s.secretKey, "secret-key", "minio123", "secret key clients sign with")
+	flag.StringVar(&s.region, "region", "us-east-1", "signing region")
+	flag.Parse()
+
+	log.Printf("mocks3 listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.verify(r); err != nil {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+
+	// Path style: /bucket/key, the bucket is part of the key here
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(key, "/") {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "only object requests are supported")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if err := s.objects.Put(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		log.Printf("PUT %s (%d bytes)", key, r.ContentLength)
+	case http.MethodGet:
+		rc, obj, err := s.objects.Get(r.Context(), key)
+		if errors.Is(err, storage.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		defer rc.Close()
+		if obj.ContentType != "" {
+			w.Header().Set("Content-Type", obj.ContentType)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+		io.Copy(w, rc)
+	case http.MethodDelete:
+		s.objects.Delete(r.Context(), key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported")
+	}
+}
+
+// verify signs a copy of r with the configured key and compares the result
+// with the Authorization header the client sent
+func (s *server) verify(r *http.Request) error {
+	got := r.Header.Get("Authorization")
+	if !strings.HasPrefix(got, "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/") {
+		return errors.New("unknown access key")
+	}
+	t, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return errors.New("missing or malformed X-Amz-Date")
+	}
+	if d := time.Since(t); d > 15*time.Minute || d < -15*time.Minute {
+		return errors.New("request time too skewed")
+	}
+
+	clone := r.Clone(r.Context())
+	clone.URL.Host = r.Host
+	storage.SignV4(clone, s.accessKey, s.secretKey, s.region, r.Header.Get("X-Amz-Content-Sha256"), t)
+	if clone.Header.Get("Authorization") != got {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,301 @@
+// Command mocksmtp is a local stand-in for an SMTP server, for trying out
+// email notifications without a real mailbox. It offers STARTTLS with a
+// throwaway self-signed certificate, or implicit TLS with -implicit-tls,
+// accepts AUTH PLAIN and prints a summary of every message it receives,
+// optionally saving them as .eml files.
+//
+//	go run ./cmd/mocksmtp -addr :2525 -dir /tmp/mail
+//
+// and in config.yaml:
+//
+//	notification:
+//	  enable: true
+//	  email:
+//	    host: "localhost"
+//	    port: 2525
+//	    security: "starttls"
+//	    insecure_skip_verify: true
+//	    username: "itam"
+//	    password: "secret"
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	username, password, dir string
+	tlsConfig               *tls.Config
+	received                int64
+)
+
+func main() {
+	addr := flag.String("addr", ":2525", "listen address")
+	implicitTLS := flag.Bool("implicit-tls", false, "speak TLS from the first byte, like port 465")
+	flag.StringVar(&username, "user", "itam", "AUTH username, empty accepts any")
+	flag.StringVar(&password, "pass", "secret", "AUTH password")
+	flag.StringVar(&dir, "dir", "", "save received messages as .eml files here")
+	flag.Parse()
+
+	cert, err := selfSigned()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	var ln net.Listener
+	if *implicitTLS {
+		ln, err = tls.Listen("tcp", *addr, tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", *addr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("mocksmtp listening on %s (implicit TLS: %v)", *addr, *implicitTLS)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go serve(conn)
+	}
+}
+
+type session struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	authed bool
+	from   string
+	rcpt   []string
+}
+
+func (s *session) reply(format string, args ...interface{}) {
+	fmt.Fprintf(s.conn, format+"\r\n", args...)
+}
+
+func serve(conn net.Conn) {
+	defer conn.Close()
+	_, secure := conn.(*tls.Conn)
+	s := &session{conn: conn, r: bufio.NewReader(conn)}
+	s.reply("220 mocksmtp ready")
+
+	for {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			s.reply("250-mocksmtp")
+			if !secure {
+				s.reply("250-STARTTLS")
+			}
+			s.reply("250-AUTH PLAIN")
+			s.reply("250 8BITMIME")
+		case "STARTTLS":
+			if secure {
+				s.reply("503 already running TLS")
+				continue
+			}
+			s.reply("220 go ahead")
+			tlsConn := tls.Server(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				log.Printf("STARTTLS handshake: %v", err)
+				return
+			}
+			conn, secure = tlsConn, true
+			s.conn, s.r = tlsConn, bufio.NewReader(tlsConn)
+			s.authed, s.from, s.rcpt = false, "", nil
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mech, "PLAIN") {
+				s.reply("504 only PLAIN is supported")
+				continue
+			}
+			if !secure && !strings.HasPrefix(conn.RemoteAddr().String(), "127.0.0.1") {
+				s.reply("538 encryption required")
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(raw), "\x00")
+			if err != nil || len(parts) != 3 || (username != "" && (parts[1] != username || parts[2] != password)) {
+				s.reply("535 authentication failed")
+				continue
+			}
+			s.authed = true
+			s.reply("235 authenticated")
+		case "MAIL":
+			if username != "" && !s.authed {
+				s.reply("530 authentication required")
+				continue
+			}
+			from, ok := address(arg, "FROM:")
+			if !ok {
+				s.reply("501 syntax: MAIL FROM:<address>")
+				continue
+			}
+			s.from, s.rcpt = from, nil
+			s.reply("250 ok")
+		case "RCPT":
+			if s.from == "" {
+				s.reply("503 MAIL first")
+				continue
+			}
+			to, ok := address(arg, "TO:")
+			if !ok || to == "" {
+				s.reply("501 syntax: RCPT TO:<address>")
+				continue
+			}
+			s.rcpt = append(s.rcpt, to)
+			s.reply("250 ok")
+		case "DATA":
+			if len(s.rcpt) == 0 {
+				s.reply("503 RCPT first")
+				continue
+			}
+			s.reply("354 end with <CRLF>.<CRLF>")
+			msg, err := readData(s.r)
+			if err != nil {
+				return
+			}
+			s.reply("250 queued")
+			show(s.from, s.rcpt, msg, secure)
+			s.from, s.rcpt = "", nil
+		case "RSET":
+			s.from, s.rcpt = "", nil
+			s.reply("250 ok")
+		case "NOOP":
+			s.reply("250 ok")
+		case "QUIT":
+			s.reply("221 bye")
+			return
+		default:
+			s.reply("502 command not implemented")
+		}
+	}
+}
+
+// address takes the path out of "FROM:<a@b> BODY=8BITMIME" and the like
+func address(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+		return "", false
+	}
+	return path[1 : len(path)-1], true
+}
+
+// readData reads a dot-terminated message, undoing dot stuffing
+func readData(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return buf.Bytes(), nil
+		}
+		buf.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func show(from string, rcpt []string, raw []byte, secure bool) {
+	n := atomic.AddInt64(&received, 1)
+	var b strings.Builder
+	fmt.Fprintf(&b, "message %d from %s to %s (TLS: %v)\n", n, from, strings.Join(rcpt, ", "), secure)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		fmt.Fprintf(&b, "  unparsable: %v\n", err)
+	} else {
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		fmt.Fprintf(&b, "  Subject: %s\n", subject)
+		listParts(&b, msg.Header.Get("Content-Type"), msg.Body, "  ")
+	}
+	if dir != "" {
+		name := filepath.Join(dir, fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102-150405"), n))
+		if err := os.WriteFile(name, raw, 0o644); err != nil {
+			fmt.Fprintf(&b, "  save: %v\n", err)
+		} else {
+			fmt.Fprintf(&b, "  saved to %s\n", name)
+		}
+	}
+	log.Print(b.String())
+}
+
+// listParts prints the MIME tree of a message body
+func listParts(b *strings.Builder, contentType string, body io.Reader, indent string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		data, _ := io.ReadAll(body)
+		fmt.Fprintf(b, "%s- %s (%d bytes)\n", indent, contentType, len(data))
+		return
+	}
+	fmt.Fprintf(b, "%s- %s\n", indent, mediaType)
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			return
+		}
+		if name := p.FileName(); name != "" {
+			data, _ := io.ReadAll(p)
+			fmt.Fprintf(b, "%s  - attachment %q %s (%d encoded bytes)\n", indent, name, p.Header.Get("Content-Type"), len(data))
+			continue
+		}
+		listParts(b, p.Header.Get("Content-Type"), p, indent+"  ")
+	}
+}
+
+// selfSigned makes a throwaway certificate for localhost
+func selfSigned() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "mocksmtp"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
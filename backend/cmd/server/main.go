@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"itam-backend/internal/conf"
 	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
 	"itam-backend/internal/notification"
+	"itam-backend/internal/scheduler"
 	"itam-backend/internal/server"
+	"itam-backend/internal/session"
+	"itam-backend/internal/storage"
+	"itam-backend/internal/webhook"
 	"log"
 )
 
@@ -16,13 +22,33 @@ func main() {
 	// 2. Initialize Database
 	data.InitDB(cfg)
 
-	// 3. Initialize Notification Service
+	// 3. Initialize Sessions
+	middleware.InitAuth(cfg)
+	session.Init(cfg)
+
+	// 4. Initialize Notification Service
 	notifyService := notification.NewService(&cfg.Notification)
 
-	// 4. Initialize Server
-	r := server.NewHTTPServer(cfg, notifyService)
+	// 5. Initialize File Storage
+	store, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+
+	// 6. Start Background Jobs
+	notifyService.Start(context.Background())
+	scheduler.NewContractExpiryScanner(&cfg.Contract, notifyService, store).Start(context.Background())
+	scheduler.NewLDAPSync(&cfg.Auth).Start(context.Background())
+	dispatcher, err := webhook.NewDispatcher(&cfg.Webhook)
+	if err != nil {
+		log.Fatalf("Failed to initialize webhooks: %v", err)
+	}
+	dispatcher.Start(context.Background())
+
+	// 7. Initialize Server
+	r := server.NewHTTPServer(cfg, notifyService, store, dispatcher)
 
-	// 5. Run Server
+	// 8. Run Server
 	addr := fmt.Sprintf(":%s", cfg.Server.Port)
 	log.Printf("Starting server on %s", addr)
 	if err := r.Run(addr); err != nil {
@@ -0,0 +1,268 @@
+// Package audit records every create/update/delete issued through GORM on
+// behalf of an authenticated request into the audit_logs table.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"itam-backend/internal/model"
+)
+
+// ActorKey is the context key holding the Actor of the current request
+const ActorKey = "auditActor"
+
+const oldRowsKey = "audit:old_rows"
+
+// Actor identifies who issued a change
+type Actor struct {
+	UserID    uint
+	Username  string
+	ClientIP  string
+	UserAgent string
+}
+
+// ActorFromContext returns the actor stored in ctx, if any
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	if ctx == nil {
+		return Actor{}, false
+	}
+	actor, ok := ctx.Value(ActorKey).(Actor)
+	return actor, ok
+}
+
+// ignoredColumns are left out of update diffs since they change on every write
+var ignoredColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// Register installs the audit callbacks on db
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("audit:after_create", afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("audit:before_update", loadOldRows); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("audit:after_update", afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("audit:before_delete", loadOldRows); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("audit:after_delete", afterDelete)
+}
+
+func shouldAudit(db *gorm.DB) (Actor, bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Table == (model.AuditLog{}).TableName() {
+		return Actor{}, false
+	}
+	return ActorFromContext(db.Statement.Context)
+}
+
+func afterCreate(db *gorm.DB) {
+	actor, ok := shouldAudit(db)
+	if !ok {
+		return
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			row := structToRow(db, reflect.Indirect(rv.Index(i)))
+			write(db, actor, "create", row, nil, row)
+		}
+	case reflect.Struct:
+		row := structToRow(db, rv)
+		write(db, actor, "create", row, nil, row)
+	}
+}
+
+func afterUpdate(db *gorm.DB) {
+	actor, ok := shouldAudit(db)
+	if !ok {
+		return
+	}
+	oldRows, ok := db.InstanceGet(oldRowsKey)
+	if !ok {
+		return
+	}
+
+	for _, oldRow := range oldRows.([]map[string]interface{}) {
+		var newRow map[string]interface{}
+		pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+		if err := newQuery(db).Where(clause.Eq{Column: clause.Column{Name: pk}, Value: oldRow[pk]}).Take(&newRow).Error; err != nil {
+			continue
+		}
+
+		oldDiff, newDiff := diff(oldRow, newRow)
+		if len(newDiff) == 0 {
+			continue
+		}
+		write(db, actor, "update", oldRow, oldDiff, newDiff)
+	}
+}
+
+func afterDelete(db *gorm.DB) {
+	actor, ok := shouldAudit(db)
+	if !ok {
+		return
+	}
+	oldRows, ok := db.InstanceGet(oldRowsKey)
+	if !ok {
+		return
+	}
+
+	for _, oldRow := range oldRows.([]map[string]interface{}) {
+		write(db, actor, "delete", oldRow, oldRow, nil)
+	}
+}
+
+// loadOldRows snapshots the rows an update/delete is about to touch
+func loadOldRows(db *gorm.DB) {
+	if _, ok := shouldAudit(db); !ok || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return
+	}
+
+	var exprs []clause.Expression
+	if where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where); ok {
+		exprs = append(exprs, where.Exprs...)
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	if rv.Kind() == reflect.Struct {
+		pk := db.Statement.Schema.PrioritizedPrimaryField
+		if v, isZero := pk.ValueOf(db.Statement.Context, rv); !isZero {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: v})
+		}
+	}
+
+	// Never snapshot a whole table; GORM refuses such writes anyway
+	if len(exprs) == 0 {
+		return
+	}
+
+	var rows []map[string]interface{}
+	if err := newQuery(db).Where(clause.Where{Exprs: exprs}).Find(&rows).Error; err != nil {
+		log.Printf("audit: failed to load rows of %s: %v", db.Statement.Table, err)
+		return
+	}
+	db.InstanceSet(oldRowsKey, rows)
+}
+
+func newQuery(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Unscoped().
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+}
+
+func structToRow(db *gorm.DB, rv reflect.Value) map[string]interface{} {
+	row := map[string]interface{}{}
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		v, _ := field.ValueOf(db.Statement.Context, rv)
+		row[field.DBName] = v
+	}
+	return row
+}
+
+func diff(oldRow, newRow map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	oldDiff := map[string]interface{}{}
+	newDiff := map[string]interface{}{}
+	for k, nv := range newRow {
+		if ignoredColumns[k] {
+			continue
+		}
+		ov := oldRow[k]
+		if fmt.Sprint(normalize(ov)) != fmt.Sprint(normalize(nv)) {
+			oldDiff[k] = ov
+			newDiff[k] = nv
+		}
+	}
+	return oldDiff, newDiff
+}
+
+func write(db *gorm.DB, actor Actor, op string, row, oldValues, newValues map[string]interface{}) {
+	entity := db.NamingStrategy.ColumnName("", db.Statement.Schema.Name)
+
+	changes := model.JSONMap{}
+	if oldValues != nil {
+		changes["old"] = mask(oldValues)
+	}
+	if newValues != nil {
+		changes["new"] = mask(newValues)
+	}
+
+	entry := model.AuditLog{
+		Username:   actor.Username,
+		Action:     entity + "." + op,
+		TargetType: entity,
+		TargetID:   toUint(row[db.Statement.Schema.PrioritizedPrimaryField.DBName]),
+		Changes:    changes,
+		ClientIP:   actor.ClientIP,
+		UserAgent:  actor.UserAgent,
+	}
+	if actor.UserID != 0 {
+		entry.UserID = &actor.UserID
+	}
+	// Entries follow the tenant of the changed row; system jobs act on all tenants
+	if v, ok := row["tenant_id"]; ok {
+		entry.TenantID = toUint(v)
+	}
+
+	// Same connection as the audited statement, so the entry commits with it
+	if err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Create(&entry).Error; err != nil {
+		log.Printf("audit: failed to record %s: %v", entry.Action, err)
+	}
+}
+
+// mask hides credentials so they never land in the audit trail
+func mask(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if isSensitive(k) {
+			out[k] = "******"
+			continue
+		}
+		out[k] = normalize(v)
+	}
+	return out
+}
+
+func isSensitive(column string) bool {
+	for _, s := range []string{"password", "secret", "token"} {
+		if strings.Contains(column, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case *[]byte:
+		if t == nil {
+			return nil
+		}
+		return string(*t)
+	}
+	return v
+}
+
+func toUint(v interface{}) uint {
+	n, _ := strconv.ParseUint(fmt.Sprint(normalize(v)), 10, 64)
+	return uint(n)
+}
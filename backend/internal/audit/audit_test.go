@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"itam-backend/internal/model"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// account has the kinds of credential columns the audit trail must hide
+type account struct {
+	ID           uint
+	TenantID     uint
+	Name         string
+	Role         string
+	PasswordHash string
+	MFASecret    string
+	APIToken     string
+	UpdatedAt    time.Time
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&account{}, &model.AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func asActor(db *gorm.DB) *gorm.DB {
+	return db.WithContext(context.WithValue(context.Background(), ActorKey, Actor{UserID: 7, Username: "auditor", ClientIP: "192.0.2.1"}))
+}
+
+// lastEntry returns the newest audit entry, failing unless there are want
+func lastEntry(t *testing.T, db *gorm.DB, want int64) model.AuditLog {
+	t.Helper()
+	var n int64
+	db.Model(&model.AuditLog{}).Count(&n)
+	if n != want {
+		t.Fatalf("%d audit entries, want %d", n, want)
+	}
+	var entry model.AuditLog
+	db.Order("id DESC").First(&entry)
+	return entry
+}
+
+func values(t *testing.T, entry model.AuditLog, side string) map[string]interface{} {
+	t.Helper()
+	v, ok := entry.Changes[side].(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s: no %s values in %v", entry.Action, side, entry.Changes)
+	}
+	return v
+}
+
+func TestAuditRecordsDiffs(t *testing.T) {
+	db := openDB(t)
+	a := account{TenantID: 3, Name: "amy", Role: "user", PasswordHash: "hash-1"}
+	if err := asActor(db).Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry := lastEntry(t, db, 1)
+	if entry.Action != "account.create" || entry.TargetID != a.ID || entry.TenantID != 3 ||
+		entry.UserID == nil || *entry.UserID != 7 || entry.Username != "auditor" || entry.ClientIP != "192.0.2.1" {
+		t.Fatalf("create entry: %+v", entry)
+	}
+	if created := values(t, entry, "new"); created["name"] != "amy" || created["role"] != "user" {
+		t.Fatalf("created values: %v", created)
+	}
+
+	// Only the changed columns, before and after
+	if err := asActor(db).Model(&a).Updates(map[string]interface{}{"role": "admin", "name": "amy"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry = lastEntry(t, db, 2)
+	oldValues, newValues := values(t, entry, "old"), values(t, entry, "new")
+	if entry.Action != "account.update" || len(newValues) != 1 || oldValues["role"] != "user" || newValues["role"] != "admin" {
+		t.Fatalf("update entry %s: %v -> %v", entry.Action, oldValues, newValues)
+	}
+
+	// Writing the same values again, or without an actor, records nothing
+	asActor(db).Model(&a).Update("role", "admin")
+	db.Model(&a).Update("role", "user")
+	lastEntry(t, db, 2)
+
+	if err := asActor(db).Delete(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	entry = lastEntry(t, db, 3)
+	if deleted := values(t, entry, "old"); entry.Action != "account.delete" || deleted["role"] != "user" || entry.Changes["new"] != nil {
+		t.Fatalf("delete entry %s: %v", entry.Action, entry.Changes)
+	}
+}
+
+func TestAuditMasksCredentials(t *testing.T) {
+	db := openDB(t)
+	a := account{Name: "bob", PasswordHash: "hash-1", MFASecret: "totp-1", APIToken: "token-1"}
+	if err := asActor(db).Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	asActor(db).Model(&a).Updates(map[string]interface{}{"password_hash": "hash-2", "mfa_secret": "totp-2", "api_token": "token-2"})
+	asActor(db).Delete(&a)
+
+	var entries []model.AuditLog
+	db.Order("id").Find(&entries)
+	if len(entries) != 3 {
+		t.Fatalf("%d audit entries, want 3", len(entries))
+	}
+	for _, entry := range entries {
+		for _, side := range []string{"old", "new"} {
+			v, ok := entry.Changes[side].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, column := range []string{"password_hash", "mfa_secret", "api_token"} {
+				if v[column] != "******" {
+					t.Errorf("%s %s %s = %v", entry.Action, side, column, v[column])
+				}
+			}
+		}
+	}
+	// A credential change is still recorded, just not its value
+	if v := values(t, entries[1], "new"); len(v) != 3 {
+		t.Fatalf("update recorded %v", v)
+	}
+}
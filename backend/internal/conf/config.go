@@ -4,18 +4,26 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 	"log"
+	"time"
 )
 
 type Config struct {
 	Server       ServerConfig       `mapstructure:"server"`
 	Database     DatabaseConfig     `mapstructure:"database"`
 	Redis        RedisConfig        `mapstructure:"redis"`
+	Auth         AuthConfig         `mapstructure:"auth"`
 	Notification NotificationConfig `mapstructure:"notification"`
+	Contract     ContractConfig     `mapstructure:"contract"`
+	Storage      StorageConfig      `mapstructure:"storage"`
+	Webhook      WebhookConfig      `mapstructure:"webhook"`
 }
 
 type ServerConfig struct {
 	Port string `mapstructure:"port"`
 	Mode string `mapstructure:"mode"`
+	// TrustedProxies lists the reverse proxies, as addresses or CIDRs,
+	// whose X-Forwarded-For header names the client. Empty trusts none.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -33,10 +41,162 @@ type RedisConfig struct {
 	Db       int    `mapstructure:"db"`
 }
 
+type AuthConfig struct {
+	AccessTokenTTL  time.Duration  `mapstructure:"access_token_ttl"`  // lifetime of JWT access tokens, e.g. "15m"
+	RefreshTokenTTL time.Duration  `mapstructure:"refresh_token_ttl"` // lifetime of a session without refresh, e.g. "168h"
+	SessionStore    string         `mapstructure:"session_store"`     // "memory" or "redis"
+	JWTSecret       string         `mapstructure:"jwt_secret"`        // HS256 secret used when no keys are listed, env ITAM_JWT_SECRET
+	SigningKey      string         `mapstructure:"signing_key"`       // kid of the key that signs new tokens, defaults to the first key
+	Keys            []JWTKeyConfig `mapstructure:"keys"`              // all keys accepted for verification
+	OIDC            OIDCConfig     `mapstructure:"oidc"`
+	LDAP            LDAPConfig     `mapstructure:"ldap"`
+	Authenticators  []string       `mapstructure:"authenticators"` // password login chain, tried in order: local, ldap
+	MFA             MFAConfig      `mapstructure:"mfa"`
+	Lockout         LockoutConfig  `mapstructure:"lockout"`
+	APITokenMaxTTL  time.Duration  `mapstructure:"api_token_max_ttl"` // longest lifetime of personal API tokens, 0 allows tokens that never expire
+}
+
+// JWTKeyConfig is one JWT key. HS256 keys take secret or secret_file;
+// RS256 and EdDSA keys take PEM files, a key without private_key_file
+// only verifies tokens, e.g. one being rotated out.
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`        // kid header value
+	Algorithm      string `mapstructure:"algorithm"` // HS256, RS256 or EdDSA
+	Secret         string `mapstructure:"secret"`
+	SecretFile     string `mapstructure:"secret_file"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
+
+// OIDCConfig single sign-on through an OpenID Connect provider
+type OIDCConfig struct {
+	Enable            bool          `mapstructure:"enable"`
+	Issuer            string        `mapstructure:"issuer"` // e.g. "https://idp.example.com/realms/corp"
+	ClientID          string        `mapstructure:"client_id"`
+	ClientSecret      string        `mapstructure:"client_secret"`       // empty for public clients
+	RedirectURL       string        `mapstructure:"redirect_url"`        // this server's /api/v1/auth/oidc/callback
+	PostLoginRedirect string        `mapstructure:"post_login_redirect"` // frontend page receiving the tokens, empty returns JSON
+	Scopes            []string      `mapstructure:"scopes"`
+	UsernameClaim     string        `mapstructure:"username_claim"` // e.g. "preferred_username"
+	GroupsClaim       string        `mapstructure:"groups_claim"`   // e.g. "groups"
+	AutoProvision     bool          `mapstructure:"auto_provision"` // create unknown users on first login
+	Tenant            string        `mapstructure:"tenant"`         // tenant code for provisioned users
+	DefaultRole       string        `mapstructure:"default_role"`   // role when no group mapping matches
+	RoleMappings      []RoleMapping `mapstructure:"role_mappings"`  // first matching group wins
+}
+
+// LDAPConfig password login against LDAP or Active Directory
+type LDAPConfig struct {
+	URL                  string        `mapstructure:"url"` // ldap://host:389 or ldaps://host:636
+	StartTLS             bool          `mapstructure:"start_tls"`
+	InsecureSkipVerify   bool          `mapstructure:"insecure_skip_verify"`
+	Timeout              time.Duration `mapstructure:"timeout"`
+	BindDN               string        `mapstructure:"bind_dn"` // service account used to find users, empty for anonymous
+	BindPassword         string        `mapstructure:"bind_password"`
+	BaseDN               string        `mapstructure:"base_dn"`
+	UserFilter           string        `mapstructure:"user_filter"` // {username} is replaced by the escaped login name
+	UsernameAttribute    string        `mapstructure:"username_attribute"`
+	DisplayNameAttribute string        `mapstructure:"display_name_attribute"`
+	EmailAttribute       string        `mapstructure:"email_attribute"`
+	GroupAttribute       string        `mapstructure:"group_attribute"` // group DNs on the user entry, e.g. memberOf
+	IDAttribute          string        `mapstructure:"id_attribute"`    // stable ID such as objectGUID, empty uses the DN
+	AutoProvision        bool          `mapstructure:"auto_provision"`
+	Tenant               string        `mapstructure:"tenant"`
+	DefaultRole          string        `mapstructure:"default_role"`
+	RoleMappings         []RoleMapping `mapstructure:"role_mappings"` // group DN or its CN
+	SyncInterval         time.Duration `mapstructure:"sync_interval"` // 0 disables the periodic sync
+	SyncFilter           string        `mapstructure:"sync_filter"`
+	DisableMissing       bool          `mapstructure:"disable_missing"` // disable accounts no longer returned by the sync
+}
+
+// MFAConfig configures TOTP two-factor authentication of password logins
+type MFAConfig struct {
+	Issuer            string        `mapstructure:"issuer"`             // shown by authenticator apps
+	EnforcePrivileged bool          `mapstructure:"enforce_privileged"` // require MFA for roles that can write or delete
+	ChallengeTTL      time.Duration `mapstructure:"challenge_ttl"`      // time to enter the code after the password
+	RecoveryCodes     int           `mapstructure:"recovery_codes"`     // number of one-time recovery codes issued
+}
+
+// LockoutConfig limits password guessing. Failures past the free ones are
+// delayed with exponential backoff per username and per client IP, and
+// max_attempts consecutive failures lock the account.
+type LockoutConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`     // consecutive failures that lock an account, 0 never locks
+	LockDuration   time.Duration `mapstructure:"lock_duration"`    // 0 keeps accounts locked until an admin unlocks them
+	FreeAttempts   int           `mapstructure:"free_attempts"`    // failures per username before backoff starts
+	IPFreeAttempts int           `mapstructure:"ip_free_attempts"` // failures per client IP before backoff starts
+	BaseDelay      time.Duration `mapstructure:"base_delay"`       // first backoff delay, doubled on every further failure
+	MaxDelay       time.Duration `mapstructure:"max_delay"`
+	Window         time.Duration `mapstructure:"window"` // failures older than this no longer count towards backoff
+}
+
+// RoleMapping maps an external group to a local role
+type RoleMapping struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
+}
+
+// StorageConfig selects where uploaded files are kept
+type StorageConfig struct {
+	Driver string             `mapstructure:"driver"` // "local", "s3" or "memory" (testing only, lost on restart)
+	Local  LocalStorageConfig `mapstructure:"local"`
+	S3     S3Config           `mapstructure:"s3"`
+}
+
+type LocalStorageConfig struct {
+	Root string `mapstructure:"root"`
+}
+
+// S3Config configures an S3-compatible bucket, e.g. AWS S3 or MinIO
+type S3Config struct {
+	Endpoint  string        `mapstructure:"endpoint"` // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://minio:9000"
+	Region    string        `mapstructure:"region"`
+	Bucket    string        `mapstructure:"bucket"`
+	AccessKey string        `mapstructure:"access_key"` // env ITAM_S3_ACCESS_KEY
+	SecretKey string        `mapstructure:"secret_key"` // env ITAM_S3_SECRET_KEY
+	Prefix    string        `mapstructure:"prefix"`     // prepended to every key, e.g. "itam/"
+	PathStyle bool          `mapstructure:"path_style"` // bucket in the path instead of the host name, needed by MinIO
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// WebhookConfig tunes outbound webhook delivery
+type WebhookConfig struct {
+	Timeout      time.Duration `mapstructure:"timeout"`       // per attempt
+	MaxAttempts  int           `mapstructure:"max_attempts"`  // a delivery fails for good after this many
+	RetryBase    time.Duration `mapstructure:"retry_base"`    // first retry delay, doubled on each further attempt
+	RetryMax     time.Duration `mapstructure:"retry_max"`     // longest retry delay
+	PollInterval time.Duration `mapstructure:"poll_interval"` // how often due retries are picked up
+	Workers      int           `mapstructure:"workers"`       // deliveries sent in parallel
+	// Loopback, private, link-local, 0.0.0.0/8 and carrier-grade NAT
+	// (100.64.0.0/10) addresses are refused unless one of these CIDRs,
+	// e.g. "10.20.0.0/16", contains them
+	AllowedNetworks []string `mapstructure:"allowed_networks"`
+}
+
+type ContractConfig struct {
+	ExpiryScanInterval time.Duration `mapstructure:"expiry_scan_interval"` // e.g. "1h", 0 disables the scanner
+	ReminderDays       []int         `mapstructure:"reminder_days"`        // days before EndDate to alert, e.g. [30, 7, 1]
+	MaxFileSizeMB      int64         `mapstructure:"max_file_size_mb"`     // largest accepted contract file
+	AllowedFileTypes   []string      `mapstructure:"allowed_file_types"`   // MIME types detected from content, empty allows any
+}
+
 type NotificationConfig struct {
-	Enable bool      `mapstructure:"enable"`
-	SMS    SMSConfig `mapstructure:"sms"`
-	IM     IMConfig  `mapstructure:"im"`
+	Enable  bool        `mapstructure:"enable"`
+	BaseURL string      `mapstructure:"base_url"` // web UI address for links in messages, e.g. "https://itam.example.com"
+	SMS     SMSConfig   `mapstructure:"sms"`
+	IM      IMConfig    `mapstructure:"im"`
+	Email   EmailConfig `mapstructure:"email"`
+	Queue   QueueConfig `mapstructure:"queue"`
+}
+
+// QueueConfig tunes the notification outbox, which every channel is
+// delivered from with its own retries
+type QueueConfig struct {
+	Workers      int           `mapstructure:"workers"`       // deliveries sent in parallel
+	MaxAttempts  int           `mapstructure:"max_attempts"`  // a delivery is dead-lettered after this many
+	RetryBase    time.Duration `mapstructure:"retry_base"`    // first retry delay, doubled on each further attempt
+	RetryMax     time.Duration `mapstructure:"retry_max"`     // longest retry delay
+	PollInterval time.Duration `mapstructure:"poll_interval"` // how often due retries are picked up
 }
 
 type SMSConfig struct {
@@ -50,7 +210,20 @@ type SMSConfig struct {
 type IMConfig struct {
 	Provider string `mapstructure:"provider"` // e.g., "feishu", "dingtalk", "wechat_work"
 	Webhook  string `mapstructure:"webhook"`
-	Secret   string `mapstructure:"secret"` // Optional, for signature verification
+	Secret   string `mapstructure:"secret"` // Optional signing secret (Feishu, DingTalk); WeCom bots are not signed
+}
+
+// EmailConfig configures the SMTP channel, which is off while Host is empty
+type EmailConfig struct {
+	Host               string        `mapstructure:"host"`
+	Port               int           `mapstructure:"port"`
+	Security           string        `mapstructure:"security"` // "starttls", "tls" (implicit, usually port 465) or "none"
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Username           string        `mapstructure:"username"`
+	Password           string        `mapstructure:"password"` // env ITAM_SMTP_PASSWORD
+	From               string        `mapstructure:"from"`     // e.g. "ITAM <itam@example.com>"
+	To                 []string      `mapstructure:"to"`       // always copied, e.g. the IT or finance mailbox
+	Timeout            time.Duration `mapstructure:"timeout"`
 }
 
 func LoadConfig() *Config {
@@ -64,6 +237,76 @@ func LoadConfig() *Config {
 	viper.SetDefault("server.mode", "debug")
 	viper.SetDefault("database.driver", "sqlite")
 	viper.SetDefault("database.dbname", "itam.db")
+	viper.SetDefault("storage.driver", "local")
+	viper.SetDefault("storage.local.root", "./uploads")
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.s3.path_style", true)
+	viper.SetDefault("storage.s3.timeout", "60s")
+	viper.SetDefault("storage.s3.access_key", "")
+	viper.SetDefault("storage.s3.secret_key", "")
+	viper.BindEnv("storage.s3.access_key", "ITAM_S3_ACCESS_KEY")
+	viper.BindEnv("storage.s3.secret_key", "ITAM_S3_SECRET_KEY")
+	viper.SetDefault("webhook.timeout", "10s")
+	viper.SetDefault("webhook.max_attempts", 8)
+	viper.SetDefault("webhook.retry_base", "30s")
+	viper.SetDefault("webhook.retry_max", "1h")
+	viper.SetDefault("webhook.poll_interval", "10s")
+	viper.SetDefault("webhook.workers", 4)
+	viper.SetDefault("notification.email.port", 587)
+	viper.SetDefault("notification.email.security", "starttls")
+	viper.SetDefault("notification.email.timeout", "30s")
+	viper.SetDefault("notification.email.password", "")
+	viper.BindEnv("notification.email.password", "ITAM_SMTP_PASSWORD")
+	viper.SetDefault("notification.queue.workers", 4)
+	viper.SetDefault("notification.queue.max_attempts", 6)
+	viper.SetDefault("notification.queue.retry_base", "1m")
+	viper.SetDefault("notification.queue.retry_max", "1h")
+	viper.SetDefault("notification.queue.poll_interval", "10s")
+	viper.SetDefault("auth.access_token_ttl", "15m")
+	viper.SetDefault("auth.refresh_token_ttl", "168h")
+	viper.SetDefault("auth.session_store", "memory")
+	viper.SetDefault("auth.jwt_secret", "")
+	viper.BindEnv("auth.jwt_secret", "ITAM_JWT_SECRET")
+	viper.SetDefault("auth.authenticators", []string{"local"})
+	viper.SetDefault("auth.api_token_max_ttl", "8760h")
+	viper.SetDefault("auth.lockout.max_attempts", 5)
+	viper.SetDefault("auth.lockout.lock_duration", "15m")
+	viper.SetDefault("auth.lockout.free_attempts", 3)
+	viper.SetDefault("auth.lockout.ip_free_attempts", 10)
+	viper.SetDefault("auth.lockout.base_delay", "1s")
+	viper.SetDefault("auth.lockout.max_delay", "5m")
+	viper.SetDefault("auth.lockout.window", "15m")
+	viper.SetDefault("auth.mfa.issuer", "ITAM")
+	viper.SetDefault("auth.mfa.challenge_ttl", "5m")
+	viper.SetDefault("auth.mfa.recovery_codes", 10)
+	viper.SetDefault("auth.ldap.timeout", "10s")
+	viper.SetDefault("auth.ldap.user_filter", "(&(objectClass=person)(uid={username}))")
+	viper.SetDefault("auth.ldap.username_attribute", "uid")
+	viper.SetDefault("auth.ldap.display_name_attribute", "displayName")
+	viper.SetDefault("auth.ldap.email_attribute", "mail")
+	viper.SetDefault("auth.ldap.group_attribute", "memberOf")
+	viper.SetDefault("auth.ldap.auto_provision", true)
+	viper.SetDefault("auth.ldap.tenant", "default")
+	viper.SetDefault("auth.ldap.default_role", "user")
+	viper.SetDefault("auth.ldap.sync_filter", "(objectClass=person)")
+	viper.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("auth.oidc.username_claim", "preferred_username")
+	viper.SetDefault("auth.oidc.groups_claim", "groups")
+	viper.SetDefault("auth.oidc.auto_provision", true)
+	viper.SetDefault("auth.oidc.tenant", "default")
+	viper.SetDefault("auth.oidc.default_role", "user")
+	viper.SetDefault("contract.expiry_scan_interval", "1h")
+	viper.SetDefault("contract.reminder_days", []int{30, 7, 1})
+	viper.SetDefault("contract.max_file_size_mb", 20)
+	viper.SetDefault("contract.allowed_file_types", []string{
+		"application/pdf",
+		"image/png",
+		"image/jpeg",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/msword",
+		"application/vnd.ms-excel",
+	})
 
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("Warning: Config file not found, using defaults. Error: %v", err)
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"errors"
+	"itam-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ScopeRoot returns the organization whose subtree a user with the given
+// data scope and organization may see. ok is false for the "all" scope;
+// root is nil when the user only sees the rows they created (self scope,
+// or no organization assigned).
+func ScopeRoot(db *gorm.DB, scope string, orgID uint) (root *model.Organization, ok bool, err error) {
+	if scope == model.DataScopeAll {
+		return nil, false, nil
+	}
+	if scope == model.DataScopeSelf || orgID == 0 {
+		return nil, true, nil
+	}
+
+	var org model.Organization
+	if err := db.First(&org, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, true, nil
+		}
+		return nil, true, err
+	}
+	if scope == model.DataScopeDepartment {
+		return &org, true, nil
+	}
+
+	// Company scope climbs to the nearest company or group above the user's org
+	ids, err := org.AncestorIDs()
+	if err != nil {
+		return nil, true, err
+	}
+	var ancestors []model.Organization
+	if err := db.Where("id IN ?", ids).Order("level desc").Find(&ancestors).Error; err != nil {
+		return nil, true, err
+	}
+	for i := range ancestors {
+		if ancestors[i].Type == model.OrgTypeCompany || ancestors[i].Type == model.OrgTypeGroup {
+			return &ancestors[i], true, nil
+		}
+	}
+	if len(ancestors) > 0 {
+		return &ancestors[len(ancestors)-1], true, nil
+	}
+	return &org, true, nil
+}
+
+// InScope reports whether a row of organization orgID created by
+// createdBy lies within root's subtree or was created by userID; root as
+// returned by ScopeRoot with ok set
+func InScope(db *gorm.DB, root *model.Organization, userID uint, orgID *uint, createdBy uint) (bool, error) {
+	if createdBy != 0 && createdBy == userID {
+		return true, nil
+	}
+	if root == nil || orgID == nil {
+		return false, nil
+	}
+	var org model.Organization
+	if err := db.First(&org, *orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return root.IsAncestorOf(&org), nil
+}
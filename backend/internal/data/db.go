@@ -1,9 +1,12 @@
 package data
 
 import (
+	"context"
 	"fmt"
+	"itam-backend/internal/audit"
 	"itam-backend/internal/conf"
 	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
 	"log"
 
 	"gorm.io/driver/mysql"
@@ -14,6 +17,10 @@ import (
 
 var DB *gorm.DB
 
+// DefaultTenantID is the platform tenant; shared settings such as roles
+// and tenants themselves are managed from it
+var DefaultTenantID uint
+
 func InitDB(cfg *conf.Config) {
 	var err error
 	var dsn string
@@ -49,15 +56,149 @@ func InitDB(cfg *conf.Config) {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
+	if err := tenant.Register(DB); err != nil {
+		log.Fatalf("failed to register tenant callbacks: %v", err)
+	}
+	if err := audit.Register(DB); err != nil {
+		log.Fatalf("failed to register audit callbacks: %v", err)
+	}
+
+	// Relations used to carry a soft-delete column, they are hard-deleted now;
+	// dropping the column rebuilds the table, AutoMigrate then restores its indexes
+	if DB.Migrator().HasColumn(&model.AssetRelation{}, "deleted_at") {
+		if err := migrateRelationSoftDelete(); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+	}
+
 	// Auto Migrate - 迁移所有模型
 	if err := DB.AutoMigrate(
 		&model.Asset{},
 		&model.SystemInterface{},
 		&model.Contract{},
 		&model.ContractFile{},
+		&model.User{},
+		&model.Role{},
+		&model.AuditLog{},
+		&model.AssetRelation{},
+		&model.ContractReminder{},
+		&model.AssetImport{},
+		&model.AssetTypeSchema{},
+		&model.Tenant{},
+		&model.Organization{},
+		&model.MFARecoveryCode{},
+		&model.APIToken{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
+		&model.Notification{},
+		&model.NotificationAttachment{},
+		&model.NotificationDelivery{},
+		&model.NotificationRule{},
+		&model.NotificationPreference{},
 	); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
+	// Contract codes used to be unique across tenants
+	if DB.Migrator().HasIndex(&model.Contract{}, "idx_contracts_code") {
+		if err := DB.Migrator().DropIndex(&model.Contract{}, "idx_contracts_code"); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+	}
+
+	defaultTenant, err := seedTenant()
+	if err != nil {
+		log.Fatalf("failed to seed default tenant: %v", err)
+	}
+	DefaultTenantID = defaultTenant.ID
+
+	if err := seedRoles(); err != nil {
+		log.Fatalf("failed to seed roles: %v", err)
+	}
+
+	if err := seedAdmin(defaultTenant.ID); err != nil {
+		log.Fatalf("failed to seed admin user: %v", err)
+	}
 
 	log.Printf("Database connected: %s", cfg.Database.Driver)
 }
+
+// migrateRelationSoftDelete purges soft-deleted relations and drops the
+// deleted_at column with its index
+func migrateRelationSoftDelete() error {
+	err := DB.WithContext(tenant.WithAll(context.Background())).
+		Where("deleted_at IS NOT NULL").Delete(&model.AssetRelation{}).Error
+	if err != nil {
+		return err
+	}
+	if DB.Migrator().HasIndex(&model.AssetRelation{}, "idx_asset_relations_deleted_at") {
+		if err := DB.Migrator().DropIndex(&model.AssetRelation{}, "idx_asset_relations_deleted_at"); err != nil {
+			return err
+		}
+	}
+	return DB.Migrator().DropColumn(&model.AssetRelation{}, "deleted_at")
+}
+
+// seedRoles creates the built-in roles that do not exist yet
+func seedRoles() error {
+	for _, role := range model.DefaultRoles() {
+		role := role
+		if err := DB.Where("name = ?", role.Name).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedTenant creates the default tenant and hands it every row that
+// predates multi-tenancy
+func seedTenant() (*model.Tenant, error) {
+	t := model.Tenant{Name: "Default", Code: model.DefaultTenantCode, Status: model.TenantStatusActive}
+	if err := DB.Where("code = ?", t.Code).FirstOrCreate(&t).Error; err != nil {
+		return nil, err
+	}
+
+	for _, m := range []interface{}{
+		&model.Asset{}, &model.SystemInterface{}, &model.Contract{}, &model.ContractFile{},
+		&model.User{}, &model.AuditLog{}, &model.AssetRelation{}, &model.AssetImport{},
+		&model.Organization{},
+	} {
+		err := DB.Session(&gorm.Session{SkipHooks: true}).WithContext(tenant.WithAll(context.Background())).
+			Model(m).Unscoped().
+			Where("tenant_id IS NULL OR tenant_id = 0").
+			UpdateColumn("tenant_id", t.ID).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// seedAdmin creates the default administrator when the users table is empty
+func seedAdmin(tenantID uint) error {
+	ctx := tenant.WithAll(context.Background())
+
+	var count int64
+	if err := DB.WithContext(ctx).Model(&model.User{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	admin := model.User{
+		TenantID:    tenantID,
+		Username:    "admin",
+		DisplayName: "Administrator",
+		Role:        "admin",
+		Status:      model.UserStatusActive,
+	}
+	if err := admin.SetPassword("admin123"); err != nil {
+		return err
+	}
+	if err := DB.WithContext(ctx).Create(&admin).Error; err != nil {
+		return err
+	}
+
+	log.Println("Default admin user created (admin/admin123), please change the password")
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package event is an in-process bus for domain events such as
+// "asset.created". Handlers publish after a change is committed and
+// subscribers, like outbound webhooks, react to it.
+package event
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"itam-backend/internal/audit"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	AssetCreated = "asset.created"
+	AssetUpdated = "asset.updated"
+	AssetDeleted = "asset.deleted"
+
+	ContractCreated = "contract.created"
+	ContractUpdated = "contract.updated"
+	ContractDeleted = "contract.deleted"
+
+	InterfaceCreated = "interface.created"
+	InterfaceUpdated = "interface.updated"
+	InterfaceDeleted = "interface.deleted"
+
+	FileUploaded = "file.uploaded"
+)
+
+// AllTypes lists every event type that is published
+var AllTypes = []string{
+	AssetCreated, AssetUpdated, AssetDeleted,
+	ContractCreated, ContractUpdated, ContractDeleted,
+	InterfaceCreated, InterfaceUpdated, InterfaceDeleted,
+	FileUploaded,
+}
+
+// Event is something that happened to a tenant's data
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	TenantID   uint        `json:"tenant_id"`
+	Actor      string      `json:"actor,omitempty"` // username, empty for system changes
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"` // the object after the change, or before a delete
+}
+
+// Handler receives published events. It runs on the publisher's
+// goroutine, so anything slow must be handed off.
+type Handler func(Event)
+
+// Bus fans events out to its subscribers
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Default is the bus the handlers publish to
+var Default = NewBus()
+
+// Subscribe registers h for every event published after the call
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, h)
+	b.mu.Unlock()
+}
+
+// Publish calls every subscriber in turn; a panicking subscriber is
+// logged and does not keep the event from the others
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event %s %s: subscriber panicked: %v", e.Type, e.ID, r)
+				}
+			}()
+			h(e)
+		}()
+	}
+}
+
+// Subscribe registers h on the Default bus
+func Subscribe(h Handler) {
+	Default.Subscribe(h)
+}
+
+// Publish publishes an event of type typ about data on the Default bus,
+// taking the actor from ctx (a *gin.Context works)
+func Publish(ctx context.Context, typ string, tenantID uint, data interface{}) {
+	e := Event{
+		ID:         NewID(),
+		Type:       typ,
+		TenantID:   tenantID,
+		OccurredAt: time.Now(),
+		Data:       data,
+	}
+	if actor, ok := audit.ActorFromContext(ctx); ok {
+		e.Actor = actor.Username
+	}
+	Default.Publish(e)
+}
+
+// NewID returns a random event ID
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsValidFilter reports whether f is an event type, a "resource.*"
+// wildcard or "*"
+func IsValidFilter(f string) bool {
+	if f == "*" {
+		return true
+	}
+	for _, t := range AllTypes {
+		if t == f || resource(t)+".*" == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether any of filters selects typ
+func Matches(filters []string, typ string) bool {
+	for _, f := range filters {
+		if f == "*" || f == typ || f == resource(typ)+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+func resource(typ string) string {
+	r, _, _ := strings.Cut(typ, ".")
+	return r
+}
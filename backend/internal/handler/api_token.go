@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPITokenRequest create API token request body
+type CreateAPITokenRequest struct {
+	Name       string     `json:"name" binding:"required,max=100"`
+	Scopes     []string   `json:"scopes" binding:"required,min=1"` // permission codes, e.g. "asset:read"
+	AllowedIPs []string   `json:"allowed_ips"`                     // IPs or CIDR ranges, empty allows any
+	ExpiresAt  *time.Time `json:"expires_at"`                      // defaults to the longest lifetime allowed
+}
+
+// CreateAPITokenResponse the new token, shown only once
+type CreateAPITokenResponse struct {
+	model.APIToken
+	Token string `json:"token"`
+}
+
+// APITokenHandler personal API tokens
+type APITokenHandler struct {
+	cfg *conf.AuthConfig
+}
+
+func NewAPITokenHandler(cfg *conf.AuthConfig) *APITokenHandler {
+	return &APITokenHandler{cfg: cfg}
+}
+
+// GetTokens 当前用户的 API 令牌列表
+func (h *APITokenHandler) GetTokens(c *gin.Context) {
+	var tokens []model.APIToken
+	if err := data.DB.WithContext(c).Where("user_id = ?", c.GetUint("userID")).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateToken 创建 API 令牌，明文只在此返回一次
+func (h *APITokenHandler) CreateToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A token can only narrow what its owner may do
+	for _, s := range req.Scopes {
+		if !model.IsValidPermission(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + s})
+			return
+		}
+		if !middleware.HasPermission(c, s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Your role does not grant " + s})
+			return
+		}
+	}
+	for _, ip := range req.AllowedIPs {
+		if !model.IsValidIPRule(ip) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP or CIDR range: " + ip})
+			return
+		}
+	}
+
+	now := time.Now()
+	expiresAt := req.ExpiresAt
+	if max := h.cfg.APITokenMaxTTL; max > 0 {
+		limit := now.Add(max)
+		if expiresAt == nil {
+			expiresAt = &limit
+		} else if expiresAt.After(limit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry exceeds the longest lifetime allowed: " + max.String()})
+			return
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	token, hash := middleware.GenerateAPIToken()
+	t := model.APIToken{
+		UserID:     c.GetUint("userID"),
+		Name:       req.Name,
+		Prefix:     token[:len(middleware.APITokenPrefix)+8],
+		TokenHash:  hash,
+		Scopes:     req.Scopes,
+		AllowedIPs: req.AllowedIPs,
+		ExpiresAt:  expiresAt,
+	}
+	if err := data.DB.WithContext(c).Create(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, CreateAPITokenResponse{APIToken: t, Token: token})
+}
+
+// RevokeToken 吊销 API 令牌
+func (h *APITokenHandler) RevokeToken(c *gin.Context) {
+	var t model.APIToken
+	if err := data.DB.WithContext(c).Where("user_id = ?", c.GetUint("userID")).First(&t, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err := data.DB.WithContext(c).Delete(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
@@ -3,8 +3,10 @@ package handler
 import (
 	"fmt"
 	"itam-backend/internal/data"
+	"itam-backend/internal/event"
 	"itam-backend/internal/model"
 	"itam-backend/internal/notification"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -20,14 +22,20 @@ func NewAssetHandler(notify *notification.Service) *AssetHandler {
 	}
 }
 
+var assetListSpec = ListSpec{
+	SortColumns:   []string{"name", "type", "platform", "ip", "status", "region", "owner", "created_at", "updated_at"},
+	FilterColumns: []string{"name", "type", "platform", "ip", "status", "region", "owner", "org_id"},
+	SearchColumns: []string{"name", "ip", "owner", "description"},
+	DefaultSort:   "id",
+	ExportColumns: []string{"id", "name", "type", "platform", "ip", "status", "region", "owner", "org_id",
+		"description", "specs", "created_at", "updated_at"},
+	JSONColumn:  "attributes",
+	ScopeColumn: "created_by",
+}
+
 func (h *AssetHandler) GetAssets(c *gin.Context) {
 	var assets []model.Asset
-	result := data.DB.Find(&assets)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, assets)
+	respondList(c, data.DB.WithContext(c).Model(&model.Asset{}), assetListSpec, &assets)
 }
 
 func (h *AssetHandler) CreateAsset(c *gin.Context) {
@@ -36,15 +44,37 @@ func (h *AssetHandler) CreateAsset(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	asset.CreatedBy = c.GetUint("userID")
+	if err := checkOrgAssignment(c, asset.OrgID); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := validateAssetAttributes(c, &asset); err != nil {
+		respondError(c, err)
+		return
+	}
 
-	result := data.DB.Create(&asset)
+	result := data.DB.WithContext(c).Create(&asset)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 
+	event.Publish(c, event.AssetCreated, asset.TenantID, asset)
+
 	// Send Notification
-	go h.notify.SendAlert("New Asset Created", fmt.Sprintf("Asset %s (%s) has been added by %s.", asset.Name, asset.IP, asset.Owner))
+	if err := h.notify.Send(notification.Message{
+		Kind:       notification.KindAssetCreated,
+		Title:      "New Asset Created",
+		Content:    fmt.Sprintf("Asset %s (%s) has been added by %s.", asset.Name, asset.IP, asset.Owner),
+		Severity:   notification.SeverityInfo,
+		Link:       fmt.Sprintf("/assets?id=%d", asset.ID),
+		TenantID:   asset.TenantID,
+		Recipients: []string{asset.Owner},
+		Data:       map[string]interface{}{"Asset": asset},
+	}); err != nil {
+		log.Printf("Asset %d: %v", asset.ID, err)
+	}
 
 	c.JSON(http.StatusOK, asset)
 }
@@ -53,33 +83,86 @@ func (h *AssetHandler) UpdateAsset(c *gin.Context) {
 	var asset model.Asset
 	id := c.Param("id")
 
-	if err := data.DB.First(&asset, id).Error; err != nil {
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&asset, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
 		return
 	}
 
+	// Attributes are merged into the stored ones; send null to clear one
+	stored, createdBy, orgID, oldType := asset.Model, asset.CreatedBy, copyOrgID(asset.OrgID), asset.Type
 	if err := c.ShouldBindJSON(&asset); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The path picks the row, never an id in the body
+	asset.Model, asset.CreatedBy = stored, createdBy
+	if !sameOrg(orgID, asset.OrgID) {
+		if err := checkOrgAssignment(c, asset.OrgID); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	if err := dropStaleAttributes(c, &asset, oldType); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := validateAssetAttributes(c, &asset); err != nil {
+		respondError(c, err)
+		return
+	}
 
-	data.DB.Save(&asset)
+	// Write through the data scope as well; the handle above carries the load
+	if db, err = scopedDB(c, "created_by"); err == nil {
+		err = updateByID(db, &asset, stored.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	event.Publish(c, event.AssetUpdated, asset.TenantID, asset)
 	c.JSON(http.StatusOK, asset)
 }
 
 func (h *AssetHandler) DeleteAsset(c *gin.Context) {
 	id := c.Param("id")
 	var asset model.Asset
-	
-	// Get asset info before deletion for notification
-	if err := data.DB.First(&asset, id).Error; err == nil {
-		// Send Notification
-		go h.notify.SendAlert("Asset Deleted", fmt.Sprintf("Asset %s (%s) has been removed.", asset.Name, asset.IP))
-	}
 
-	if err := data.DB.Delete(&model.Asset{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
 		return
 	}
+
+	// Get asset info before deletion for notification
+	if err := db.First(&asset, id).Error; err == nil {
+		if err := db.Delete(&model.Asset{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Drop the relations of the deleted asset so the topology has no dangling edges
+		data.DB.WithContext(c).Where("source_asset_id = ? OR target_asset_id = ?", id, id).Delete(&model.AssetRelation{})
+
+		event.Publish(c, event.AssetDeleted, asset.TenantID, asset)
+
+		// Send Notification
+		if err := h.notify.Send(notification.Message{
+			Kind:       notification.KindAssetDeleted,
+			Title:      "Asset Deleted",
+			Content:    fmt.Sprintf("Asset %s (%s) has been removed.", asset.Name, asset.IP),
+			Severity:   notification.SeverityWarning,
+			Link:       "/assets",
+			TenantID:   asset.TenantID,
+			Recipients: []string{asset.Owner},
+			Data:       map[string]interface{}{"Asset": asset},
+		}); err != nil {
+			log.Printf("Asset %d: %v", asset.ID, err)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted"})
 }
@@ -0,0 +1,489 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"itam-backend/internal/data"
+	"itam-backend/internal/event"
+	"itam-backend/internal/model"
+	"itam-backend/internal/xlsx"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxImportFileSize = 10 << 20 // 10MB
+
+// Import modes
+const (
+	ImportModeInsert = "insert" // every row must be a new asset
+	ImportModeUpsert = "upsert" // rows matching an existing name+IP update it
+)
+
+// importFields are the asset columns that can be imported
+var importFields = []string{"name", "type", "platform", "ip", "status", "region", "owner", "description", "specs"}
+
+// importHeaderAliases maps lower-cased spreadsheet headers to asset fields,
+// covering the Chinese headers of the CSV template shipped with the frontend
+var importHeaderAliases = map[string]string{
+	"名称": "name", "资产名称": "name",
+	"类型":   "type",
+	"平台":   "platform",
+	"ip地址": "ip", "ip address": "ip",
+	"状态": "status",
+	"区域": "region", "地域": "region",
+	"负责人": "owner",
+	"描述":  "description",
+	"规格":  "specs", "配置": "specs",
+}
+
+// ImportRowResult outcome of a single spreadsheet row
+type ImportRowResult struct {
+	Row     int      `json:"row"`    // 1-based line number in the file, header is row 1
+	Action  string   `json:"action"` // create, update, error
+	AssetID uint     `json:"asset_id,omitempty"`
+	Name    string   `json:"name"`
+	IP      string   `json:"ip"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// ImportResponse import summary plus the row-by-row report
+type ImportResponse struct {
+	Import model.AssetImport `json:"import"`
+	Rows   []ImportRowResult `json:"rows"`
+}
+
+type importRow struct {
+	line       int
+	values     map[string]string
+	attributes model.JSONMap // custom attributes the asset keeps, as validated
+	result     *ImportRowResult
+	asset      *model.Asset // as written by applyImport, published once committed
+}
+
+var assetImportListSpec = ListSpec{
+	SortColumns:   []string{"created_at", "status"},
+	FilterColumns: []string{"status", "mode", "format", "imported_by"},
+	DefaultSort:   "-id",
+}
+
+// GetAssetImports 导入历史
+func (h *AssetHandler) GetAssetImports(c *gin.Context) {
+	var imports []model.AssetImport
+	respondList(c, data.DB.WithContext(c).Model(&model.AssetImport{}), assetImportListSpec, &imports)
+}
+
+// ImportAssets 批量导入资产 (CSV / XLSX)
+//
+// Multipart form fields:
+//
+//	file     the .csv or .xlsx file, first row is the header
+//	mode     insert (default) or upsert; duplicates are matched on name+IP,
+//	         blank cells leave the matched asset's value unchanged
+//	dry_run  true to only validate and return the report
+//	mapping  optional JSON object of header -> field, e.g. {"Hostname":"name"}
+//
+// Rows are written in a single transaction and only if every row is valid.
+func (h *AssetHandler) ImportAssets(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	if file.Size > maxImportFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds 10MB"})
+		return
+	}
+
+	mode := c.DefaultPostForm("mode", ImportModeInsert)
+	if mode != ImportModeInsert && mode != ImportModeUpsert {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be insert or upsert"})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	var mapping map[string]string
+	if v := c.PostForm("mapping"); v != "" {
+		if err := json.Unmarshal([]byte(v), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of header to field"})
+			return
+		}
+		for header, field := range mapping {
+			if !contains(importFields, field) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("mapping %q: unknown field %q", header, field)})
+				return
+			}
+		}
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	if v := c.PostForm("format"); v != "" {
+		format = v
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer f.Close()
+
+	var records [][]string
+	switch format {
+	case "csv":
+		records, err = readCSV(f)
+	case "xlsx":
+		records, err = xlsx.ReadRows(f, file.Size)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .csv and .xlsx files are supported"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(records) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File must have a header row and at least one data row"})
+		return
+	}
+
+	columns, err := mapImportColumns(records[0], mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := parseImportRows(records, columns)
+	if err := planImport(c, rows, mode); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	history := model.AssetImport{
+		FileName:   file.Filename,
+		Format:     format,
+		Mode:       mode,
+		DryRun:     dryRun,
+		TotalRows:  len(rows),
+		ImportedBy: c.GetString("username"),
+		Errors:     model.JSONMap{},
+	}
+	resp := ImportResponse{Rows: make([]ImportRowResult, 0, len(rows))}
+	for _, r := range rows {
+		switch r.result.Action {
+		case "create":
+			history.CreatedCount++
+		case "update":
+			history.UpdatedCount++
+		default:
+			history.FailedCount++
+			history.Errors[strconv.Itoa(r.line)] = strings.Join(r.result.Errors, "; ")
+		}
+	}
+
+	switch {
+	case dryRun:
+		history.Status = model.ImportStatusDryRun
+	case history.FailedCount > 0:
+		history.Status = model.ImportStatusFailed
+	default:
+		history.Status = model.ImportStatusSucceeded
+	}
+
+	err = data.DB.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if history.Status == model.ImportStatusSucceeded {
+			if err := applyImport(c, tx, rows, columns); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&history).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, r := range rows {
+		if r.asset != nil {
+			typ := event.AssetUpdated
+			if r.result.Action == "create" {
+				typ = event.AssetCreated
+			}
+			event.Publish(c, typ, r.asset.TenantID, *r.asset)
+		}
+		resp.Rows = append(resp.Rows, *r.result)
+	}
+	resp.Import = history
+
+	if history.Status == model.ImportStatusFailed {
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// Excel writes a UTF-8 BOM in front of the header
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(b))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return records, nil
+}
+
+// mapImportColumns resolves each header to an asset field, explicit mapping first
+func mapImportColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		field, ok := mapping[h]
+		if !ok {
+			key := strings.ToLower(h)
+			if contains(importFields, key) {
+				field = key
+			} else {
+				field = importHeaderAliases[key]
+			}
+		}
+		if field == "" {
+			continue
+		}
+		if _, dup := columns[field]; dup {
+			return nil, fmt.Errorf("more than one column maps to %s", field)
+		}
+		columns[field] = i
+	}
+
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("no column maps to the required field name")
+	}
+	return columns, nil
+}
+
+func parseImportRows(records [][]string, columns map[string]int) []*importRow {
+	var rows []*importRow
+	for i, record := range records[1:] {
+		values := map[string]string{}
+		empty := true
+		for field, idx := range columns {
+			if idx < len(record) {
+				values[field] = strings.TrimSpace(record[idx])
+				if values[field] != "" {
+					empty = false
+				}
+			}
+		}
+		if empty {
+			continue
+		}
+		rows = append(rows, &importRow{
+			line:   i + 2,
+			values: values,
+			result: &ImportRowResult{Row: i + 2, Name: values["name"], IP: values["ip"]},
+		})
+	}
+	return rows
+}
+
+// planImport validates every row and decides whether it creates or updates an asset
+func planImport(c *gin.Context, rows []*importRow, mode string) error {
+	seen := map[string]int{}
+	var names []string
+	for _, r := range rows {
+		res := r.result
+		if res.Name == "" {
+			res.Errors = append(res.Errors, "name is required")
+		}
+		if res.IP != "" && net.ParseIP(res.IP) == nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("invalid IP address %q", res.IP))
+		}
+		if status, ok := r.values["status"]; ok && status != "" {
+			normalized, valid := normalizeAssetStatus(status)
+			if !valid {
+				res.Errors = append(res.Errors, fmt.Sprintf("status must be one of %s", strings.Join(model.AssetStatuses, ", ")))
+			}
+			r.values["status"] = normalized
+		}
+
+		key := assetKey(res.Name, res.IP)
+		if first, dup := seen[key]; dup {
+			res.Errors = append(res.Errors, fmt.Sprintf("duplicate of row %d (same name and IP)", first))
+		} else {
+			seen[key] = r.line
+		}
+		names = append(names, res.Name)
+	}
+
+	// Matches are looked up tenant-wide, but only assets within the
+	// caller's data scope may be updated
+	existing := map[string]uint{}
+	inScope := map[uint]bool{}
+	if len(names) > 0 {
+		var assets []model.Asset
+		if err := data.DB.WithContext(c).Select("id", "name", "ip").Where("name IN ?", names).Find(&assets).Error; err != nil {
+			return err
+		}
+		for _, a := range assets {
+			existing[assetKey(a.Name, a.IP)] = a.ID
+		}
+		db, err := scopedDB(c, "created_by")
+		if err != nil {
+			return err
+		}
+		var ids []uint
+		if err := db.Model(&model.Asset{}).Where("name IN ?", names).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			inScope[id] = true
+		}
+	}
+
+	var updateIDs []uint
+	for _, r := range rows {
+		res := r.result
+		if id, ok := existing[assetKey(res.Name, res.IP)]; ok {
+			if !inScope[id] {
+				res.Errors = append(res.Errors, "an asset with this name and IP exists outside your data scope")
+			} else if mode == ImportModeInsert {
+				res.Errors = append(res.Errors, fmt.Sprintf("asset already exists (id %d)", id))
+			} else {
+				res.AssetID = id
+				updateIDs = append(updateIDs, id)
+			}
+		}
+	}
+	current := map[uint]model.Asset{}
+	if len(updateIDs) > 0 {
+		var assets []model.Asset
+		if err := data.DB.WithContext(c).Where("id IN ?", updateIDs).Find(&assets).Error; err != nil {
+			return err
+		}
+		for _, a := range assets {
+			current[a.ID] = a
+		}
+	}
+
+	for _, r := range rows {
+		res := r.result
+		if len(res.Errors) == 0 {
+			if err := planAttributes(c, r, current[res.AssetID]); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case len(res.Errors) > 0:
+			res.Action = "error"
+		case res.AssetID != 0:
+			res.Action = "update"
+		default:
+			res.Action = "create"
+		}
+	}
+	return nil
+}
+
+// planAttributes checks the custom attributes the row leaves on its asset
+// against the schema of the asset's type, dropping those of a type it
+// changes from, and keeps them to be written
+func planAttributes(c *gin.Context, r *importRow, asset model.Asset) error {
+	oldType := asset.Type
+	if t := r.values["type"]; t != "" || r.result.AssetID == 0 {
+		asset.Type = t
+	}
+	if err := dropStaleAttributes(c, &asset, oldType); err != nil {
+		return err
+	}
+	if err := validateAssetAttributes(c, &asset); err != nil {
+		var bad *badRequestError
+		if !errors.As(err, &bad) {
+			return err
+		}
+		r.result.Errors = append(r.result.Errors, bad.Error())
+	}
+	r.attributes = asset.Attributes
+	return nil
+}
+
+// applyImport writes the planned rows; updates only touch the mapped
+// columns whose cell is not blank
+func applyImport(c *gin.Context, tx *gorm.DB, rows []*importRow, columns map[string]int) error {
+	for _, r := range rows {
+		switch r.result.Action {
+		case "create":
+			asset := model.Asset{
+				Name:        r.values["name"],
+				Type:        r.values["type"],
+				Platform:    r.values["platform"],
+				IP:          r.values["ip"],
+				Status:      r.values["status"],
+				Region:      r.values["region"],
+				Owner:       r.values["owner"],
+				Description: r.values["description"],
+				Specs:       r.values["specs"],
+				Attributes:  r.attributes,
+				CreatedBy:   c.GetUint("userID"),
+			}
+			if asset.Status == "" {
+				asset.Status = model.AssetStatusOnline
+			}
+			if err := tx.Create(&asset).Error; err != nil {
+				return fmt.Errorf("row %d: %w", r.line, err)
+			}
+			r.result.AssetID = asset.ID
+			r.asset = &asset
+		case "update":
+			updates := map[string]interface{}{}
+			for field := range columns {
+				if r.values[field] != "" {
+					updates[field] = r.values[field]
+				}
+			}
+			if _, ok := updates["type"]; ok {
+				updates["attributes"] = r.attributes
+			}
+			asset := model.Asset{}
+			asset.ID = r.result.AssetID
+			if err := tx.Model(&asset).Updates(updates).Error; err != nil {
+				return fmt.Errorf("row %d: %w", r.line, err)
+			}
+			if err := tx.First(&asset, asset.ID).Error; err != nil {
+				return fmt.Errorf("row %d: %w", r.line, err)
+			}
+			r.asset = &asset
+		}
+	}
+	return nil
+}
+
+func normalizeAssetStatus(s string) (string, bool) {
+	for _, v := range model.AssetStatuses {
+		if strings.EqualFold(v, s) {
+			return v, true
+		}
+	}
+	return s, false
+}
+
+func assetKey(name, ip string) string {
+	return name + "|" + ip
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"itam-backend/internal/data"
+	"itam-backend/internal/event"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signedIn stands in for the auth and tenant middleware, the requests run
+// as the given user
+func signedIn(user *model.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Set("tenantID", user.TenantID)
+		if user.OrgID != nil {
+			c.Set("orgID", *user.OrgID)
+		} else {
+			c.Set("orgID", uint(0))
+		}
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Set(tenant.Key, tenant.Scope{TenantID: user.TenantID})
+		c.Next()
+	}
+}
+
+func newAssetEngine(t *testing.T) *gin.Engine {
+	setupTestDB(t)
+	h := NewAssetHandler(nil)
+	r := gin.New()
+	r.Use(signedIn(findUser(t, "admin")))
+	r.POST("/assets/import", h.ImportAssets)
+	r.PUT("/assets/:id", h.UpdateAsset)
+	return r
+}
+
+func importCSV(t *testing.T, r *gin.Engine, csv string, fields map[string]string) (int, ImportResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "assets.csv")
+	fw.Write([]byte(csv))
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/assets/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp ImportResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func createTestAsset(t *testing.T, asset model.Asset) model.Asset {
+	t.Helper()
+	asset.TenantID = data.DefaultTenantID
+	if err := data.DB.WithContext(tenant.WithTenant(context.Background(), data.DefaultTenantID)).Create(&asset).Error; err != nil {
+		t.Fatal(err)
+	}
+	return asset
+}
+
+func loadTestAsset(t *testing.T, id uint) model.Asset {
+	t.Helper()
+	var asset model.Asset
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).First(&asset, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return asset
+}
+
+func createTestSchema(t *testing.T, typ string, fields ...model.AttributeField) {
+	t.Helper()
+	if err := data.DB.Create(&model.AssetTypeSchema{Type: typ, Fields: fields}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportReportsAttributeErrors(t *testing.T) {
+	r := newAssetEngine(t)
+	createTestSchema(t, "imp-server", model.AttributeField{Key: "rack", Type: model.AttributeTypeString, Required: true})
+
+	code, resp := importCSV(t, r, "name,type\nimp-a,imp-server\nimp-b,imp-plain\n", map[string]string{"dry_run": "true"})
+	if code != http.StatusOK || len(resp.Rows) != 2 {
+		t.Fatalf("dry run: %d %+v", code, resp)
+	}
+	if row := resp.Rows[0]; row.Action != "error" || len(row.Errors) != 1 || row.Errors[0] != "attribute rack is required" {
+		t.Fatalf("row of a type with a required attribute = %+v", row)
+	}
+	if row := resp.Rows[1]; row.Action != "create" {
+		t.Fatalf("row of a type without a schema = %+v", row)
+	}
+
+	// The real import refuses the file as a whole
+	if code, resp := importCSV(t, r, "name,type\nimp-a,imp-server\n", nil); code != http.StatusUnprocessableEntity || resp.Import.FailedCount != 1 {
+		t.Fatalf("import: %d %+v", code, resp.Import)
+	}
+}
+
+func TestTypeChangeDropsStaleAttributes(t *testing.T) {
+	r := newAssetEngine(t)
+	createTestSchema(t, "chg-vm",
+		model.AttributeField{Key: "cores", Type: model.AttributeTypeInt},
+		model.AttributeField{Key: "tier", Type: model.AttributeTypeString})
+	createTestSchema(t, "chg-db", model.AttributeField{Key: "tier", Type: model.AttributeTypeString})
+
+	check := func(name string, asset model.Asset) {
+		t.Helper()
+		if asset.Type != "chg-db" || len(asset.Attributes) != 1 || asset.Attributes["tier"] != "gold" {
+			t.Fatalf("%s: type %s, attributes %v; want chg-db keeping only tier", name, asset.Type, asset.Attributes)
+		}
+	}
+
+	// Through the import
+	imported := createTestAsset(t, model.Asset{Name: "chg-a", IP: "10.9.0.1", Type: "chg-vm", Status: model.AssetStatusOnline,
+		Attributes: model.JSONMap{"cores": float64(4), "tier": "gold"}})
+	code, resp := importCSV(t, r, "name,ip,type\nchg-a,10.9.0.1,chg-db\n", map[string]string{"mode": ImportModeUpsert})
+	if code != http.StatusOK || resp.Import.UpdatedCount != 1 {
+		t.Fatalf("import: %d %+v", code, resp)
+	}
+	check("import", loadTestAsset(t, imported.ID))
+
+	// Through the API
+	updated := createTestAsset(t, model.Asset{Name: "chg-b", Type: "chg-vm", Status: model.AssetStatusOnline,
+		Attributes: model.JSONMap{"cores": float64(8), "tier": "gold"}})
+	req := httptest.NewRequest(http.MethodPut, "/assets/"+strconv.Itoa(int(updated.ID)), strings.NewReader(`{"type":"chg-db"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	check("update", loadTestAsset(t, updated.ID))
+
+	// Attributes no type defines are still refused
+	req = httptest.NewRequest(http.MethodPut, "/assets/"+strconv.Itoa(int(updated.ID)), strings.NewReader(`{"type":"chg-vm","attributes":{"colour":"red"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown attribute: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUpsertSkipsBlankCells(t *testing.T) {
+	r := newAssetEngine(t)
+	createTestSchema(t, "blank-vm", model.AttributeField{Key: "cores", Type: model.AttributeTypeInt})
+	asset := createTestAsset(t, model.Asset{Name: "blank-a", IP: "10.9.1.1", Type: "blank-vm", Status: model.AssetStatusMaintenance,
+		Owner: "Ann", Description: "keep me", Attributes: model.JSONMap{"cores": float64(2)}})
+
+	code, resp := importCSV(t, r, "name,ip,type,status,owner,description\nblank-a,10.9.1.1,,,Bob,\n", map[string]string{"mode": ImportModeUpsert})
+	if code != http.StatusOK || resp.Import.UpdatedCount != 1 {
+		t.Fatalf("import: %d %+v", code, resp)
+	}
+	got := loadTestAsset(t, asset.ID)
+	if got.Owner != "Bob" {
+		t.Fatalf("owner = %q, want the imported Bob", got.Owner)
+	}
+	if got.Status != model.AssetStatusMaintenance || got.Type != "blank-vm" || got.Description != "keep me" || got.Attributes["cores"] != float64(2) {
+		t.Fatalf("blank cells overwrote the asset: %+v", got)
+	}
+}
+
+func TestImportPublishesEvents(t *testing.T) {
+	r := newAssetEngine(t)
+	existing := createTestAsset(t, model.Asset{Name: "evt-a", IP: "10.9.2.1", Type: "vm", Status: model.AssetStatusOnline, Owner: "Ann"})
+
+	var (
+		mu     sync.Mutex
+		events []event.Event
+	)
+	event.Subscribe(func(e event.Event) {
+		if asset, ok := e.Data.(model.Asset); ok && strings.HasPrefix(asset.Name, "evt-") {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		}
+	})
+
+	csv := "name,ip,type,owner\nevt-a,10.9.2.1,,Bob\nevt-b,10.9.2.2,vm,Cid\n"
+	if code, _ := importCSV(t, r, csv, map[string]string{"mode": ImportModeUpsert, "dry_run": "true"}); code != http.StatusOK {
+		t.Fatalf("dry run: %d", code)
+	}
+	if len(events) != 0 {
+		t.Fatalf("dry run published %d events", len(events))
+	}
+
+	code, resp := importCSV(t, r, csv, map[string]string{"mode": ImportModeUpsert})
+	if code != http.StatusOK || resp.Import.CreatedCount != 1 || resp.Import.UpdatedCount != 1 {
+		t.Fatalf("import: %d %+v", code, resp.Import)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+	updated, created := events[0].Data.(model.Asset), events[1].Data.(model.Asset)
+	if events[0].Type != event.AssetUpdated || updated.ID != existing.ID || updated.Owner != "Bob" || updated.Type != "vm" {
+		t.Fatalf("first event %s %+v, want the update of evt-a", events[0].Type, updated)
+	}
+	if events[1].Type != event.AssetCreated || created.ID != resp.Rows[1].AssetID || created.Owner != "Cid" {
+		t.Fatalf("second event %s %+v, want the creation of evt-b", events[1].Type, created)
+	}
+}
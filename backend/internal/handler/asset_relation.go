@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultImpactDepth = 5
+	maxImpactDepth     = 10
+)
+
+// Impact directions
+const (
+	// DirectionDownstream follows edges backwards: the assets that run on or
+	// depend on the given asset, i.e. what breaks when it goes down.
+	DirectionDownstream = "downstream"
+	// DirectionUpstream follows edges forwards: what the asset itself relies on.
+	DirectionUpstream = "upstream"
+	DirectionBoth     = "both"
+)
+
+// AssetRelationRequest create/update relation request body
+type AssetRelationRequest struct {
+	SourceAssetID uint   `json:"source_asset_id" binding:"required"`
+	TargetAssetID uint   `json:"target_asset_id" binding:"required"`
+	RelationType  string `json:"relation_type" binding:"required"`
+	Description   string `json:"description"`
+}
+
+// ImpactedAsset an asset reached while walking the relation graph
+type ImpactedAsset struct {
+	Asset        model.Asset `json:"asset"`
+	Depth        int         `json:"depth"`
+	Direction    string      `json:"direction"`
+	RelationType string      `json:"relation_type"` // type of the edge that reached this asset
+	Path         []uint      `json:"path"`          // asset IDs from the root to this asset
+}
+
+// ImpactResponse result of an impact analysis
+type ImpactResponse struct {
+	Asset     model.Asset     `json:"asset"`
+	Direction string          `json:"direction"`
+	MaxDepth  int             `json:"max_depth"`
+	Affected  []ImpactedAsset `json:"affected"`
+	Owners    []string        `json:"owners"`    // distinct owners of the affected assets
+	Cycles    [][]uint        `json:"cycles"`    // paths that loop back to an asset already on the path
+	Truncated bool            `json:"truncated"` // more relations exist beyond max_depth
+}
+
+type AssetRelationHandler struct{}
+
+func NewAssetRelationHandler() *AssetRelationHandler {
+	return &AssetRelationHandler{}
+}
+
+// GetRelations 获取关系列表，可按 asset_id（任一端）与 relation_type 过滤
+func (h *AssetRelationHandler) GetRelations(c *gin.Context) {
+	query, err := scopedRelations(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if assetID := c.Query("asset_id"); assetID != "" {
+		query = query.Where("source_asset_id = ? OR target_asset_id = ?", assetID, assetID)
+	}
+	if relType := c.Query("relation_type"); relType != "" {
+		query = query.Where("relation_type = ?", relType)
+	}
+
+	var relations []model.AssetRelation
+	if err := query.Order("id asc").Find(&relations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, relations)
+}
+
+// GetAssetRelations 获取与某资产相连的所有关系
+func (h *AssetRelationHandler) GetAssetRelations(c *gin.Context) {
+	id := c.Param("id")
+	query, err := scopedRelations(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var relations []model.AssetRelation
+	if err := query.Where("source_asset_id = ? OR target_asset_id = ?", id, id).Order("id asc").Find(&relations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, relations)
+}
+
+// CreateRelation 创建资产关系
+func (h *AssetRelationHandler) CreateRelation(c *gin.Context) {
+	var req AssetRelationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status, err := validateRelation(c, req, 0); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	relation := model.AssetRelation{
+		SourceAssetID: req.SourceAssetID,
+		TargetAssetID: req.TargetAssetID,
+		RelationType:  req.RelationType,
+		Description:   req.Description,
+	}
+	if err := data.DB.WithContext(c).Create(&relation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, relation)
+}
+
+// UpdateRelation 更新资产关系
+func (h *AssetRelationHandler) UpdateRelation(c *gin.Context) {
+	var relation model.AssetRelation
+	id := c.Param("id")
+
+	query, err := scopedRelations(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := query.First(&relation, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relation not found"})
+		return
+	}
+
+	var req AssetRelationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status, err := validateRelation(c, req, relation.ID); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	relation.SourceAssetID = req.SourceAssetID
+	relation.TargetAssetID = req.TargetAssetID
+	relation.RelationType = req.RelationType
+	relation.Description = req.Description
+
+	if err := data.DB.WithContext(c).Save(&relation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, relation)
+}
+
+// DeleteRelation 删除资产关系
+func (h *AssetRelationHandler) DeleteRelation(c *gin.Context) {
+	var relation model.AssetRelation
+	id := c.Param("id")
+
+	query, err := scopedRelations(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := query.First(&relation, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relation not found"})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Delete(&relation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Relation deleted"})
+}
+
+// GetImpact 影响分析：沿关系图遍历，返回受影响的资产及其负责人
+// Query: direction=downstream|upstream|both (default downstream), depth=1..10 (default 5),
+// relation_type=runs_on,depends_on (optional filter)
+func (h *AssetRelationHandler) GetImpact(c *gin.Context) {
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var root model.Asset
+	if err := db.First(&root, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+
+	direction := c.DefaultQuery("direction", DirectionDownstream)
+	if direction != DirectionDownstream && direction != DirectionUpstream && direction != DirectionBoth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction must be downstream, upstream or both"})
+		return
+	}
+
+	depth, err := strconv.Atoi(c.DefaultQuery("depth", strconv.Itoa(defaultImpactDepth)))
+	if err != nil || depth < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "depth must be a positive integer"})
+		return
+	}
+	if depth > maxImpactDepth {
+		depth = maxImpactDepth
+	}
+
+	var relTypes []string
+	if v := c.Query("relation_type"); v != "" {
+		relTypes = strings.Split(v, ",")
+	}
+
+	resp := ImpactResponse{
+		Asset:     root,
+		Direction: direction,
+		MaxDepth:  depth,
+		Affected:  []ImpactedAsset{},
+		Owners:    []string{},
+		Cycles:    [][]uint{},
+	}
+
+	var directions []string
+	if direction == DirectionBoth {
+		directions = []string{DirectionDownstream, DirectionUpstream}
+	} else {
+		directions = []string{direction}
+	}
+
+	for _, dir := range directions {
+		affected, cycles, truncated, err := walkRelations(c, root.ID, dir, depth, relTypes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		resp.Affected = append(resp.Affected, affected...)
+		resp.Cycles = append(resp.Cycles, cycles...)
+		resp.Truncated = resp.Truncated || truncated
+	}
+
+	owners := map[string]bool{}
+	for _, a := range resp.Affected {
+		if a.Asset.Owner != "" && !owners[a.Asset.Owner] {
+			owners[a.Asset.Owner] = true
+			resp.Owners = append(resp.Owners, a.Asset.Owner)
+		}
+	}
+	sort.Strings(resp.Owners)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// walkRelations does a breadth-first walk from root, loading one level of edges per query.
+// Each asset is visited once; an edge back to an asset already on the current path is reported as a cycle.
+func walkRelations(c *gin.Context, root uint, direction string, maxDepth int, relTypes []string) ([]ImpactedAsset, [][]uint, bool, error) {
+	fromCol := "target_asset_id"
+	if direction == DirectionUpstream {
+		fromCol = "source_asset_id"
+	}
+
+	paths := map[uint][]uint{root: {root}}
+	frontier := []uint{root}
+	var (
+		affected  []ImpactedAsset
+		cycles    [][]uint
+		truncated bool
+	)
+
+	for depth := 1; len(frontier) > 0; depth++ {
+		query, err := scopedRelations(c)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		query = query.Where(fromCol+" IN ?", frontier)
+		if len(relTypes) > 0 {
+			query = query.Where("relation_type IN ?", relTypes)
+		}
+		var edges []model.AssetRelation
+		if err := query.Order("id asc").Find(&edges).Error; err != nil {
+			return nil, nil, false, err
+		}
+
+		if depth > maxDepth {
+			// Only edges into assets not reached yet mean the walk was cut short
+			for _, e := range edges {
+				to := e.SourceAssetID
+				if direction == DirectionUpstream {
+					to = e.TargetAssetID
+				}
+				if _, seen := paths[to]; !seen {
+					truncated = true
+					break
+				}
+			}
+			break
+		}
+
+		reached := map[uint]string{}
+		var next []uint
+		for _, e := range edges {
+			from, to := e.TargetAssetID, e.SourceAssetID
+			if direction == DirectionUpstream {
+				from, to = e.SourceAssetID, e.TargetAssetID
+			}
+
+			if _, seen := paths[to]; seen {
+				if containsID(paths[from], to) {
+					cycles = append(cycles, append(append([]uint{}, paths[from]...), to))
+				}
+				continue
+			}
+
+			paths[to] = append(append([]uint{}, paths[from]...), to)
+			reached[to] = e.RelationType
+			next = append(next, to)
+		}
+
+		if len(next) > 0 {
+			var assets []model.Asset
+			if err := data.DB.WithContext(c).Where("id IN ?", next).Find(&assets).Error; err != nil {
+				return nil, nil, false, err
+			}
+			byID := make(map[uint]model.Asset, len(assets))
+			for _, a := range assets {
+				byID[a.ID] = a
+			}
+			for _, id := range next {
+				asset, ok := byID[id]
+				if !ok {
+					continue // dangling edge to a deleted asset
+				}
+				affected = append(affected, ImpactedAsset{
+					Asset:        asset,
+					Depth:        depth,
+					Direction:    direction,
+					RelationType: reached[id],
+					Path:         paths[id],
+				})
+			}
+		}
+		frontier = next
+	}
+
+	return affected, cycles, truncated, nil
+}
+
+// scopedRelations returns a query for the relations whose both ends lie
+// within the caller's data scope
+func scopedRelations(c *gin.Context) (*gorm.DB, error) {
+	query := data.DB.WithContext(c).Model(&model.AssetRelation{})
+	if middleware.DataScope(c) == model.DataScopeAll {
+		return query, nil
+	}
+	var ends [2]*gorm.DB
+	for i := range ends {
+		db, err := scopedDB(c, "created_by")
+		if err != nil {
+			return nil, err
+		}
+		ends[i] = db.Model(&model.Asset{}).Select("id")
+	}
+	return query.Where("source_asset_id IN (?) AND target_asset_id IN (?)", ends[0], ends[1]), nil
+}
+
+// validateRelation checks both endpoints exist and the edge is not a duplicate
+func validateRelation(c *gin.Context, req AssetRelationRequest, selfID uint) (int, error) {
+	if !model.IsValidRelationType(req.RelationType) {
+		return http.StatusBadRequest, fmt.Errorf("relation_type must be one of %s", strings.Join(model.RelationTypes, ", "))
+	}
+	if req.SourceAssetID == req.TargetAssetID {
+		return http.StatusBadRequest, fmt.Errorf("an asset cannot relate to itself")
+	}
+
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var count int64
+	db.Model(&model.Asset{}).Where("id IN ?", []uint{req.SourceAssetID, req.TargetAssetID}).Count(&count)
+	if count != 2 {
+		return http.StatusBadRequest, fmt.Errorf("source or target asset not found")
+	}
+
+	data.DB.WithContext(c).Model(&model.AssetRelation{}).
+		Where("source_asset_id = ? AND target_asset_id = ? AND relation_type = ? AND id <> ?",
+			req.SourceAssetID, req.TargetAssetID, req.RelationType, selfID).
+		Count(&count)
+	if count > 0 {
+		return http.StatusConflict, fmt.Errorf("relation already exists")
+	}
+	return 0, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
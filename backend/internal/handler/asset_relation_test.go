@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"itam-backend/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRelationEngine(t *testing.T) *gin.Engine {
+	setupTestDB(t)
+	h := NewAssetRelationHandler()
+	r := gin.New()
+	r.Use(signedIn(findUser(t, "admin")))
+	r.POST("/relations", h.CreateRelation)
+	r.DELETE("/relations/:id", h.DeleteRelation)
+	r.GET("/assets/:id/impact", h.GetImpact)
+	return r
+}
+
+func createTestRelation(t *testing.T, r *gin.Engine, source, target uint) model.AssetRelation {
+	t.Helper()
+	body := fmt.Sprintf(`{"source_asset_id":%d,"target_asset_id":%d,"relation_type":"runs_on"}`, source, target)
+	req := httptest.NewRequest(http.MethodPost, "/relations", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create relation %d -> %d: %d %s", source, target, w.Code, w.Body)
+	}
+	var relation model.AssetRelation
+	json.Unmarshal(w.Body.Bytes(), &relation)
+	return relation
+}
+
+func TestRelationCanBeCreatedAgainAfterDelete(t *testing.T) {
+	r := newRelationEngine(t)
+	vm := createTestAsset(t, model.Asset{Name: "rel-vm", Type: "vm", Status: model.AssetStatusOnline})
+	host := createTestAsset(t, model.Asset{Name: "rel-host", Type: "server", Status: model.AssetStatusOnline})
+
+	relation := createTestRelation(t, r, vm.ID, host.ID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/relations/%d", relation.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	createTestRelation(t, r, vm.ID, host.ID)
+}
+
+func TestImpactTruncation(t *testing.T) {
+	r := newRelationEngine(t)
+	impact := func(root uint) ImpactResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/assets/%d/impact?depth=1", root), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("impact: %d %s", w.Code, w.Body)
+		}
+		var resp ImpactResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// app runs on vm runs on host: the app lies beyond depth 1
+	host := createTestAsset(t, model.Asset{Name: "trunc-host", Type: "server", Status: model.AssetStatusOnline})
+	vm := createTestAsset(t, model.Asset{Name: "trunc-vm", Type: "vm", Status: model.AssetStatusOnline})
+	app := createTestAsset(t, model.Asset{Name: "trunc-app", Type: "app", Status: model.AssetStatusOnline})
+	createTestRelation(t, r, vm.ID, host.ID)
+	createTestRelation(t, r, app.ID, vm.ID)
+	if resp := impact(host.ID); len(resp.Affected) != 1 || !resp.Truncated {
+		t.Fatalf("chain: %d affected, truncated %v; want 1 and truncated", len(resp.Affected), resp.Truncated)
+	}
+
+	// Two assets on each other: the only edge past depth 1 leads back to the root
+	a := createTestAsset(t, model.Asset{Name: "trunc-a", Type: "vm", Status: model.AssetStatusOnline})
+	b := createTestAsset(t, model.Asset{Name: "trunc-b", Type: "vm", Status: model.AssetStatusOnline})
+	createTestRelation(t, r, a.ID, b.ID)
+	createTestRelation(t, r, b.ID, a.ID)
+	if resp := impact(a.ID); len(resp.Affected) != 1 || resp.Truncated {
+		t.Fatalf("cycle: %d affected, truncated %v; want 1 and not truncated", len(resp.Affected), resp.Truncated)
+	}
+}
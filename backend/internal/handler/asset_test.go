@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// putJSON sends a PUT with a JSON body and returns the recorder
+func putJSON(r *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateIgnoresBodyID(t *testing.T) {
+	setupTestDB(t)
+	other := model.Tenant{Name: "Other", Code: "body-id-other", Status: model.TenantStatusActive}
+	if err := data.DB.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	all := data.DB.WithContext(tenant.WithAll(context.Background()))
+	create := func(tenantID uint, row interface{}) {
+		t.Helper()
+		if err := data.DB.WithContext(tenant.WithTenant(context.Background(), tenantID)).Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seq := 0 // contract codes are unique per tenant
+
+	r := gin.New()
+	r.Use(signedIn(findUser(t, "admin")))
+	r.PUT("/assets/:id", NewAssetHandler(nil).UpdateAsset)
+	r.PUT("/contracts/:id", NewContractHandler(nil, nil).UpdateContract)
+	r.PUT("/interfaces/:id", NewInterfaceHandler().UpdateInterface)
+
+	tests := []struct {
+		path   string
+		create func(tenantID uint) uint
+		load   func(id uint) (string, uint)
+	}{
+		{
+			"/assets",
+			func(tenantID uint) uint {
+				a := model.Asset{Name: "body-id", Status: model.AssetStatusOnline}
+				create(tenantID, &a)
+				return a.ID
+			},
+			func(id uint) (string, uint) {
+				var a model.Asset
+				all.First(&a, id)
+				return a.Name, a.TenantID
+			},
+		},
+		{
+			"/contracts",
+			func(tenantID uint) uint {
+				seq++
+				c := model.Contract{Name: "body-id", Code: fmt.Sprintf("BODY-ID-%d", seq)}
+				create(tenantID, &c)
+				return c.ID
+			},
+			func(id uint) (string, uint) {
+				var c model.Contract
+				all.First(&c, id)
+				return c.Name, c.TenantID
+			},
+		},
+		{
+			"/interfaces",
+			func(tenantID uint) uint {
+				i := model.SystemInterface{Name: "body-id"}
+				create(tenantID, &i)
+				return i.ID
+			},
+			func(id uint) (string, uint) {
+				var i model.SystemInterface
+				all.First(&i, id)
+				return i.Name, i.TenantID
+			},
+		},
+	}
+	for _, tt := range tests {
+		mine, sibling, victim := tt.create(data.DefaultTenantID), tt.create(data.DefaultTenantID), tt.create(other.ID)
+
+		// Aim the body at another tenant's row, then at a row of our own
+		for _, target := range []uint{victim, sibling} {
+			body := fmt.Sprintf(`{"id":%d,"tenant_id":%d,"name":"stolen"}`, target, other.ID)
+			if w := putJSON(r, fmt.Sprintf("%s/%d", tt.path, mine), body); w.Code != http.StatusOK {
+				t.Fatalf("%s: %d %s", tt.path, w.Code, w.Body)
+			}
+		}
+
+		want := map[uint][2]interface{}{
+			mine:    {"stolen", data.DefaultTenantID},
+			sibling: {"body-id", data.DefaultTenantID},
+			victim:  {"body-id", other.ID},
+		}
+		for id, w := range want {
+			if name, tenantID := tt.load(id); name != w[0] || tenantID != w[1] {
+				t.Errorf("%s %d: name %q in tenant %d, want %q in tenant %d", tt.path, id, name, tenantID, w[0], w[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AssetTypeRequest create/update asset type schema request body
+type AssetTypeRequest struct {
+	Type        string                 `json:"type" binding:"required"`
+	Description string                 `json:"description"`
+	Fields      []model.AttributeField `json:"fields"`
+}
+
+type AssetTypeHandler struct{}
+
+func NewAssetTypeHandler() *AssetTypeHandler {
+	return &AssetTypeHandler{}
+}
+
+// GetAttributeTypes 获取可用的字段类型
+func (h *AssetTypeHandler) GetAttributeTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, model.AttributeTypes)
+}
+
+// GetAssetTypes 获取资产类型属性定义列表
+func (h *AssetTypeHandler) GetAssetTypes(c *gin.Context) {
+	var schemas []model.AssetTypeSchema
+	if err := data.DB.WithContext(c).Order("type asc").Find(&schemas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schemas)
+}
+
+// GetAssetType 获取单个资产类型属性定义
+func (h *AssetTypeHandler) GetAssetType(c *gin.Context) {
+	var schema model.AssetTypeSchema
+	if err := data.DB.WithContext(c).First(&schema, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset type not found"})
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// CreateAssetType 定义资产类型的自定义属性
+func (h *AssetTypeHandler) CreateAssetType(c *gin.Context) {
+	var req AssetTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schema := model.AssetTypeSchema{
+		Type:        strings.TrimSpace(req.Type),
+		Description: req.Description,
+		Fields:      model.AttributeFields(req.Fields),
+	}
+	if err := schema.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	data.DB.WithContext(c).Unscoped().Model(&model.AssetTypeSchema{}).Where("type = ?", schema.Type).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Asset type already has a schema"})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Create(&schema).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// UpdateAssetType 更新字段定义；已有资产的属性值在下次保存时按新定义校验
+func (h *AssetTypeHandler) UpdateAssetType(c *gin.Context) {
+	var schema model.AssetTypeSchema
+	if err := data.DB.WithContext(c).First(&schema, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset type not found"})
+		return
+	}
+
+	var req AssetTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The schema is matched by Asset.Type, renaming would detach existing assets
+	if strings.TrimSpace(req.Type) != schema.Type {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Asset type cannot be renamed"})
+		return
+	}
+
+	schema.Description = req.Description
+	schema.Fields = model.AttributeFields(req.Fields)
+	if err := schema.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Save(&schema).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// DeleteAssetType 删除属性定义，仍有资产使用该类型时不可删除
+func (h *AssetTypeHandler) DeleteAssetType(c *gin.Context) {
+	var schema model.AssetTypeSchema
+	if err := data.DB.WithContext(c).First(&schema, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset type not found"})
+		return
+	}
+
+	// Schemas are shared, count the assets of every tenant
+	var count int64
+	data.DB.WithContext(tenant.WithAll(c)).Model(&model.Asset{}).Where("type = ?", schema.Type).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Asset type is used by %d asset(s)", count)})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Unscoped().Delete(&schema).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Asset type deleted"})
+}
+
+// validateAssetAttributes checks asset.Attributes against the schema of
+// asset.Type and replaces them with the normalized values.
+// Types without a schema accept no attributes.
+func validateAssetAttributes(c *gin.Context, asset *model.Asset) error {
+	var schema model.AssetTypeSchema
+	err := data.DB.WithContext(c).Where("type = ?", asset.Type).First(&schema).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		for _, v := range asset.Attributes {
+			if v != nil {
+				return &badRequestError{fmt.Errorf("asset type %q has no custom attributes", asset.Type)}
+			}
+		}
+		asset.Attributes = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	attrs, errs := schema.ValidateAttributes(asset.Attributes)
+	if len(errs) > 0 {
+		return &badRequestError{errors.New(strings.Join(errs, "; "))}
+	}
+
+	for _, f := range schema.Fields {
+		ref, ok := attrs[f.Key].(int64)
+		if f.Type != model.AttributeTypeAssetRef || !ok {
+			continue
+		}
+		if asset.ID != 0 && uint(ref) == asset.ID {
+			return &badRequestError{fmt.Errorf("attribute %s cannot reference the asset itself", f.Key)}
+		}
+		var count int64
+		if err := data.DB.WithContext(c).Model(&model.Asset{}).Where("id = ?", ref).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return &badRequestError{fmt.Errorf("attribute %s: asset %d not found", f.Key, ref)}
+		}
+	}
+
+	asset.Attributes = attrs
+	return nil
+}
+
+// dropStaleAttributes removes the attributes that oldType defines and
+// asset.Type does not, so changing an asset's type keeps the attributes
+// both types share and leaves no stale ones behind
+func dropStaleAttributes(c *gin.Context, asset *model.Asset, oldType string) error {
+	if asset.Type == oldType || len(asset.Attributes) == 0 {
+		return nil
+	}
+	var schemas []model.AssetTypeSchema
+	if err := data.DB.WithContext(c).Where("type IN ?", []string{oldType, asset.Type}).Find(&schemas).Error; err != nil {
+		return err
+	}
+	defined := map[string]map[string]bool{oldType: {}, asset.Type: {}}
+	for _, schema := range schemas {
+		for _, f := range schema.Fields {
+			defined[schema.Type][f.Key] = true
+		}
+	}
+	for key := range asset.Attributes {
+		if defined[oldType][key] && !defined[asset.Type][key] {
+			delete(asset.Attributes, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var auditListSpec = ListSpec{
+	SortColumns:   []string{"created_at", "action", "target_type"},
+	FilterColumns: []string{"user_id", "username", "action", "target_type", "target_id"},
+	DefaultSort:   "-id",
+}
+
+type AuditHandler struct{}
+
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{}
+}
+
+// GetAuditLogs 分页查询审计日志
+// Filters: user_id, username, action, target_type, target_id, from, to (RFC3339 or YYYY-MM-DD)
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	query := data.DB.WithContext(c).Model(&model.AuditLog{})
+	if v := c.Query("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	var logs []model.AuditLog
+	respondList(c, query, auditListSpec, &logs)
+}
+
+// parseTimeParam accepts RFC3339 timestamps or plain dates
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, time.Local)
+}
@@ -1,10 +1,18 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"itam-backend/internal/middleware"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/identity"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
 )
 
 // LoginRequest login request body
@@ -13,19 +21,42 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse login response
+// LoginResponse login and refresh response
 type LoginResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Token        string `json:"token"`         // access token
+	RefreshToken string `json:"refresh_token"` // single use, exchanged at /auth/refresh
+	ExpiresIn    int64  `json:"expires_in"`    // access token lifetime in seconds
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	// RecoveryCodes are shown once, when MFA is enabled during login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// RefreshRequest refresh and logout request body
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ChangePasswordRequest change password request body
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
 }
 
 // AuthHandler authentication handler
-type AuthHandler struct{}
+type AuthHandler struct {
+	authenticators []authenticator
+	mfa            *MFAHandler
+	lockout        *LockoutHandler
+}
 
 // NewAuthHandler creates new auth handler
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(cfg *conf.AuthConfig, mfa *MFAHandler, lockout *LockoutHandler) *AuthHandler {
+	return &AuthHandler{
+		authenticators: newAuthenticators(cfg),
+		mfa:            mfa,
+		lockout:        lockout,
+	}
 }
 
 // Login handles user login
@@ -36,51 +67,193 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement proper user authentication with database
-	// For now, using hardcoded credentials for demo
-	var userID uint
-	var role string
+	if h.lockout.throttled(c, req.Username) {
+		return
+	}
+	account := h.lockout.account(c, req.Username)
+	if h.lockout.locked(c, account) {
+		return
+	}
 
-	switch req.Username {
-	case "admin":
-		if req.Password != "admin123" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// An empty chain leaves single sign-on as the only way in
+	var user *model.User
+	unavailable := false
+	for _, a := range h.authenticators {
+		u, err := a.authenticate(c, req.Username, req.Password)
+		if err == nil {
+			user = u
+			break
+		}
+		if errors.Is(err, errBadCredentials) {
+			continue
+		}
+		var ie *identity.Error
+		if errors.As(err, &ie) {
+			respondAuthError(c, err)
 			return
 		}
-		userID = 1
-		role = "admin"
-	case "user":
-		if req.Password != "user123" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		log.Printf("Login: %s authenticator failed: %v", a.name(), err)
+		unavailable = true
+	}
+	if user == nil {
+		if unavailable {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service unavailable"})
 			return
 		}
-		userID = 2
-		role = "user"
-	default:
+		h.lockout.fail(c, req.Username, account)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := middleware.GenerateToken(userID, req.Username, role)
+	// Password logins of MFA users stop here until the code is checked
+	// at /auth/mfa/challenge; SSO logins rely on the provider's own MFA.
+	// Failures are only cleared once the second factor passed too.
+	if h.mfa.required(user) {
+		if err := checkLogin(user); err != nil {
+			respondAuthError(c, err)
+			return
+		}
+		challenge, err := h.mfa.challenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor authentication"})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	h.lockout.succeed(c, req.Username, user)
+	resp, err := completeLogin(c, user)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Refresh tokens
+// are single use: presenting one twice ends the session.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, hash, err := parseRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	s, err := session.Default.Get(id)
+	if errors.Is(err, session.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	if s.RefreshHash != hash {
+		// An old refresh token came back, assume it was stolen
+		session.RevokeSession(session.Default, s)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reused, session revoked"})
+		return
+	}
+
+	// Pick up role, organization and status changes made since login
+	var user model.User
+	if err := data.DB.WithContext(tenant.WithAll(c)).First(&user, s.UserID).Error; err != nil || !user.IsActive() {
+		session.RevokeSession(session.Default, s)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+		return
+	}
+	// The session outlives a lock, but gets no tokens while it lasts
+	if h.lockout.locked(c, &user) {
+		return
+	}
+	var t model.Tenant
+	if err := data.DB.First(&t, user.TenantID).Error; err != nil || !t.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is disabled"})
+		return
+	}
+
+	prevAccessID, prevAccessExpiresAt := s.AccessID, s.AccessExpiresAt
+	resp, err := renewSession(s, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	s.IP = c.ClientIP()
+	ok, err := session.Default.Rotate(s, hash)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used"})
+		return
+	}
+	session.Default.Revoke(prevAccessID, prevAccessExpiresAt)
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token:    token,
-		Username: req.Username,
-		Role:     role,
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
-// Logout handles user logout
+// Logout ends the session of the presented access token, or of the
+// refresh token in the body
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// In a stateless JWT system, logout is handled client-side
-	// by removing the token from storage
+	id := c.GetString("sessionID")
+	if id == "" {
+		var req RefreshRequest
+		c.ShouldBindJSON(&req)
+		sid, hash, err := parseRefreshToken(req.RefreshToken)
+		if err == nil {
+			if s, err := session.Default.Get(sid); err == nil && s.RefreshHash == hash {
+				id = s.ID
+			}
+		}
+	}
+
+	if id != "" {
+		s, err := session.Default.Get(id)
+		if err == nil {
+			err = session.RevokeSession(session.Default, s)
+		}
+		if err != nil && !errors.Is(err, session.ErrNotFound) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+			return
+		}
+	}
+	if jti := c.GetString("tokenID"); jti != "" {
+		// The token may belong to a session that already ended
+		if exp, ok := c.Get("tokenExpiresAt"); ok {
+			session.Default.Revoke(jti, exp.(time.Time))
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+// LogoutAll ends every session of the current user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	n, err := endSessions(c, c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions", "sessions": n})
+}
+
+// GetSessions lists the sessions of the current user
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	infos, err := sessionInfos(c.GetUint("userID"), c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, infos)
+}
+
 // GetCurrentUser returns current user info
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 	username, exists := c.Get("username")
@@ -93,14 +266,51 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
 	c.JSON(http.StatusOK, gin.H{
-		"user_id":  userID,
-		"username": username,
-		"role":     role,
+		"user_id":   userID,
+		"tenant_id": c.GetUint("tenantID"),
+		"org_id":    c.GetUint("orgID"),
+		"username":  username,
+		"role":      role,
 	})
 }
 
 // ChangePassword handles password change
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
-	// TODO: Implement password change logic
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	var user model.User
+	if err := data.DB.WithContext(c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.AuthSource != model.AuthSourceLocal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the identity provider"})
+		return
+	}
+
+	if !user.CheckPassword(req.OldPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Old password is incorrect"})
+		return
+	}
+
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Model(&user).Update("password_hash", user.PasswordHash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Sign out other devices, the current session stays
+	revokeOtherSessions(c, user.ID)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChangePassword(t *testing.T) {
+	setupTestDB(t)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	user := createTestUser(t, "passwd.ian", "user", nil)
+	startSession(t, user.ID)
+	otherJTI := startSession(t, user.ID)
+	sessions, _ := session.Default.ListByUser(user.ID)
+	var current *session.Session
+	for _, s := range sessions {
+		if s.AccessID != otherJTI {
+			current = s
+		}
+	}
+	_, hash := middleware.GenerateAPIToken()
+	if err := data.DB.WithContext(ctx).Create(&model.APIToken{TenantID: data.DefaultTenantID, UserID: user.ID, Name: "ci", TokenHash: hash}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(signedIn(user), func(c *gin.Context) { c.Set("sessionID", current.ID) }, middleware.AuditContext())
+	r.PUT("/password", NewAuthHandler(&conf.AuthConfig{}, nil, nil).ChangePassword)
+	change := func(oldPassword, newPassword string) int {
+		body := fmt.Sprintf(`{"old_password":%q,"new_password":%q}`, oldPassword, newPassword)
+		return putJSON(r, "/password", body).Code
+	}
+
+	// Refusals leave the password and the sessions alone
+	if code := change("wrong123", "changed123"); code != http.StatusBadRequest {
+		t.Fatalf("wrong old password: %d", code)
+	}
+	if code := change("secret123", "short"); code != http.StatusBadRequest {
+		t.Fatalf("short new password: %d", code)
+	}
+	if u := findUser(t, user.Username); !u.CheckPassword("secret123") {
+		t.Fatal("password changed by a refused request")
+	}
+	if list, _ := session.Default.ListByUser(user.ID); len(list) != 2 {
+		t.Fatalf("%d sessions after refusals, want 2", len(list))
+	}
+
+	if code := change("secret123", "changed123"); code != http.StatusOK {
+		t.Fatalf("change: %d", code)
+	}
+	if u := findUser(t, user.Username); !u.CheckPassword("changed123") {
+		t.Fatal("new password not set")
+	}
+
+	// Other devices are signed out and API tokens revoked, this one stays
+	list, _ := session.Default.ListByUser(user.ID)
+	if len(list) != 1 || list[0].ID != current.ID {
+		t.Fatalf("%d sessions left, want only the current one", len(list))
+	}
+	if revoked, _ := session.Default.IsRevoked(otherJTI); !revoked {
+		t.Fatal("access token of the other session still valid")
+	}
+	var tokens int64
+	data.DB.WithContext(ctx).Model(&model.APIToken{}).Where("user_id = ?", user.ID).Count(&tokens)
+	if tokens != 0 {
+		t.Fatalf("%d API token(s) left", tokens)
+	}
+
+	// The change is audited without the hash
+	var entry model.AuditLog
+	if err := data.DB.WithContext(ctx).Where("action = ? AND target_id = ?", "user.update", user.ID).Order("id DESC").First(&entry).Error; err != nil {
+		t.Fatalf("no audit entry: %v", err)
+	}
+	for _, side := range []string{"old", "new"} {
+		if v, _ := entry.Changes[side].(map[string]interface{}); v["password_hash"] != "******" {
+			t.Errorf("audited %s password_hash: %v", side, v["password_hash"])
+		}
+	}
+}
+
+func TestChangePasswordOfExternalAccount(t *testing.T) {
+	setupTestDB(t)
+	user := model.User{TenantID: data.DefaultTenantID, Username: "passwd.ldap", Role: "user", AuthSource: model.AuthSourceLDAP}
+	user.SetPassword("secret123")
+	if err := data.DB.WithContext(tenant.WithTenant(context.Background(), data.DefaultTenantID)).Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(signedIn(&user))
+	r.PUT("/password", NewAuthHandler(&conf.AuthConfig{}, nil, nil).ChangePassword)
+	w := putJSON(r, "/password", `{"old_password":"secret123","new_password":"changed123"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "identity provider") {
+		t.Fatalf("change of a directory password: %d %s", w.Code, w.Body)
+	}
+}
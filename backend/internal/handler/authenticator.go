@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/identity"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errBadCredentials means an authenticator does not know the user or the
+// password is wrong, so the next one in the chain gets a try
+var errBadCredentials = identity.ErrBadCredentials
+
+// authenticator checks a username and password against one source of
+// accounts
+type authenticator interface {
+	name() string
+	authenticate(c *gin.Context, username, password string) (*model.User, error)
+}
+
+// localAuthenticator checks passwords stored in the database
+type localAuthenticator struct{}
+
+func (localAuthenticator) name() string { return model.AuthSourceLocal }
+
+func (localAuthenticator) authenticate(c *gin.Context, username, password string) (*model.User, error) {
+	// Usernames are unique across tenants, the user's row decides the tenant
+	var user model.User
+	err := data.DB.WithContext(tenant.WithAll(c)).
+		Where("username = ? AND auth_source = ?", username, model.AuthSourceLocal).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.CheckPassword(password) {
+		return nil, errBadCredentials
+	}
+	return &user, nil
+}
+
+// ldapAuthenticator binds against an LDAP or Active Directory server and
+// provisions the matching local account
+type ldapAuthenticator struct {
+	dir *identity.LDAPDirectory
+}
+
+func (ldapAuthenticator) name() string { return model.AuthSourceLDAP }
+
+func (a ldapAuthenticator) authenticate(c *gin.Context, username, password string) (*model.User, error) {
+	id, err := a.dir.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return provisionExternalUser(c, id, a.dir.Policy())
+}
+
+// newAuthenticators builds the login chain in the configured order
+func newAuthenticators(cfg *conf.AuthConfig) []authenticator {
+	var chain []authenticator
+	for _, name := range cfg.Authenticators {
+		switch name {
+		case model.AuthSourceLocal:
+			chain = append(chain, localAuthenticator{})
+		case model.AuthSourceLDAP:
+			chain = append(chain, ldapAuthenticator{dir: identity.NewLDAPDirectory(&cfg.LDAP)})
+		default:
+			log.Fatalf("Unknown authenticator %q, expected local or ldap", name)
+		}
+	}
+	return chain
+}
@@ -1,39 +1,61 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"itam-backend/internal/conf"
 	"itam-backend/internal/data"
+	"itam-backend/internal/event"
 	"itam-backend/internal/model"
+	"itam-backend/internal/storage"
+	"log"
+	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-type ContractHandler struct{}
+type ContractHandler struct {
+	cfg   *conf.ContractConfig
+	store storage.Storage
+}
 
-func NewContractHandler() *ContractHandler {
-	return &ContractHandler{}
+func NewContractHandler(cfg *conf.ContractConfig, store storage.Storage) *ContractHandler {
+	return &ContractHandler{cfg: cfg, store: store}
 }
 
 // --- Contract CRUD ---
 
+var contractListSpec = ListSpec{
+	SortColumns: []string{"name", "code", "type", "status", "vendor", "amount", "currency",
+		"start_date", "end_date", "sign_date", "owner", "created_at", "updated_at"},
+	FilterColumns: []string{"code", "type", "status", "vendor", "currency", "owner", "asset_id", "org_id"},
+	SearchColumns: []string{"name", "code", "vendor", "owner", "description"},
+	DefaultSort:   "id",
+	ExportColumns: []string{"id", "code", "name", "type", "status", "vendor", "amount", "currency",
+		"start_date", "end_date", "sign_date", "owner", "contact_info", "asset_id", "org_id", "description",
+		"created_at", "updated_at"},
+	ScopeColumn: "created_by",
+}
+
 func (h *ContractHandler) GetContracts(c *gin.Context) {
 	var contracts []model.Contract
-	result := data.DB.Find(&contracts)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, contracts)
+	respondList(c, data.DB.WithContext(c).Model(&model.Contract{}), contractListSpec, &contracts)
 }
 
 func (h *ContractHandler) GetContract(c *gin.Context) {
 	id := c.Param("id")
 	var contract model.Contract
-	if err := data.DB.First(&contract, id).Error; err != nil {
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&contract, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Contract not found"})
 		return
 	}
@@ -46,12 +68,18 @@ func (h *ContractHandler) CreateContract(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	contract.CreatedBy = c.GetUint("userID")
+	if err := checkOrgAssignment(c, contract.OrgID); err != nil {
+		respondError(c, err)
+		return
+	}
 
-	result := data.DB.Create(&contract)
+	result := data.DB.WithContext(c).Create(&contract)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	event.Publish(c, event.ContractCreated, contract.TenantID, contract)
 	c.JSON(http.StatusOK, contract)
 }
 
@@ -59,35 +87,87 @@ func (h *ContractHandler) UpdateContract(c *gin.Context) {
 	var contract model.Contract
 	id := c.Param("id")
 
-	if err := data.DB.First(&contract, id).Error; err != nil {
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&contract, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Contract not found"})
 		return
 	}
 
+	stored, createdBy, orgID := contract.Model, contract.CreatedBy, copyOrgID(contract.OrgID)
 	if err := c.ShouldBindJSON(&contract); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The path picks the row, never an id in the body
+	contract.Model, contract.CreatedBy = stored, createdBy
+	if !sameOrg(orgID, contract.OrgID) {
+		if err := checkOrgAssignment(c, contract.OrgID); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
 
-	data.DB.Save(&contract)
+	// Write through the data scope as well; the handle above carries the load
+	if db, err = scopedDB(c, "created_by"); err == nil {
+		err = updateByID(db, &contract, stored.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	event.Publish(c, event.ContractUpdated, contract.TenantID, contract)
 	c.JSON(http.StatusOK, contract)
 }
 
 func (h *ContractHandler) DeleteContract(c *gin.Context) {
 	id := c.Param("id")
-	if err := data.DB.Delete(&model.Contract{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
 		return
 	}
+
+	// Load it first so the event carries what was deleted
+	var contract model.Contract
+	if err := db.First(&contract, id).Error; err == nil {
+		if err := db.Delete(&model.Contract{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		event.Publish(c, event.ContractDeleted, contract.TenantID, contract)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Contract deleted"})
 }
 
 // --- Contract Files ---
 
+// loadScopedContract loads a contract within the caller's data scope,
+// writing the error response when there is none
+func loadScopedContract(c *gin.Context, id interface{}) (*model.Contract, bool) {
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	var contract model.Contract
+	if err := db.First(&contract, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contract not found"})
+		return nil, false
+	}
+	return &contract, true
+}
+
 func (h *ContractHandler) GetContractFiles(c *gin.Context) {
-	contractID := c.Param("id")
+	contract, ok := loadScopedContract(c, c.Param("id"))
+	if !ok {
+		return
+	}
 	var files []model.ContractFile
-	if err := data.DB.Where("contract_id = ?", contractID).Order("version desc").Find(&files).Error; err != nil {
+	if err := data.DB.WithContext(c).Where("contract_id = ?", contract.ID).Order("version desc").Find(&files).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -102,30 +182,89 @@ func (h *ContractHandler) UploadContractFile(c *gin.Context) {
 		return
 	}
 
+	contract, ok := loadScopedContract(c, contractID)
+	if !ok {
+		return
+	}
+
+	// Stop oversized bodies before they are spooled to disk, leaving
+	// room for the multipart framing around the file
+	maxSize := h.cfg.MaxFileSizeMB << 20
+	if maxSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	}
+	tooLarge := gin.H{"error": fmt.Sprintf("File exceeds %dMB", h.cfg.MaxFileSizeMB)}
+
 	file, err := c.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
+	if maxSize > 0 && file.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	if file.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is empty"})
+		return
+	}
+	fileName := sanitizeFileName(file.Filename)
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	defer src.Close()
+
+	contentType, err := detectFileType(src, fileName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	if len(h.cfg.AllowedFileTypes) > 0 && !contains(h.cfg.AllowedFileTypes, contentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File type " + contentType + " is not allowed"})
+		return
+	}
+
+	// Hash first, then rewind and store
+	hash := sha256.New()
+	if _, err := io.Copy(hash, src); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	// The same content uploaded again is not a new version
+	var duplicate model.ContractFile
+	if err := data.DB.WithContext(c).Where("contract_id = ? AND sha256 = ?", contractID, sum).First(&duplicate).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("This file is already uploaded as version %d", duplicate.Version),
+			"file":  duplicate,
+		})
+		return
+	}
 
 	// Determine version
 	var lastFile model.ContractFile
 	newVersion := 1
-	if err := data.DB.Where("contract_id = ?", contractID).Order("version desc").First(&lastFile).Error; err == nil {
+	if err := data.DB.WithContext(c).Where("contract_id = ?", contractID).Order("version desc").First(&lastFile).Error; err == nil {
 		newVersion = lastFile.Version + 1
 	}
 
-	// Ensure upload directory exists
-	uploadDir := "./uploads/contracts"
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
-		return
-	}
-
-	// Save file
-	filename := fmt.Sprintf("%d_v%d_%s", contractID, newVersion, file.Filename)
-	dst := filepath.Join(uploadDir, filename)
-	if err := c.SaveUploadedFile(file, dst); err != nil {
+	// Save file, under a name built from the content rather than the client
+	key := fmt.Sprintf("contracts/%d/%d/v%d_%s%s", contract.TenantID, contractID, newVersion, sum[:16], fileExtension(contentType))
+	if err := h.store.Put(c, key, src, file.Size, contentType); err != nil {
+		log.Printf("Contract %d: failed to store file: %v", contractID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 		return
 	}
@@ -133,16 +272,22 @@ func (h *ContractHandler) UploadContractFile(c *gin.Context) {
 	// Save record
 	contractFile := model.ContractFile{
 		ContractID: uint(contractID),
-		FileName:   file.Filename,
-		FilePath:   dst,
+		FileName:   fileName,
+		FilePath:   key,
+		FileSize:   file.Size,
+		FileType:   contentType,
+		SHA256:     sum,
+		Storage:    h.store.Name(),
 		Version:    newVersion,
-		UploadedBy: "admin", // TODO: Get from context
+		UploadedBy: c.GetString("username"),
 	}
 
-	if err := data.DB.Create(&contractFile).Error; err != nil {
+	if err := data.DB.WithContext(c).Create(&contractFile).Error; err != nil {
+		h.store.Delete(c, key)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file record"})
 		return
 	}
+	event.Publish(c, event.FileUploaded, contractFile.TenantID, contractFile)
 
 	c.JSON(http.StatusOK, contractFile)
 }
@@ -150,10 +295,47 @@ func (h *ContractHandler) UploadContractFile(c *gin.Context) {
 func (h *ContractHandler) DownloadContractFile(c *gin.Context) {
 	fileID := c.Param("file_id")
 	var contractFile model.ContractFile
-	if err := data.DB.First(&contractFile, fileID).Error; err != nil {
+	if err := data.DB.WithContext(c).First(&contractFile, fileID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
+	// Files are visible with the contract they belong to
+	if _, ok := loadScopedContract(c, contractFile.ContractID); !ok {
+		return
+	}
+
+	// Uploads from before storage backends were written straight to disk
+	if contractFile.Storage == "" {
+		c.File(contractFile.FilePath)
+		return
+	}
+	if contractFile.Storage != h.store.Name() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File is kept in " + contractFile.Storage + " storage, which is not configured"})
+		return
+	}
+
+	rc, obj, err := h.store.Get(c, contractFile.FilePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File content is missing"})
+		return
+	}
+	if err != nil {
+		log.Printf("Contract file %d: %v", contractFile.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer rc.Close()
 
-	c.File(contractFile.FilePath)
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	headers := map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": contractFile.FileName}),
+		"X-Content-Type-Options": "nosniff",
+	}
+	if contractFile.SHA256 != "" {
+		headers["X-Content-SHA256"] = contractFile.SHA256
+	}
+	c.DataFromReader(http.StatusOK, obj.Size, contentType, rc, headers)
 }
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/storage"
+	"itam-backend/internal/tenant"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// uploadFile posts content as the multipart file field of an upload and
+// returns the response and how much of the body the server read
+func uploadFile(r *gin.Engine, contractID uint, name string, content []byte) (*httptest.ResponseRecorder, int64) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", name)
+	part.Write(content)
+	mw.Close()
+
+	read := &countingReader{r: &body}
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/contracts/%d/files", contractID), read)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, read.n
+}
+
+func pdf(text string) []byte {
+	return []byte("%PDF-1.4\n% " + text + "\n%%EOF\n")
+}
+
+func TestUploadContractFile(t *testing.T) {
+	setupTestDB(t)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	contract := model.Contract{Name: "upload", Code: "UPLOAD-1"}
+	if err := data.DB.WithContext(ctx).Create(&contract).Error; err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	h := NewContractHandler(&conf.ContractConfig{MaxFileSizeMB: 1, AllowedFileTypes: []string{"application/pdf"}}, store)
+	r := gin.New()
+	r.Use(signedIn(findUser(t, "admin")))
+	r.POST("/contracts/:id/files", h.UploadContractFile)
+	files := func() []model.ContractFile {
+		var list []model.ContractFile
+		data.DB.WithContext(ctx).Where("contract_id = ?", contract.ID).Order("version").Find(&list)
+		return list
+	}
+
+	// Refused before anything is stored
+	refusals := []struct {
+		name    string
+		file    string
+		content []byte
+		want    int
+	}{
+		{"over the size limit", "big.pdf", append(pdf("big"), bytes.Repeat([]byte("x"), 8<<20)...), http.StatusRequestEntityTooLarge},
+		{"PNG named .pdf", "scan.pdf", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...), http.StatusUnsupportedMediaType},
+		{"HTML named .pdf", "page.pdf", []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType},
+		{"empty", "empty.pdf", nil, http.StatusBadRequest},
+	}
+	for _, tt := range refusals {
+		w, read := uploadFile(r, contract.ID, tt.file, tt.content)
+		if w.Code != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+		// Reading stops at the limit and the framing allowance
+		if read > 3<<20 {
+			t.Errorf("%s: read %d bytes of the body", tt.name, read)
+		}
+	}
+	if n := len(files()); n != 0 {
+		t.Fatalf("%d files recorded by refused uploads", n)
+	}
+
+	// The type comes from the content, not the name
+	w, _ := uploadFile(r, contract.ID, "signed.bin", pdf("v1"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", w.Code, w.Body)
+	}
+	var first model.ContractFile
+	json.Unmarshal(w.Body.Bytes(), &first)
+	if first.FileType != "application/pdf" || !strings.HasSuffix(first.FilePath, ".pdf") || first.Version != 1 {
+		t.Fatalf("stored as %s at %s, version %d", first.FileType, first.FilePath, first.Version)
+	}
+	rc, _, err := store.Get(context.Background(), first.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(stored, pdf("v1")) {
+		t.Fatalf("stored %q", stored)
+	}
+
+	// The same content again is refused, whatever its name
+	if w, _ := uploadFile(r, contract.ID, "copy.pdf", pdf("v1")); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate: %d %s", w.Code, w.Body)
+	}
+	if w, _ := uploadFile(r, contract.ID, "signed.pdf", pdf("v2")); w.Code != http.StatusOK {
+		t.Fatalf("new version: %d %s", w.Code, w.Body)
+	}
+	if list := files(); len(list) != 2 || list[1].Version != 2 || list[0].SHA256 == list[1].SHA256 {
+		t.Fatalf("files after the new version: %+v", list)
+	}
+}
@@ -1,19 +1,26 @@
 package handler
 
 import (
-	"itam-backend/internal/data"
 	"itam-backend/internal/model"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func GetDashboardStats(c *gin.Context) {
+	// Counts cover the assets within the caller's data scope
+	db, err := scopedDB(c, "created_by")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
 	var assetCount int64
-	data.DB.Model(&model.Asset{}).Count(&assetCount)
+	db.Session(&gorm.Session{}).Model(&model.Asset{}).Count(&assetCount)
 
 	var offlineCount int64
-	data.DB.Model(&model.Asset{}).Where("status IN ?", []string{"Offline", "Maintenance", "Stopped"}).Count(&offlineCount)
+	db.Session(&gorm.Session{}).Model(&model.Asset{}).Where("status IN ?", []string{"Offline", "Maintenance", "Stopped"}).Count(&offlineCount)
 
 	// Calculate mock SLA based on online percentage (simple logic for demo)
 	sla := 100.0
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errOutOfScope = errors.New("organization is outside your data scope")
+
+// scopeRoot returns the organization whose subtree the caller may see.
+// ok is false for the "all" scope; root is nil when the caller only sees
+// the rows they created (self scope, or no organization assigned).
+func scopeRoot(c *gin.Context) (root *model.Organization, ok bool, err error) {
+	return data.ScopeRoot(data.DB.WithContext(c), middleware.DataScope(c), c.GetUint("orgID"))
+}
+
+// applyDataScope restricts query to the rows of the caller's data scope:
+// rows of an organization in the scope subtree, plus the rows the caller
+// created (selfColumn holds the creator's user ID).
+func applyDataScope(c *gin.Context, query *gorm.DB, selfColumn string) (*gorm.DB, error) {
+	root, scoped, err := scopeRoot(c)
+	if err != nil || !scoped {
+		return query, err
+	}
+
+	userID := c.GetUint("userID")
+	if root == nil {
+		return query.Where(selfColumn+" = ?", userID), nil
+	}
+	orgs := data.DB.WithContext(c).Model(&model.Organization{}).Select("id").Where("tree_path LIKE ?", root.TreePath+"%")
+	return query.Where(data.DB.Where("org_id IN (?)", orgs).Or(selfColumn+" = ?", userID)), nil
+}
+
+// scopeList applies the data scope and the ?org_tree= filter of list endpoints.
+//
+//	?org_tree=5      rows of organization 5 and all organizations below it
+//	?org_tree=mine   same, starting from the caller's own organization
+func scopeList(c *gin.Context, query *gorm.DB, spec ListSpec) (*gorm.DB, error) {
+	query, err := applyDataScope(c, query, spec.ScopeColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	v := c.Query("org_tree")
+	if v == "" {
+		return query, nil
+	}
+	var orgID uint
+	if v == "mine" {
+		orgID = c.GetUint("orgID")
+	} else if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+		orgID = uint(n)
+	}
+	if orgID == 0 {
+		return nil, &badRequestError{fmt.Errorf("invalid org_tree: %s", v)}
+	}
+
+	var org model.Organization
+	if err := data.DB.WithContext(c).First(&org, orgID).Error; err != nil {
+		return nil, &badRequestError{fmt.Errorf("organization %d not found", orgID)}
+	}
+	orgs := data.DB.WithContext(c).Model(&model.Organization{}).Select("id").Where("tree_path LIKE ?", org.TreePath+"%")
+	return query.Where("org_id IN (?)", orgs), nil
+}
+
+// scopedDB returns a request database handle limited to the caller's data
+// scope, for loading single rows of scoped tables by ID
+func scopedDB(c *gin.Context, selfColumn string) (*gorm.DB, error) {
+	return applyDataScope(c, data.DB.WithContext(c), selfColumn)
+}
+
+// scopedOrganizations returns a request database handle limited to the
+// organizations of the caller's data scope subtree. The self scope sees
+// none, as orgInScope lets it change none.
+func scopedOrganizations(c *gin.Context) (*gorm.DB, error) {
+	db := data.DB.WithContext(c)
+	root, scoped, err := scopeRoot(c)
+	if err != nil || !scoped {
+		return db, err
+	}
+	if root == nil {
+		return db.Where("1 = 0"), nil
+	}
+	return db.Where("tree_path LIKE ?", root.TreePath+"%"), nil
+}
+
+// updateByID writes row, loaded by id and then bound from a request body,
+// back to that row alone. Unlike Save it never falls back to an insert
+// when nothing matched.
+func updateByID(db *gorm.DB, row interface{}, id uint) error {
+	result := db.Model(row).Where("id = ?", id).Select("*").Omit("id", "created_at").Updates(row)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// checkOrgAssignment verifies orgID exists and lies within the caller's data scope
+func checkOrgAssignment(c *gin.Context, orgID *uint) error {
+	if orgID == nil {
+		return nil
+	}
+
+	var org model.Organization
+	if err := data.DB.WithContext(c).First(&org, *orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &badRequestError{fmt.Errorf("organization %d not found", *orgID)}
+		}
+		return err
+	}
+
+	in, err := orgInScope(c, &org)
+	if err != nil {
+		return err
+	}
+	if !in {
+		return &badRequestError{errOutOfScope}
+	}
+	return nil
+}
+
+// orgInScope reports whether org lies within the caller's data scope
+// subtree; always true for the "all" scope. A nil org stands for the top
+// of the tree, above every scope root.
+func orgInScope(c *gin.Context, org *model.Organization) (bool, error) {
+	root, scoped, err := scopeRoot(c)
+	if err != nil || !scoped {
+		return true, err
+	}
+	return root != nil && org != nil && root.IsAncestorOf(org), nil
+}
+
+// copyOrgID returns a pointer to a copy of id. Decoding a request body
+// writes through a non-nil pointer, which would change a kept copy too.
+func copyOrgID(id *uint) *uint {
+	if id == nil {
+		return nil
+	}
+	v := *id
+	return &v
+}
+
+func sameOrg(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
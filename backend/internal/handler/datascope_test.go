@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createTestOrg(t *testing.T, name string, parent *model.Organization) model.Organization {
+	t.Helper()
+	db := data.DB.WithContext(tenant.WithTenant(context.Background(), data.DefaultTenantID))
+	org := model.Organization{Name: name, Type: model.OrgTypeDepartment, Level: 1}
+	parentPath := "/"
+	if parent != nil {
+		parentPath, org.Level, org.ParentID = parent.TreePath, parent.Level+1, &parent.ID
+	} else {
+		org.Type = model.OrgTypeCompany
+	}
+	if err := db.Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+	org.TreePath = (&model.Organization{TreePath: parentPath}).ChildPath(org.ID)
+	if err := db.Model(&org).Update("tree_path", org.TreePath).Error; err != nil {
+		t.Fatal(err)
+	}
+	return org
+}
+
+// createScopedUser creates a user of the organization whose role may
+// write assets and contracts within the given data scope
+func createScopedUser(t *testing.T, username, scope string, orgID uint) *model.User {
+	t.Helper()
+	role := createTestRole(t, "test-"+scope, scope, "asset:*", "contract:*")
+	return createTestUser(t, username, role.Name, &orgID)
+}
+
+func TestWritesStayInDataScope(t *testing.T) {
+	setupTestDB(t)
+	company := createTestOrg(t, "Scope Co", nil)
+	ops := createTestOrg(t, "Scope Ops", &company)
+	sales := createTestOrg(t, "Scope Sales", &company)
+	users := map[string]*model.User{
+		model.DataScopeDepartment: createScopedUser(t, "scope.dept", model.DataScopeDepartment, ops.ID),
+		model.DataScopeSelf:       createScopedUser(t, "scope.self", model.DataScopeSelf, ops.ID),
+	}
+	adminID := findUser(t, "admin").ID
+	all := data.DB.WithContext(tenant.WithAll(context.Background()))
+	seq := 0
+
+	insert := func(row interface{}) {
+		t.Helper()
+		if err := data.DB.WithContext(tenant.WithTenant(context.Background(), data.DefaultTenantID)).Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	resources := []struct {
+		path   string
+		table  string
+		create func(createdBy, orgID uint) uint
+	}{
+		{"/assets", "assets", func(createdBy, orgID uint) uint {
+			a := model.Asset{Name: "scoped", Status: model.AssetStatusOnline, CreatedBy: createdBy, OrgID: &orgID}
+			insert(&a)
+			return a.ID
+		}},
+		{"/contracts", "contracts", func(createdBy, orgID uint) uint {
+			seq++
+			c := model.Contract{Name: "scoped", Code: fmt.Sprintf("SCOPE-%d", seq), CreatedBy: createdBy, OrgID: &orgID}
+			insert(&c)
+			return c.ID
+		}},
+	}
+
+	for scope, user := range users {
+		r := gin.New()
+		r.Use(signedIn(user))
+		assets := NewAssetHandler(notification.NewService(&conf.NotificationConfig{}))
+		contracts := NewContractHandler(nil, nil)
+		r.POST("/assets", assets.CreateAsset)
+		r.PUT("/assets/:id", assets.UpdateAsset)
+		r.DELETE("/assets/:id", assets.DeleteAsset)
+		r.POST("/contracts", contracts.CreateContract)
+		r.PUT("/contracts/:id", contracts.UpdateContract)
+		r.DELETE("/contracts/:id", contracts.DeleteContract)
+		send := func(method, path, body string) int {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		for _, res := range resources {
+			name := func(id uint) string {
+				var n string
+				all.Table(res.table).Select("name").Where("id = ? AND deleted_at IS NULL", id).Scan(&n)
+				return n
+			}
+			label := scope + " " + res.path
+
+			mine := res.create(user.ID, ops.ID)
+			colleague := res.create(adminID, ops.ID) // in the department, created by someone else
+			outside := res.create(adminID, sales.ID)
+
+			// Rows outside the scope can be neither updated nor deleted
+			if code := send(http.MethodPut, fmt.Sprintf("%s/%d", res.path, outside), `{"name":"changed"}`); code != http.StatusNotFound {
+				t.Errorf("%s: update outside the scope = %d", label, code)
+			}
+			send(http.MethodDelete, fmt.Sprintf("%s/%d", res.path, outside), "")
+			// nor reached through an id in the body of an update of one's own row
+			body := fmt.Sprintf(`{"id":%d,"name":"changed","org_id":%d}`, outside, ops.ID)
+			if code := send(http.MethodPut, fmt.Sprintf("%s/%d", res.path, mine), body); code != http.StatusOK {
+				t.Errorf("%s: update of own row = %d", label, code)
+			}
+			if n := name(outside); n != "scoped" {
+				t.Errorf("%s: row outside the scope became %q", label, n)
+			}
+			if n := name(mine); n != "changed" {
+				t.Errorf("%s: own row is %q, want changed", label, n)
+			}
+
+			// Neither created in nor moved to an organization outside the scope
+			if code := send(http.MethodPost, res.path, fmt.Sprintf(`{"name":"new","code":"SCOPE-NEW","org_id":%d}`, sales.ID)); code != http.StatusBadRequest {
+				t.Errorf("%s: create outside the scope = %d", label, code)
+			}
+			if code := send(http.MethodPut, fmt.Sprintf("%s/%d", res.path, mine), fmt.Sprintf(`{"org_id":%d}`, sales.ID)); code != http.StatusBadRequest {
+				t.Errorf("%s: move outside the scope = %d", label, code)
+			}
+
+			// A colleague's row is in the department scope, not in the self scope
+			want := http.StatusOK
+			if scope == model.DataScopeSelf {
+				want = http.StatusNotFound
+			}
+			if code := send(http.MethodPut, fmt.Sprintf("%s/%d", res.path, colleague), `{"name":"changed"}`); code != want {
+				t.Errorf("%s: update of a colleague's row = %d, want %d", label, code, want)
+			}
+			send(http.MethodDelete, fmt.Sprintf("%s/%d", res.path, colleague), "")
+			if deleted := name(colleague) == ""; deleted != (scope != model.DataScopeSelf) {
+				t.Errorf("%s: colleague's row deleted = %v", label, deleted)
+			}
+		}
+	}
+}
+
+func TestOrganizationReadsStayInDataScope(t *testing.T) {
+	setupTestDB(t)
+	company := createTestOrg(t, "Read Co", nil)
+	ops := createTestOrg(t, "Read Ops", &company)
+	team := createTestOrg(t, "Read Ops Team", &ops)
+	sales := createTestOrg(t, "Read Sales", &company)
+
+	get := func(user *model.User, path string, out interface{}) int {
+		t.Helper()
+		r := gin.New()
+		r.Use(signedIn(user))
+		h := NewOrganizationHandler()
+		r.GET("/organizations", h.GetOrganizations)
+		r.GET("/organizations/tree", h.GetOrganizationTree)
+		r.GET("/organizations/:id", h.GetOrganization)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code == http.StatusOK && out != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code
+	}
+	ids := func(orgs []model.Organization) string {
+		var list []string
+		for _, o := range orgs {
+			list = append(list, fmt.Sprint(o.ID))
+		}
+		return strings.Join(list, ",")
+	}
+	ofOrgs := func(orgs ...model.Organization) string { return ids(orgs) }
+
+	// The department scope sees its subtree, rooted at its own organization
+	dept := createScopedUser(t, "orgread.dept", model.DataScopeDepartment, ops.ID)
+	var tree []OrganizationNode
+	if code := get(dept, "/organizations/tree", &tree); code != http.StatusOK {
+		t.Fatalf("tree: %d", code)
+	}
+	if len(tree) != 1 || tree[0].ID != ops.ID || len(tree[0].Children) != 1 || tree[0].Children[0].ID != team.ID {
+		t.Fatalf("department tree = %+v, want ops with its team", tree)
+	}
+	var list []model.Organization
+	if code := get(dept, "/organizations", &list); code != http.StatusOK || ids(list) != ofOrgs(ops, team) {
+		t.Fatalf("department list: %d %v, want ops and team", code, ids(list))
+	}
+	list = nil
+	if code := get(dept, fmt.Sprintf("/organizations?root=%d", ops.ID), &list); code != http.StatusOK || ids(list) != ofOrgs(ops, team) {
+		t.Fatalf("department list under ops: %d %v", code, ids(list))
+	}
+	for _, org := range []model.Organization{company, sales} {
+		if code := get(dept, fmt.Sprintf("/organizations/%d", org.ID), nil); code != http.StatusNotFound {
+			t.Fatalf("department got %s: %d, want 404", org.Name, code)
+		}
+		if code := get(dept, fmt.Sprintf("/organizations?root=%d", org.ID), nil); code != http.StatusNotFound {
+			t.Fatalf("department listed under %s: %d, want 404", org.Name, code)
+		}
+	}
+	var got model.Organization
+	if code := get(dept, fmt.Sprintf("/organizations/%d", team.ID), &got); code != http.StatusOK || got.ID != team.ID {
+		t.Fatalf("department get team: %d %+v", code, got)
+	}
+
+	// The self scope sees no organization
+	self := createScopedUser(t, "orgread.self", model.DataScopeSelf, ops.ID)
+	tree, list = nil, nil
+	if code := get(self, "/organizations/tree", &tree); code != http.StatusOK || len(tree) != 0 {
+		t.Fatalf("self tree: %d %+v, want empty", code, tree)
+	}
+	if code := get(self, "/organizations", &list); code != http.StatusOK || len(list) != 0 {
+		t.Fatalf("self list: %d %v, want empty", code, ids(list))
+	}
+	if code := get(self, fmt.Sprintf("/organizations/%d", ops.ID), nil); code != http.StatusNotFound {
+		t.Fatalf("self got its organization: %d, want 404", code)
+	}
+
+	// The all scope sees the whole company
+	tree = nil
+	if code := get(findUser(t, "admin"), "/organizations/tree", &tree); code != http.StatusOK {
+		t.Fatalf("admin tree: %d", code)
+	}
+	var root *OrganizationNode
+	for i := range tree {
+		if tree[i].ID == company.ID {
+			root = &tree[i]
+		}
+	}
+	if root == nil || len(root.Children) != 2 {
+		t.Fatalf("admin tree lacks the company with ops and sales: %+v", tree)
+	}
+}
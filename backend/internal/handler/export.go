@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/xlsx"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Export formats
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatXLSX   = "xlsx"
+	ExportFormatNDJSON = "ndjson"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ExportFormatNDJSON: "application/x-ndjson",
+}
+
+// exportFlushEvery rows between flushes of the response writer
+const exportFlushEvery = 500
+
+// rowWriter writes one export format; header is called once before any row
+type rowWriter interface {
+	header(columns []string) error
+	row(values []interface{}) error
+	close() error
+}
+
+// ExportAssets 导出资产
+func (h *AssetHandler) ExportAssets(c *gin.Context) {
+	respondExport(c, data.DB.WithContext(c).Model(&model.Asset{}), assetListSpec, "assets")
+}
+
+// ExportContracts 导出合同
+func (h *ContractHandler) ExportContracts(c *gin.Context) {
+	respondExport(c, data.DB.WithContext(c).Model(&model.Contract{}), contractListSpec, "contracts")
+}
+
+// ExportInterfaces 导出接口
+func (h *InterfaceHandler) ExportInterfaces(c *gin.Context) {
+	respondExport(c, data.DB.WithContext(c).Model(&model.SystemInterface{}), interfaceListSpec, "interfaces")
+}
+
+// respondExport streams every row matching the list filters as a download.
+//
+//	?format=csv|xlsx|ndjson      defaults to csv
+//	?columns=name,ip,status      subset and order of spec.ExportColumns
+//
+// Filters, ?q= and ?sort= behave as on the list endpoint; paging is ignored.
+// Rows are read from a database cursor and written as they are scanned.
+func respondExport(c *gin.Context, query *gorm.DB, spec ListSpec, name string) {
+	format := strings.ToLower(c.DefaultQuery("format", ExportFormatCSV))
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, xlsx or ndjson"})
+		return
+	}
+
+	columns := spec.ExportColumns
+	if v := c.Query("columns"); v != "" {
+		columns = nil
+		for _, col := range strings.Split(v, ",") {
+			col = strings.TrimSpace(col)
+			if !contains(spec.ExportColumns, col) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot export column %s", col)})
+				return
+			}
+			if !contains(columns, col) {
+				columns = append(columns, col)
+			}
+		}
+	}
+
+	params, err := parseListParams(c, spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query = applyFilters(c, query, spec)
+	if spec.ScopeColumn != "" {
+		if query, err = scopeList(c, query, spec); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	query = query.Select(columns).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: params.Sort}, Desc: params.Desc})
+	if params.Sort != "id" {
+		query = query.Order("id")
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// Past this point the status is sent; errors can only cut the download short
+	w, err := newRowWriter(format, c.Writer, name)
+	if err == nil {
+		err = w.header(columns)
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for n := 1; err == nil && rows.Next(); n++ {
+		if err = rows.Scan(ptrs...); err != nil {
+			break
+		}
+		for i, v := range values {
+			values[i] = exportValue(v)
+		}
+		if err = w.row(values); err != nil {
+			break
+		}
+		if n%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		log.Printf("Export %s aborted: %v", name, err)
+		return
+	}
+	c.Writer.Flush()
+}
+
+// exportValue normalizes driver values: text columns can arrive as []byte
+func exportValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+func newRowWriter(format string, w http.ResponseWriter, sheet string) (rowWriter, error) {
+	switch format {
+	case ExportFormatXLSX:
+		xw, err := xlsx.NewWriter(w, sheet)
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxRowWriter{w: xw}, nil
+	case ExportFormatNDJSON:
+		return &ndjsonRowWriter{w: bufio.NewWriter(w)}, nil
+	default:
+		// UTF-8 BOM so Excel opens non-ASCII text correctly
+		if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+			return nil, err
+		}
+		return &csvRowWriter{w: csv.NewWriter(w)}, nil
+	}
+}
+
+type csvRowWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (w *csvRowWriter) header(columns []string) error {
+	w.record = make([]string, len(columns))
+	return w.w.Write(columns)
+}
+
+func (w *csvRowWriter) row(values []interface{}) error {
+	for i, v := range values {
+		switch t := v.(type) {
+		case nil:
+			w.record[i] = ""
+		case float64:
+			w.record[i] = strconv.FormatFloat(t, 'f', -1, 64)
+		case string:
+			w.record[i] = csvText(t)
+		default:
+			w.record[i] = fmt.Sprint(t)
+		}
+	}
+	return w.w.Write(w.record)
+}
+
+// csvText prefixes text that a spreadsheet would run as a formula with a
+// quote, so a name like "=HYPERLINK(...)" stays text when the file is
+// opened in Excel. XLSX exports write inline strings, which never are.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (w *csvRowWriter) close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type xlsxRowWriter struct {
+	w *xlsx.Writer
+}
+
+func (w *xlsxRowWriter) header(columns []string) error {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = col
+	}
+	return w.w.WriteRow(values)
+}
+
+func (w *xlsxRowWriter) row(values []interface{}) error { return w.w.WriteRow(values) }
+
+func (w *xlsxRowWriter) close() error { return w.w.Close() }
+
+// ndjsonRowWriter writes one JSON object per line, keys in column order
+type ndjsonRowWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (w *ndjsonRowWriter) header(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+func (w *ndjsonRowWriter) row(values []interface{}) error {
+	w.w.WriteByte('{')
+	for i, col := range w.columns {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(col)
+		val, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		w.w.Write(key)
+		w.w.WriteByte(':')
+		w.w.Write(val)
+	}
+	_, err := w.w.WriteString("}\n")
+	return err
+}
+
+func (w *ndjsonRowWriter) close() error { return w.w.Flush() }
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCSVExportNeutralizesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w := &csvRowWriter{w: csv.NewWriter(&buf)}
+	if err := w.header([]string{"name", "owner", "amount", "note"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{"=HYPERLINK(\"http://evil.example.com\",\"x\")", "+cmd|' /C calc'!A0", -12.5, "@SUM(A1:A9)"},
+		{"-2+3", "\tTAB", 7.0, "\r=1"},
+		{"db-01", "Ann", nil, "a=b"},
+	}
+	for _, row := range rows {
+		if err := w.row(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "owner", "amount", "note"},
+		{"'=HYPERLINK(\"http://evil.example.com\",\"x\")", "'+cmd|' /C calc'!A0", "-12.5", "'@SUM(A1:A9)"},
+		{"'-2+3", "'\tTAB", "7", "'\r=1"},
+		{"db-01", "Ann", "", "a=b"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("%d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("record %d column %d = %q, want %q", i, j, records[i][j], want[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"itam-backend/internal/audit"
+	"itam-backend/internal/data"
+	"itam-backend/internal/identity"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondAuthError answers a failed login
+func respondAuthError(c *gin.Context, err error) {
+	var ie *identity.Error
+	if errors.As(err, &ie) {
+		c.JSON(ie.Status, gin.H{"error": ie.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// provisionExternalUser maps an external identity to its local account,
+// recording the changes under the identity's name
+func provisionExternalUser(c *gin.Context, id *identity.Identity, policy identity.Policy) (*model.User, error) {
+	ctx := context.WithValue(c, audit.ActorKey, audit.Actor{
+		Username:  id.Source + ":" + id.Username,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	return identity.Provision(ctx, id, policy)
+}
+
+// checkLogin checks the account and its tenant may sign in
+func checkLogin(user *model.User) error {
+	if !user.IsActive() {
+		return &identity.Error{Status: http.StatusForbidden, Message: "Account is disabled"}
+	}
+	if user.LockedAt(time.Now()) {
+		return &identity.Error{Status: http.StatusLocked, Message: "Account is locked"}
+	}
+	var t model.Tenant
+	if err := data.DB.First(&t, user.TenantID).Error; err != nil || !t.IsActive() {
+		return &identity.Error{Status: http.StatusForbidden, Message: "Tenant is disabled"}
+	}
+	return nil
+}
+
+// completeLogin checks the account and its tenant may sign in, records
+// the login and starts a session
+func completeLogin(c *gin.Context, user *model.User) (*LoginResponse, error) {
+	if err := checkLogin(user); err != nil {
+		return nil, err
+	}
+
+	data.DB.WithContext(tenant.WithTenant(c, user.TenantID)).Model(user).Updates(map[string]interface{}{
+		"last_login_at": time.Now(),
+		"last_login_ip": c.ClientIP(),
+	})
+
+	resp, err := issueSession(c, user)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+	return resp, nil
+}
@@ -2,12 +2,21 @@ package handler
 
 import (
 	"itam-backend/internal/data"
+	"itam-backend/internal/event"
 	"itam-backend/internal/model"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+var interfaceListSpec = ListSpec{
+	SortColumns:   []string{"name", "method", "url", "status", "created_at", "updated_at"},
+	FilterColumns: []string{"name", "method", "status"},
+	SearchColumns: []string{"name", "url", "description"},
+	DefaultSort:   "id",
+	ExportColumns: []string{"id", "name", "method", "url", "status", "description", "created_at", "updated_at"},
+}
+
 type InterfaceHandler struct{}
 
 func NewInterfaceHandler() *InterfaceHandler {
@@ -17,19 +26,14 @@ func NewInterfaceHandler() *InterfaceHandler {
 // GetInterfaces 获取所有接口列表
 func (h *InterfaceHandler) GetInterfaces(c *gin.Context) {
 	var interfaces []model.SystemInterface
-	result := data.DB.Find(&interfaces)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, interfaces)
+	respondList(c, data.DB.WithContext(c).Model(&model.SystemInterface{}), interfaceListSpec, &interfaces)
 }
 
 // GetInterface 获取单个接口详情
 func (h *InterfaceHandler) GetInterface(c *gin.Context) {
 	id := c.Param("id")
 	var iface model.SystemInterface
-	if err := data.DB.First(&iface, id).Error; err != nil {
+	if err := data.DB.WithContext(c).First(&iface, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Interface not found"})
 		return
 	}
@@ -44,11 +48,12 @@ func (h *InterfaceHandler) CreateInterface(c *gin.Context) {
 		return
 	}
 
-	result := data.DB.Create(&iface)
+	result := data.DB.WithContext(c).Create(&iface)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	event.Publish(c, event.InterfaceCreated, iface.TenantID, iface)
 	c.JSON(http.StatusOK, iface)
 }
 
@@ -57,26 +62,39 @@ func (h *InterfaceHandler) UpdateInterface(c *gin.Context) {
 	var iface model.SystemInterface
 	id := c.Param("id")
 
-	if err := data.DB.First(&iface, id).Error; err != nil {
+	if err := data.DB.WithContext(c).First(&iface, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Interface not found"})
 		return
 	}
 
+	stored := iface.Model
 	if err := c.ShouldBindJSON(&iface); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The path picks the row, never an id in the body
+	iface.Model = stored
 
-	data.DB.Save(&iface)
+	if err := updateByID(data.DB.WithContext(c), &iface, stored.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	event.Publish(c, event.InterfaceUpdated, iface.TenantID, iface)
 	c.JSON(http.StatusOK, iface)
 }
 
 // DeleteInterface 删除接口
 func (h *InterfaceHandler) DeleteInterface(c *gin.Context) {
 	id := c.Param("id")
-	if err := data.DB.Delete(&model.SystemInterface{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+
+	// Load it first so the event carries what was deleted
+	var iface model.SystemInterface
+	if err := data.DB.WithContext(c).First(&iface, id).Error; err == nil {
+		if err := data.DB.WithContext(c).Delete(&model.SystemInterface{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		event.Publish(c, event.InterfaceDeleted, iface.TenantID, iface)
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Interface deleted"})
 }
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"itam-backend/internal/audit"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"itam-backend/internal/tenant"
+	"itam-backend/internal/throttle"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LockoutHandler guards logins against password guessing and lets admins
+// unlock accounts
+type LockoutHandler struct {
+	cfg     *conf.LockoutConfig
+	notify  *notification.Service
+	backoff *throttle.Backoff
+}
+
+func NewLockoutHandler(cfg *conf.LockoutConfig, notify *notification.Service) *LockoutHandler {
+	return &LockoutHandler{
+		cfg:     cfg,
+		notify:  notify,
+		backoff: throttle.New(cfg.BaseDelay, cfg.MaxDelay, cfg.Window),
+	}
+}
+
+// throttled answers 429 while the username or client IP is backing off
+func (h *LockoutHandler) throttled(c *gin.Context, username string) bool {
+	now := time.Now()
+	wait := h.backoff.Wait("user:"+username, h.cfg.FreeAttempts, now)
+	if w := h.backoff.Wait("ip:"+c.ClientIP(), h.cfg.IPFreeAttempts, now); w > wait {
+		wait = w
+	}
+	if wait <= 0 {
+		return false
+	}
+	secs := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later", "retry_after": secs})
+	return true
+}
+
+// account returns the user with the username, whatever its source
+func (h *LockoutHandler) account(c *gin.Context, username string) *model.User {
+	var user model.User
+	if err := data.DB.WithContext(tenant.WithAll(c)).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil
+	}
+	return &user
+}
+
+// locked answers 423 when the account is locked. It runs before the
+// password is checked, so the answer does not tell whether it was right.
+func (h *LockoutHandler) locked(c *gin.Context, user *model.User) bool {
+	if user == nil || !user.LockedAt(time.Now()) {
+		return false
+	}
+	c.JSON(http.StatusLocked, gin.H{"error": "Account is locked", "locked_until": user.LockedUntil})
+	return true
+}
+
+// fail records a failed login of username from the client, locking the
+// account once it reaches the configured number of consecutive failures
+func (h *LockoutHandler) fail(c *gin.Context, username string, user *model.User) {
+	now := time.Now()
+	h.backoff.Fail("user:"+username, now)
+	h.backoff.Fail("ip:"+c.ClientIP(), now)
+	if user != nil {
+		h.failAccount(c, user)
+	}
+}
+
+// failAccount counts a failure against the account itself, also used for
+// wrong second factor codes
+func (h *LockoutHandler) failAccount(c *gin.Context, user *model.User) {
+	// Counting is not audited, only the lock itself
+	db := data.DB.WithContext(tenant.WithTenant(c.Request.Context(), user.TenantID))
+	now := time.Now()
+
+	// A lock that ran out starts the count over
+	if user.IsLocked && !user.LockedAt(now) {
+		db.Model(&model.User{}).Where("id = ? AND is_locked = ? AND locked_until < ?", user.ID, true, now).
+			Updates(map[string]interface{}{"is_locked": false, "locked_until": nil, "failed_logins": 0})
+	}
+	if err := db.Model(&model.User{}).Where("id = ?", user.ID).
+		UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+		log.Printf("Lockout: failed to count login failure of %s: %v", user.Username, err)
+		return
+	}
+
+	var failures int
+	db.Model(&model.User{}).Where("id = ?", user.ID).Pluck("failed_logins", &failures)
+	if h.cfg.MaxAttempts <= 0 || failures < h.cfg.MaxAttempts {
+		return
+	}
+
+	updates := map[string]interface{}{"is_locked": true, "locked_until": nil}
+	until := "an administrator unlocks it"
+	if h.cfg.LockDuration > 0 {
+		t := now.Add(h.cfg.LockDuration)
+		updates["locked_until"] = t
+		until = t.Format("2006-01-02 15:04:05")
+	}
+	ctx := context.WithValue(tenant.WithTenant(c, user.TenantID), audit.ActorKey, audit.Actor{
+		Username:  "system",
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	// Only the request that flips the flag sends the notification
+	res := data.DB.WithContext(ctx).Model(&model.User{}).Where("id = ? AND is_locked = ?", user.ID, false).Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+	log.Printf("Lockout: account %s locked after %d failed logins from %s", user.Username, failures, c.ClientIP())
+	if err := h.notify.Send(notification.Message{
+		Kind:  notification.KindAccountLocked,
+		Title: "Account Locked",
+		Content: fmt.Sprintf("Account %s was locked after %d failed login attempts, the last from %s. Locked until %s.",
+			user.Username, failures, c.ClientIP(), until),
+		Severity:   notification.SeverityCritical,
+		TenantID:   user.TenantID,
+		Recipients: []string{user.Username},
+		Data: map[string]interface{}{
+			"Username": user.Username,
+			"Failures": failures,
+			"IP":       c.ClientIP(),
+			"Until":    until,
+		},
+	}); err != nil {
+		log.Printf("Lockout: %v", err)
+	}
+}
+
+// succeed clears the failures of a successful login
+func (h *LockoutHandler) succeed(c *gin.Context, username string, user *model.User) {
+	h.backoff.Reset("user:" + username)
+	if user.FailedLogins == 0 && !user.IsLocked {
+		return
+	}
+	data.DB.WithContext(tenant.WithTenant(c.Request.Context(), user.TenantID)).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"is_locked": false, "locked_until": nil, "failed_logins": 0})
+}
+
+// UnlockUser 解锁因登录失败被锁定的账号
+func (h *LockoutHandler) UnlockUser(c *gin.Context) {
+	user, ok := scopedUser(c)
+	if !ok {
+		return
+	}
+	if err := data.DB.WithContext(c).Model(user).Updates(map[string]interface{}{
+		"is_locked":     false,
+		"locked_until":  nil,
+		"failed_logins": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.backoff.Reset("user:" + user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lockoutFlow serves login, refresh and unlock with the given lockout
+// policy, trusting no proxy like the server does by default
+type lockoutFlow struct {
+	*gin.Engine
+	t *testing.T
+}
+
+func newLockoutFlow(t *testing.T, cfg conf.LockoutConfig) *lockoutFlow {
+	setupTestDB(t)
+	lockout := NewLockoutHandler(&cfg, notification.NewService(&conf.NotificationConfig{}))
+	auth := NewAuthHandler(&conf.AuthConfig{Authenticators: []string{model.AuthSourceLocal}},
+		NewMFAHandler(&conf.MFAConfig{}, lockout), lockout)
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	r.POST("/login", auth.Login)
+	r.POST("/refresh", auth.Refresh)
+	r.POST("/users/:id/unlock", signedIn(findUser(t, "admin")), lockout.UnlockUser)
+	return &lockoutFlow{Engine: r, t: t}
+}
+
+// post sends body from the client address, claiming forwardedFor if set
+func (f *lockoutFlow) post(path, body, remote, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remote + ":40000"
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, req)
+	return w
+}
+
+func (f *lockoutFlow) login(username, password, remote string) *httptest.ResponseRecorder {
+	return f.post("/login", fmt.Sprintf(`{"username":%q,"password":%q}`, username, password), remote, "")
+}
+
+func TestLoginBackoff(t *testing.T) {
+	f := newLockoutFlow(t, conf.LockoutConfig{FreeAttempts: 2, IPFreeAttempts: 4,
+		BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+	createTestUser(t, "backoff.amy", "user", nil)
+	createTestUser(t, "backoff.bob", "user", nil)
+
+	// The free failures and one more, then even the right password waits
+	for i := 0; i < 3; i++ {
+		if w := f.login("backoff.amy", "wrong", "192.0.2.10"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: %d %s", i+1, w.Code, w.Body)
+		}
+	}
+	w := f.login("backoff.amy", "secret123", "192.0.2.11")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("after the free failures: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := f.login("backoff.bob", "secret123", "192.0.2.11"); w.Code != http.StatusOK {
+		t.Fatalf("other user: %d %s", w.Code, w.Body)
+	}
+
+	// Guessing across usernames backs the client address off, whatever
+	// address it claims to forward for
+	for i := 0; i < 5; i++ {
+		f.post("/login", fmt.Sprintf(`{"username":"nobody.%d","password":"wrong"}`, i), "198.51.100.20", fmt.Sprintf("10.0.0.%d", i))
+	}
+	if w := f.post("/login", `{"username":"backoff.bob","password":"secret123"}`, "198.51.100.20", "10.0.0.99"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("client address after the free failures: %d %s", w.Code, w.Body)
+	}
+	if w := f.login("backoff.bob", "secret123", "198.51.100.21"); w.Code != http.StatusOK {
+		t.Fatalf("other address: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLockoutAndUnlock(t *testing.T) {
+	f := newLockoutFlow(t, conf.LockoutConfig{MaxAttempts: 3, FreeAttempts: 100, IPFreeAttempts: 100,
+		BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+	user := createTestUser(t, "lockout.cat", "user", nil)
+
+	w := f.login(user.Username, "secret123", "192.0.2.30")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	var resp LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	for i := 0; i < 3; i++ {
+		f.login(user.Username, "wrong", "192.0.2.30")
+	}
+	if w := f.login(user.Username, "secret123", "192.0.2.30"); w.Code != http.StatusLocked {
+		t.Fatalf("right password on a locked account: %d %s", w.Code, w.Body)
+	}
+	// Sessions from before the lock get no new tokens either
+	refresh := fmt.Sprintf(`{"refresh_token":%q}`, resp.RefreshToken)
+	if w := f.post("/refresh", refresh, "192.0.2.30", ""); w.Code != http.StatusLocked {
+		t.Fatalf("refresh on a locked account: %d %s", w.Code, w.Body)
+	}
+
+	if w := f.post(fmt.Sprintf("/users/%d/unlock", user.ID), "", "192.0.2.1", ""); w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", w.Code, w.Body)
+	}
+	if w := f.post("/refresh", refresh, "192.0.2.30", ""); w.Code != http.StatusOK {
+		t.Fatalf("refresh after unlock: %d %s", w.Code, w.Body)
+	}
+	if w := f.login(user.Username, "secret123", "192.0.2.30"); w.Code != http.StatusOK {
+		t.Fatalf("login after unlock: %d %s", w.Code, w.Body)
+	}
+	if u := findUser(t, user.Username); u.IsLocked || u.FailedLogins != 0 {
+		t.Fatalf("after unlock: locked %v with %d failures", u.IsLocked, u.FailedLogins)
+	}
+}
@@ -0,0 +1,434 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"itam-backend/internal/audit"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/identity"
+	"itam-backend/internal/mfa"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const mfaChallengeAud = "itam-mfa-challenge"
+
+// mfaChallenge is handed out after a correct password when a second
+// factor is needed; its jti makes it single use
+type mfaChallenge struct {
+	UserID uint `json:"uid"`
+	jwt.RegisteredClaims
+}
+
+// MFAChallengeResponse login response when a TOTP code is still needed
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	MFAEnrolled    bool   `json:"mfa_enrolled"` // false: set up an authenticator first, see /auth/mfa/challenge/setup
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+}
+
+// MFAChallengeRequest second login step
+type MFAChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"` // TOTP or recovery code
+}
+
+// MFACodeRequest request body carrying a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFASetupResponse a new, not yet verified TOTP secret
+type MFASetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// URI to render as a QR code
+}
+
+// MFAHandler TOTP two-factor authentication
+type MFAHandler struct {
+	cfg     *conf.MFAConfig
+	lockout *LockoutHandler
+}
+
+func NewMFAHandler(cfg *conf.MFAConfig, lockout *LockoutHandler) *MFAHandler {
+	return &MFAHandler{cfg: cfg, lockout: lockout}
+}
+
+// enforced reports whether policy makes MFA mandatory for the user
+func (h *MFAHandler) enforced(user *model.User) bool {
+	if !h.cfg.EnforcePrivileged {
+		return false
+	}
+	var role model.Role
+	if err := data.DB.Where("name = ?", user.Role).First(&role).Error; err != nil {
+		return false
+	}
+	return role.IsPrivileged()
+}
+
+// required reports whether a password login needs a second factor
+func (h *MFAHandler) required(user *model.User) bool {
+	return user.MFAEnabled || h.enforced(user)
+}
+
+// challenge starts the second login step for user
+func (h *MFAHandler) challenge(user *model.User) (*MFAChallengeResponse, error) {
+	token, err := middleware.SignClaims(mfaChallenge{
+		UserID: user.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.NewID(),
+			Audience:  jwt.ClaimStrings{mfaChallengeAud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.cfg.ChallengeTTL)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallengeResponse{
+		MFARequired:    true,
+		MFAEnrolled:    user.MFAEnabled,
+		ChallengeToken: token,
+		ExpiresIn:      int64(h.cfg.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+// parseChallenge returns the user of a challenge token
+func (h *MFAHandler) parseChallenge(c *gin.Context, token string) (*mfaChallenge, *model.User, bool) {
+	var ch mfaChallenge
+	if err := middleware.ParseClaims(token, &ch, jwt.WithAudience(mfaChallengeAud)); err != nil || ch.ID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge, sign in again"})
+		return nil, nil, false
+	}
+	revoked, err := session.Default.IsRevoked(ch.ID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return nil, nil, false
+	}
+	var user model.User
+	if revoked || data.DB.WithContext(tenant.WithAll(c)).First(&user, ch.UserID).Error != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge, sign in again"})
+		return nil, nil, false
+	}
+	return &ch, &user, true
+}
+
+// Challenge 登录第二步：校验验证码并签发令牌。未绑定的用户在此完成绑定，
+// 响应中附带恢复码。
+func (h *MFAHandler) Challenge(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ch, user, ok := h.parseChallenge(c, req.ChallengeToken)
+	if !ok || h.lockout.locked(c, user) {
+		return
+	}
+
+	// Wrong codes count towards the account lockout like wrong passwords
+	var codes []string
+	if user.MFAEnabled {
+		ok, err := verifyMFACode(c, user, req.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ok {
+			h.lockout.failAccount(c, user)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+			return
+		}
+	} else {
+		var err error
+		codes, err = h.enable(userContext(c, user), user, req.Code)
+		var ie *identity.Error
+		if errors.As(err, &ie) && ie.Status == http.StatusUnauthorized {
+			h.lockout.failAccount(c, user)
+		}
+		if err != nil {
+			respondAuthError(c, err)
+			return
+		}
+	}
+	h.lockout.succeed(c, user.Username, user)
+
+	// Spend the challenge so it cannot start a second session
+	if err := session.Default.Revoke(ch.ID, ch.ExpiresAt.Time); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+
+	resp, err := completeLogin(c, user)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	resp.RecoveryCodes = codes
+	c.JSON(http.StatusOK, resp)
+}
+
+// ChallengeSetup 登录时强制绑定：为尚未启用两步验证的用户生成密钥
+func (h *MFAHandler) ChallengeSetup(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, user, ok := h.parseChallenge(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	h.setup(c, userContext(c, user), user)
+}
+
+// GetStatus 当前用户的两步验证状态
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	var remaining int64
+	data.DB.Model(&model.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.MFAEnabled,
+		"required":                 h.enforced(user),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Setup 生成新的 TOTP 密钥，验证后才生效
+func (h *MFAHandler) Setup(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	h.setup(c, c, user)
+}
+
+// Enable 验证新密钥并启用两步验证，返回恢复码
+func (h *MFAHandler) Enable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	codes, err := h.enable(c, user, req.Code)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	revokeOtherSessions(c, user.ID)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable 关闭两步验证，策略要求的角色不能关闭
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if h.enforced(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if ok, err := verifyMFACode(c, user, req.Code); err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+	if err := resetMFA(data.DB.WithContext(c), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes 作废旧恢复码并生成新的一组
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	// Only a TOTP code, a recovery code must not mint new ones
+	step, ok := mfa.Validate(user.MFASecret, req.Code, time.Now(), user.MFALastStep)
+	if !ok || !spendStep(c, user, step) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+	var codes []string
+	err := data.DB.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = h.replaceRecoveryCodes(tx, user)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *MFAHandler) setup(c *gin.Context, ctx context.Context, user *model.User) {
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := data.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"mfa_secret":    secret,
+		"mfa_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MFASetupResponse{
+		Secret: secret,
+		URI:    mfa.ProvisioningURI(h.cfg.Issuer, user.Username, secret),
+	})
+}
+
+// enable turns MFA on once code proves the pending secret was set up,
+// returning the new recovery codes
+func (h *MFAHandler) enable(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, &identity.Error{Status: http.StatusConflict, Message: "Two-factor authentication is already enabled"}
+	}
+	if user.MFASecret == "" {
+		return nil, &identity.Error{Status: http.StatusBadRequest, Message: "Set up an authenticator first"}
+	}
+	step, ok := mfa.Validate(user.MFASecret, code, time.Now(), user.MFALastStep)
+	if !ok {
+		return nil, &identity.Error{Status: http.StatusUnauthorized, Message: "Invalid verification code"}
+	}
+
+	var codes []string
+	err := data.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled":   true,
+			"mfa_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = h.replaceRecoveryCodes(tx, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (h *MFAHandler) replaceRecoveryCodes(tx *gorm.DB, user *model.User) ([]string, error) {
+	if err := tx.Where("user_id = ?", user.ID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes, err := mfa.GenerateRecoveryCodes(h.cfg.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]model.MFARecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = model.MFARecoveryCode{UserID: user.ID, SecretHash: mfa.HashRecoveryCode(code)}
+	}
+	if len(rows) > 0 {
+		if err := tx.Create(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// verifyMFACode accepts a TOTP code or an unused recovery code, each only
+// once
+func verifyMFACode(c *gin.Context, user *model.User, code string) (bool, error) {
+	if step, ok := mfa.Validate(user.MFASecret, code, time.Now(), user.MFALastStep); ok {
+		return spendStep(c, user, step), nil
+	}
+	if code == "" {
+		return false, nil
+	}
+	res := data.DB.WithContext(userContext(c, user)).Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND secret_hash = ? AND used_at IS NULL", user.ID, mfa.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return res.RowsAffected == 1, res.Error
+}
+
+// spendStep records step as used; it fails when a concurrent request got
+// there first. Not audited, it changes on every login.
+func spendStep(c *gin.Context, user *model.User, step int64) bool {
+	res := data.DB.WithContext(tenant.WithTenant(c.Request.Context(), user.TenantID)).Model(&model.User{}).
+		Where("id = ? AND mfa_last_step < ?", user.ID, step).
+		Update("mfa_last_step", step)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// resetMFA turns MFA off and drops the secret and recovery codes
+func resetMFA(db *gorm.DB, user *model.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled":   false,
+			"mfa_secret":    "",
+			"mfa_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.MFARecoveryCode{}).Error
+	})
+}
+
+// currentUser loads the signed-in user
+func currentUser(c *gin.Context) (*model.User, bool) {
+	var user model.User
+	if err := data.DB.WithContext(c).First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// userContext is the database context for changes a user makes to their
+// own account before they hold a token
+func userContext(c *gin.Context, user *model.User) context.Context {
+	return context.WithValue(tenant.WithTenant(c, user.TenantID), audit.ActorKey, audit.Actor{
+		UserID:    user.ID,
+		Username:  user.Username,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+}
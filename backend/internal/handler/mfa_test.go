@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/mfa"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mfaFlow serves the password and second factor login steps, and a route
+// that checks access tokens
+type mfaFlow struct {
+	*gin.Engine
+	t *testing.T
+}
+
+func newMFAFlow(t *testing.T, enforce bool) *mfaFlow {
+	setupTestDB(t)
+	notify := notification.NewService(&conf.NotificationConfig{})
+	lockout := NewLockoutHandler(&conf.LockoutConfig{}, notify)
+	h := NewMFAHandler(&conf.MFAConfig{Issuer: "ITAM", EnforcePrivileged: enforce, ChallengeTTL: 5 * time.Minute, RecoveryCodes: 3}, lockout)
+	auth := NewAuthHandler(&conf.AuthConfig{Authenticators: []string{model.AuthSourceLocal}}, h, lockout)
+
+	r := gin.New()
+	r.POST("/login", auth.Login)
+	r.POST("/mfa/challenge", h.Challenge)
+	r.POST("/mfa/challenge/setup", h.ChallengeSetup)
+	r.GET("/token", middleware.JWTAuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	authed := r.Group("/", middleware.JWTAuthMiddleware(), middleware.TenantContext())
+	authed.POST("/mfa/disable", h.Disable)
+	return &mfaFlow{Engine: r, t: t}
+}
+
+// send posts body, or gets when body is empty, and decodes the reply
+func (f *mfaFlow) send(path, token, body string) (int, map[string]interface{}) {
+	method := http.MethodPost
+	if body == "" {
+		method = http.MethodGet
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, req)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// login runs the password step and returns its reply
+func (f *mfaFlow) login(username string) map[string]interface{} {
+	f.t.Helper()
+	code, resp := f.send("/login", "", fmt.Sprintf(`{"username":%q,"password":"secret123"}`, username))
+	if code != http.StatusOK {
+		f.t.Fatalf("login %s: %d %v", username, code, resp)
+	}
+	return resp
+}
+
+// challenge answers a challenge token with code
+func (f *mfaFlow) challenge(token, code string) (int, map[string]interface{}) {
+	return f.send("/mfa/challenge", "", fmt.Sprintf(`{"challenge_token":%q,"code":%q}`, token, code))
+}
+
+func TestMFAChallenge(t *testing.T) {
+	f := newMFAFlow(t, true)
+	role := createTestRole(t, "mfa-writer", model.DataScopeAll, model.PermAssetWrite)
+	user := createTestUser(t, "mfa.fay", role.Name, nil)
+
+	// Policy sends the writer to enroll before any token is issued
+	resp := f.login(user.Username)
+	if resp["mfa_required"] != true || resp["mfa_enrolled"] != false || resp["token"] != nil {
+		t.Fatalf("password step: %v", resp)
+	}
+	challenge, _ := resp["challenge_token"].(string)
+
+	// The challenge is no access token
+	if code, _ := f.send("/token", challenge, ""); code != http.StatusUnauthorized {
+		t.Fatalf("challenge as access token: %d", code)
+	}
+
+	code, setup := f.send("/mfa/challenge/setup", "", fmt.Sprintf(`{"challenge_token":%q}`, challenge))
+	if code != http.StatusOK {
+		t.Fatalf("setup: %d %v", code, setup)
+	}
+	secret, _ := setup["secret"].(string)
+	totp, err := mfa.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, resp = f.challenge(challenge, totp)
+	if code != http.StatusOK {
+		t.Fatalf("enroll: %d %v", code, resp)
+	}
+	recovery, _ := resp["recovery_codes"].([]interface{})
+	access, _ := resp["token"].(string)
+	if len(recovery) != 3 || access == "" {
+		t.Fatalf("enroll: %d recovery codes, token %q", len(recovery), access)
+	}
+
+	// Neither the spent challenge nor an access token starts another login,
+	// even with a good code
+	if code, _ := f.challenge(challenge, recovery[2].(string)); code != http.StatusUnauthorized {
+		t.Fatalf("spent challenge: %d", code)
+	}
+	if code, _ := f.challenge(access, recovery[2].(string)); code != http.StatusUnauthorized {
+		t.Fatalf("access token as challenge: %d", code)
+	}
+	if code, _ := f.send("/token", access, ""); code != http.StatusOK {
+		t.Fatalf("access token: %d", code)
+	}
+
+	// A TOTP code and a recovery code each work once
+	resp = f.login(user.Username)
+	if resp["mfa_enrolled"] != true {
+		t.Fatalf("enrolled login: %v", resp)
+	}
+	if code, _ := f.challenge(resp["challenge_token"].(string), totp); code != http.StatusUnauthorized {
+		t.Fatalf("used TOTP code: %d", code)
+	}
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		challenge := f.login(user.Username)["challenge_token"].(string)
+		if code, resp := f.challenge(challenge, recovery[0].(string)); code != want {
+			t.Fatalf("recovery code, use %d: %d %v", i+1, code, resp)
+		}
+	}
+	if code, _ := f.challenge(f.login(user.Username)["challenge_token"].(string), recovery[1].(string)); code != http.StatusOK {
+		t.Fatalf("another recovery code: %d", code)
+	}
+}
+
+func TestMFAPolicyForPrivilegedRoles(t *testing.T) {
+	setupTestDB(t)
+	reader := createTestUser(t, "mfa.gus", createTestRole(t, "mfa-reader", model.DataScopeAll, model.PermAssetRead).Name, nil)
+	writer := createTestUser(t, "mfa.hal", createTestRole(t, "mfa-editor", model.DataScopeAll, model.PermAssetWrite).Name, nil)
+
+	tests := []struct {
+		enforce  bool
+		user     *model.User
+		required bool
+	}{
+		{true, reader, false},
+		{true, writer, true},
+		{false, writer, false},
+	}
+	for _, tt := range tests {
+		resp := newMFAFlow(t, tt.enforce).login(tt.user.Username)
+		if required := resp["mfa_required"] == true; required != tt.required || required == (resp["token"] != nil) {
+			t.Errorf("%s with enforcement %v: %v", tt.user.Username, tt.enforce, resp)
+		}
+	}
+
+	// An enrolled writer cannot turn MFA off while policy requires it
+	f := newMFAFlow(t, true)
+	challenge := f.login(writer.Username)["challenge_token"].(string)
+	_, setup := f.send("/mfa/challenge/setup", "", fmt.Sprintf(`{"challenge_token":%q}`, challenge))
+	totp, _ := mfa.Code(setup["secret"].(string), time.Now())
+	_, resp := f.challenge(challenge, totp)
+	recovery := resp["recovery_codes"].([]interface{})
+	code, _ := f.send("/mfa/disable", resp["token"].(string), fmt.Sprintf(`{"code":%q}`, recovery[0]))
+	if code != http.StatusForbidden {
+		t.Fatalf("disable under policy: %d", code)
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var notificationListSpec = ListSpec{
+	SortColumns:   []string{"created_at"},
+	FilterColumns: []string{"status", "kind", "severity"},
+	DefaultSort:   "-id",
+}
+
+// NotificationHandler the notification outbox and its per-channel deliveries
+type NotificationHandler struct {
+	notify *notification.Service
+}
+
+func NewNotificationHandler(notify *notification.Service) *NotificationHandler {
+	return &NotificationHandler{notify: notify}
+}
+
+// GetNotifications 通知列表（分页），含各渠道的投递状态
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	var notifications []model.Notification
+	query := data.DB.WithContext(c).Model(&model.Notification{}).Preload("Deliveries", deliveriesInOrder)
+	respondList(c, query, notificationListSpec, &notifications)
+}
+
+// GetNotification 通知详情
+func (h *NotificationHandler) GetNotification(c *gin.Context) {
+	var n model.Notification
+	if err := data.DB.WithContext(c).Preload("Deliveries", deliveriesInOrder).First(&n, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, n)
+}
+
+// RetryNotification 重新投递进入死信的渠道
+func (h *NotificationHandler) RetryNotification(c *gin.Context) {
+	var n model.Notification
+	if err := data.DB.WithContext(c).First(&n, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	retried, err := h.notify.Retry(c, n.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if retried == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Notification has no dead-lettered deliveries"})
+		return
+	}
+	data.DB.WithContext(c).Preload("Deliveries", deliveriesInOrder).First(&n, n.ID)
+	c.JSON(http.StatusAccepted, n)
+}
+
+// deliveriesInOrder preloads the channel deliveries in the order they were queued
+func deliveriesInOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
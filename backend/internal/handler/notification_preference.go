@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NotificationPreferenceRequest the current user's notification settings
+type NotificationPreferenceRequest struct {
+	Subscriptions   []string `json:"subscriptions"`     // event types to get by email besides the routed ones, "*" for all
+	MutedEventTypes []string `json:"muted_event_types"` // event types never to get by email
+	MinSeverity     string   `json:"min_severity"`      // skip anything less urgent, empty for no minimum
+	QuietHoursStart string   `json:"quiet_hours_start"` // "HH:MM", set together with quiet_hours_end
+	QuietHoursEnd   string   `json:"quiet_hours_end"`
+	Timezone        string   `json:"timezone"` // IANA name such as "Asia/Shanghai", empty for the server's
+}
+
+// NotificationPreferenceHandler the current user's notification settings
+type NotificationPreferenceHandler struct{}
+
+func NewNotificationPreferenceHandler() *NotificationPreferenceHandler {
+	return &NotificationPreferenceHandler{}
+}
+
+// GetNotificationPreference 当前用户的通知订阅与免打扰设置
+func (h *NotificationPreferenceHandler) GetNotificationPreference(c *gin.Context) {
+	var pref model.NotificationPreference
+	err := data.DB.WithContext(c).Where("user_id = ?", c.GetUint("userID")).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, model.NotificationPreference{TenantID: c.GetUint("tenantID"), UserID: c.GetUint("userID")})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pref)
+}
+
+// UpdateNotificationPreference 更新当前用户的通知订阅与免打扰设置
+func (h *NotificationPreferenceHandler) UpdateNotificationPreference(c *gin.Context) {
+	var req NotificationPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validatePreferenceRequest(c, &req) {
+		return
+	}
+
+	var pref model.NotificationPreference
+	err := data.DB.WithContext(c).Where("user_id = ?", c.GetUint("userID")).First(&pref).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pref.UserID = c.GetUint("userID")
+	pref.Subscriptions = req.Subscriptions
+	pref.MutedEventTypes = req.MutedEventTypes
+	pref.MinSeverity = req.MinSeverity
+	pref.QuietHoursStart = req.QuietHoursStart
+	pref.QuietHoursEnd = req.QuietHoursEnd
+	pref.Timezone = req.Timezone
+	if err := data.DB.WithContext(c).Save(&pref).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pref)
+}
+
+// validatePreferenceRequest writes the error response when req is invalid
+func validatePreferenceRequest(c *gin.Context, req *NotificationPreferenceRequest) bool {
+	for _, k := range req.Subscriptions {
+		if k != "*" && !notification.IsValidKind(k) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type: " + k})
+			return false
+		}
+		// "*" stays allowed; routing only delivers the kinds the user may read
+		if k != "*" && !middleware.HasPermission(c, notification.KindPermission(k)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied for event type: " + k})
+			return false
+		}
+	}
+	for _, k := range req.MutedEventTypes {
+		if !notification.IsValidKind(k) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type: " + k})
+			return false
+		}
+	}
+	if req.MinSeverity != "" && !notification.IsValidSeverity(req.MinSeverity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown severity: " + req.MinSeverity})
+		return false
+	}
+	if (req.QuietHoursStart == "") != (req.QuietHoursEnd == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quiet hours need both a start and an end"})
+		return false
+	}
+	if req.QuietHoursStart != "" {
+		for _, t := range []string{req.QuietHoursStart, req.QuietHoursEnd} {
+			if _, err := notification.ParseClock(t); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return false
+			}
+		}
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone: " + req.Timezone})
+			return false
+		}
+	}
+	return true
+}
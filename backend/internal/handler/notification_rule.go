@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationRuleRequest create / update routing rule request body
+type NotificationRuleRequest struct {
+	Name           string   `json:"name" binding:"required,max=100"`
+	Priority       int      `json:"priority"`
+	Enabled        *bool    `json:"enabled"` // defaults to true
+	EventTypes     []string `json:"event_types"`
+	Severities     []string `json:"severities"`
+	AssetTypes     []string `json:"asset_types"`
+	Platforms      []string `json:"platforms"`
+	Regions        []string `json:"regions"`
+	ContractTypes  []string `json:"contract_types"`
+	Channels       []string `json:"channels"`   // none with stop_processing drops matching messages
+	Recipients     []string `json:"recipients"` // usernames, display names, addresses or "@owner"
+	StopProcessing bool     `json:"stop_processing"`
+}
+
+// RoutePreviewRequest a sample message to route
+type RoutePreviewRequest struct {
+	EventType string `json:"event_type" binding:"required"`
+	Severity  string `json:"severity"` // defaults to info
+	Asset     *struct {
+		Type      string `json:"type"`
+		Platform  string `json:"platform"`
+		Region    string `json:"region"`
+		Owner     string `json:"owner"`
+		OrgID     *uint  `json:"org_id"` // checked against subscribers' data scope
+		CreatedBy uint   `json:"created_by"`
+	} `json:"asset"`
+	Contract *struct {
+		Type      string `json:"type"`
+		Owner     string `json:"owner"`
+		OrgID     *uint  `json:"org_id"`
+		CreatedBy uint   `json:"created_by"`
+	} `json:"contract"`
+	Recipients []string   `json:"recipients"` // defaults to the asset or contract owner
+	Time       *time.Time `json:"time"`       // defaults to now, set it to check quiet hours
+}
+
+// RoutePreviewResponse who would be notified
+type RoutePreviewResponse struct {
+	Enabled bool `json:"enabled"` // notifications are switched on at all
+	*notification.Route
+}
+
+var notificationChannels = []string{model.NotificationChannelIM, model.NotificationChannelEmail, model.NotificationChannelSMS}
+
+// NotificationRuleHandler notification routing rules
+type NotificationRuleHandler struct {
+	notify *notification.Service
+}
+
+func NewNotificationRuleHandler(notify *notification.Service) *NotificationRuleHandler {
+	return &NotificationRuleHandler{notify: notify}
+}
+
+// GetRules 通知路由规则列表，按评估顺序
+func (h *NotificationRuleHandler) GetRules(c *gin.Context) {
+	var rules []model.NotificationRule
+	if err := data.DB.WithContext(c).Order("priority, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// GetRule 通知路由规则详情
+func (h *NotificationRuleHandler) GetRule(c *gin.Context) {
+	var rule model.NotificationRule
+	if err := data.DB.WithContext(c).First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateRule 创建通知路由规则
+func (h *NotificationRuleHandler) CreateRule(c *gin.Context) {
+	var req NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateRuleRequest(c, &req) {
+		return
+	}
+
+	rule := model.NotificationRule{CreatedBy: c.GetUint("userID"), Enabled: true}
+	applyRuleRequest(&rule, &req)
+	if err := data.DB.WithContext(c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule 更新通知路由规则
+func (h *NotificationRuleHandler) UpdateRule(c *gin.Context) {
+	var rule model.NotificationRule
+	if err := data.DB.WithContext(c).First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	var req NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateRuleRequest(c, &req) {
+		return
+	}
+
+	applyRuleRequest(&rule, &req)
+	if err := data.DB.WithContext(c).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule 删除通知路由规则
+func (h *NotificationRuleHandler) DeleteRule(c *gin.Context) {
+	var rule model.NotificationRule
+	if err := data.DB.WithContext(c).First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	if err := data.DB.WithContext(c).Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted"})
+}
+
+// PreviewRoute 预览示例消息会通知到哪些渠道和人，不实际发送
+func (h *NotificationRuleHandler) PreviewRoute(c *gin.Context) {
+	var req RoutePreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !notification.IsValidKind(req.EventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type: " + req.EventType})
+		return
+	}
+	if req.Severity == "" {
+		req.Severity = string(notification.SeverityInfo)
+	}
+	if !notification.IsValidSeverity(req.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown severity: " + req.Severity})
+		return
+	}
+
+	msg := notification.Message{
+		Kind:       req.EventType,
+		Severity:   notification.Severity(req.Severity),
+		TenantID:   c.GetUint("tenantID"),
+		Recipients: req.Recipients,
+		Data:       map[string]interface{}{},
+	}
+	if a := req.Asset; a != nil {
+		msg.Data["Asset"] = model.Asset{Type: a.Type, Platform: a.Platform, Region: a.Region, Owner: a.Owner, OrgID: a.OrgID, CreatedBy: a.CreatedBy}
+		if len(req.Recipients) == 0 && a.Owner != "" {
+			msg.Recipients = append(msg.Recipients, a.Owner)
+		}
+	}
+	if ct := req.Contract; ct != nil {
+		msg.Data["Contract"] = model.Contract{Type: ct.Type, Owner: ct.Owner, OrgID: ct.OrgID, CreatedBy: ct.CreatedBy}
+		if len(req.Recipients) == 0 && ct.Owner != "" {
+			msg.Recipients = append(msg.Recipients, ct.Owner)
+		}
+	}
+	at := time.Now()
+	if req.Time != nil {
+		at = *req.Time
+	}
+
+	route, err := h.notify.Route(msg, at)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, RoutePreviewResponse{Enabled: h.notify.Enabled(), Route: route})
+}
+
+// validateRuleRequest checks the conditions, channels and recipients,
+// writing the error response when they are invalid
+func validateRuleRequest(c *gin.Context, req *NotificationRuleRequest) bool {
+	for _, k := range req.EventTypes {
+		if !notification.IsValidKind(k) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type: " + k})
+			return false
+		}
+	}
+	for _, s := range req.Severities {
+		if !notification.IsValidSeverity(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown severity: " + s})
+			return false
+		}
+	}
+	for _, ch := range req.Channels {
+		if !contains(notificationChannels, ch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown channel: " + ch})
+			return false
+		}
+	}
+	for i, r := range req.Recipients {
+		req.Recipients[i] = strings.TrimSpace(r)
+		if req.Recipients[i] == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Recipients must not be empty"})
+			return false
+		}
+	}
+	if len(req.Recipients) > 0 && !contains(req.Channels, model.NotificationChannelEmail) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Recipients only apply to the email channel"})
+		return false
+	}
+	return true
+}
+
+func applyRuleRequest(rule *model.NotificationRule, req *NotificationRuleRequest) {
+	rule.Name = req.Name
+	rule.Priority = req.Priority
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	rule.EventTypes = req.EventTypes
+	rule.Severities = req.Severities
+	rule.AssetTypes = req.AssetTypes
+	rule.Platforms = req.Platforms
+	rule.Regions = req.Regions
+	rule.ContractTypes = req.ContractTypes
+	rule.Channels = req.Channels
+	rule.Recipients = req.Recipients
+	rule.StopProcessing = req.StopProcessing
+}
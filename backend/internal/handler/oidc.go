@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"itam-backend/internal/conf"
+	"itam-backend/internal/identity"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/oidc"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcCookie     = "itam_oidc"
+	oidcCookiePath = "/api/v1/auth/oidc"
+	oidcStateAud   = "itam-oidc-state"
+	oidcStateTTL   = 10 * time.Minute
+)
+
+// oidcState is the pending login kept in a signed cookie between the
+// redirect to the provider and the callback
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// OIDCHandler OpenID Connect single sign-on
+type OIDCHandler struct {
+	cfg      *conf.OIDCConfig
+	provider *oidc.Provider
+}
+
+func NewOIDCHandler(cfg *conf.OIDCConfig) *OIDCHandler {
+	return &OIDCHandler{cfg: cfg, provider: oidc.NewProvider(cfg)}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	if !h.cfg.Enable {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled"})
+		return
+	}
+
+	st := oidcState{
+		State:    oidc.RandomString(),
+		Nonce:    oidc.RandomString(),
+		Verifier: oidc.RandomString(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	}
+	redirect, err := h.provider.AuthCodeURL(c, st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	cookie, err := middleware.SignClaims(st)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	h.setCookie(c, cookie, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Callback completes the login after the identity provider redirects back
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if !h.cfg.Enable {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled"})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": e, "error_description": c.Query("error_description")})
+		return
+	}
+
+	raw, err := c.Cookie(oidcCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login session missing or expired, start again"})
+		return
+	}
+	h.setCookie(c, "", -1)
+
+	var st oidcState
+	if err := middleware.ParseClaims(raw, &st, jwt.WithAudience(oidcStateAud)); err != nil || st.State != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state"})
+		return
+	}
+
+	claims, err := h.provider.Exchange(c, c.Query("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := claims.String(h.cfg.UsernameClaim)
+	if username == "" {
+		username = claims.String("email")
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+	user, err := provisionExternalUser(c, &identity.Identity{
+		Source:      model.AuthSourceOIDC,
+		ExternalID:  claims.Subject,
+		Username:    username,
+		DisplayName: claims.String("name"),
+		Email:       claims.String("email"),
+		Groups:      claims.Strings(h.cfg.GroupsClaim),
+	}, identity.Policy{
+		AutoProvision: h.cfg.AutoProvision,
+		Tenant:        h.cfg.Tenant,
+		DefaultRole:   h.cfg.DefaultRole,
+		RoleMappings:  h.cfg.RoleMappings,
+	})
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	resp, err := completeLogin(c, user)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	if h.cfg.PostLoginRedirect == "" {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	// The fragment never reaches server logs or Referer headers
+	fragment := url.Values{
+		"access_token":  {resp.Token},
+		"refresh_token": {resp.RefreshToken},
+		"expires_in":    {strconv.FormatInt(resp.ExpiresIn, 10)},
+	}
+	c.Redirect(http.StatusFound, h.cfg.PostLoginRedirect+"#"+fragment.Encode())
+}
+
+func (h *OIDCHandler) setCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.cfg.RedirectURL, "https://")
+	c.SetCookie(oidcCookie, value, maxAge, oidcCookiePath, "", secure, true)
+}
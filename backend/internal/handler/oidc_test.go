@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var setupOnce sync.Once
+
+// setupTestDB opens a fresh SQLite database, seeded like on first start,
+// and the in-memory session store, once for the package's tests
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	setupOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		dir, err := os.MkdirTemp("", "itam-handler-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &conf.Config{Database: conf.DatabaseConfig{Driver: "sqlite", DbName: filepath.Join(dir, "itam.db")}}
+		data.InitDB(cfg)
+		middleware.InitAuth(cfg)
+		session.Init(cfg)
+	})
+}
+
+// testIssuer is an OpenID provider whose token endpoint answers with an
+// ID token for the claims set in next, carrying the nonce of the login
+type testIssuer struct {
+	*httptest.Server
+	key  *rsa.PrivateKey
+	next jwt.MapClaims
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss.URL,
+			"authorization_endpoint": iss.URL + "/authorize",
+			"token_endpoint":         iss.URL + "/token",
+			"jwks_uri":               iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims := jwt.MapClaims{"iss": iss.URL, "aud": "itam", "exp": time.Now().Add(time.Minute).Unix()}
+		for k, v := range iss.next {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		raw, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": raw})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+type oidcFlow struct {
+	engine *gin.Engine
+	iss    *testIssuer
+}
+
+func newOIDCFlow(t *testing.T) *oidcFlow {
+	setupTestDB(t)
+	iss := newTestIssuer(t)
+	h := NewOIDCHandler(&conf.OIDCConfig{
+		Enable:        true,
+		Issuer:        iss.URL,
+		ClientID:      "itam",
+		RedirectURL:   "http://itam.test/api/v1/auth/oidc/callback",
+		Scopes:        []string{"openid"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		AutoProvision: true,
+		Tenant:        model.DefaultTenantCode,
+		DefaultRole:   "user",
+		RoleMappings:  []conf.RoleMapping{{Group: "itam-operators", Role: "operator"}},
+	})
+	r := gin.New()
+	r.GET("/api/v1/auth/oidc/login", h.Login)
+	r.GET("/api/v1/auth/oidc/callback", h.Callback)
+	return &oidcFlow{engine: r, iss: iss}
+}
+
+// login starts a login, returning the state cookie and the state and
+// nonce sent to the provider
+func (f *oidcFlow) login(t *testing.T) (*http.Cookie, string, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	f.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login cookies = %+v", cookies)
+	}
+	return cookies[0], loc.Query().Get("state"), loc.Query().Get("nonce")
+}
+
+func (f *oidcFlow) callback(cookie *http.Cookie, state string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=c1&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	f.engine.ServeHTTP(w, req)
+	return w
+}
+
+func findUser(t *testing.T, username string) *model.User {
+	t.Helper()
+	var user model.User
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).Where("username = ?", username).First(&user).Error; err != nil {
+		t.Fatalf("user %s: %v", username, err)
+	}
+	return &user
+}
+
+func TestOIDCCallbackProvisionsWithRoleMapping(t *testing.T) {
+	f := newOIDCFlow(t)
+
+	cookie, state, nonce := f.login(t)
+	f.iss.next = jwt.MapClaims{
+		"sub": "sub-ann", "nonce": nonce, "preferred_username": "ann.oidc",
+		"name": "Ann", "email": "ann@example.com", "groups": []string{"staff", "itam-operators"},
+	}
+	w := f.callback(cookie, state)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: %d %s", w.Code, w.Body)
+	}
+	var resp LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("callback body %s: %v", w.Body, err)
+	}
+
+	user := findUser(t, "ann.oidc")
+	if user.Role != "operator" || user.AuthSource != model.AuthSourceOIDC || user.ExternalID != "sub-ann" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+	if user.TenantID != data.DefaultTenantID || user.Email != "ann@example.com" || user.DisplayName != "Ann" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+
+	// Leaving the mapped group drops back to the default role on next login
+	cookie, state, nonce = f.login(t)
+	f.iss.next = jwt.MapClaims{"sub": "sub-ann", "nonce": nonce, "preferred_username": "ann.oidc", "groups": []string{"staff"}}
+	if w := f.callback(cookie, state); w.Code != http.StatusOK {
+		t.Fatalf("second callback: %d %s", w.Code, w.Body)
+	}
+	if user := findUser(t, "ann.oidc"); user.Role != "user" {
+		t.Fatalf("role after leaving the group = %s, want user", user.Role)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	f := newOIDCFlow(t)
+
+	cookie, state, nonce := f.login(t)
+	_, otherState, _ := f.login(t)
+	f.iss.next = jwt.MapClaims{"sub": "sub-eve", "nonce": nonce, "preferred_username": "eve.oidc"}
+
+	// Swap two characters of the signature
+	tampered := *cookie
+	sig := []byte(cookie.Value)
+	n := len(sig)
+	sig[n-4], sig[n-3] = sig[n-3], sig[n-4]
+	if sig[n-4] == sig[n-3] {
+		sig[n-4] ^= 1
+	}
+	tampered.Value = string(sig)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		state  string
+		want   int
+	}{
+		{"no cookie", nil, state, http.StatusBadRequest},
+		{"state of another login", cookie, otherState, http.StatusBadRequest},
+		{"empty state", cookie, "", http.StatusBadRequest},
+		{"tampered cookie", &tampered, state, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := f.callback(tt.cookie, tt.state); w.Code != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	var count int64
+	data.DB.WithContext(tenant.WithAll(context.Background())).Model(&model.User{}).Where("username = ?", "eve.oidc").Count(&count)
+	if count != 0 {
+		t.Fatal("user provisioned without a matching state")
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	f := newOIDCFlow(t)
+
+	cookie, state, _ := f.login(t)
+	// An ID token minted for another login is replayed
+	f.iss.next = jwt.MapClaims{"sub": "sub-mal", "nonce": "nonce-of-another-login", "preferred_username": "mal.oidc"}
+	w := f.callback(cookie, state)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback: %d %s, want 401", w.Code, w.Body)
+	}
+}
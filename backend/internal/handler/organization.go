@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrganizationRequest create/update organization request body
+type OrganizationRequest struct {
+	ParentID *uint  `json:"parent_id"` // create only, use the move endpoint afterwards
+	Name     string `json:"name" binding:"required"`
+	Code     string `json:"code"`
+	Type     string `json:"type" binding:"required"`
+}
+
+// MoveOrganizationRequest move organization request body
+type MoveOrganizationRequest struct {
+	ParentID *uint `json:"parent_id"` // null makes the organization a root
+}
+
+// OrganizationNode organization with its children, for the tree view
+type OrganizationNode struct {
+	model.Organization
+	Children []*OrganizationNode `json:"children"`
+}
+
+type OrganizationHandler struct{}
+
+func NewOrganizationHandler() *OrganizationHandler {
+	return &OrganizationHandler{}
+}
+
+// GetOrganizations 获取组织列表；?parent_id= 只返回直接下级，?root= 返回该节点及全部下级
+func (h *OrganizationHandler) GetOrganizations(c *gin.Context) {
+	query, err := scopedOrganizations(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	query = query.Order("tree_path asc")
+	if v := c.Query("parent_id"); v != "" {
+		query = query.Where("parent_id = ?", v)
+	}
+	if v := c.Query("root"); v != "" {
+		var root model.Organization
+		scoped, _ := scopedOrganizations(c)
+		if err := scoped.First(&root, v).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		query = query.Where("tree_path LIKE ?", root.TreePath+"%")
+	}
+
+	var orgs []model.Organization
+	if err := query.Find(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+// GetOrganizationTree 获取组织树，数据范围受限时以范围内的顶层组织为根
+func (h *OrganizationHandler) GetOrganizationTree(c *gin.Context) {
+	query, err := scopedOrganizations(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var orgs []model.Organization
+	if err := query.Order("level asc, id asc").Find(&orgs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Parents come first since rows are ordered by level; the scope root's
+	// parent is not among them
+	nodes := map[uint]*OrganizationNode{}
+	roots := []*OrganizationNode{}
+	for _, org := range orgs {
+		node := &OrganizationNode{Organization: org, Children: []*OrganizationNode{}}
+		nodes[org.ID] = node
+		if org.ParentID == nil {
+			roots = append(roots, node)
+		} else if parent, ok := nodes[*org.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	c.JSON(http.StatusOK, roots)
+}
+
+// GetOrganization 获取单个组织
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	var org model.Organization
+	if !loadScopedOrganization(c, &org) {
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// CreateOrganization 创建组织
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !contains(model.OrgTypes, req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of " + strings.Join(model.OrgTypes, ", ")})
+		return
+	}
+
+	org := model.Organization{
+		ParentID: req.ParentID,
+		Name:     req.Name,
+		Code:     req.Code,
+		Type:     req.Type,
+		TreePath: "/",
+		Level:    1,
+	}
+
+	err := data.DB.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if req.ParentID == nil {
+			if in, err := orgInScope(c, nil); err != nil || !in {
+				return scopeErr(err)
+			}
+		} else {
+			var parent model.Organization
+			if err := tx.First(&parent, *req.ParentID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &badRequestError{errors.New("parent organization not found")}
+				}
+				return err
+			}
+			if in, err := orgInScope(c, &parent); err != nil || !in {
+				return scopeErr(err)
+			}
+			org.TreePath = parent.TreePath
+			org.Level = parent.Level + 1
+		}
+
+		// The path ends with the node's own ID, known only after the insert
+		parentPath := org.TreePath
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		org.TreePath = (&model.Organization{TreePath: parentPath}).ChildPath(org.ID)
+		return tx.Model(&org).Update("tree_path", org.TreePath).Error
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// UpdateOrganization 更新组织名称、代码或类型
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	var org model.Organization
+	if !loadScopedOrganization(c, &org) {
+		return
+	}
+
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !contains(model.OrgTypes, req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of " + strings.Join(model.OrgTypes, ", ")})
+		return
+	}
+
+	org.Name = req.Name
+	org.Code = req.Code
+	org.Type = req.Type
+	if err := data.DB.WithContext(c).Save(&org).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// MoveOrganization 移动组织到新的上级，整棵子树随之移动
+func (h *OrganizationHandler) MoveOrganization(c *gin.Context) {
+	var org model.Organization
+	if !loadScopedOrganization(c, &org) {
+		return
+	}
+
+	var req MoveOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := data.DB.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// Lock both nodes so concurrent moves cannot interleave and leave a
+		// subtree under a path that no longer exists or under itself
+		locked := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Session(&gorm.Session{})
+		if err := locked.First(&org, org.ID).Error; err != nil {
+			return err
+		}
+
+		newParentPath, newLevel := "/", 1
+		if req.ParentID != nil {
+			var parent model.Organization
+			if err := locked.First(&parent, *req.ParentID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &badRequestError{errors.New("parent organization not found")}
+				}
+				return err
+			}
+			if in, err := orgInScope(c, &parent); err != nil || !in {
+				return scopeErr(err)
+			}
+			if org.IsAncestorOf(&parent) {
+				return &badRequestError{errors.New("cannot move an organization under itself or its descendants")}
+			}
+			newParentPath, newLevel = parent.TreePath, parent.Level+1
+		} else if in, err := orgInScope(c, nil); err != nil || !in {
+			return scopeErr(err)
+		}
+
+		oldPath := org.TreePath
+		newPath := (&model.Organization{TreePath: newParentPath}).ChildPath(org.ID)
+		delta := newLevel - org.Level
+
+		if err := tx.Model(&org).Update("parent_id", req.ParentID).Error; err != nil {
+			return err
+		}
+
+		var subtree []model.Organization
+		if err := tx.Where("tree_path LIKE ?", oldPath+"%").Find(&subtree).Error; err != nil {
+			return err
+		}
+		for _, node := range subtree {
+			err := tx.Model(&node).Updates(map[string]interface{}{
+				"tree_path": newPath + strings.TrimPrefix(node.TreePath, oldPath),
+				"level":     node.Level + delta,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	data.DB.WithContext(c).First(&org, org.ID)
+	c.JSON(http.StatusOK, org)
+}
+
+// DeleteOrganization 删除组织，仍有下级或被资产、合同、用户引用时不可删除
+func (h *OrganizationHandler) DeleteOrganization(c *gin.Context) {
+	var org model.Organization
+	if !loadScopedOrganization(c, &org) {
+		return
+	}
+
+	var children int64
+	data.DB.WithContext(c).Model(&model.Organization{}).Where("parent_id = ?", org.ID).Count(&children)
+	if children > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Organization has %d child organization(s)", children)})
+		return
+	}
+
+	for name, m := range map[string]interface{}{"asset": &model.Asset{}, "contract": &model.Contract{}, "user": &model.User{}} {
+		var count int64
+		data.DB.WithContext(c).Model(m).Where("org_id = ?", org.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Organization is assigned to %d %s(s)", count, name)})
+			return
+		}
+	}
+
+	if err := data.DB.WithContext(c).Unscoped().Delete(&org).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+}
+
+// loadScopedOrganization loads the organization of the request path into
+// org, writing the error response unless it exists and lies within the
+// caller's data scope
+func loadScopedOrganization(c *gin.Context, org *model.Organization) bool {
+	if err := data.DB.WithContext(c).First(org, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return false
+	}
+	in, err := orgInScope(c, org)
+	if err != nil {
+		respondError(c, err)
+		return false
+	}
+	if !in {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return false
+	}
+	return true
+}
+
+// scopeErr is the error for a scope check that failed with err, or that
+// found the organization outside the caller's data scope
+func scopeErr(err error) error {
+	if err != nil {
+		return err
+	}
+	return &badRequestError{errOutOfScope}
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"itam-backend/internal/model"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// ListSpec declares what a list endpoint lets clients sort and filter on.
+// Only whitelisted columns ever reach SQL.
+type ListSpec struct {
+	SortColumns   []string // columns accepted by ?sort=
+	FilterColumns []string // exact-match filters, ?status=Online or ?status=Online,Offline
+	SearchColumns []string // columns matched by ?q= with LIKE
+	DefaultSort   string   // e.g. "-id" for newest first
+	ExportColumns []string // columns available to ?columns= on the export endpoint, in default order
+	JSONColumn    string   // JSON object column filtered by ?attr.<key>=value
+	ScopeColumn   string   // creator column; when set rows are limited to the caller's data scope
+}
+
+// ListResult is the response envelope shared by every list endpoint
+type ListResult struct {
+	Items      interface{} `json:"items"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page,omitempty"`
+	PageSize   int         `json:"page_size"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// ListParams are the parsed list query parameters
+type ListParams struct {
+	Page     int
+	PageSize int
+	Sort     string
+	Desc     bool
+	Cursor   *uint // set in cursor mode; nil pointer value means the first page
+	IsCursor bool
+}
+
+// parseListParams reads page/page_size, sort and cursor from the request.
+//
+//	?page=2&page_size=50         offset pagination
+//	?cursor=&page_size=50        keyset pagination on id, follow next_cursor;
+//	                             only sort=id and sort=-id are allowed with it
+//	?sort=-created_at            descending sort; ?sort=name&order=desc also works
+func parseListParams(c *gin.Context, spec ListSpec) (ListParams, error) {
+	p := ListParams{Page: 1, PageSize: defaultPageSize}
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid page: %s", v)
+		}
+		p.Page = n
+	}
+	if v := c.Query("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid page_size: %s", v)
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		p.PageSize = n
+	}
+
+	sort := c.DefaultQuery("sort", spec.DefaultSort)
+	if sort == "" {
+		sort = "id"
+	}
+	if strings.HasPrefix(sort, "-") {
+		p.Desc = true
+		sort = sort[1:]
+	}
+	if order := c.Query("order"); order != "" {
+		p.Desc = strings.EqualFold(order, "desc")
+	}
+	if sort != "id" && !contains(spec.SortColumns, sort) {
+		return p, fmt.Errorf("cannot sort by %s", sort)
+	}
+	p.Sort = sort
+
+	if v, ok := c.GetQuery("cursor"); ok {
+		p.IsCursor = true
+		if v != "" {
+			id, err := decodeCursor(v)
+			if err != nil {
+				return p, err
+			}
+			p.Cursor = &id
+		}
+		// Keyset pagination is only stable on the primary key
+		if p.Sort != "id" {
+			return p, fmt.Errorf("cannot sort by %s with cursor pagination, only by id", p.Sort)
+		}
+	}
+	return p, nil
+}
+
+// applyFilters adds the whitelisted exact-match filters and ?q= search to query
+func applyFilters(c *gin.Context, query *gorm.DB, spec ListSpec) *gorm.DB {
+	for _, col := range spec.FilterColumns {
+		v := c.Query(col)
+		if v == "" {
+			continue
+		}
+		if values := strings.Split(v, ","); len(values) > 1 {
+			query = query.Where(clause.IN{Column: clause.Column{Name: col}, Values: toInterfaces(values)})
+		} else {
+			query = query.Where(clause.Eq{Column: clause.Column{Name: col}, Value: v})
+		}
+	}
+
+	if spec.JSONColumn != "" {
+		for param, values := range c.Request.URL.Query() {
+			key := strings.TrimPrefix(param, attrFilterPrefix)
+			if key == param || values[0] == "" {
+				continue
+			}
+			if !model.IsValidAttributeKey(key) {
+				query.AddError(&badRequestError{fmt.Errorf("invalid attribute filter %s", param)})
+				continue
+			}
+			expr := jsonTextExpr(query, spec.JSONColumn, key)
+			if list := strings.Split(values[0], ","); len(list) > 1 {
+				query = query.Where(expr+" IN ?", list)
+			} else {
+				query = query.Where(expr+" = ?", values[0])
+			}
+		}
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" && len(spec.SearchColumns) > 0 {
+		// % and _ in the search are literal characters, not wildcards
+		pattern := "%" + likeEscaper.Replace(q) + "%"
+		var exprs []clause.Expression
+		for _, col := range spec.SearchColumns {
+			exprs = append(exprs, clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []interface{}{clause.Column{Name: col}, pattern}})
+		}
+		query = query.Where(clause.Or(exprs...))
+	}
+	return query
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which unlike a backslash
+// means the same in every supported database's string literals
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+const attrFilterPrefix = "attr."
+
+// jsonTextExpr returns SQL extracting key from a JSON object column as text.
+// key must have passed model.IsValidAttributeKey since it is inlined.
+func jsonTextExpr(db *gorm.DB, column, key string) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("%s->>'%s'", column, key)
+	case "mysql":
+		return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '$.%s'))", column, key)
+	default:
+		return fmt.Sprintf("CAST(json_extract(%s, '$.%s') AS TEXT)", column, key)
+	}
+}
+
+// listQuery filters, counts, sorts and pages query into dest (a pointer to a slice)
+func listQuery(c *gin.Context, query *gorm.DB, spec ListSpec, dest interface{}) (*ListResult, error) {
+	params, err := parseListParams(c, spec)
+	if err != nil {
+		return nil, &badRequestError{err}
+	}
+
+	query = applyFilters(c, query, spec)
+	if spec.ScopeColumn != "" {
+		if query, err = scopeList(c, query, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	// New session so Count and Find each start from the filtered statement
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	result := &ListResult{Items: dest, Total: total, PageSize: params.PageSize}
+
+	if params.IsCursor {
+		// Keyset pagination is only stable on the primary key
+		if params.Cursor != nil {
+			op := ">"
+			if params.Desc {
+				op = "<"
+			}
+			query = query.Where("id "+op+" ?", *params.Cursor)
+		}
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: params.Desc})
+		if err := query.Limit(params.PageSize + 1).Find(dest).Error; err != nil {
+			return nil, err
+		}
+
+		items := reflect.ValueOf(dest).Elem()
+		if items.Len() > params.PageSize {
+			items.Set(items.Slice(0, params.PageSize))
+			last := items.Index(params.PageSize - 1)
+			result.NextCursor = encodeCursor(uint(reflect.Indirect(last).FieldByName("ID").Uint()))
+		}
+		return result, nil
+	}
+
+	result.Page = params.Page
+	query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: params.Sort}, Desc: params.Desc})
+	if params.Sort != "id" {
+		query = query.Order("id")
+	}
+	if err := query.Offset((params.Page - 1) * params.PageSize).Limit(params.PageSize).Find(dest).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// respondList writes the list envelope or the matching error response
+func respondList(c *gin.Context, query *gorm.DB, spec ListSpec, dest interface{}) {
+	result, err := listQuery(c, query, spec, dest)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// respondError writes 400 for a badRequestError and 500 for anything else
+func respondError(c *gin.Context, err error) {
+	if _, ok := err.(*badRequestError); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+type badRequestError struct{ err error }
+
+func (e *badRequestError) Error() string { return e.err.Error() }
+
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeCursor(s string) (uint, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return uint(id), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toInterfaces(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseListParamsCursorSort(t *testing.T) {
+	spec := ListSpec{SortColumns: []string{"name", "created_at"}, DefaultSort: "-id"}
+	tests := []struct {
+		query   string
+		desc    bool
+		wantErr string
+	}{
+		{"cursor=", true, ""},
+		{"cursor=&sort=id", false, ""},
+		{"cursor=&sort=-id", true, ""},
+		{"cursor=&sort=id&order=desc", true, ""},
+		{"cursor=&sort=name", false, "cannot sort by name with cursor pagination"},
+		{"cursor=&sort=-created_at", false, "cannot sort by created_at with cursor pagination"},
+		{"cursor=" + encodeCursor(42) + "&sort=name", false, "cannot sort by name with cursor pagination"},
+		{"page=2&sort=name", false, ""},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/assets?"+tt.query, nil)
+		p, err := parseListParams(c, spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if strings.HasPrefix(tt.query, "cursor") && (p.Sort != "id" || p.Desc != tt.desc) {
+			t.Errorf("%s: sort %s desc %v", tt.query, p.Sort, p.Desc)
+		}
+	}
+}
+
+func TestSearchEscapesWildcards(t *testing.T) {
+	setupTestDB(t)
+	for _, name := range []string{"100%_done", "1000 done", "a!b", "plain"} {
+		createTestAsset(t, model.Asset{Name: name, Type: "server", Owner: "wildcard-owner"})
+	}
+	spec := ListSpec{FilterColumns: []string{"owner"}, SearchColumns: []string{"name"}}
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"%", []string{"100%_done"}},
+		{"_", []string{"100%_done"}},
+		{"0%_", []string{"100%_done"}},
+		{"!", []string{"a!b"}},
+		{"!b", []string{"a!b"}},
+		{"done", []string{"100%_done", "1000 done"}},
+		{"0_d", nil},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/assets?owner=wildcard-owner&q="+url.QueryEscape(tt.q), nil)
+		var assets []model.Asset
+		query := data.DB.WithContext(tenant.WithAll(context.Background())).Model(&model.Asset{})
+		if err := applyFilters(c, query, spec).Order("id").Find(&assets).Error; err != nil {
+			t.Fatalf("q=%s: %v", tt.q, err)
+		}
+		var got []string
+		for _, a := range assets {
+			got = append(got, a.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("q=%s matched %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RoleRequest create/update role request body
+type RoleRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Description   string   `json:"description"`
+	Permissions   []string `json:"permissions"`
+	DataScopeType string   `json:"data_scope_type"`
+}
+
+type RoleHandler struct{}
+
+func NewRoleHandler() *RoleHandler {
+	return &RoleHandler{}
+}
+
+// GetPermissions 获取所有可分配的权限码
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, model.AllPermissions)
+}
+
+// GetRoles 获取角色列表
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	var roles []model.Role
+	if err := data.DB.WithContext(c).Order("id asc").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole 获取单个角色
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	id := c.Param("id")
+	var role model.Role
+	if err := data.DB.WithContext(c).First(&role, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole 创建角色
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DataScopeType != "" && !model.IsValidDataScope(req.DataScopeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "data_scope_type must be one of self, department, company, all"})
+		return
+	}
+	if req.DataScopeType == "" {
+		req.DataScopeType = model.DataScopeAll
+	}
+	if err := roleGrantError(c, req.Permissions, req.DataScopeType); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot create role " + req.Name + ": it " + err.Error()})
+		return
+	}
+
+	var count int64
+	data.DB.WithContext(c).Unscoped().Model(&model.Role{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	role := model.Role{
+		Name:          req.Name,
+		Description:   req.Description,
+		Permissions:   model.StringList(req.Permissions),
+		DataScopeType: req.DataScopeType,
+	}
+
+	if err := data.DB.WithContext(c).Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.InvalidateRoleCache()
+	c.JSON(http.StatusOK, role)
+}
+
+// UpdateRole 更新角色权限
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var role model.Role
+	id := c.Param("id")
+
+	if err := data.DB.WithContext(c).First(&role, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	// Only holders of every permission may change the role they act under
+	if role.Name == c.GetString("role") && !middleware.HasPermission(c, model.PermAll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot edit your own role"})
+		return
+	}
+	if err := roleGrantError(c, role.Permissions, role.DataScopeType); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot edit role " + role.Name + ": it " + err.Error()})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DataScopeType != "" && !model.IsValidDataScope(req.DataScopeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "data_scope_type must be one of self, department, company, all"})
+		return
+	}
+
+	// Renaming would orphan the users that reference the role by name
+	if role.BuiltIn && req.Name != role.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be renamed"})
+		return
+	}
+
+	oldName := role.Name
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Permissions = model.StringList(req.Permissions)
+	if req.DataScopeType != "" {
+		role.DataScopeType = req.DataScopeType
+	}
+	if err := roleGrantError(c, role.Permissions, role.DataScopeType); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot update role " + role.Name + ": it " + err.Error()})
+		return
+	}
+
+	err := data.DB.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		if oldName != role.Name {
+			// Roles are shared, so are the users referencing them
+			return tx.WithContext(tenant.WithAll(c)).Model(&model.User{}).Where("role = ?", oldName).Update("role", role.Name).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.InvalidateRoleCache()
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole 删除角色，内置角色和仍被用户使用的角色不可删除
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	var role model.Role
+	id := c.Param("id")
+
+	if err := data.DB.WithContext(c).First(&role, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+	if err := roleGrantError(c, role.Permissions, role.DataScopeType); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot delete role " + role.Name + ": it " + err.Error()})
+		return
+	}
+
+	var count int64
+	data.DB.WithContext(tenant.WithAll(c)).Model(&model.User{}).Where("role = ?", role.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Role is assigned to %d user(s)", count)})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Unscoped().Delete(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.InvalidateRoleCache()
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+func validatePermissions(perms []string) error {
+	for _, p := range perms {
+		if !model.IsValidPermission(p) {
+			return fmt.Errorf("unknown permission: %s", p)
+		}
+	}
+	return nil
+}
+
+// checkRoleAssignment writes the error response unless the caller may hand
+// out the named role: it must exist, and grant no permission or wider data
+// scope than the caller's own role does
+func checkRoleAssignment(c *gin.Context, name string) bool {
+	var role model.Role
+	if err := data.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + name})
+		return false
+	}
+	if err := roleGrantError(c, role.Permissions, role.DataScopeType); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot assign role " + name + ": it " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// checkManagedUser writes the error response unless the caller may act on
+// user, which takes being able to assign the user's current role; a role
+// that no longer exists grants nothing
+func checkManagedUser(c *gin.Context, user *model.User) bool {
+	var role model.Role
+	if err := data.DB.Where("name = ?", user.Role).First(&role).Error; err != nil {
+		return true
+	}
+	if err := roleGrantError(c, role.Permissions, role.DataScopeType); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot manage user " + user.Username + ": their role " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// roleGrantError reports a permission the caller does not hold, or a data
+// scope wider than the caller's, among the ones a role grants
+func roleGrantError(c *gin.Context, perms []string, scope string) error {
+	for _, p := range perms {
+		if !middleware.HasPermission(c, p) {
+			return fmt.Errorf("grants %s which you do not hold", p)
+		}
+	}
+	if scopeRank(scope) > scopeRank(middleware.DataScope(c)) {
+		return fmt.Errorf("has the data scope %s which is wider than yours", scope)
+	}
+	return nil
+}
+
+// scopeRank orders data scopes from narrowest to widest, unknown ones
+// count as self like in middleware.DataScope
+func scopeRank(scope string) int {
+	for i, s := range model.DataScopes {
+		if s == scope {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestRole creates the role unless it exists
+func createTestRole(t *testing.T, name, scope string, perms ...string) *model.Role {
+	t.Helper()
+	role := model.Role{Name: name, Permissions: model.StringList(perms), DataScopeType: scope}
+	if err := data.DB.Where("name = ?", name).FirstOrCreate(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	middleware.InvalidateRoleCache()
+	return &role
+}
+
+func loadTestRole(t *testing.T, name string) model.Role {
+	t.Helper()
+	var role model.Role
+	if err := data.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	return role
+}
+
+func TestRoleWritesStayWithinOwnGrants(t *testing.T) {
+	setupTestDB(t)
+	manager := createTestRole(t, "role-manager", model.DataScopeDepartment, "role:read", "role:write", "asset:read", "asset:write")
+	wide := createTestRole(t, "role-wide", model.DataScopeSelf, "user:write")
+
+	h := NewRoleHandler()
+	r := gin.New()
+	r.Use(signedIn(createTestUser(t, "role.manager", manager.Name, nil)))
+	r.POST("/roles", h.CreateRole)
+	r.PUT("/roles/:id", h.UpdateRole)
+	r.DELETE("/roles/:id", h.DeleteRole)
+	send := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	creates := []struct {
+		body string
+		want int
+	}{
+		{`{"name":"role-ok","permissions":["asset:read"],"data_scope_type":"self"}`, http.StatusOK},
+		{`{"name":"role-star","permissions":["*"],"data_scope_type":"self"}`, http.StatusForbidden},
+		{`{"name":"role-users","permissions":["user:write"],"data_scope_type":"self"}`, http.StatusForbidden},
+		{`{"name":"role-all","permissions":["asset:read"],"data_scope_type":"all"}`, http.StatusForbidden},
+		{`{"name":"role-default","permissions":["asset:read"]}`, http.StatusForbidden}, // defaults to all
+	}
+	for _, tt := range creates {
+		if code := send(http.MethodPost, "/roles", tt.body); code != tt.want {
+			t.Errorf("create %s = %d, want %d", tt.body, code, tt.want)
+		}
+	}
+
+	ok := loadTestRole(t, "role-ok")
+	admin := loadTestRole(t, "admin")
+	updates := []struct {
+		id   uint
+		body string
+		want int
+	}{
+		{ok.ID, `{"name":"role-ok","permissions":["*"]}`, http.StatusForbidden},
+		{ok.ID, `{"name":"role-ok","permissions":["asset:read"],"data_scope_type":"all"}`, http.StatusForbidden},
+		{ok.ID, `{"name":"role-ok","permissions":["asset:write"],"data_scope_type":"department"}`, http.StatusOK},
+		{manager.ID, `{"name":"role-manager","permissions":["role:read","role:write","asset:read","asset:write","user:write"]}`, http.StatusForbidden},
+		{manager.ID, `{"name":"role-manager","permissions":["role:read","role:write"]}`, http.StatusForbidden},
+		{admin.ID, `{"name":"admin","permissions":["asset:read"]}`, http.StatusForbidden},
+		{wide.ID, `{"name":"role-wide","permissions":[]}`, http.StatusForbidden},
+	}
+	for _, tt := range updates {
+		if code := send(http.MethodPut, fmt.Sprintf("/roles/%d", tt.id), tt.body); code != tt.want {
+			t.Errorf("update %d with %s = %d, want %d", tt.id, tt.body, code, tt.want)
+		}
+	}
+	if got := loadTestRole(t, "admin").Permissions; len(got) != 1 || got[0] != model.PermAll {
+		t.Fatalf("admin role permissions = %v", got)
+	}
+	if got := loadTestRole(t, "role-manager").Permissions; len(got) != 4 {
+		t.Fatalf("own role permissions = %v", got)
+	}
+
+	if code := send(http.MethodDelete, fmt.Sprintf("/roles/%d", wide.ID), ""); code != http.StatusForbidden {
+		t.Errorf("delete of a role granting more = %d", code)
+	}
+	if code := send(http.MethodDelete, fmt.Sprintf("/roles/%d", ok.ID), ""); code != http.StatusOK {
+		t.Errorf("delete of a role within own grants = %d", code)
+	}
+}
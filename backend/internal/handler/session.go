@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionInfo session as shown to users and admins
+type SessionInfo struct {
+	ID          string    `json:"id"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Current     bool      `json:"current"`
+}
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// issueSession starts a session for user and returns its first token pair
+func issueSession(c *gin.Context, user *model.User) (*LoginResponse, error) {
+	now := time.Now()
+	s := &session.Session{
+		ID:        session.NewID(),
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		CreatedAt: now,
+	}
+	resp, err := renewSession(s, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Default.Save(s); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// renewSession puts a new refresh secret and access token into s, the
+// caller persists it
+func renewSession(s *session.Session, user *model.User) (*LoginResponse, error) {
+	token, claims, err := middleware.GenerateToken(user, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := session.NewID() + session.NewID()
+	now := time.Now()
+	s.RefreshHash = session.HashSecret(secret)
+	s.AccessID = claims.ID
+	s.AccessExpiresAt = claims.ExpiresAt.Time
+	s.RefreshedAt = now
+	s.ExpiresAt = now.Add(middleware.RefreshTokenTTL())
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: s.ID + "." + secret,
+		ExpiresIn:    int64(time.Until(s.AccessExpiresAt).Seconds()),
+		Username:     user.Username,
+		Role:         user.Role,
+	}, nil
+}
+
+// parseRefreshToken splits a refresh token into session ID and secret hash
+func parseRefreshToken(token string) (id, hash string, err error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", errInvalidRefreshToken
+	}
+	return id, session.HashSecret(secret), nil
+}
+
+// sessionInfos lists the live sessions of a user, newest first
+func sessionInfos(userID uint, currentID string) ([]SessionInfo, error) {
+	sessions, err := session.Default.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, SessionInfo{
+			ID:          s.ID,
+			IP:          s.IP,
+			UserAgent:   s.UserAgent,
+			CreatedAt:   s.CreatedAt,
+			RefreshedAt: s.RefreshedAt,
+			ExpiresAt:   s.ExpiresAt,
+			Current:     s.ID == currentID,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CreatedAt.After(infos[j].CreatedAt) })
+	return infos, nil
+}
+
+// revokeOtherSessions signs the user out everywhere but the current session
+func revokeOtherSessions(c *gin.Context, userID uint) {
+	revokeAPITokens(c, userID)
+	sessions, err := session.Default.ListByUser(userID)
+	if err != nil {
+		return
+	}
+	for _, s := range sessions {
+		if s.ID != c.GetString("sessionID") {
+			session.RevokeSession(session.Default, s)
+		}
+	}
+}
+
+// endSessions signs the user out everywhere and returns how many sessions
+// were ended. API tokens go too, they would otherwise keep working.
+func endSessions(c *gin.Context, userID uint) (int, error) {
+	if err := revokeAPITokens(c, userID); err != nil {
+		return 0, err
+	}
+	return session.RevokeUser(session.Default, userID)
+}
+
+// revokeAPITokens deletes the personal API tokens of the user
+func revokeAPITokens(c *gin.Context, userID uint) error {
+	return data.DB.WithContext(c).Where("user_id = ?", userID).Delete(&model.APIToken{}).Error
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantRequest create/update tenant request body
+type TenantRequest struct {
+	Name             string `json:"name" binding:"required"`
+	Code             string `json:"code" binding:"required"`
+	SubscriptionType string `json:"subscription_type"`
+	Status           string `json:"status" binding:"omitempty,oneof=active disabled"`
+}
+
+type TenantHandler struct{}
+
+func NewTenantHandler() *TenantHandler {
+	return &TenantHandler{}
+}
+
+// GetTenants 获取租户列表
+func (h *TenantHandler) GetTenants(c *gin.Context) {
+	var tenants []model.Tenant
+	if err := data.DB.WithContext(c).Order("id asc").Find(&tenants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tenants)
+}
+
+// GetTenant 获取单个租户
+func (h *TenantHandler) GetTenant(c *gin.Context) {
+	var t model.Tenant
+	if err := data.DB.WithContext(c).First(&t, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// CreateTenant 创建租户，再通过 POST /users 指定 tenant_id 创建其管理员
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	var req TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	data.DB.WithContext(c).Unscoped().Model(&model.Tenant{}).Where("code = ?", req.Code).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tenant code already exists"})
+		return
+	}
+
+	t := model.Tenant{
+		Name:             req.Name,
+		Code:             req.Code,
+		SubscriptionType: req.SubscriptionType,
+		Status:           req.Status,
+	}
+	if t.SubscriptionType == "" {
+		t.SubscriptionType = "community"
+	}
+	if t.Status == "" {
+		t.Status = model.TenantStatusActive
+	}
+
+	if err := data.DB.WithContext(c).Create(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// UpdateTenant 更新租户信息或启用/停用租户
+func (h *TenantHandler) UpdateTenant(c *gin.Context) {
+	var t model.Tenant
+	if err := data.DB.WithContext(c).First(&t, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		return
+	}
+
+	var req TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if t.ID == data.DefaultTenantID && (req.Code != t.Code || req.Status == model.TenantStatusDisabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The default tenant cannot be renamed or disabled"})
+		return
+	}
+
+	t.Name = req.Name
+	t.Code = req.Code
+	if req.SubscriptionType != "" {
+		t.SubscriptionType = req.SubscriptionType
+	}
+	if req.Status != "" {
+		t.Status = req.Status
+	}
+
+	if err := data.DB.WithContext(c).Save(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.InvalidateTenantCache()
+	c.JSON(http.StatusOK, t)
+}
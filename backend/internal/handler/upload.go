@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFileNameLength bounds the display name kept for an upload, in bytes
+const maxFileNameLength = 200
+
+// oleMagic starts legacy Office documents (.doc, .xls, .ppt)
+var oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// officeTypes maps extensions to the MIME types of Office documents,
+// which content sniffing alone reports as zip or unknown binary
+var officeTypes = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".doc":  "application/msword",
+	".xls":  "application/vnd.ms-excel",
+	".ppt":  "application/vnd.ms-powerpoint",
+}
+
+// fileExtensions is the storage extension for each detected type
+var fileExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"text/plain":      ".txt",
+	"application/zip": ".zip",
+}
+
+// detectFileType sniffs the MIME type of an upload from its first bytes.
+// The client's Content-Type and file name are not trusted, the name only
+// tells apart Office formats sharing a container (zip or OLE).
+func detectFileType(r io.ReadSeeker, name string) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case contentType == "application/zip" && (ext == ".docx" || ext == ".xlsx" || ext == ".pptx"):
+		return officeTypes[ext], nil
+	case bytes.HasPrefix(head, oleMagic) && (ext == ".doc" || ext == ".xls" || ext == ".ppt"):
+		return officeTypes[ext], nil
+	}
+	return contentType, nil
+}
+
+// fileExtension returns the extension files of contentType are stored with
+func fileExtension(contentType string) string {
+	if ext, ok := fileExtensions[contentType]; ok {
+		return ext
+	}
+	for ext, t := range officeTypes {
+		if t == contentType {
+			return ext
+		}
+	}
+	return ".bin"
+}
+
+// sanitizeFileName reduces a client supplied name to a safe display name:
+// no directories, control characters or invalid UTF-8, bounded in length
+func sanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+	name = strings.ToValidUTF8(name, "")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(strings.Trim(name, "."))
+
+	if len(name) > maxFileNameLength {
+		// Keep the extension, cut the stem on a rune boundary
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		stem := name[:maxFileNameLength-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+		name = stem + ext
+	}
+	if name == "" || name == "/" {
+		return "file"
+	}
+	return name
+}
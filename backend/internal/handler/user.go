@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"context"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUserRequest create user request body
+type CreateUserRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Password    string `json:"password" binding:"required,min=6"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
+	TenantID    uint   `json:"tenant_id"` // defaults to the caller's tenant
+	OrgID       *uint  `json:"org_id"`
+}
+
+// UpdateUserRequest update user request body, empty fields are left unchanged
+type UpdateUserRequest struct {
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+	Role        *string `json:"role"`
+	Password    *string `json:"password" binding:"omitempty,min=6"`
+	OrgID       *uint   `json:"org_id"` // 0 removes the user from its organization
+}
+
+type UserHandler struct{}
+
+func NewUserHandler() *UserHandler {
+	return &UserHandler{}
+}
+
+// GetUsers 获取用户列表
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	var users []model.User
+	db, err := scopedDB(c, "id")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.Order("id asc").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser 获取单个用户
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id := c.Param("id")
+	var user model.User
+	db, err := scopedDB(c, "id")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser 创建用户
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Creating the first users of another tenant is reserved to platform admins
+	ctx := context.Context(c)
+	if req.TenantID != 0 && req.TenantID != c.GetUint("tenantID") {
+		if c.GetUint("tenantID") != data.DefaultTenantID || !middleware.HasPermission(c, model.PermTenantWrite) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot create users in another tenant"})
+			return
+		}
+		var t model.Tenant
+		if err := data.DB.First(&t, req.TenantID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tenant not found"})
+			return
+		}
+		if req.OrgID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assign the organization from within the tenant"})
+			return
+		}
+		ctx = tenant.WithTenant(c, req.TenantID)
+	} else if err := checkOrgAssignment(c, req.OrgID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// Usernames are unique across tenants since login does not ask for one
+	var count int64
+	data.DB.WithContext(tenant.WithAll(c)).Unscoped().Model(&model.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	user := model.User{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Role:        req.Role,
+		Status:      model.UserStatusActive,
+		OrgID:       req.OrgID,
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if !checkRoleAssignment(c, user.Role) {
+		return
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	if err := data.DB.WithContext(ctx).Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser 更新用户资料、角色或重置密码
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var user model.User
+	id := c.Param("id")
+
+	db, err := scopedDB(c, "id")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkManagedUser(c, &user) {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, orgID := user.Role, user.OrgID
+	if req.DisplayName != nil {
+		user.DisplayName = *req.DisplayName
+	}
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.Role != nil && *req.Role != "" && *req.Role != user.Role {
+		if user.ID == c.GetUint("userID") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot change your own role"})
+			return
+		}
+		if !checkRoleAssignment(c, *req.Role) {
+			return
+		}
+		user.Role = *req.Role
+	}
+	if req.OrgID != nil {
+		if *req.OrgID == 0 {
+			user.OrgID = nil
+		} else if err := checkOrgAssignment(c, req.OrgID); err != nil {
+			respondError(c, err)
+			return
+		} else {
+			user.OrgID = req.OrgID
+		}
+	}
+	if req.Password != nil {
+		if err := user.SetPassword(*req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+	}
+
+	if err := data.DB.WithContext(c).Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Tokens carry the role and organization, so the user signs in again
+	// to pick up new ones, as after a password change
+	if req.Password != nil || user.Role != role || !sameOrg(orgID, user.OrgID) {
+		endSessions(c, user.ID)
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser 删除用户
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	var user model.User
+	id := c.Param("id")
+
+	db, err := scopedDB(c, "id")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkManagedUser(c, &user) {
+		return
+	}
+
+	if currentID, _ := c.Get("userID"); currentID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete yourself"})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Delete(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	endSessions(c, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// EnableUser 启用账户
+func (h *UserHandler) EnableUser(c *gin.Context) {
+	h.setStatus(c, model.UserStatusActive)
+}
+
+// DisableUser 禁用账户
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	h.setStatus(c, model.UserStatusDisabled)
+}
+
+func (h *UserHandler) setStatus(c *gin.Context, status string) {
+	var user model.User
+	id := c.Param("id")
+
+	db, err := scopedDB(c, "id")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !checkManagedUser(c, &user) {
+		return
+	}
+
+	if currentID, _ := c.Get("userID"); currentID == user.ID && status == model.UserStatusDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot disable yourself"})
+		return
+	}
+
+	if err := data.DB.WithContext(c).Model(&user).Update("status", status).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status == model.UserStatusDisabled {
+		endSessions(c, user.ID)
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// scopedUser loads the user in the URL within the caller's tenant and data scope
+func scopedUser(c *gin.Context) (*model.User, bool) {
+	db, err := scopedDB(c, "id")
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	var user model.User
+	if err := db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetUserSessions 查看用户的登录会话
+func (h *UserHandler) GetUserSessions(c *gin.Context) {
+	user, ok := scopedUser(c)
+	if !ok {
+		return
+	}
+	infos, err := sessionInfos(user.ID, c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, infos)
+}
+
+// TerminateUserSessions 强制下线用户的全部会话
+func (h *UserHandler) TerminateUserSessions(c *gin.Context) {
+	user, ok := scopedUser(c)
+	if !ok {
+		return
+	}
+	n, err := endSessions(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions terminated", "sessions": n})
+}
+
+// TerminateUserSession 强制下线用户的单个会话
+func (h *UserHandler) TerminateUserSession(c *gin.Context) {
+	user, ok := scopedUser(c)
+	if !ok {
+		return
+	}
+	s, err := session.Default.Get(c.Param("sid"))
+	if err != nil || s.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err := session.RevokeSession(session.Default, s); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Session store unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session terminated"})
+}
+
+// ResetUserMFA 重置用户的两步验证，用于丢失设备的情况
+func (h *UserHandler) ResetUserMFA(c *gin.Context) {
+	user, ok := scopedUser(c)
+	if !ok || !checkManagedUser(c, user) {
+		return
+	}
+	if err := resetMFA(data.DB.WithContext(c), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
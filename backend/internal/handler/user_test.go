@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestUser creates a user of the default tenant
+func createTestUser(t *testing.T, username, role string, orgID *uint) *model.User {
+	t.Helper()
+	user := model.User{TenantID: data.DefaultTenantID, Username: username, Role: role, OrgID: orgID}
+	user.SetPassword("secret123")
+	if err := data.DB.WithContext(tenant.WithTenant(context.Background(), data.DefaultTenantID)).Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// startSession records a login of the user and returns its access token ID
+func startSession(t *testing.T, userID uint) string {
+	t.Helper()
+	s := &session.Session{
+		ID:              session.NewID(),
+		UserID:          userID,
+		TenantID:        data.DefaultTenantID,
+		AccessID:        session.NewID(),
+		AccessExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt:       time.Now(),
+		ExpiresAt:       time.Now().Add(time.Hour),
+	}
+	if err := session.Default.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	return s.AccessID
+}
+
+func TestUpdateUserRevokesSessions(t *testing.T) {
+	setupTestDB(t)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	user := model.User{TenantID: data.DefaultTenantID, Username: "revoke.dan", Role: "user"}
+	user.SetPassword("secret123")
+	org := model.Organization{TenantID: data.DefaultTenantID, Name: "Ops", Type: "department"}
+	if err := data.DB.WithContext(ctx).Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := data.DB.WithContext(ctx).Create(&org).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(signedIn(findUser(t, "admin")))
+	r.PUT("/users/:id", NewUserHandler().UpdateUser)
+	update := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/users/%d", user.ID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("update %s: %d %s", body, w.Code, w.Body)
+		}
+	}
+	live := func() int {
+		t.Helper()
+		sessions, err := session.Default.ListByUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(sessions)
+	}
+
+	tests := []struct {
+		body   string
+		revoke bool
+	}{
+		{`{"display_name":"Dan"}`, false},
+		{`{"role":"user"}`, false},
+		{`{"role":"operator"}`, true},
+		{fmt.Sprintf(`{"org_id":%d}`, org.ID), true},
+		{fmt.Sprintf(`{"org_id":%d,"email":"dan@example.com"}`, org.ID), false},
+		{`{"org_id":0}`, true},
+		{`{"password":"another123"}`, true},
+	}
+	for _, tt := range tests {
+		jti := startSession(t, user.ID)
+		update(tt.body)
+		revoked, _ := session.Default.IsRevoked(jti)
+		if tt.revoke && (live() != 0 || !revoked) {
+			t.Errorf("%s: %d session(s) left, token revoked %v; want signed out", tt.body, live(), revoked)
+		}
+		if !tt.revoke && (live() == 0 || revoked) {
+			t.Errorf("%s: signed out", tt.body)
+		}
+		session.RevokeUser(session.Default, user.ID)
+	}
+}
+
+func TestUserWritesSpareHigherRoles(t *testing.T) {
+	setupTestDB(t)
+	manager := createTestRole(t, "user-manager", model.DataScopeAll, "user:read", "user:write")
+	createTestRole(t, "user-target", model.DataScopeSelf, "user:read")
+	guarded := createTestUser(t, "guarded.admin", "admin", nil)
+	plain := createTestUser(t, "plain.user", "user-target", nil)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	for _, u := range []*model.User{guarded, plain} {
+		if err := data.DB.WithContext(ctx).Model(u).Updates(map[string]interface{}{"mfa_enabled": true, "mfa_secret": "JBSWY3DPEHPK3PXP"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewUserHandler()
+	r := gin.New()
+	r.Use(signedIn(createTestUser(t, "user.manager", manager.Name, nil)))
+	r.PUT("/users/:id", h.UpdateUser)
+	r.DELETE("/users/:id", h.DeleteUser)
+	r.POST("/users/:id/disable", h.DisableUser)
+	r.POST("/users/:id/mfa/reset", h.ResetUserMFA)
+	send := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, tt := range []struct {
+		user *model.User
+		want int
+	}{{guarded, http.StatusForbidden}, {plain, http.StatusOK}} {
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodPut, "/users/%d", `{"password":"hijacked123"}`},
+			{http.MethodPost, "/users/%d/mfa/reset", ""},
+			{http.MethodPost, "/users/%d/disable", ""},
+			{http.MethodDelete, "/users/%d", ""},
+		} {
+			if code := send(req.method, fmt.Sprintf(req.path, tt.user.ID), req.body); code != tt.want {
+				t.Errorf("%s %s of %s = %d, want %d", req.method, req.path, tt.user.Username, code, tt.want)
+			}
+		}
+	}
+
+	var got model.User
+	if err := data.DB.WithContext(ctx).First(&got, guarded.ID).Error; err != nil {
+		t.Fatalf("admin was deleted: %v", err)
+	}
+	if !got.CheckPassword("secret123") || got.Status != model.UserStatusActive || !got.MFAEnabled {
+		t.Fatalf("admin was changed: %+v", got)
+	}
+	if err := data.DB.WithContext(ctx).First(&got, plain.ID).Error; err == nil {
+		t.Fatal("user within the manager's grants was not deleted")
+	}
+}
+
+func TestEndingSessionsRevokesAPITokens(t *testing.T) {
+	setupTestDB(t)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	user := createTestUser(t, "tokens.eve", "user", nil)
+
+	r := gin.New()
+	r.Use(signedIn(findUser(t, "admin")))
+	h := NewUserHandler()
+	r.PUT("/users/:id", h.UpdateUser)
+	r.DELETE("/users/:id/sessions", h.TerminateUserSessions)
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodDelete, fmt.Sprintf("/users/%d/sessions", user.ID), ""},
+		{http.MethodPut, fmt.Sprintf("/users/%d", user.ID), `{"password":"another123"}`},
+	}
+	for _, tt := range tests {
+		_, hash := middleware.GenerateAPIToken()
+		token := model.APIToken{TenantID: data.DefaultTenantID, UserID: user.ID, Name: "ci", TokenHash: hash}
+		if err := data.DB.WithContext(ctx).Create(&token).Error; err != nil {
+			t.Fatal(err)
+		}
+		startSession(t, user.ID)
+
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", tt.method, tt.path, w.Code, w.Body)
+		}
+		var left int64
+		data.DB.WithContext(ctx).Model(&model.APIToken{}).Where("user_id = ?", user.ID).Count(&left)
+		if left != 0 {
+			t.Errorf("%s %s: %d API token(s) left", tt.method, tt.path, left)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"itam-backend/internal/data"
+	"itam-backend/internal/event"
+	"itam-backend/internal/model"
+	"itam-backend/internal/webhook"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookRequest create / update webhook request body
+type WebhookRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	URL          string   `json:"url" binding:"required,max=500"`
+	Events       []string `json:"events" binding:"required,min=1"` // e.g. "asset.created", "contract.*" or "*"
+	Active       *bool    `json:"active"`                          // defaults to true
+	RotateSecret bool     `json:"rotate_secret"`                   // update only: issue a new signing secret
+}
+
+// WebhookResponse a webhook, with its signing secret when just issued
+type WebhookResponse struct {
+	model.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+var webhookDeliveryListSpec = ListSpec{
+	SortColumns:   []string{"created_at"},
+	FilterColumns: []string{"status", "event_type", "event_id"},
+	DefaultSort:   "-id",
+}
+
+// WebhookHandler outbound webhook subscriptions and their delivery log
+type WebhookHandler struct {
+	dispatcher *webhook.Dispatcher
+}
+
+func NewWebhookHandler(dispatcher *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{dispatcher: dispatcher}
+}
+
+// GetEventTypes 可订阅的事件类型
+func (h *WebhookHandler) GetEventTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, event.AllTypes)
+}
+
+// GetWebhooks Webhook 订阅列表
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	var hooks []model.Webhook
+	if err := data.DB.WithContext(c).Order("id").Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// GetWebhook Webhook 订阅详情
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	var hook model.Webhook
+	if err := data.DB.WithContext(c).First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// CreateWebhook 创建 Webhook 订阅，签名密钥只在此返回一次
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.validateWebhookRequest(c, &req) {
+		return
+	}
+
+	hook := model.Webhook{
+		Name:      req.Name,
+		URL:       req.URL,
+		Secret:    newWebhookSecret(),
+		Events:    req.Events,
+		Active:    req.Active == nil || *req.Active,
+		CreatedBy: c.GetUint("userID"),
+	}
+	if err := data.DB.WithContext(c).Create(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, WebhookResponse{Webhook: hook, Secret: hook.Secret})
+}
+
+// UpdateWebhook 更新 Webhook 订阅，可轮换签名密钥
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	var hook model.Webhook
+	if err := data.DB.WithContext(c).First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.validateWebhookRequest(c, &req) {
+		return
+	}
+
+	hook.Name = req.Name
+	hook.URL = req.URL
+	hook.Events = req.Events
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	resp := WebhookResponse{}
+	if req.RotateSecret {
+		hook.Secret = newWebhookSecret()
+		resp.Secret = hook.Secret
+	}
+	if err := data.DB.WithContext(c).Save(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp.Webhook = hook
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteWebhook 删除 Webhook 订阅，未完成的投递随之失败
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	var hook model.Webhook
+	if err := data.DB.WithContext(c).First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err := data.DB.WithContext(c).Delete(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// GetDeliveries Webhook 投递日志（分页）
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	var hook model.Webhook
+	if err := data.DB.WithContext(c).First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	var deliveries []model.WebhookDelivery
+	query := data.DB.WithContext(c).Model(&model.WebhookDelivery{}).Where("webhook_id = ?", hook.ID)
+	respondList(c, query, webhookDeliveryListSpec, &deliveries)
+}
+
+// Redeliver 以原始内容重新投递一次
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	var old model.WebhookDelivery
+	if err := data.DB.WithContext(c).Where("webhook_id = ?", c.Param("id")).First(&old, c.Param("delivery_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	var hook model.Webhook
+	if err := data.DB.WithContext(c).First(&hook, old.WebhookID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if !hook.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook is disabled"})
+		return
+	}
+
+	delivery, err := h.dispatcher.Redeliver(c, &old)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// validateWebhookRequest checks the URL and event filters, writing the
+// error response when they are invalid
+func (h *WebhookHandler) validateWebhookRequest(c *gin.Context, req *WebhookRequest) bool {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL must be an absolute http or https URL"})
+		return false
+	}
+	if u.User != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL must not contain credentials, deliveries are signed instead"})
+		return false
+	}
+	if err := h.dispatcher.CheckURL(c, req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL is not allowed: " + err.Error()})
+		return false
+	}
+	for _, e := range req.Events {
+		if !event.IsValidFilter(e) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event: " + e})
+			return false
+		}
+	}
+	return true
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,144 @@
+// Package identity turns users vouched for by external identity
+// providers (OIDC, LDAP) into local accounts.
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Identity is a user asserted by an external identity provider
+type Identity struct {
+	Source      string // model.AuthSource*
+	ExternalID  string // stable ID at the provider, e.g. the OIDC sub
+	Username    string
+	DisplayName string
+	Email       string
+	Groups      []string
+}
+
+// Policy decides how identities become local users
+type Policy struct {
+	AutoProvision bool
+	Tenant        string // tenant code of new users
+	DefaultRole   string
+	RoleMappings  []conf.RoleMapping
+}
+
+// Error is a refused login with the HTTP status to answer with
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// ErrNotProvisioned is returned when an identity has no account and the
+// policy does not create one
+var ErrNotProvisioned = &Error{http.StatusForbidden, "No account is linked to this identity"}
+
+// MapRole returns the role of the first mapping whose group the user is
+// in, or fallback
+func MapRole(mappings []conf.RoleMapping, groups []string, fallback string) string {
+	member := map[string]bool{}
+	for _, g := range groups {
+		member[g] = true
+	}
+	for _, m := range mappings {
+		if member[m.Group] {
+			return m.Role
+		}
+	}
+	return fallback
+}
+
+// Provision finds the local account of an identity, creating it when the
+// policy allows. Profile fields are refreshed every time, and so is the
+// role when role mappings are set. ctx should carry the audit actor.
+func Provision(ctx context.Context, id *Identity, policy Policy) (*model.User, error) {
+	ctx = tenant.WithAll(ctx)
+
+	role := MapRole(policy.RoleMappings, id.Groups, policy.DefaultRole)
+	if role == "" {
+		role = "user"
+	}
+	var count int64
+	data.DB.Model(&model.Role{}).Where("name = ?", role).Count(&count)
+	if count == 0 {
+		return nil, &Error{http.StatusForbidden, "Mapped role does not exist: " + role}
+	}
+
+	var user model.User
+	err := data.DB.WithContext(ctx).Where("auth_source = ? AND external_id = ?", id.Source, id.ExternalID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !policy.AutoProvision {
+			return nil, ErrNotProvisioned
+		}
+		return create(ctx, id, policy.Tenant, role)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if id.DisplayName != "" && id.DisplayName != user.DisplayName {
+		updates["display_name"] = id.DisplayName
+	}
+	if id.Email != "" && id.Email != user.Email {
+		updates["email"] = id.Email
+	}
+	if len(policy.RoleMappings) > 0 && role != user.Role {
+		updates["role"] = role
+	}
+	if len(updates) > 0 {
+		if err := data.DB.WithContext(tenant.WithTenant(ctx, user.TenantID)).Model(&user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func create(ctx context.Context, id *Identity, tenantCode, role string) (*model.User, error) {
+	var t model.Tenant
+	if err := data.DB.Where("code = ?", tenantCode).First(&t).Error; err != nil {
+		return nil, &Error{http.StatusForbidden, "Tenant for new users not found: " + tenantCode}
+	}
+
+	// Usernames are global, never take over an account from another source
+	var count int64
+	data.DB.WithContext(ctx).Unscoped().Model(&model.User{}).Where("username = ?", id.Username).Count(&count)
+	if count > 0 {
+		return nil, &Error{http.StatusConflict, "Username already belongs to another account: " + id.Username}
+	}
+
+	user := model.User{
+		Username:    id.Username,
+		DisplayName: id.DisplayName,
+		Email:       id.Email,
+		Role:        role,
+		Status:      model.UserStatusActive,
+		AuthSource:  id.Source,
+		ExternalID:  id.ExternalID,
+	}
+	// Not a usable password, these users sign in through their provider
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := user.SetPassword(hex.EncodeToString(secret)); err != nil {
+		return nil, err
+	}
+	if err := data.DB.WithContext(tenant.WithTenant(ctx, t.ID)).Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,150 @@
+package identity
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/ldap"
+	"itam-backend/internal/model"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrBadCredentials is returned when the directory rejects a login
+var ErrBadCredentials = errors.New("invalid credentials")
+
+// LDAPDirectory authenticates and lists users of an LDAP or Active
+// Directory server
+type LDAPDirectory struct {
+	cfg *conf.LDAPConfig
+}
+
+func NewLDAPDirectory(cfg *conf.LDAPConfig) *LDAPDirectory {
+	return &LDAPDirectory{cfg: cfg}
+}
+
+// Policy returns the provisioning policy of directory users
+func (d *LDAPDirectory) Policy() Policy {
+	return Policy{
+		AutoProvision: d.cfg.AutoProvision,
+		Tenant:        d.cfg.Tenant,
+		DefaultRole:   d.cfg.DefaultRole,
+		RoleMappings:  d.cfg.RoleMappings,
+	}
+}
+
+// Authenticate looks the user up with the service account, then binds as
+// the user to check the password
+func (d *LDAPDirectory) Authenticate(username, password string) (*Identity, error) {
+	if username == "" || password == "" {
+		return nil, ErrBadCredentials
+	}
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(d.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     d.cfg.BaseDN,
+		Scope:      ldap.ScopeSubtree,
+		Filter:     filter,
+		Attributes: d.attributes(),
+		SizeLimit:  2,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap user search: %w", err)
+	}
+	if len(entries) != 1 {
+		// No such user, or an ambiguous filter
+		return nil, ErrBadCredentials
+	}
+
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		if ldap.IsInvalidCredentials(err) {
+			return nil, ErrBadCredentials
+		}
+		return nil, err
+	}
+	return d.identity(entries[0]), nil
+}
+
+// ListUsers returns every user matching the sync filter
+func (d *LDAPDirectory) ListUsers() ([]*Identity, error) {
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     d.cfg.BaseDN,
+		Scope:      ldap.ScopeSubtree,
+		Filter:     d.cfg.SyncFilter,
+		Attributes: d.attributes(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap sync search: %w", err)
+	}
+	var ids []*Identity
+	for _, e := range entries {
+		if id := d.identity(e); id.Username != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (d *LDAPDirectory) connect() (*ldap.Conn, error) {
+	conn, err := ldap.Dial(d.cfg.URL, ldap.DialOptions{
+		StartTLS:           d.cfg.StartTLS,
+		InsecureSkipVerify: d.cfg.InsecureSkipVerify,
+		Timeout:            d.cfg.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect: %w", err)
+	}
+	// Without a service account searches run anonymously
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (d *LDAPDirectory) attributes() []string {
+	attrs := []string{d.cfg.UsernameAttribute, d.cfg.DisplayNameAttribute, d.cfg.EmailAttribute, d.cfg.GroupAttribute}
+	if d.cfg.IDAttribute != "" {
+		attrs = append(attrs, d.cfg.IDAttribute)
+	}
+	return attrs
+}
+
+// identity maps a directory entry to an Identity. Groups hold both the
+// group DN and its first RDN value, so mappings may use either.
+func (d *LDAPDirectory) identity(e *ldap.Entry) *Identity {
+	id := &Identity{
+		Source:      model.AuthSourceLDAP,
+		ExternalID:  strings.ToLower(e.DN),
+		Username:    e.Get(d.cfg.UsernameAttribute),
+		DisplayName: e.Get(d.cfg.DisplayNameAttribute),
+		Email:       e.Get(d.cfg.EmailAttribute),
+	}
+	if d.cfg.IDAttribute != "" {
+		if v := e.Get(d.cfg.IDAttribute); v != "" {
+			// objectGUID and friends are binary
+			if !utf8.ValidString(v) {
+				v = hex.EncodeToString([]byte(v))
+			}
+			id.ExternalID = v
+		}
+	}
+	for _, g := range e.GetAll(d.cfg.GroupAttribute) {
+		id.Groups = append(id.Groups, g, ldap.RDNValue(g))
+	}
+	return id
+}
@@ -0,0 +1,75 @@
+package identity
+
+import (
+	"errors"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/ldap"
+	"net"
+	"testing"
+)
+
+func ldapEntry(dn string, attrs map[string]string) *ldap.Entry {
+	e := &ldap.Entry{DN: dn}
+	for name, value := range attrs {
+		e.Attributes = append(e.Attributes, ldap.Attribute{Name: name, Values: []string{value}})
+	}
+	return e
+}
+
+func testDirectory(t *testing.T) *LDAPDirectory {
+	t.Helper()
+	srv := ldap.NewMemoryServer([]*ldap.Entry{
+		ldapEntry("cn=svc,dc=example,dc=com", map[string]string{"cn": "svc", "userPassword": "svc"}),
+		ldapEntry("uid=alice,ou=people,dc=example,dc=com", map[string]string{
+			"objectClass": "person", "uid": "alice", "mail": "alice@example.com", "userPassword": "alice-pw",
+		}),
+		ldapEntry("uid=bob,ou=people,dc=example,dc=com", map[string]string{
+			"objectClass": "person", "uid": "bob", "userPassword": "bob-pw",
+		}),
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	return NewLDAPDirectory(&conf.LDAPConfig{
+		URL:               "ldap://" + l.Addr().String(),
+		BindDN:            "cn=svc,dc=example,dc=com",
+		BindPassword:      "svc",
+		BaseDN:            "dc=example,dc=com",
+		UserFilter:        "(&(objectClass=person)(uid={username}))",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+	})
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	d := testDirectory(t)
+
+	id, err := d.Authenticate("alice", "alice-pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Username != "alice" || id.Email != "alice@example.com" || id.ExternalID != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Fatalf("identity = %+v", id)
+	}
+
+	tests := []struct {
+		name               string
+		username, password string
+	}{
+		{"empty password", "alice", ""},
+		{"wrong password", "alice", "bob-pw"},
+		{"unknown user", "carol", "carol"},
+		{"wildcard username", "*", "alice-pw"},
+		{"injected filter", "*)(uid=*", "alice-pw"},
+		{"injected filter closing the and", "alice)(|(uid=*", "alice-pw"},
+	}
+	for _, tt := range tests {
+		if _, err := d.Authenticate(tt.username, tt.password); !errors.Is(err, ErrBadCredentials) {
+			t.Errorf("%s: err = %v, want ErrBadCredentials", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier bytes used by LDAPv3 (RFC 4511)
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	appBindRequest     = 0x60
+	appBindResponse    = 0x61
+	appUnbindRequest   = 0x42
+	appSearchRequest   = 0x63
+	appSearchEntry     = 0x64
+	appSearchDone      = 0x65
+	appSearchReference = 0x73
+	appExtendedRequest = 0x77
+	appExtendedResp    = 0x78
+
+	ctxSimpleAuth = 0x80
+	ctxExtName    = 0x80
+)
+
+const maxPacketSize = 16 << 20
+
+var errMalformed = errors.New("ldap: malformed packet")
+
+// packet is one BER element; constructed elements carry children,
+// primitive ones carry value
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+func (p *packet) constructed() bool { return p.tag&0x20 != 0 }
+
+func (p *packet) child(i int) *packet {
+	if i < len(p.children) {
+		return p.children[i]
+	}
+	return &packet{}
+}
+
+func (p *packet) str() string { return string(p.value) }
+
+func (p *packet) int() int64 {
+	var v int64
+	for i, b := range p.value {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+func seq(tag byte, children ...*packet) *packet {
+	return &packet{tag: tag, children: children}
+}
+
+func prim(tag byte, value []byte) *packet {
+	return &packet{tag: tag, value: value}
+}
+
+func octets(s string) *packet {
+	return prim(tagOctetString, []byte(s))
+}
+
+func integer(tag byte, v int64) *packet {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return prim(tag, b)
+}
+
+func boolean(v bool) *packet {
+	if v {
+		return prim(tagBoolean, []byte{0xff})
+	}
+	return prim(tagBoolean, []byte{0})
+}
+
+func (p *packet) encode() []byte {
+	content := p.value
+	if p.constructed() {
+		content = nil
+		for _, c := range p.children {
+			content = append(content, c.encode()...)
+		}
+	}
+
+	out := []byte{p.tag}
+	n := len(content)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	default:
+		var lb []byte
+		for ; n > 0; n >>= 8 {
+			lb = append([]byte{byte(n)}, lb...)
+		}
+		out = append(out, 0x80|byte(len(lb)))
+		out = append(out, lb...)
+	}
+	return append(out, content...)
+}
+
+// readPacket reads one complete BER element from r
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	n := int(first)
+	if first&0x80 != 0 {
+		size := int(first & 0x7f)
+		if size == 0 || size > 4 {
+			return nil, errMalformed
+		}
+		n = 0
+		for i := 0; i < size; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > maxPacketSize {
+		return nil, fmt.Errorf("ldap: packet of %d bytes too large", n)
+	}
+	content := make([]byte, n)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return decode(tag, content)
+}
+
+func decode(tag byte, content []byte) (*packet, error) {
+	p := &packet{tag: tag}
+	if !p.constructed() {
+		p.value = content
+		return p, nil
+	}
+	for len(content) > 0 {
+		if len(content) < 2 {
+			return nil, errMalformed
+		}
+		ctag, first := content[0], content[1]
+		pos, n := 2, int(first)
+		if first&0x80 != 0 {
+			size := int(first & 0x7f)
+			if size == 0 || size > 4 || len(content) < 2+size {
+				return nil, errMalformed
+			}
+			n = 0
+			for _, b := range content[2 : 2+size] {
+				n = n<<8 | int(b)
+			}
+			pos += size
+		}
+		if n < 0 || len(content) < pos+n {
+			return nil, errMalformed
+		}
+		child, err := decode(ctag, content[pos:pos+n])
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		content = content[pos+n:]
+	}
+	return p, nil
+}
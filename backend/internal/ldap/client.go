@@ -0,0 +1,295 @@
+// Package ldap is a small LDAPv3 client covering what authentication
+// needs (simple bind, search, StartTLS), plus an in-memory directory
+// server for local testing.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Result codes (RFC 4511 4.1.9)
+const (
+	ResultSuccess            = 0
+	ResultOperationsError    = 1
+	ResultProtocolError      = 2
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultInsufficientAccess = 50
+	ResultUnwillingToPerform = 53
+)
+
+// Search scopes
+const (
+	ScopeBase     = 0
+	ScopeOneLevel = 1
+	ScopeSubtree  = 2
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Error is an LDAP result other than success
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// IsInvalidCredentials reports whether err is a failed bind
+func IsInvalidCredentials(err error) bool {
+	var le *Error
+	return errors.As(err, &le) && le.Code == ResultInvalidCredentials
+}
+
+// Attribute is one attribute of an entry
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+// Entry is a directory entry
+type Entry struct {
+	DN         string
+	Attributes []Attribute
+}
+
+// GetAll returns the values of an attribute, names compare case-insensitively
+func (e *Entry) GetAll(name string) []string {
+	for _, a := range e.Attributes {
+		if strings.EqualFold(a.Name, name) {
+			return a.Values
+		}
+	}
+	return nil
+}
+
+// Get returns the first value of an attribute or ""
+func (e *Entry) Get(name string) string {
+	if v := e.GetAll(name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// DialOptions connection settings
+type DialOptions struct {
+	StartTLS           bool // upgrade ldap:// connections with StartTLS
+	InsecureSkipVerify bool // accept any server certificate, for testing only
+	Timeout            time.Duration
+}
+
+// Conn is a synchronous LDAP connection, one operation at a time
+type Conn struct {
+	conn    net.Conn
+	rd      *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial connects to an ldap:// or ldaps:// URL
+func Dial(rawURL string, opts DialOptions) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: opts.InsecureSkipVerify}
+
+	host := u.Host
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(host, "389")
+		}
+		conn, err = net.DialTimeout("tcp", host, opts.Timeout)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(host, "636")
+		}
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: opts.Timeout}, "tcp", host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{conn: conn, rd: bufio.NewReader(conn), timeout: opts.Timeout}
+	if u.Scheme == "ldap" && opts.StartTLS {
+		if err := c.startTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Close sends an unbind and closes the connection
+func (c *Conn) Close() error {
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	c.send(prim(appUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+// Bind authenticates with a simple bind. An empty password would be an
+// unauthenticated bind that servers accept for any DN, so it is refused.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return &Error{Code: ResultInvalidCredentials, Message: "empty password"}
+	}
+	resp, err := c.roundTrip(seq(appBindRequest,
+		integer(tagInteger, 3),
+		octets(dn),
+		prim(ctxSimpleAuth, []byte(password)),
+	))
+	if err != nil {
+		return err
+	}
+	return resultError(resp)
+}
+
+// SearchRequest search parameters
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string // empty returns all user attributes
+	SizeLimit  int
+}
+
+// Search runs a search and returns the matching entries; referrals are ignored
+func (c *Conn) Search(req *SearchRequest) ([]*Entry, error) {
+	filter, err := ParseFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := seq(tagSequence)
+	for _, a := range req.Attributes {
+		attrs.children = append(attrs.children, octets(a))
+	}
+
+	id, err := c.send(seq(appSearchRequest,
+		octets(req.BaseDN),
+		integer(tagEnumerated, int64(req.Scope)),
+		integer(tagEnumerated, 0), // never deref aliases
+		integer(tagInteger, int64(req.SizeLimit)),
+		integer(tagInteger, 0),
+		boolean(false),
+		filter.packet(),
+		attrs,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case appSearchEntry:
+			e := &Entry{DN: op.child(0).str()}
+			for _, a := range op.child(1).children {
+				attr := Attribute{Name: a.child(0).str()}
+				for _, v := range a.child(1).children {
+					attr.Values = append(attr.Values, v.str())
+				}
+				e.Attributes = append(e.Attributes, attr)
+			}
+			entries = append(entries, e)
+		case appSearchReference:
+		case appSearchDone:
+			return entries, resultError(op)
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response 0x%02x to search", op.tag)
+		}
+	}
+}
+
+func (c *Conn) startTLS(config *tls.Config) error {
+	resp, err := c.roundTrip(seq(appExtendedRequest, prim(ctxExtName, []byte(startTLSOID))))
+	if err != nil {
+		return err
+	}
+	if err := resultError(resp); err != nil {
+		return fmt.Errorf("ldap: StartTLS refused: %w", err)
+	}
+	tc := tls.Client(c.conn, config)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	c.conn, c.rd = tc, bufio.NewReader(tc)
+	return nil
+}
+
+func (c *Conn) send(op *packet) (int64, error) {
+	c.msgID++
+	msg := seq(tagSequence, integer(tagInteger, c.msgID), op)
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(msg.encode())
+	return c.msgID, err
+}
+
+func (c *Conn) receive(id int64) (*packet, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	msg, err := readPacket(c.rd)
+	if err != nil {
+		return nil, err
+	}
+	if msg.tag != tagSequence || len(msg.children) < 2 {
+		return nil, errMalformed
+	}
+	if got := msg.child(0).int(); got != id {
+		return nil, fmt.Errorf("ldap: response for message %d, expected %d", got, id)
+	}
+	return msg.child(1), nil
+}
+
+func (c *Conn) roundTrip(op *packet) (*packet, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	return c.receive(id)
+}
+
+// resultError turns an LDAPResult into an error, nil on success
+func resultError(op *packet) error {
+	code := int(op.child(0).int())
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{Code: code, Message: op.child(2).str()}
+}
+
+// RDNValue returns the value of the first RDN of a DN, e.g. "admins" for
+// "cn=admins,ou=groups,dc=example,dc=com"
+func RDNValue(dn string) string {
+	first := dn
+	if i := strings.IndexByte(dn, ','); i >= 0 {
+		first = dn[:i]
+	}
+	if i := strings.IndexByte(first, '='); i >= 0 {
+		return strings.TrimSpace(first[i+1:])
+	}
+	return first
+}
@@ -0,0 +1,293 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Filter choice tags (RFC 4511 4.5.1)
+const (
+	filterAnd       = 0xa0
+	filterOr        = 0xa1
+	filterNot       = 0xa2
+	filterEqual     = 0xa3
+	filterSubstring = 0xa4
+	filterGreater   = 0xa5
+	filterLess      = 0xa6
+	filterPresent   = 0x87
+	filterApprox    = 0xa8
+
+	subInitial = 0x80
+	subAny     = 0x81
+	subFinal   = 0x82
+)
+
+// Filter is a parsed search filter such as "(&(objectClass=person)(uid=bob))"
+type Filter struct {
+	op       byte
+	attr     string
+	value    string
+	children []*Filter
+
+	// substring filter parts, as in "(cn=initial*any*final)"
+	initial string
+	any     []string
+	final   string
+}
+
+// EscapeFilter escapes a value for use inside a filter string
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ParseFilter parses the string representation of a search filter (RFC 4515)
+func ParseFilter(s string) (*Filter, error) {
+	s = strings.TrimSpace(s)
+	f, rest, err := parseFilter(s)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid filter %q: %w", s, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("ldap: invalid filter %q: trailing %q", s, rest)
+	}
+	return f, nil
+}
+
+func parseFilter(s string) (*Filter, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("expected '('")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", fmt.Errorf("unexpected end")
+	}
+
+	switch s[0] {
+	case '&', '|', '!':
+		f := &Filter{op: map[byte]byte{'&': filterAnd, '|': filterOr, '!': filterNot}[s[0]]}
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			f.children = append(f.children, child)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", fmt.Errorf("expected ')'")
+		}
+		if f.op == filterNot && len(f.children) != 1 {
+			return nil, "", fmt.Errorf("'!' takes exactly one filter")
+		}
+		return f, s[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("expected ')'")
+	}
+	item, rest := s[:end], s[end+1:]
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, "", fmt.Errorf("expected attr=value")
+	}
+	attr, raw := item[:eq], item[eq+1:]
+
+	f := &Filter{op: filterEqual, attr: attr}
+	switch attr[len(attr)-1] {
+	case '>':
+		f.op, f.attr = filterGreater, attr[:len(attr)-1]
+	case '<':
+		f.op, f.attr = filterLess, attr[:len(attr)-1]
+	case '~':
+		f.op, f.attr = filterApprox, attr[:len(attr)-1]
+	}
+	if f.op == filterEqual && raw == "*" {
+		f.op = filterPresent
+		return f, rest, nil
+	}
+	if f.op == filterEqual && strings.Contains(raw, "*") {
+		parts := strings.Split(raw, "*")
+		f.op = filterSubstring
+		var err error
+		if f.initial, err = unescape(parts[0]); err != nil {
+			return nil, "", err
+		}
+		if f.final, err = unescape(parts[len(parts)-1]); err != nil {
+			return nil, "", err
+		}
+		for _, p := range parts[1 : len(parts)-1] {
+			if p == "" {
+				continue
+			}
+			v, err := unescape(p)
+			if err != nil {
+				return nil, "", err
+			}
+			f.any = append(f.any, v)
+		}
+		return f, rest, nil
+	}
+	v, err := unescape(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	f.value = v
+	return f, rest, nil
+}
+
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("bad escape")
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("bad escape")
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func (f *Filter) packet() *packet {
+	switch f.op {
+	case filterAnd, filterOr, filterNot:
+		p := seq(f.op)
+		for _, c := range f.children {
+			p.children = append(p.children, c.packet())
+		}
+		return p
+	case filterPresent:
+		return prim(filterPresent, []byte(f.attr))
+	case filterSubstring:
+		subs := seq(tagSequence)
+		if f.initial != "" {
+			subs.children = append(subs.children, prim(subInitial, []byte(f.initial)))
+		}
+		for _, a := range f.any {
+			subs.children = append(subs.children, prim(subAny, []byte(a)))
+		}
+		if f.final != "" {
+			subs.children = append(subs.children, prim(subFinal, []byte(f.final)))
+		}
+		return seq(filterSubstring, octets(f.attr), subs)
+	default:
+		return seq(f.op, octets(f.attr), octets(f.value))
+	}
+}
+
+func filterFromPacket(p *packet) (*Filter, error) {
+	f := &Filter{op: p.tag}
+	switch p.tag {
+	case filterAnd, filterOr, filterNot:
+		for _, c := range p.children {
+			child, err := filterFromPacket(c)
+			if err != nil {
+				return nil, err
+			}
+			f.children = append(f.children, child)
+		}
+	case filterPresent:
+		f.attr = p.str()
+	case filterSubstring:
+		f.attr = p.child(0).str()
+		for _, s := range p.child(1).children {
+			switch s.tag {
+			case subInitial:
+				f.initial = s.str()
+			case subAny:
+				f.any = append(f.any, s.str())
+			case subFinal:
+				f.final = s.str()
+			}
+		}
+	case filterEqual, filterGreater, filterLess, filterApprox:
+		f.attr, f.value = p.child(0).str(), p.child(1).str()
+	default:
+		return nil, fmt.Errorf("ldap: unsupported filter tag 0x%02x", p.tag)
+	}
+	return f, nil
+}
+
+// Match evaluates the filter against an entry, comparing values case-insensitively
+func (f *Filter) Match(e *Entry) bool {
+	switch f.op {
+	case filterAnd:
+		for _, c := range f.children {
+			if !c.Match(e) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, c := range f.children {
+			if c.Match(e) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !f.children[0].Match(e)
+	case filterPresent:
+		return strings.EqualFold(f.attr, "objectClass") || len(e.GetAll(f.attr)) > 0
+	}
+
+	for _, v := range e.GetAll(f.attr) {
+		lv := strings.ToLower(v)
+		switch f.op {
+		case filterEqual, filterApprox:
+			if lv == strings.ToLower(f.value) {
+				return true
+			}
+		case filterGreater:
+			if lv >= strings.ToLower(f.value) {
+				return true
+			}
+		case filterLess:
+			if lv <= strings.ToLower(f.value) {
+				return true
+			}
+		case filterSubstring:
+			if matchSubstring(lv, strings.ToLower(f.initial), f.any, strings.ToLower(f.final)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchSubstring(v, initial string, any []string, final string) bool {
+	if !strings.HasPrefix(v, initial) {
+		return false
+	}
+	v = v[len(initial):]
+	for _, a := range any {
+		i := strings.Index(v, strings.ToLower(a))
+		if i < 0 {
+			return false
+		}
+		v = v[i+len(a):]
+	}
+	return strings.HasSuffix(v, final)
+}
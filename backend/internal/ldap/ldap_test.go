@@ -0,0 +1,133 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+)
+
+var testEntries = []*Entry{
+	{DN: "cn=svc,dc=example,dc=com", Attributes: []Attribute{
+		{Name: "cn", Values: []string{"svc"}},
+		{Name: "userPassword", Values: []string{"svc"}},
+	}},
+	{DN: "uid=alice,ou=people,dc=example,dc=com", Attributes: []Attribute{
+		{Name: "objectClass", Values: []string{"person"}},
+		{Name: "uid", Values: []string{"alice"}},
+		{Name: "userPassword", Values: []string{"alice-pw"}},
+	}},
+	{DN: "uid=bob,ou=people,dc=example,dc=com", Attributes: []Attribute{
+		{Name: "objectClass", Values: []string{"person"}},
+		{Name: "uid", Values: []string{"bob"}},
+		{Name: "userPassword", Values: []string{"bob-pw"}},
+	}},
+}
+
+// dialMemory serves entries on a loopback port and returns a connection
+func dialMemory(t *testing.T, entries []*Entry) *Conn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewMemoryServer(entries).Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	conn, err := Dial("ldap://"+l.Addr().String(), DialOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"*", `\2a`},
+		{"*)(uid=*", `\2a\29\28uid=\2a`},
+		{`a\b`, `a\5cb`},
+		{"nul\x00", `nul\00`},
+	}
+	for _, tt := range tests {
+		if got := EscapeFilter(tt.in); got != tt.want {
+			t.Errorf("EscapeFilter(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// The escaped value parses back to a single equality on the literal text
+	f, err := ParseFilter("(uid=" + EscapeFilter("*)(uid=*") + ")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.value != "*)(uid=*" {
+		t.Fatalf("filter value = %q", f.value)
+	}
+	if f.Match(testEntries[1]) {
+		t.Fatal("escaped wildcard matched alice")
+	}
+}
+
+func TestSearchWithInjectedInput(t *testing.T) {
+	conn := dialMemory(t, testEntries)
+	if err := conn.Bind("cn=svc,dc=example,dc=com", "svc"); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(filter string) []*Entry {
+		t.Helper()
+		entries, err := conn.Search(&SearchRequest{BaseDN: "dc=example,dc=com", Scope: ScopeSubtree, Filter: filter})
+		if err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+		return entries
+	}
+
+	// Unescaped, the login name would widen the filter to every user
+	if got := search("(&(objectClass=person)(uid=*))"); len(got) != 2 {
+		t.Fatalf("wildcard search found %d entries, want 2", len(got))
+	}
+	for _, input := range []string{"*", "*)(uid=*", "alice)(uid=*"} {
+		if got := search("(&(objectClass=person)(uid=" + EscapeFilter(input) + "))"); len(got) != 0 {
+			t.Errorf("escaped %q found %d entries", input, len(got))
+		}
+	}
+	if got := search("(&(objectClass=person)(uid=" + EscapeFilter("alice") + "))"); len(got) != 1 || got[0].Get("uid") != "alice" {
+		t.Fatalf("search for alice = %v", got)
+	}
+	if got := search("(uid=alice)"); got[0].Get("userPassword") != "" {
+		t.Fatal("search returned userPassword")
+	}
+}
+
+func TestBindRejectsEmptyPassword(t *testing.T) {
+	conn := dialMemory(t, testEntries)
+
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", ""); !IsInvalidCredentials(err) {
+		t.Fatalf("client bind with empty password: err = %v", err)
+	}
+
+	// The server refuses an unauthenticated bind sent by another client
+	resp, err := conn.roundTrip(seq(appBindRequest,
+		integer(tagInteger, 3),
+		octets("uid=alice,ou=people,dc=example,dc=com"),
+		prim(ctxSimpleAuth, nil),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resultError(resp); !IsInvalidCredentials(err) {
+		t.Fatalf("server bind with empty password: err = %v", err)
+	}
+	if _, err := conn.Search(&SearchRequest{BaseDN: "dc=example,dc=com", Scope: ScopeSubtree, Filter: "(uid=*)"}); err == nil {
+		t.Fatal("search allowed after a refused bind")
+	}
+
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", "wrong"); !IsInvalidCredentials(err) {
+		t.Fatalf("bind with wrong password: err = %v", err)
+	}
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", "alice-pw"); err != nil {
+		t.Fatalf("bind with the right password: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// MemoryServer is an in-memory directory answering simple binds and
+// searches, for development and testing. Passwords are read from the
+// userPassword attribute, which is never returned by searches.
+type MemoryServer struct {
+	mu      sync.RWMutex
+	entries []*Entry
+}
+
+func NewMemoryServer(entries []*Entry) *MemoryServer {
+	return &MemoryServer{entries: entries}
+}
+
+// SetEntries replaces the directory contents
+func (s *MemoryServer) SetEntries(entries []*Entry) {
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+}
+
+// Serve accepts connections until the listener is closed
+func (s *MemoryServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *MemoryServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	bound := false
+
+	for {
+		msg, err := readPacket(rd)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("ldap: %v", err)
+			}
+			return
+		}
+		id, op := msg.child(0).int(), msg.child(1)
+
+		reply := func(p *packet) {
+			conn.Write(seq(tagSequence, integer(tagInteger, id), p).encode())
+		}
+		result := func(tag byte, code int, text string) {
+			reply(seq(tag, integer(tagEnumerated, int64(code)), octets(""), octets(text)))
+		}
+
+		switch op.tag {
+		case appUnbindRequest:
+			return
+
+		case appBindRequest:
+			dn, password := op.child(1).str(), op.child(2).str()
+			if dn == "" && password == "" {
+				bound = false
+				result(appBindResponse, ResultSuccess, "")
+				continue
+			}
+			e := s.find(dn)
+			if e == nil || password == "" || e.Get("userPassword") != password {
+				bound = false
+				result(appBindResponse, ResultInvalidCredentials, "invalid credentials")
+				continue
+			}
+			bound = true
+			result(appBindResponse, ResultSuccess, "")
+
+		case appSearchRequest:
+			if !bound {
+				result(appSearchDone, ResultInsufficientAccess, "bind required")
+				continue
+			}
+			filter, err := filterFromPacket(op.child(6))
+			if err != nil {
+				result(appSearchDone, ResultProtocolError, err.Error())
+				continue
+			}
+			var attrs []string
+			for _, a := range op.child(7).children {
+				attrs = append(attrs, a.str())
+			}
+			base, scope, limit := op.child(0).str(), int(op.child(1).int()), int(op.child(3).int())
+
+			sent, code := 0, ResultSuccess
+			for _, e := range s.search(base, scope, filter) {
+				if limit > 0 && sent == limit {
+					code = ResultSizeLimitExceeded
+					break
+				}
+				reply(entryPacket(e, attrs))
+				sent++
+			}
+			result(appSearchDone, code, "")
+
+		case appExtendedRequest:
+			result(appExtendedResp, ResultProtocolError, "extended operations are not supported")
+
+		default:
+			result(appSearchDone, ResultUnwillingToPerform, "operation not supported")
+		}
+	}
+}
+
+func (s *MemoryServer) find(dn string) *Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.entries {
+		if normalizeDN(e.DN) == normalizeDN(dn) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *MemoryServer) search(base string, scope int, filter *Filter) []*Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nb := normalizeDN(base)
+	var out []*Entry
+	for _, e := range s.entries {
+		dn := normalizeDN(e.DN)
+		var inScope bool
+		switch scope {
+		case ScopeBase:
+			inScope = dn == nb
+		case ScopeOneLevel:
+			inScope = strings.HasSuffix(dn, ","+nb) && !strings.Contains(strings.TrimSuffix(dn, ","+nb), ",")
+		default:
+			inScope = dn == nb || nb == "" || strings.HasSuffix(dn, ","+nb)
+		}
+		if inScope && filter.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func entryPacket(e *Entry, attrs []string) *packet {
+	want := map[string]bool{}
+	for _, a := range attrs {
+		want[strings.ToLower(a)] = true
+	}
+	list := seq(tagSequence)
+	for _, a := range e.Attributes {
+		name := strings.ToLower(a.Name)
+		if name == "userpassword" || (len(want) > 0 && !want[name] && !want["*"]) {
+			continue
+		}
+		vals := seq(tagSet)
+		for _, v := range a.Values {
+			vals.children = append(vals.children, octets(v))
+		}
+		list.children = append(list.children, seq(tagSequence, octets(a.Name), vals))
+	}
+	return seq(appSearchEntry, octets(e.DN), list)
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(p))
+	}
+	return strings.Join(parts, ",")
+}
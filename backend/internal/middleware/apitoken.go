@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+)
+
+// APITokenPrefix starts every personal API token, telling them apart from
+// JWT access tokens
+const APITokenPrefix = "itam_"
+
+// lastUsedInterval limits how often last_used_at is written per token
+const lastUsedInterval = time.Minute
+
+// GenerateAPIToken returns a new API token and its stored hash
+func GenerateAPIToken() (token, hash string) {
+	token = APITokenPrefix + session.NewID() + session.NewID()
+	return token, session.HashSecret(token)
+}
+
+// authenticateAPIToken sets the request identity from a personal API
+// token. The owner's current role applies, narrowed by the token scopes.
+func authenticateAPIToken(c *gin.Context, token string) (int, string) {
+	now := time.Now()
+	ctx := tenant.WithAll(context.Background())
+
+	var t model.APIToken
+	if err := data.DB.WithContext(ctx).Where("token_hash = ?", session.HashSecret(token)).First(&t).Error; err != nil || t.ExpiredAt(now) {
+		return http.StatusUnauthorized, "Invalid or expired token"
+	}
+	if !t.AllowsIP(c.ClientIP()) {
+		return http.StatusForbidden, "Token is not allowed from this address"
+	}
+
+	var user model.User
+	if err := data.DB.WithContext(ctx).First(&user, t.UserID).Error; err != nil || !user.IsActive() || user.LockedAt(now) {
+		return http.StatusUnauthorized, "Token owner is disabled"
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > lastUsedInterval || t.LastUsedIP != c.ClientIP() {
+		// Not audited, it changes all the time
+		data.DB.WithContext(tenant.WithTenant(context.Background(), t.TenantID)).Model(&model.APIToken{}).
+			Where("id = ?", t.ID).
+			UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": c.ClientIP()})
+	}
+
+	c.Set("userID", user.ID)
+	c.Set("tenantID", user.TenantID)
+	if user.OrgID != nil {
+		c.Set("orgID", *user.OrgID)
+	} else {
+		c.Set("orgID", uint(0))
+	}
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("apiTokenID", t.ID)
+	c.Set("tokenScopes", []string(t.Scopes))
+	return 0, ""
+}
+
+// tokenGrants reports whether the API token of the request, if any,
+// covers perm
+func tokenGrants(c *gin.Context, perm string) bool {
+	scopes, ok := c.Get("tokenScopes")
+	if !ok {
+		return true
+	}
+	return model.PermissionsGrant(scopes.([]string), perm)
+}
+
+// IsAPIToken reports whether the request authenticated with an API token
+func IsAPIToken(c *gin.Context) bool {
+	_, ok := c.Get("apiTokenID")
+	return ok
+}
+
+// RejectAPITokens keeps API tokens away from account management, such as
+// passwords, two-factor settings and minting further tokens
+func RejectAPITokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsAPIToken(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not available to API tokens, sign in instead"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "itam-middleware-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.InitDB(&conf.Config{Database: conf.DatabaseConfig{Driver: "sqlite", DbName: filepath.Join(dir, "itam.db")}})
+}
+
+// createTestToken stores an API token of the admin user and returns it
+func createTestToken(t *testing.T, token model.APIToken) (string, model.APIToken) {
+	t.Helper()
+	var admin model.User
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).Where("username = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	plain, hash := GenerateAPIToken()
+	token.TenantID, token.UserID, token.Name, token.TokenHash = admin.TenantID, admin.ID, "test", hash
+	if token.Scopes == nil {
+		token.Scopes = model.StringList{model.PermAll}
+	}
+	if err := data.DB.WithContext(tenant.WithTenant(context.Background(), admin.TenantID)).Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+	return plain, token
+}
+
+// newTokenEngine serves /assets behind the authentication and permission
+// middleware, trusting X-Forwarded-For only from the given proxies
+func newTokenEngine(t *testing.T, proxies []string) *gin.Engine {
+	t.Helper()
+	r := gin.New()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(JWTAuthMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/assets", RequirePermission(model.PermAssetRead), ok)
+	r.DELETE("/assets", RequirePermission(model.PermAssetWrite), ok)
+	return r
+}
+
+func sendToken(r *gin.Engine, method, token, remote, forwarded string) int {
+	req := httptest.NewRequest(method, "/assets", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.RemoteAddr = remote + ":40000"
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPITokenAllowlist(t *testing.T) {
+	setupTestDB(t)
+	token, _ := createTestToken(t, model.APIToken{AllowedIPs: model.StringList{"10.1.0.0/16", "192.0.2.7"}})
+
+	direct := newTokenEngine(t, nil)
+	tests := []struct {
+		remote, forwarded string
+		want              int
+	}{
+		{"10.1.2.3", "", http.StatusOK},
+		{"192.0.2.7", "", http.StatusOK},
+		{"198.51.100.1", "", http.StatusForbidden},
+		// A client cannot claim an allowed address for itself
+		{"198.51.100.1", "10.1.2.3", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := sendToken(direct, http.MethodGet, token, tt.remote, tt.forwarded); code != tt.want {
+			t.Errorf("from %s forwarding %q: %d, want %d", tt.remote, tt.forwarded, code, tt.want)
+		}
+	}
+
+	// Behind a trusted proxy the forwarded address is the client
+	proxied := newTokenEngine(t, []string{"172.16.0.0/12"})
+	if code := sendToken(proxied, http.MethodGet, token, "172.16.0.2", "10.1.2.3"); code != http.StatusOK {
+		t.Errorf("allowed client behind the proxy: %d", code)
+	}
+	if code := sendToken(proxied, http.MethodGet, token, "172.16.0.2", "198.51.100.1"); code != http.StatusForbidden {
+		t.Errorf("other client behind the proxy: %d", code)
+	}
+}
+
+func TestAPITokenRecordsClientAddress(t *testing.T) {
+	setupTestDB(t)
+	token, stored := createTestToken(t, model.APIToken{})
+
+	if code := sendToken(newTokenEngine(t, nil), http.MethodGet, token, "198.51.100.9", "10.9.9.9"); code != http.StatusOK {
+		t.Fatalf("request: %d", code)
+	}
+	var got model.APIToken
+	data.DB.WithContext(tenant.WithAll(context.Background())).First(&got, stored.ID)
+	if got.LastUsedIP != "198.51.100.9" || got.LastUsedAt == nil {
+		t.Fatalf("last used from %q at %v, want 198.51.100.9", got.LastUsedIP, got.LastUsedAt)
+	}
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	setupTestDB(t)
+	r := newTokenEngine(t, nil)
+	readOnly, _ := createTestToken(t, model.APIToken{Scopes: model.StringList{model.PermAssetRead}})
+	writer, _ := createTestToken(t, model.APIToken{Scopes: model.StringList{"asset:*"}})
+
+	tests := []struct {
+		name, token, method string
+		want                int
+	}{
+		{"read with read scope", readOnly, http.MethodGet, http.StatusOK},
+		{"write with read scope", readOnly, http.MethodDelete, http.StatusForbidden},
+		{"write with asset scopes", writer, http.MethodDelete, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := sendToken(r, tt.method, tt.token, "192.0.2.1", ""); code != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestAPITokenExpiry(t *testing.T) {
+	setupTestDB(t)
+	r := newTokenEngine(t, nil)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	expired, _ := createTestToken(t, model.APIToken{ExpiresAt: &past})
+	valid, _ := createTestToken(t, model.APIToken{ExpiresAt: &future})
+
+	if code := sendToken(r, http.MethodGet, expired, "192.0.2.1", ""); code != http.StatusUnauthorized {
+		t.Errorf("expired token: %d", code)
+	}
+	if code := sendToken(r, http.MethodGet, valid, "192.0.2.1", ""); code != http.StatusOK {
+		t.Errorf("unexpired token: %d", code)
+	}
+	if code := sendToken(r, http.MethodGet, "itam_unknown", "192.0.2.1", ""); code != http.StatusUnauthorized {
+		t.Errorf("unknown token: %d", code)
+	}
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"itam-backend/internal/audit"
+)
+
+// AuditContext attaches the authenticated caller to the request so that
+// database writes made with data.DB.WithContext(c) are recorded in the audit log.
+// It must run after JWTAuthMiddleware.
+func AuditContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(audit.ActorKey, audit.Actor{
+			UserID:    c.GetUint("userID"),
+			Username:  c.GetString("username"),
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Next()
+	}
+}
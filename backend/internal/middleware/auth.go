@@ -1,38 +1,120 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
 )
 
-var jwtSecret = []byte("your-secret-key-change-in-production")
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// InitAuth loads the JWT keys and token lifetimes from the configuration.
+// Release mode refuses to start with the built-in development secret.
+func InitAuth(cfg *conf.Config) {
+	if err := loadKeys(&cfg.Auth); err != nil {
+		log.Fatalf("Invalid JWT key configuration: %v", err)
+	}
+	if err := checkDefaultKey(cfg.Server.Mode); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+	if usingDefaultKey {
+		log.Printf("Warning: using the default JWT secret, tokens can be forged by anyone who knows it")
+	}
+
+	if cfg.Auth.AccessTokenTTL > 0 {
+		accessTokenTTL = cfg.Auth.AccessTokenTTL
+	}
+	if cfg.Auth.RefreshTokenTTL > 0 {
+		refreshTokenTTL = cfg.Auth.RefreshTokenTTL
+	}
+}
+
+// RefreshTokenTTL returns how long a session lives without being refreshed
+func RefreshTokenTTL() time.Duration {
+	return refreshTokenTTL
+}
 
 // Claims JWT claims structure
 type Claims struct {
 	UserID   uint   `json:"user_id"`
+	TenantID uint   `json:"tenant_id"`
+	OrgID    uint   `json:"org_id,omitempty"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	// SessionID ties the token to the refresh session that issued it,
+	// the token's own ID is RegisteredClaims.ID (jti)
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token
-func GenerateToken(userID uint, username, role string) (string, error) {
+// GenerateToken generates a short-lived access token for the user within
+// the given session; role and organization changes take effect on the
+// next login or refresh
+func GenerateToken(user *model.User, sessionID string) (string, *Claims, error) {
+	var orgID uint
+	if user.OrgID != nil {
+		orgID = *user.OrgID
+	}
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:    user.ID,
+		OrgID:     orgID,
+		TenantID:  user.TenantID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        session.NewID(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	signed, err := signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, &claims, nil
+}
+
+// parseToken validates an access token and checks it has not been revoked.
+// Tokens without a jti predate revocation support and are rejected.
+func parseToken(tokenString string) (*Claims, int, string) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
+	// Audience-bound tokens (OIDC state, MFA challenges) are not access tokens
+	if err != nil || !token.Valid || claims.ID == "" || len(claims.Audience) > 0 {
+		return nil, http.StatusUnauthorized, "Invalid or expired token"
+	}
+
+	revoked, err := session.Default.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, "Session store unavailable"
+	}
+	if revoked {
+		return nil, http.StatusUnauthorized, "Token has been revoked"
+	}
+	return claims, 0, ""
+}
+
+func setClaims(c *gin.Context, claims *Claims) {
+	c.Set("userID", claims.UserID)
+	c.Set("tenantID", claims.TenantID)
+	c.Set("orgID", claims.OrgID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("sessionID", claims.SessionID)
+	c.Set("tokenID", claims.ID)
+	c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
 }
 
 // JWTAuthMiddleware validates JWT token
@@ -53,23 +135,25 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		if isAPIToken(parts[1]) {
+			if status, msg := authenticateAPIToken(c, parts[1]); status != 0 {
+				c.JSON(status, gin.H{"error": msg})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		claims, status, msg := parseToken(parts[1])
+		if claims == nil {
+			c.JSON(status, gin.H{"error": msg})
 			c.Abort()
 			return
 		}
 
 		// Set user info in context
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		setClaims(c, claims)
 
 		c.Next()
 	}
@@ -90,17 +174,8 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-
-		if err == nil && token.Valid {
-			c.Set("userID", claims.UserID)
-			c.Set("username", claims.Username)
-			c.Set("role", claims.Role)
+		if claims, _, _ := parseToken(parts[1]); claims != nil {
+			setClaims(c, claims)
 		}
 
 		c.Next()
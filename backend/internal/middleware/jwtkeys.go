@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"itam-backend/internal/conf"
+)
+
+// defaultJWTSecret is only good for local development
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// defaultKeyID is the kid of the key built from auth.jwt_secret
+const defaultKeyID = "default"
+
+// jwtKey is a loaded signing or verification key
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{} // nil for verification-only keys
+	verify interface{}
+}
+
+var (
+	signingKey      = &jwtKey{id: defaultKeyID, method: jwt.SigningMethodHS256, sign: []byte(defaultJWTSecret), verify: []byte(defaultJWTSecret)}
+	verificationKey = map[string]*jwtKey{defaultKeyID: signingKey}
+	usingDefaultKey = true
+)
+
+// loadKeys builds the key set from the auth configuration
+func loadKeys(cfg *conf.AuthConfig) error {
+	keyCfgs := cfg.Keys
+	if len(keyCfgs) == 0 {
+		secret := cfg.JWTSecret
+		if secret == "" {
+			secret = defaultJWTSecret
+		}
+		keyCfgs = []conf.JWTKeyConfig{{ID: defaultKeyID, Algorithm: "HS256", Secret: secret}}
+	}
+
+	keys := map[string]*jwtKey{}
+	usesDefault := false
+	for _, kc := range keyCfgs {
+		if kc.ID == "" {
+			return errors.New("every auth.keys entry needs an id")
+		}
+		if _, dup := keys[kc.ID]; dup {
+			return fmt.Errorf("duplicate JWT key id %q", kc.ID)
+		}
+		key, err := loadKey(&kc)
+		if err != nil {
+			return fmt.Errorf("JWT key %q: %w", kc.ID, err)
+		}
+		if secret, ok := key.verify.([]byte); ok && string(secret) == defaultJWTSecret {
+			usesDefault = true
+		}
+		keys[kc.ID] = key
+	}
+
+	signID := cfg.SigningKey
+	if signID == "" {
+		signID = keyCfgs[0].ID
+	}
+	signer, ok := keys[signID]
+	if !ok {
+		return fmt.Errorf("signing key %q is not listed in auth.keys", signID)
+	}
+	if signer.sign == nil {
+		return fmt.Errorf("signing key %q has no private key", signID)
+	}
+
+	signingKey, verificationKey, usingDefaultKey = signer, keys, usesDefault
+	return nil
+}
+
+// checkDefaultKey refuses the built-in development secret in release mode
+func checkDefaultKey(mode string) error {
+	if usingDefaultKey && mode == "release" {
+		return errors.New("release mode with the default JWT secret, set auth.jwt_secret or ITAM_JWT_SECRET")
+	}
+	return nil
+}
+
+func loadKey(kc *conf.JWTKeyConfig) (*jwtKey, error) {
+	key := &jwtKey{id: kc.ID}
+
+	switch strings.ToUpper(kc.Algorithm) {
+	case "", "HS256":
+		secret := kc.Secret
+		if kc.SecretFile != "" {
+			b, err := os.ReadFile(kc.SecretFile)
+			if err != nil {
+				return nil, err
+			}
+			secret = strings.TrimSpace(string(b))
+		}
+		if len(secret) < 16 {
+			return nil, errors.New("HS256 secret must be at least 16 characters")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign, key.verify = []byte(secret), []byte(secret)
+
+	case "RS256", "EDDSA":
+		if strings.ToUpper(kc.Algorithm) == "RS256" {
+			key.method = jwt.SigningMethodRS256
+		} else {
+			key.method = jwt.SigningMethodEdDSA
+		}
+		if kc.PrivateKeyFile != "" {
+			priv, err := readPrivateKey(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			key.sign = priv
+			switch k := priv.(type) {
+			case *rsa.PrivateKey:
+				key.verify = &k.PublicKey
+			case ed25519.PrivateKey:
+				key.verify = k.Public()
+			}
+		}
+		if kc.PublicKeyFile != "" {
+			pub, err := readPublicKey(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			key.verify = pub
+		}
+		if key.verify == nil {
+			return nil, errors.New("private_key_file or public_key_file is required")
+		}
+		if err := checkKeyType(key); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, use HS256, RS256 or EdDSA", kc.Algorithm)
+	}
+	return key, nil
+}
+
+// checkKeyType makes sure the key material matches the declared algorithm
+func checkKeyType(key *jwtKey) error {
+	var ok bool
+	switch key.method {
+	case jwt.SigningMethodRS256:
+		_, ok = key.verify.(*rsa.PublicKey)
+	case jwt.SigningMethodEdDSA:
+		_, ok = key.verify.(ed25519.PublicKey)
+	}
+	if !ok {
+		return fmt.Errorf("key type %T does not match algorithm %s", key.verify, key.method.Alg())
+	}
+	return nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported private key format", path)
+}
+
+func readPublicKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if k, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported public key format", path)
+}
+
+// keyFunc picks the verification key named by the token's kid header and
+// refuses tokens whose algorithm differs from that key's
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := verificationKey[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verify, nil
+}
+
+// signToken signs claims with the current signing key
+func signToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(signingKey.method, claims)
+	token.Header["kid"] = signingKey.id
+	return token.SignedString(signingKey.sign)
+}
+
+// SignClaims signs server-issued tokens other than access tokens, such as
+// login state. Give them an audience and no jti so they are never
+// accepted as access tokens.
+func SignClaims(claims jwt.Claims) (string, error) {
+	return signToken(claims)
+}
+
+// ParseClaims verifies a token from SignClaims into claims
+func ParseClaims(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyFunc, opts...)
+	return err
+}
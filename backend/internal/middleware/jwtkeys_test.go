@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useKeys loads the key configuration for one test and restores the
+// previous keys afterwards
+func useKeys(t *testing.T, cfg conf.AuthConfig) error {
+	t.Helper()
+	prevSigning, prevVerification, prevDefault := signingKey, verificationKey, usingDefaultKey
+	t.Cleanup(func() {
+		signingKey, verificationKey, usingDefaultKey = prevSigning, prevVerification, prevDefault
+	})
+	return loadKeys(&cfg)
+}
+
+// writePEM writes a PEM block into the test's directory and returns its path
+func writePEM(t *testing.T, name, kind string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// forge signs access token claims with any key and kid, as a client could
+func forge(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	claims := Claims{UserID: 1, Username: "admin", Role: "admin", RegisteredClaims: jwt.RegisteredClaims{
+		ID:        "forged-" + kid,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func accepted(token string) bool {
+	claims, _, _ := parseToken(token)
+	return claims != nil
+}
+
+func TestSigningKeySelection(t *testing.T) {
+	err := useKeys(t, conf.AuthConfig{
+		Keys: []conf.JWTKeyConfig{
+			{ID: "old", Secret: "old-secret-0123456789"},
+			{ID: "new", Secret: "new-secret-0123456789"},
+		},
+		SigningKey: "new",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := GenerateToken(&model.User{Username: "kid"}, "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if kid := parsed.Header["kid"]; kid != "new" {
+		t.Fatalf("signed with kid %v, want new", kid)
+	}
+	if !accepted(token) {
+		t.Fatal("own token refused")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		// Tokens issued before the rotation still verify with the old key
+		{"old key", forge(t, jwt.SigningMethodHS256, "old", []byte("old-secret-0123456789")), true},
+		{"old secret under the new kid", forge(t, jwt.SigningMethodHS256, "new", []byte("old-secret-0123456789")), false},
+		{"unknown kid", forge(t, jwt.SigningMethodHS256, "other", []byte("new-secret-0123456789")), false},
+		{"no kid", forge(t, jwt.SigningMethodHS256, "", []byte("new-secret-0123456789")), false},
+	}
+	for _, tt := range tests {
+		if got := accepted(tt.token); got != tt.want {
+			t.Errorf("%s: accepted %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRotatedOutKeysOnlyVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubFile := writePEM(t, "old.pub", "PUBLIC KEY", pub)
+	keys := []conf.JWTKeyConfig{
+		{ID: "current", Secret: "current-secret-0123456789"},
+		{ID: "retired", Algorithm: "RS256", PublicKeyFile: pubFile},
+	}
+
+	if err := useKeys(t, conf.AuthConfig{Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	if !accepted(forge(t, jwt.SigningMethodRS256, "retired", rsaKey)) {
+		t.Fatal("token of the rotated-out key refused")
+	}
+	// A key without its private half cannot sign
+	if err := useKeys(t, conf.AuthConfig{Keys: keys, SigningKey: "retired"}); err == nil {
+		t.Fatal("verification-only key accepted as signing key")
+	}
+}
+
+func TestKeyAlgorithmIsPinned(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	priv, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = useKeys(t, conf.AuthConfig{Keys: []conf.JWTKeyConfig{
+		{ID: "rsa", Algorithm: "RS256", PublicKeyFile: writePEM(t, "rsa.pub", "PUBLIC KEY", pub)},
+		{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: writePEM(t, "ed.key", "PRIVATE KEY", priv)},
+		{ID: "hmac", Secret: "hmac-secret-0123456789"},
+	}, SigningKey: "ed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !accepted(forge(t, jwt.SigningMethodRS256, "rsa", rsaKey)) {
+		t.Fatal("RS256 token refused")
+	}
+	// The public key is no HMAC secret, nor does another key's algorithm
+	// apply under this kid
+	if accepted(forge(t, jwt.SigningMethodHS256, "rsa", pubPEM)) {
+		t.Error("HS256 token signed with the RSA public key accepted")
+	}
+	if accepted(forge(t, jwt.SigningMethodEdDSA, "rsa", edKey)) {
+		t.Error("EdDSA token under the RSA kid accepted")
+	}
+	if accepted(forge(t, jwt.SigningMethodHS512, "hmac", []byte("hmac-secret-0123456789"))) {
+		t.Error("HS512 token under the HS256 kid accepted")
+	}
+	if accepted(forge(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType)) {
+		t.Error("unsigned token accepted")
+	}
+
+	// Key material that does not fit the algorithm is refused at startup
+	err = useKeys(t, conf.AuthConfig{Keys: []conf.JWTKeyConfig{
+		{ID: "mixed", Algorithm: "EdDSA", PublicKeyFile: writePEM(t, "mixed.pub", "PUBLIC KEY", pub)},
+	}})
+	if err == nil {
+		t.Fatal("RSA key accepted for EdDSA")
+	}
+}
+
+func TestDefaultSecretRefusedInRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  conf.AuthConfig
+		bad  bool
+	}{
+		{"no secret", conf.AuthConfig{}, true},
+		{"default secret as a key", conf.AuthConfig{Keys: []conf.JWTKeyConfig{{ID: "k", Secret: defaultJWTSecret}}}, true},
+		{"own secret", conf.AuthConfig{JWTSecret: "a-real-secret-0123456789"}, false},
+	}
+	for _, tt := range tests {
+		if err := useKeys(t, tt.cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkDefaultKey("release"); (err != nil) != tt.bad {
+			t.Errorf("%s in release mode: %v", tt.name, err)
+		}
+		if err := checkDefaultKey("debug"); err != nil {
+			t.Errorf("%s in debug mode: %v", tt.name, err)
+		}
+	}
+}
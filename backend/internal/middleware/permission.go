@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+)
+
+// Machine-readable reasons returned with 403 responses
+const (
+	ReasonMissingPermission = "missing_permission"
+	ReasonUnknownRole       = "unknown_role"
+	ReasonPlatformOnly      = "platform_tenant_only"
+)
+
+var (
+	roleCacheMu sync.RWMutex
+	roleCache   = map[string]*model.Role{}
+)
+
+// InvalidateRoleCache drops cached roles, call it after roles change
+func InvalidateRoleCache() {
+	roleCacheMu.Lock()
+	roleCache = map[string]*model.Role{}
+	roleCacheMu.Unlock()
+}
+
+// cachedRole returns the named role, loading it from the database on cache miss
+func cachedRole(name string) (*model.Role, bool) {
+	roleCacheMu.RLock()
+	role, ok := roleCache[name]
+	roleCacheMu.RUnlock()
+	if ok {
+		return role, true
+	}
+
+	role = &model.Role{}
+	if err := data.DB.Where("name = ?", name).First(role).Error; err != nil {
+		return nil, false
+	}
+
+	roleCacheMu.Lock()
+	roleCache[name] = role
+	roleCacheMu.Unlock()
+	return role, true
+}
+
+// rolePermissions returns the permissions granted to a role
+func rolePermissions(name string) (model.StringList, bool) {
+	role, ok := cachedRole(name)
+	if !ok {
+		return nil, false
+	}
+	return role.Permissions, true
+}
+
+// DataScope returns the data scope of the role carried by the request.
+// Unknown roles get the narrowest scope.
+func DataScope(c *gin.Context) string {
+	role, ok := cachedRole(c.GetString("role"))
+	if !ok || !model.IsValidDataScope(role.DataScopeType) {
+		return model.DataScopeSelf
+	}
+	return role.DataScopeType
+}
+
+// HasPermission reports whether the role carried by the request grants
+// perm, and the API token scopes too when one is used
+func HasPermission(c *gin.Context, perm string) bool {
+	perms, ok := rolePermissions(c.GetString("role"))
+	return ok && model.PermissionsGrant(perms, perm) && tokenGrants(c, perm)
+}
+
+// RequirePermission rejects requests whose role, or API token scopes,
+// lack any of the given permissions
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		granted, ok := rolePermissions(role)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":  "Permission denied",
+				"reason": ReasonUnknownRole,
+				"role":   role,
+			})
+			return
+		}
+
+		var missing []string
+		for _, p := range perms {
+			if !model.PermissionsGrant(granted, p) || !tokenGrants(c, p) {
+				missing = append(missing, p)
+			}
+		}
+
+		if len(missing) > 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Permission denied",
+				"reason":  ReasonMissingPermission,
+				"role":    role,
+				"missing": missing,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
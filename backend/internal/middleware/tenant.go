@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+)
+
+var (
+	tenantCacheMu sync.RWMutex
+	tenantCache   = map[uint]bool{}
+)
+
+// InvalidateTenantCache drops cached tenant states, call it after tenants change
+func InvalidateTenantCache() {
+	tenantCacheMu.Lock()
+	tenantCache = map[uint]bool{}
+	tenantCacheMu.Unlock()
+}
+
+// tenantActive reports whether the tenant exists and is enabled
+func tenantActive(id uint) bool {
+	tenantCacheMu.RLock()
+	active, ok := tenantCache[id]
+	tenantCacheMu.RUnlock()
+	if ok {
+		return active
+	}
+
+	var t model.Tenant
+	active = data.DB.First(&t, id).Error == nil && t.IsActive()
+
+	tenantCacheMu.Lock()
+	tenantCache[id] = active
+	tenantCacheMu.Unlock()
+	return active
+}
+
+// TenantContext confines the request's database access to the tenant in
+// the token, see package tenant. It must run after JWTAuthMiddleware.
+func TenantContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetUint("tenantID")
+		if id == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has no tenant, please sign in again"})
+			return
+		}
+		if !tenantActive(id) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Tenant is disabled"})
+			return
+		}
+
+		c.Set(tenant.Key, tenant.Scope{TenantID: id})
+		c.Next()
+	}
+}
+
+// RequirePlatformTenant limits a route to users of the default tenant, for
+// settings shared by every tenant such as roles and the tenants themselves
+func RequirePlatformTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("tenantID") != data.DefaultTenantID {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":  "Permission denied",
+				"reason": ReasonPlatformOnly,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIToken 个人 API 令牌，供同步脚本与 CI 以 Bearer 方式调用
+type APIToken struct {
+	gorm.Model
+	TenantID   uint       `json:"tenant_id" gorm:"index"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:16"`                 // 令牌开头几位，便于辨认
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;size:64;not null"` // SHA-256，明文只在创建时返回一次
+	Scopes     StringList `json:"scopes"`                                // 权限范围，与用户角色权限取交集
+	AllowedIPs StringList `json:"allowed_ips"`                           // IP 或 CIDR 白名单，为空不限制
+	ExpiresAt  *time.Time `json:"expires_at"`                            // 为空表示不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// ExpiredAt reports whether the token has expired at the given time
+func (t *APIToken) ExpiredAt(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// AllowsIP reports whether the allowlist admits ip
+func (t *APIToken) AllowsIP(ip string) bool {
+	if len(t.AllowedIPs) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, rule := range t.AllowedIPs {
+		if strings.Contains(rule, "/") {
+			if _, network, err := net.ParseCIDR(rule); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(rule); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidIPRule reports whether s is an IP address or CIDR range
+func IsValidIPRule(s string) bool {
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
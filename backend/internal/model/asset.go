@@ -4,17 +4,32 @@ import (
 	"gorm.io/gorm"
 )
 
+// 资产状态
+const (
+	AssetStatusOnline      = "Online"
+	AssetStatusOffline     = "Offline"
+	AssetStatusMaintenance = "Maintenance"
+	AssetStatusStopped     = "Stopped"
+)
+
+// AssetStatuses lists the allowed Asset.Status values
+var AssetStatuses = []string{AssetStatusOnline, AssetStatusOffline, AssetStatusMaintenance, AssetStatusStopped}
+
 type Asset struct {
 	gorm.Model
-	Name        string `json:"name"`
-	Type        string `json:"type"`     // e.g., "Server", "VM", "Database", "K8s"
-	Platform    string `json:"platform"` // e.g., "AWS", "VMware", "BareMetal"
-	IP          string `json:"ip"`
-	Status      string `json:"status"` // "Online", "Offline", "Maintenance"
-	Region      string `json:"region"`
-	Owner       string `json:"owner"`
-	Description string `json:"description"`
-	Specs       string `json:"specs"` // e.g., "4vCPU/16GB"
+	TenantID    uint    `json:"tenant_id" gorm:"index"`  // 所属租户
+	OrgID       *uint   `json:"org_id" gorm:"index"`     // 所属组织
+	CreatedBy   uint    `json:"created_by" gorm:"index"` // 创建人用户ID
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`     // e.g., "Server", "VM", "Database", "K8s"
+	Platform    string  `json:"platform"` // e.g., "AWS", "VMware", "BareMetal"
+	IP          string  `json:"ip"`
+	Status      string  `json:"status"` // "Online", "Offline", "Maintenance"
+	Region      string  `json:"region"`
+	Owner       string  `json:"owner"`
+	Description string  `json:"description"`
+	Specs       string  `json:"specs"`      // e.g., "4vCPU/16GB"
+	Attributes  JSONMap `json:"attributes"` // typed fields defined by the AssetTypeSchema for Type
 }
 
 // TableName overrides the table name used by User to `profiles`
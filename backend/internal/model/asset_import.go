@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// 导入状态
+const (
+	ImportStatusSucceeded = "succeeded"
+	ImportStatusFailed    = "failed"
+	ImportStatusDryRun    = "dry_run"
+)
+
+// AssetImport 资产批量导入历史记录
+type AssetImport struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	TenantID     uint      `json:"tenant_id" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+	FileName     string    `json:"file_name"`
+	Format       string    `json:"format"` // csv, xlsx
+	Mode         string    `json:"mode"`   // insert, upsert
+	DryRun       bool      `json:"dry_run"`
+	Status       string    `json:"status" gorm:"index"` // succeeded, failed, dry_run
+	TotalRows    int       `json:"total_rows"`
+	CreatedCount int       `json:"created_count"`
+	UpdatedCount int       `json:"updated_count"`
+	FailedCount  int       `json:"failed_count"`
+	ImportedBy   string    `json:"imported_by"`
+	Errors       JSONMap   `json:"errors"` // 行号 -> 错误信息
+}
+
+func (AssetImport) TableName() string {
+	return "asset_imports"
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+)
+
+// 资产关系类型，方向均为 Source -> Target
+const (
+	RelationRunsOn     = "runs_on"     // Source 运行在 Target 之上 (VM runs_on Server)
+	RelationDependsOn  = "depends_on"  // Source 依赖 Target (App depends_on Database)
+	RelationConnectsTo = "connects_to" // Source 连接到 Target
+	RelationManages    = "manages"     // Source 管理 Target
+)
+
+// RelationTypes lists the supported relation types
+var RelationTypes = []string{RelationRunsOn, RelationDependsOn, RelationConnectsTo, RelationManages}
+
+// IsValidRelationType reports whether t is a supported relation type
+func IsValidRelationType(t string) bool {
+	for _, v := range RelationTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// AssetRelation 资产关系，构建拓扑图的有向边
+// 关系直接硬删除（唯一索引不允许保留已删除的边），因此没有 DeletedAt；
+// ID/CreatedAt/UpdatedAt 沿用 gorm.Model 的 JSON 字段名
+type AssetRelation struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	TenantID      uint   `json:"tenant_id" gorm:"index"` // 所属租户
+	SourceAssetID uint   `json:"source_asset_id" gorm:"not null;index;uniqueIndex:idx_asset_relation"`
+	TargetAssetID uint   `json:"target_asset_id" gorm:"not null;index;uniqueIndex:idx_asset_relation"`
+	RelationType  string `json:"relation_type" gorm:"size:50;not null;uniqueIndex:idx_asset_relation"`
+	Description   string `json:"description"`
+}
+
+func (AssetRelation) TableName() string {
+	return "asset_relations"
+}
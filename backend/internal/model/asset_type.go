@@ -0,0 +1,209 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 自定义属性字段类型
+const (
+	AttributeTypeString   = "string"
+	AttributeTypeInt      = "int"
+	AttributeTypeDate     = "date" // stored as YYYY-MM-DD
+	AttributeTypeEnum     = "enum"
+	AttributeTypeIP       = "ip"
+	AttributeTypeAssetRef = "asset_ref" // ID of another asset
+)
+
+// AttributeTypes lists the allowed AttributeField.Type values
+var AttributeTypes = []string{
+	AttributeTypeString, AttributeTypeInt, AttributeTypeDate,
+	AttributeTypeEnum, AttributeTypeIP, AttributeTypeAssetRef,
+}
+
+// attributeKeyPattern keeps keys safe to embed in JSON path expressions
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// IsValidAttributeKey reports whether key can be used as an attribute key
+func IsValidAttributeKey(key string) bool {
+	return attributeKeyPattern.MatchString(key)
+}
+
+// AttributeField 资产类型的一个自定义字段定义
+type AttributeField struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"` // enum only
+}
+
+// AttributeFields is a []AttributeField persisted as a JSON array
+type AttributeFields []AttributeField
+
+func (f AttributeFields) Value() (driver.Value, error) {
+	if f == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+func (f *AttributeFields) Scan(value interface{}) error {
+	return scanJSON(value, f)
+}
+
+func (AttributeFields) GormDataType() string {
+	return "json"
+}
+
+func (AttributeFields) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+// AssetTypeSchema 资产类型属性定义，按 Asset.Type 匹配
+type AssetTypeSchema struct {
+	gorm.Model
+	Type        string          `json:"type" gorm:"uniqueIndex;not null"`
+	Description string          `json:"description"`
+	Fields      AttributeFields `json:"fields"`
+}
+
+func (AssetTypeSchema) TableName() string {
+	return "asset_type_schemas"
+}
+
+// Validate checks the field definitions themselves
+func (s *AssetTypeSchema) Validate() error {
+	seen := map[string]bool{}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if !IsValidAttributeKey(f.Key) {
+			return fmt.Errorf("field key %q must be lower-case letters, digits and underscores", f.Key)
+		}
+		if seen[f.Key] {
+			return fmt.Errorf("duplicate field key %s", f.Key)
+		}
+		seen[f.Key] = true
+
+		valid := false
+		for _, t := range AttributeTypes {
+			valid = valid || f.Type == t
+		}
+		if !valid {
+			return fmt.Errorf("field %s: type must be one of %s", f.Key, strings.Join(AttributeTypes, ", "))
+		}
+		if f.Type == AttributeTypeEnum && len(f.Options) == 0 {
+			return fmt.Errorf("field %s: enum needs at least one option", f.Key)
+		}
+		if f.Type != AttributeTypeEnum {
+			f.Options = nil
+		}
+		if f.Label == "" {
+			f.Label = f.Key
+		}
+	}
+	return nil
+}
+
+// ValidateAttributes checks attrs against the schema and returns the
+// normalized values: ints and asset refs become int64, dates YYYY-MM-DD.
+// Null values are dropped so clients can clear an optional attribute.
+func (s *AssetTypeSchema) ValidateAttributes(attrs JSONMap) (JSONMap, []string) {
+	var errs []string
+	out := JSONMap{}
+
+	fields := map[string]AttributeField{}
+	for _, f := range s.Fields {
+		fields[f.Key] = f
+	}
+	for key := range attrs {
+		if _, ok := fields[key]; !ok {
+			errs = append(errs, fmt.Sprintf("unknown attribute %s for type %s", key, s.Type))
+		}
+	}
+
+	for _, f := range s.Fields {
+		raw, ok := attrs[f.Key]
+		if !ok || raw == nil || raw == "" {
+			if f.Required {
+				errs = append(errs, fmt.Sprintf("attribute %s is required", f.Key))
+			}
+			continue
+		}
+		v, err := normalizeAttribute(f, raw)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("attribute %s: %v", f.Key, err))
+			continue
+		}
+		out[f.Key] = v
+	}
+	return out, errs
+}
+
+func normalizeAttribute(f AttributeField, raw interface{}) (interface{}, error) {
+	switch f.Type {
+	case AttributeTypeInt, AttributeTypeAssetRef:
+		var n int64
+		switch v := raw.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("must be an integer")
+			}
+			n = int64(v)
+		case string:
+			parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("must be an integer")
+			}
+			n = parsed
+		default:
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if f.Type == AttributeTypeAssetRef && n <= 0 {
+			return nil, fmt.Errorf("must be an asset ID")
+		}
+		return n, nil
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("must be a string")
+	}
+	s = strings.TrimSpace(s)
+
+	switch f.Type {
+	case AttributeTypeDate:
+		for _, layout := range []string{"2006-01-02", "2006/01/02", time.RFC3339} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.Format("2006-01-02"), nil
+			}
+		}
+		return nil, fmt.Errorf("must be a date (YYYY-MM-DD)")
+	case AttributeTypeEnum:
+		for _, o := range f.Options {
+			if o == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+	case AttributeTypeIP:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		return ip.String(), nil
+	default:
+		return s, nil
+	}
+}
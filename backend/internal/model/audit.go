@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditLog 审计日志，记录所有变更操作
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	TenantID   uint      `json:"tenant_id" gorm:"index"` // 所属租户，取自被修改的记录
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+	UserID     *uint     `json:"user_id" gorm:"index"`                  // 操作人，系统操作为空
+	Username   string    `json:"username"`                              // 操作人用户名
+	Action     string    `json:"action" gorm:"size:100;index;not null"` // e.g. asset.create, contract.delete
+	TargetType string    `json:"target_type" gorm:"size:50;index"`      // 目标实体：asset, contract ...
+	TargetID   uint      `json:"target_id" gorm:"index"`                // 目标实体ID
+	Changes    JSONMap   `json:"changes"`                               // {"old": {...}, "new": {...}}
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
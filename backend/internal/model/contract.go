@@ -4,11 +4,22 @@ import (
 	"gorm.io/gorm"
 )
 
+// 合同状态
+const (
+	ContractStatusDraft      = "draft"
+	ContractStatusActive     = "active"
+	ContractStatusExpired    = "expired"
+	ContractStatusTerminated = "terminated"
+)
+
 // Contract 合同主模型
 type Contract struct {
 	gorm.Model
+	TenantID    uint   `json:"tenant_id" gorm:"index;uniqueIndex:idx_contract_tenant_code,priority:1"` // 所属租户
+	OrgID       *uint  `json:"org_id" gorm:"index"`               // 所属组织
+	CreatedBy   uint   `json:"created_by" gorm:"index"`           // 创建人用户ID
 	Name        string `json:"name" gorm:"not null"`
-	Code        string `json:"code" gorm:"uniqueIndex"`           // 合同编号
+	Code        string `json:"code" gorm:"uniqueIndex:idx_contract_tenant_code,priority:2"` // 合同编号
 	Type        string `json:"type"`                              // 合同类型：采购、维保、租赁等
 	Status      string `json:"status" gorm:"default:'draft'"`     // 状态：draft, active, expired, terminated
 	Vendor      string `json:"vendor"`                            // 供应商
@@ -30,11 +41,14 @@ func (Contract) TableName() string {
 // ContractFile 合同文件版本模型
 type ContractFile struct {
 	gorm.Model
+	TenantID   uint   `json:"tenant_id" gorm:"index"`             // 所属租户
 	ContractID uint   `json:"contract_id" gorm:"not null;index"` // 所属合同ID
 	FileName   string `json:"file_name" gorm:"not null"`           // 原始文件名
 	FilePath   string `json:"file_path" gorm:"not null"`           // 存储路径
 	FileSize   int64  `json:"file_size"`                           // 文件大小(字节)
 	FileType   string `json:"file_type"`                           // 文件类型
+	SHA256     string `json:"sha256" gorm:"size:64;index"`         // 内容 SHA-256
+	Storage    string `json:"storage" gorm:"size:16"`              // 存储后端：local, s3；为空表示早期直接写入本地磁盘
 	Version    int    `json:"version" gorm:"not null"`             // 版本号
 	UploadedBy string `json:"uploaded_by"`                         // 上传人
 	Remark     string `json:"remark"`                              // 版本备注
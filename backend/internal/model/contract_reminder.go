@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// ContractReminder 已发送的合同到期提醒，避免重启后重复提醒
+type ContractReminder struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	ContractID    uint      `json:"contract_id" gorm:"not null;uniqueIndex:idx_contract_reminder"`
+	EndDate       string    `json:"end_date" gorm:"size:32;not null;uniqueIndex:idx_contract_reminder"` // 提醒时的结束日期，续期后重新提醒
+	ThresholdDays int       `json:"threshold_days" gorm:"not null;uniqueIndex:idx_contract_reminder"`   // 提前天数，-1 表示已到期
+	SentAt        time.Time `json:"sent_at"`
+}
+
+// ContractReminderExpired 到期通知的 ThresholdDays，与 0 天提醒区分
+const ContractReminderExpired = -1
+
+func (ContractReminder) TableName() string {
+	return "contract_reminders"
+}
@@ -6,6 +6,7 @@ import (
 
 type SystemInterface struct {
 	gorm.Model
+	TenantID    uint   `json:"tenant_id" gorm:"index"` // 所属租户
 	Name        string `json:"name"`
 	Method      string `json:"method"` // GET, POST, etc.
 	URL         string `json:"url"`
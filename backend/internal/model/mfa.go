@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// MFARecoveryCode 两步验证恢复码，每个只能使用一次
+type MFARecoveryCode struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	SecretHash string     `json:"-" gorm:"size:64;not null"` // 恢复码的 SHA-256，明文只在生成时返回一次
+	UsedAt     *time.Time `json:"used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
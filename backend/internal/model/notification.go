@@ -0,0 +1,120 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 通知投递状态，重试耗尽的投递进入死信
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusDead    = "dead"
+)
+
+// 通知渠道
+const (
+	NotificationChannelIM    = "im"
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+)
+
+// Notification 通知发件箱，每条通知按渠道分别投递
+type Notification struct {
+	ID         uint                   `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time              `json:"created_at" gorm:"index"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+	TenantID   uint                   `json:"tenant_id" gorm:"index"`
+	Kind       string                 `json:"kind" gorm:"size:64;index"`
+	Title      string                 `json:"title" gorm:"size:200"`
+	Severity   string                 `json:"severity" gorm:"size:16;index"`
+	Payload    string                 `json:"-" gorm:"type:text"`          // 序列化的消息内容
+	Status     string                 `json:"status" gorm:"size:16;index"` // pending, sent, dead，由各渠道投递状态汇总
+	Rules      StringList             `json:"rules"`                       // 命中的路由规则，为空表示默认路由
+	Deliveries []NotificationDelivery `json:"deliveries,omitempty" gorm:"foreignKey:NotificationID"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// NotificationAttachment 通知附件，单独存放以免撑大消息内容
+type NotificationAttachment struct {
+	ID             uint   `json:"id" gorm:"primarykey"`
+	TenantID       uint   `json:"tenant_id" gorm:"index"`
+	NotificationID uint   `json:"notification_id" gorm:"index;not null"`
+	Name           string `json:"name"`
+	ContentType    string `json:"content_type"`
+	Data           []byte `json:"-"`
+}
+
+func (NotificationAttachment) TableName() string {
+	return "notification_attachments"
+}
+
+// NotificationDelivery 通知在一个渠道上的投递及其最近一次尝试的结果
+type NotificationDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	TenantID       uint       `json:"tenant_id" gorm:"index"`
+	NotificationID uint       `json:"notification_id" gorm:"index;not null"`
+	Channel        string     `json:"channel" gorm:"size:16"`      // im, email, sms
+	Recipient      string     `json:"recipient" gorm:"size:255"`   // 邮箱地址，群机器人等渠道为空
+	Status         string     `json:"status" gorm:"size:16;index"` // pending, sent, dead
+	Attempts       int        `json:"attempts"`                    // 已尝试次数
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func (NotificationDelivery) TableName() string {
+	return "notification_deliveries"
+}
+
+// OwnerRecipient 规则接收人中代表资产或合同负责人的占位符
+const OwnerRecipient = "@owner"
+
+// NotificationRule 通知路由规则，为匹配的消息选择渠道和接收人。
+// 条件均为列表，为空表示不限，非空时消息的对应值须在列表中。
+type NotificationRule struct {
+	gorm.Model
+	TenantID       uint       `json:"tenant_id" gorm:"index"`
+	Name           string     `json:"name" gorm:"size:100;not null"`
+	Priority       int        `json:"priority"` // 数值小的先评估
+	Enabled        bool       `json:"enabled"`
+	EventTypes     StringList `json:"event_types"`     // 消息类型，如 asset_created、contract_expiring
+	Severities     StringList `json:"severities"`      // info, warning, critical
+	AssetTypes     StringList `json:"asset_types"`     // 资产类型
+	Platforms      StringList `json:"platforms"`       // 资产平台
+	Regions        StringList `json:"regions"`         // 资产区域
+	ContractTypes  StringList `json:"contract_types"`  // 合同类型
+	Channels       StringList `json:"channels"`        // im, email, sms
+	Recipients     StringList `json:"recipients"`      // 邮件接收人：用户名、显示名、邮箱或 "@owner"
+	StopProcessing bool       `json:"stop_processing"` // 命中后不再评估后续规则
+	CreatedBy      uint       `json:"created_by"`
+}
+
+func (NotificationRule) TableName() string {
+	return "notification_rules"
+}
+
+// NotificationPreference 用户的通知订阅、屏蔽与免打扰时段，作用于发给本人的邮件
+type NotificationPreference struct {
+	ID              uint       `json:"id" gorm:"primarykey"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	TenantID        uint       `json:"tenant_id" gorm:"index"`
+	UserID          uint       `json:"user_id" gorm:"uniqueIndex;not null"`
+	Subscriptions   StringList `json:"subscriptions"`                   // 额外订阅的消息类型，"*" 表示全部
+	MutedEventTypes StringList `json:"muted_event_types"`               // 不再接收的消息类型
+	MinSeverity     string     `json:"min_severity" gorm:"size:16"`     // 低于该级别的不发送，为空不限
+	QuietHoursStart string     `json:"quiet_hours_start" gorm:"size:5"` // 免打扰开始，如 "22:00"
+	QuietHoursEnd   string     `json:"quiet_hours_end" gorm:"size:5"`   // 免打扰结束，如 "08:00"，非紧急消息推迟到此时
+	Timezone        string     `json:"timezone" gorm:"size:64"`         // IANA 时区，为空使用服务器时区
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 组织类型
+const (
+	OrgTypeGroup      = "group"
+	OrgTypeCompany    = "company"
+	OrgTypeDepartment = "department"
+	OrgTypeTeam       = "team"
+)
+
+// OrgTypes lists the allowed Organization.Type values
+var OrgTypes = []string{OrgTypeGroup, OrgTypeCompany, OrgTypeDepartment, OrgTypeTeam}
+
+// 数据范围，见 Role.DataScopeType
+const (
+	DataScopeSelf       = "self"       // rows the user created
+	DataScopeDepartment = "department" // the user's org and everything below it
+	DataScopeCompany    = "company"    // the user's company (or group) and everything below it
+	DataScopeAll        = "all"        // the whole tenant
+)
+
+// DataScopes lists the allowed Role.DataScopeType values
+var DataScopes = []string{DataScopeSelf, DataScopeDepartment, DataScopeCompany, DataScopeAll}
+
+// Organization 组织架构节点，tree_path 为物化路径，如 "/1/5/"
+type Organization struct {
+	gorm.Model
+	TenantID uint   `json:"tenant_id" gorm:"index"`          // 所属租户
+	ParentID *uint  `json:"parent_id" gorm:"index"`          // 根节点为空
+	Name     string `json:"name" gorm:"not null"`            // 名称
+	Code     string `json:"code"`                            // 部门/公司代码
+	Type     string `json:"type" gorm:"not null"`            // group, company, department, team
+	TreePath string `json:"tree_path" gorm:"index;size:512"` // 自根节点起的 ID 路径
+	Level    int    `json:"level" gorm:"not null;default:1"` // 根节点为 1
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// ChildPath returns the tree_path of a child with the given ID
+func (o *Organization) ChildPath(id uint) string {
+	return o.TreePath + strconv.FormatUint(uint64(id), 10) + "/"
+}
+
+// IsAncestorOf reports whether o is other or one of its ancestors
+func (o *Organization) IsAncestorOf(other *Organization) bool {
+	return strings.HasPrefix(other.TreePath, o.TreePath)
+}
+
+// AncestorIDs returns the IDs on the path from the root down to o, o included
+func (o *Organization) AncestorIDs() ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(strings.Trim(o.TreePath, "/"), "/") {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt tree_path %q", o.TreePath)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 权限码，格式为 "资源:操作"
+const (
+	PermAll = "*"
+
+	PermDashboardRead = "dashboard:read"
+
+	PermAssetRead   = "asset:read"
+	PermAssetWrite  = "asset:write"
+	PermAssetDelete = "asset:delete"
+
+	PermAssetTypeWrite = "asset_type:write" // manage custom attribute schemas
+
+	PermContractRead   = "contract:read"
+	PermContractWrite  = "contract:write"
+	PermContractDelete = "contract:delete"
+
+	PermInterfaceRead   = "interface:read"
+	PermInterfaceWrite  = "interface:write"
+	PermInterfaceDelete = "interface:delete"
+
+	PermUserRead  = "user:read"
+	PermUserWrite = "user:write"
+
+	PermRoleRead  = "role:read"
+	PermRoleWrite = "role:write"
+
+	PermAuditRead = "audit:read"
+
+	PermOrgRead  = "org:read"
+	PermOrgWrite = "org:write"
+
+	PermTenantRead  = "tenant:read"
+	PermTenantWrite = "tenant:write"
+
+	PermWebhookRead  = "webhook:read"
+	PermWebhookWrite = "webhook:write"
+
+	PermNotificationRead  = "notification:read"
+	PermNotificationWrite = "notification:write" // manage routing rules, retry dead-lettered notifications
+)
+
+// AllPermissions lists every permission code understood by the API
+var AllPermissions = []string{
+	PermDashboardRead,
+	PermAssetRead, PermAssetWrite, PermAssetDelete,
+	PermAssetTypeWrite,
+	PermContractRead, PermContractWrite, PermContractDelete,
+	PermInterfaceRead, PermInterfaceWrite, PermInterfaceDelete,
+	PermUserRead, PermUserWrite,
+	PermRoleRead, PermRoleWrite,
+	PermAuditRead,
+	PermOrgRead, PermOrgWrite,
+	PermTenantRead, PermTenantWrite,
+	PermWebhookRead, PermWebhookWrite,
+	PermNotificationRead, PermNotificationWrite,
+}
+
+// IsValidPermission reports whether p is a known permission code or wildcard
+func IsValidPermission(p string) bool {
+	if p == PermAll {
+		return true
+	}
+	for _, known := range AllPermissions {
+		if p == known || p == strings.SplitN(known, ":", 2)[0]+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidDataScope reports whether s is a known data scope
+func IsValidDataScope(s string) bool {
+	for _, v := range DataScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Role 角色，定义功能权限集合
+type Role struct {
+	gorm.Model
+	Name          string     `json:"name" gorm:"uniqueIndex;size:64;not null"`
+	Description   string     `json:"description"`
+	Permissions   StringList `json:"permissions"`                          // 权限码列表，支持 "*" 与 "asset:*"
+	DataScopeType string     `json:"data_scope_type" gorm:"default:'all'"` // 数据范围：self, department, company, all
+	BuiltIn       bool       `json:"built_in"`                             // 内置角色不可删除
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// HasPermission reports whether the role grants the permission,
+// either directly or through a "*" / "resource:*" wildcard
+func (r *Role) HasPermission(perm string) bool {
+	return PermissionsGrant(r.Permissions, perm)
+}
+
+// PermissionsGrant reports whether the granted set covers perm
+func PermissionsGrant(granted []string, perm string) bool {
+	resource := strings.SplitN(perm, ":", 2)[0]
+	for _, p := range granted {
+		if p == PermAll || p == perm || p == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoles are created on first start
+func DefaultRoles() []Role {
+	return []Role{
+		{
+			Name:          "admin",
+			Description:   "Administrator with full access",
+			Permissions:   StringList{PermAll},
+			DataScopeType: DataScopeAll,
+			BuiltIn:       true,
+		},
+		{
+			Name:        "operator",
+			Description: "Manage assets, contracts and interfaces without deleting them",
+			Permissions: StringList{
+				PermDashboardRead,
+				PermAssetRead, PermAssetWrite,
+				PermContractRead, PermContractWrite,
+				PermInterfaceRead, PermInterfaceWrite,
+				PermOrgRead,
+			},
+			DataScopeType: DataScopeAll,
+			BuiltIn:       true,
+		},
+		{
+			Name:        "user",
+			Description: "Read-only access",
+			Permissions: StringList{
+				PermDashboardRead,
+				PermAssetRead,
+				PermContractRead,
+				PermInterfaceRead,
+				PermOrgRead,
+			},
+			DataScopeType: DataScopeAll,
+			BuiltIn:       true,
+		},
+	}
+}
+
+// IsPrivileged reports whether the role can change or delete anything,
+// which is what makes two-factor authentication mandatory under policy
+func (r *Role) IsPrivileged() bool {
+	for _, p := range r.Permissions {
+		if p == PermAll || strings.HasSuffix(p, ":*") || strings.HasSuffix(p, ":write") || strings.HasSuffix(p, ":delete") {
+			return true
+		}
+	}
+	return false
+}
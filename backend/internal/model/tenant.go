@@ -0,0 +1,32 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// 租户状态
+const (
+	TenantStatusActive   = "active"
+	TenantStatusDisabled = "disabled"
+)
+
+// DefaultTenantCode is the tenant that owns data created before multi-tenancy
+const DefaultTenantCode = "default"
+
+// Tenant 租户，最高层级的数据隔离单位（如不同的子公司）
+type Tenant struct {
+	gorm.Model
+	Name             string `json:"name" gorm:"not null"`
+	Code             string `json:"code" gorm:"uniqueIndex;size:50;not null"`
+	SubscriptionType string `json:"subscription_type" gorm:"default:'community'"`
+	Status           string `json:"status" gorm:"default:'active'"` // 状态：active, disabled
+}
+
+func (Tenant) TableName() string {
+	return "tenants"
+}
+
+// IsActive reports whether users of the tenant may sign in
+func (t *Tenant) IsActive() bool {
+	return t.Status == "" || t.Status == TenantStatusActive
+}
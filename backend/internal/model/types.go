@@ -0,0 +1,94 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// jsonDBDataType maps JSON columns to JSONB on Postgres and JSON on MySQL/SQLite
+func jsonDBDataType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "JSONB"
+	default:
+		return "JSON"
+	}
+}
+
+// StringList is a []string persisted as a JSON array
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(value, l)
+}
+
+func (StringList) GormDataType() string {
+	return "json"
+}
+
+func (StringList) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+// Contains reports whether s is in the list
+func (l StringList) Contains(s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONMap is a free-form JSON object column
+type JSONMap map[string]interface{}
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+func (m *JSONMap) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+func (JSONMap) GormDataType() string {
+	return "json"
+}
+
+func (JSONMap) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+func scanJSON(value interface{}, dest interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", value)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, dest)
+}
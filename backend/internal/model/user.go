@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 用户状态
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+)
+
+// 认证来源
+const (
+	AuthSourceLocal = "local" // 本地密码
+	AuthSourceOIDC  = "oidc"  // OpenID Connect 单点登录
+	AuthSourceLDAP  = "ldap"  // LDAP / Active Directory
+)
+
+// User 系统用户
+type User struct {
+	gorm.Model
+	TenantID     uint       `json:"tenant_id" gorm:"index"` // 所属租户
+	OrgID        *uint      `json:"org_id" gorm:"index"`    // 所属组织
+	Username     string     `json:"username" gorm:"uniqueIndex;size:64;not null"`
+	PasswordHash string     `json:"-" gorm:"not null"`                           // bcrypt 哈希，不对外输出
+	DisplayName  string     `json:"display_name"`                                // 显示名称
+	Email        string     `json:"email"`                                       // 邮箱
+	Role         string     `json:"role" gorm:"default:'user'"`                  // 角色
+	Status       string     `json:"status" gorm:"default:'active'"`              // 状态：active, disabled
+	AuthSource   string     `json:"auth_source" gorm:"size:16;default:'local'"`  // 认证来源：local, oidc, ldap
+	ExternalID   string     `json:"external_id,omitempty" gorm:"index;size:255"` // 外部身份标识，如 OIDC sub
+	MFAEnabled   bool       `json:"mfa_enabled" gorm:"default:false"`            // 是否启用两步验证
+	MFASecret    string     `json:"-" gorm:"size:64"`                            // TOTP 密钥，未启用时为待验证的密钥
+	MFALastStep  int64      `json:"-"`                                           // 最后使用的 TOTP 时间步，防止重放
+	IsLocked     bool       `json:"is_locked" gorm:"default:false"`              // 连续登录失败被锁定
+	LockedUntil  *time.Time `json:"locked_until"`                                // 锁定截止时间，为空表示需管理员解锁
+	FailedLogins int        `json:"failed_logins" gorm:"default:0"`              // 连续登录失败次数
+	LastLoginAt  *time.Time `json:"last_login_at"`                               // 最后登录时间
+	LastLoginIP  string     `json:"last_login_ip"`                               // 最后登录IP
+}
+
+func (User) TableName() string {
+	return "users"
+}
+
+// SetPassword hashes the plain password and stores it on the user
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether the plain password matches the stored hash
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// LockedAt reports whether the account is locked at the given time
+func (u *User) LockedAt(now time.Time) bool {
+	return u.IsLocked && (u.LockedUntil == nil || now.Before(*u.LockedUntil))
+}
+
+// IsActive reports whether the account is allowed to log in
+func (u *User) IsActive() bool {
+	return u.Status != UserStatusDisabled
+}
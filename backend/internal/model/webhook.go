@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook 出站 Webhook 订阅，事件以签名的 JSON POST 到 URL
+type Webhook struct {
+	gorm.Model
+	TenantID  uint       `json:"tenant_id" gorm:"index"`
+	Name      string     `json:"name" gorm:"size:100;not null"`
+	URL       string     `json:"url" gorm:"size:500;not null"`
+	Secret    string     `json:"-" gorm:"size:64;not null"` // HMAC-SHA256 签名密钥，只在创建或轮换时返回
+	Events    StringList `json:"events"`                    // 订阅的事件，支持 "asset.*" 与 "*"
+	Active    bool       `json:"active"`
+	CreatedBy uint       `json:"created_by"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// 投递状态
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookDelivery 一次事件投递及其最近一次尝试的结果
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	TenantID       uint       `json:"tenant_id" gorm:"index"`
+	WebhookID      uint       `json:"webhook_id" gorm:"index;not null"`
+	EventID        string     `json:"event_id" gorm:"size:32;index"`
+	EventType      string     `json:"event_type" gorm:"size:64;index"`
+	Payload        string     `json:"payload" gorm:"type:text"`     // 发送的 JSON 正文
+	Status         string     `json:"status" gorm:"size:16;index"`  // pending, succeeded, failed
+	Attempts       int        `json:"attempts"`                     // 已尝试次数
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index"` // 待重试时间
+	ResponseStatus int        `json:"response_status"`              // 最近一次 HTTP 状态码
+	ResponseBody   string     `json:"response_body" gorm:"type:text"`
+	Error          string     `json:"error"`
+	DurationMs     int64      `json:"duration_ms"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,296 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Email security modes
+const (
+	SecuritySTARTTLS = "starttls"
+	SecurityTLS      = "tls"
+	SecurityNone     = "none"
+)
+
+//go:embed templates/email.html templates/email.txt
+var templateFS embed.FS
+
+// pair lets templates pass a label and a value to the "row" template
+func pair(label string, value interface{}) []interface{} {
+	return []interface{}{label, value}
+}
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("email").Funcs(htmltemplate.FuncMap{"pair": pair}).ParseFS(templateFS, "templates/email.html"))
+	textTemplates = texttemplate.Must(texttemplate.New("email").Funcs(texttemplate.FuncMap{"pair": pair}).ParseFS(templateFS, "templates/email.txt"))
+)
+
+// emailView is what the templates render
+type emailView struct {
+	Message
+	Link          string
+	SeverityLabel string
+	Color         string
+}
+
+// sendEmail sends msg to the given addresses, or to msg.Recipients and
+// the always-copied addresses when to is empty
+func (s *Service) sendEmail(msg Message, to []string) error {
+	cfg := s.cfg.Email
+	if cfg.Host == "" {
+		return nil
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("email: invalid from address %q: %w", cfg.From, err)
+	}
+	if len(to) == 0 {
+		if to, err = s.recipients(msg); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	raw, err := s.buildEmail(msg, from, to)
+	if err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	if err := s.sendSMTP(from.Address, to, raw); err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	return nil
+}
+
+// recipients resolves msg.Recipients to addresses, adding the configured
+// always-copied ones. Names that match no user with an email are skipped.
+func (s *Service) recipients(msg Message) ([]string, error) {
+	seen := map[string]bool{}
+	var to []string
+	add := func(addr string) {
+		if key := strings.ToLower(addr); addr != "" && !seen[key] {
+			seen[key] = true
+			to = append(to, addr)
+		}
+	}
+	for _, addr := range s.cfg.Email.To {
+		add(addr)
+	}
+
+	var names []string
+	for _, r := range msg.Recipients {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if a, err := mail.ParseAddress(r); err == nil {
+			add(a.Address)
+			continue
+		}
+		names = append(names, r)
+	}
+	if len(names) == 0 {
+		return to, nil
+	}
+
+	var users []model.User
+	err := data.DB.WithContext(msg.scope()).
+		Where("(username IN ? OR display_name IN ?) AND status = ? AND email <> ''", names, names, model.UserStatusActive).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		add(u.Email)
+	}
+	return to, nil
+}
+
+// buildEmail renders msg as a MIME message: HTML and plain text
+// alternatives, followed by the attachments
+func (s *Service) buildEmail(msg Message, from *mail.Address, to []string) ([]byte, error) {
+	kind := msg.Kind
+	if htmlTemplates.Lookup(kind) == nil || textTemplates.Lookup(kind) == nil {
+		kind = "default"
+	}
+	view := emailView{
+		Message:       msg,
+		Link:          s.link(msg),
+		SeverityLabel: msg.Severity.label(),
+		Color:         map[Severity]string{SeverityCritical: "#cf1322", SeverityWarning: "#d46b08"}[msg.Severity],
+	}
+	if view.Color == "" {
+		view.Color = "#1677ff"
+	}
+	var html, text bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&html, kind, view); err != nil {
+		return nil, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, kind, view); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mixed := multipart.NewWriter(&buf)
+	altBoundary := multipart.NewWriter(io.Discard).Boundary()
+	host := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "【ITAM】"+msg.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomID(), host)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	// The alternatives nest in the first part of the mixed body
+	w, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + altBoundary},
+	})
+	if err != nil {
+		return nil, err
+	}
+	alt := multipart.NewWriter(w)
+	alt.SetBoundary(altBoundary)
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		qp.Write(part.body)
+		qp.Close()
+	}
+	if err := alt.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		pw, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			io.WriteString(pw, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(pw, encoded+"\r\n")
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendSMTP delivers raw to the configured server, over implicit TLS or
+// upgraded with STARTTLS unless security is "none"
+func (s *Service) sendSMTP(from string, to []string, raw []byte) error {
+	cfg := s.cfg.Email
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	switch cfg.Security {
+	case SecurityTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case SecuritySTARTTLS, SecurityNone:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("unknown security mode %q, expected starttls, tls or none", cfg.Security)
+	}
+	if err != nil {
+		return err
+	}
+	if cfg.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(cfg.Timeout))
+	}
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.Security == SecuritySTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not offer STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		// PlainAuth refuses to send the password unencrypted, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return fmt.Errorf("recipient %s: %w", addr, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(b)
+}
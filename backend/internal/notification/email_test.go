@@ -0,0 +1,331 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"itam-backend/internal/conf"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is an SMTP server that records one session: the commands in
+// order, whether each ran over TLS, the AUTH PLAIN credentials and the
+// message
+type fakeSMTP struct {
+	addr     string
+	starttls bool // offer STARTTLS
+	implicit bool // speak TLS from the first byte
+
+	mu       sync.Mutex
+	commands []string
+	overTLS  map[string]bool
+	auth     string
+	from     string
+	rcpt     []string
+	data     []byte
+	done     chan struct{}
+}
+
+func selfSignedConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func newFakeSMTP(t *testing.T, starttls, implicit bool) *fakeSMTP {
+	config := selfSignedConfig(t)
+	var l net.Listener
+	var err error
+	if implicit {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", config)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	f := &fakeSMTP{addr: l.Addr().String(), starttls: starttls, implicit: implicit, overTLS: map[string]bool{}, done: make(chan struct{})}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer close(f.done)
+		f.serve(conn, config)
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn, config *tls.Config) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	secure := f.implicit
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		f.mu.Lock()
+		f.commands = append(f.commands, verb)
+		f.overTLS[verb] = secure
+		f.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			if f.starttls && !secure {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, config)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			f.mu.Lock()
+			f.auth = string(raw)
+			f.mu.Unlock()
+			tp.PrintfLine("235 accepted")
+		case "MAIL":
+			f.mu.Lock()
+			f.from = arg
+			f.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			f.mu.Lock()
+			f.rcpt = append(f.rcpt, arg)
+			f.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.data = data
+			f.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// wait returns once the client hung up
+func (f *fakeSMTP) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP session did not end")
+	}
+}
+
+func emailService(f *fakeSMTP, security string) *Service {
+	host, port, _ := net.SplitHostPort(f.addr)
+	p, _ := strconv.Atoi(port)
+	return NewService(&conf.NotificationConfig{
+		Enable:  true,
+		BaseURL: "https://itam.example.com/",
+		Email: conf.EmailConfig{
+			Host: host, Port: p, Security: security, InsecureSkipVerify: true,
+			Username: "itam", Password: "secret",
+			From: "ITAM <itam@example.com>", Timeout: 5 * time.Second,
+		},
+	})
+}
+
+var emailMessage = Message{
+	Title:    "合同即将到期",
+	Content:  "Contract <b>C-7</b> expires in 7 days",
+	Severity: SeverityWarning,
+	Link:     "/contracts?id=7",
+	Attachments: []Attachment{
+		{Name: "报价 offer.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte("%PDF-1.4 \x00\xff"), 20)},
+		{Name: "notes.bin", Data: []byte{1, 2, 3}},
+	},
+}
+
+func TestSendEmailSTARTTLS(t *testing.T) {
+	f := newFakeSMTP(t, true, false)
+	if err := emailService(f, SecuritySTARTTLS).sendEmail(emailMessage, []string{"ops@example.com", "fin@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	f.wait(t)
+
+	if got := strings.Join(f.commands, " "); got != "EHLO STARTTLS EHLO AUTH MAIL RCPT RCPT DATA QUIT" {
+		t.Fatalf("commands = %s", got)
+	}
+	for _, verb := range []string{"AUTH", "MAIL", "DATA"} {
+		if !f.overTLS[verb] {
+			t.Fatalf("%s sent before TLS was up", verb)
+		}
+	}
+	if f.auth != "\x00itam\x00secret" {
+		t.Fatalf("AUTH PLAIN = %q", f.auth)
+	}
+	if f.from != "FROM:<itam@example.com>" || len(f.rcpt) != 2 || f.rcpt[1] != "TO:<fin@example.com>" {
+		t.Fatalf("envelope from %s to %v", f.from, f.rcpt)
+	}
+
+	checkEmailStructure(t, f.data)
+}
+
+func TestSendEmailRefusesWithoutSTARTTLS(t *testing.T) {
+	f := newFakeSMTP(t, false, false)
+	err := emailService(f, SecuritySTARTTLS).sendEmail(emailMessage, []string{"ops@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "does not offer STARTTLS") {
+		t.Fatalf("err = %v", err)
+	}
+	f.wait(t)
+
+	for _, verb := range f.commands {
+		if verb == "AUTH" || verb == "MAIL" || verb == "DATA" {
+			t.Fatalf("%s sent over plain text, commands = %v", verb, f.commands)
+		}
+	}
+	if f.auth != "" {
+		t.Fatal("password sent in the clear")
+	}
+}
+
+func TestSendEmailImplicitTLS(t *testing.T) {
+	f := newFakeSMTP(t, false, true)
+	if err := emailService(f, SecurityTLS).sendEmail(emailMessage, []string{"ops@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	f.wait(t)
+	if !f.overTLS["EHLO"] || f.auth != "\x00itam\x00secret" || f.data == nil {
+		t.Fatalf("commands = %v over TLS %v", f.commands, f.overTLS)
+	}
+}
+
+// checkEmailStructure parses the message the way a mail client would:
+// multipart/mixed holding multipart/alternative (text, then HTML) and
+// the base64 encoded attachments
+func checkEmailStructure(t *testing.T, raw []byte) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "【ITAM】"+emailMessage.Title {
+		t.Fatalf("subject = %q, %v", subject, err)
+	}
+	if msg.Header.Get("To") != "ops@example.com, fin@example.com" || msg.Header.Get("MIME-Version") != "1.0" {
+		t.Fatalf("headers = %v", msg.Header)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %s", msg.Header.Get("Content-Type"))
+	}
+	mixed := multipart.NewReader(msg.Body, params["boundary"])
+
+	first, err := mixed.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(first.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("first part is %s", mediaType)
+	}
+	alt := multipart.NewReader(first, params["boundary"])
+	var bodies []string
+	for {
+		p, err := alt.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The reader decodes quoted-printable and drops the header
+		if p.Header.Get("Content-Transfer-Encoding") != "" {
+			t.Fatalf("part %s is not quoted-printable", p.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(p)
+		bodies = append(bodies, p.Header.Get("Content-Type")+"\n"+string(b))
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("%d alternatives, want 2", len(bodies))
+	}
+	text, html := bodies[0], bodies[1]
+	if !strings.HasPrefix(text, "text/plain; charset=utf-8\n") || !strings.Contains(text, emailMessage.Content) ||
+		!strings.Contains(text, "https://itam.example.com/contracts?id=7") {
+		t.Fatalf("text part = %s", text)
+	}
+	if !strings.HasPrefix(html, "text/html; charset=utf-8\n") || !strings.Contains(html, "Contract &lt;b&gt;C-7&lt;/b&gt;") {
+		t.Fatalf("html part = %s", html)
+	}
+
+	for _, want := range emailMessage.Attachments {
+		p, err := mixed.NextPart()
+		if err != nil {
+			t.Fatalf("attachment %s: %v", want.Name, err)
+		}
+		contentType := want.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if p.FileName() != want.Name || p.Header.Get("Content-Type") != contentType || p.Header.Get("Content-Transfer-Encoding") != "base64" {
+			t.Fatalf("attachment headers = %v, filename %q", p.Header, p.FileName())
+		}
+		encoded, _ := io.ReadAll(p)
+		for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\n") {
+			if len(strings.TrimSuffix(line, "\r")) > 76 {
+				t.Fatalf("base64 line of %d characters", len(line))
+			}
+		}
+		got, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(encoded)), ""))
+		if err != nil || !bytes.Equal(got, want.Data) {
+			t.Fatalf("attachment %s decodes to %q, %v", want.Name, got, err)
+		}
+	}
+	if _, err := mixed.NextPart(); err != io.EOF {
+		t.Fatalf("extra part after the attachments: %v", err)
+	}
+}
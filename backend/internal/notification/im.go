@@ -0,0 +1,199 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IM providers
+const (
+	ProviderFeishu     = "feishu"
+	ProviderDingTalk   = "dingtalk"
+	ProviderWeChatWork = "wechat_work"
+)
+
+// The bots answer HTTP 200 for most failures and report them in the body
+type imResponse struct {
+	ErrCode *int   `json:"errcode"` // DingTalk, WeCom
+	ErrMsg  string `json:"errmsg"`
+	Code    *int   `json:"code"` // Feishu
+	Msg     string `json:"msg"`
+}
+
+func (s *Service) sendIM(msg Message) error {
+	cfg := s.cfg.IM
+	if cfg.Webhook == "" {
+		return nil
+	}
+
+	switch cfg.Provider {
+	case ProviderFeishu:
+		return s.sendFeishu(cfg.Webhook, cfg.Secret, msg)
+	case ProviderDingTalk:
+		return s.sendDingTalk(cfg.Webhook, cfg.Secret, msg)
+	case ProviderWeChatWork:
+		return s.sendWeChatWork(cfg.Webhook, msg)
+	default:
+		return fmt.Errorf("unknown IM provider: %s", cfg.Provider)
+	}
+}
+
+// sendFeishu posts an interactive card. Bots with signature verification
+// expect timestamp and sign in the body, sign being the base64 HMAC-SHA256
+// of nothing, keyed with "timestamp\nsecret".
+func (s *Service) sendFeishu(webhook, secret string, msg Message) error {
+	template := map[Severity]string{SeverityCritical: "red", SeverityWarning: "orange"}[msg.Severity]
+	if template == "" {
+		template = "blue"
+	}
+	elements := []interface{}{
+		map[string]interface{}{
+			"tag":  "div",
+			"text": map[string]interface{}{"tag": "lark_md", "content": fmt.Sprintf("**Severity:** %s\n%s", msg.Severity.label(), msg.Content)},
+		},
+	}
+	if link := s.link(msg); link != "" {
+		elements = append(elements, map[string]interface{}{
+			"tag": "action",
+			"actions": []interface{}{map[string]interface{}{
+				"tag":  "button",
+				"text": map[string]interface{}{"tag": "plain_text", "content": "View in ITAM"},
+				"type": "primary",
+				"url":  link,
+			}},
+		})
+	}
+	body := map[string]interface{}{
+		"msg_type": "interactive",
+		"card": map[string]interface{}{
+			"header": map[string]interface{}{
+				"title":    map[string]interface{}{"tag": "plain_text", "content": "【ITAM】" + msg.Title},
+				"template": template,
+			},
+			"elements": elements,
+		},
+	}
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+		body["timestamp"] = timestamp
+		body["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	resp, err := s.postIM(webhook, body)
+	if err != nil {
+		return fmt.Errorf("feishu: %w", err)
+	}
+	if resp.Code != nil && *resp.Code != 0 {
+		return fmt.Errorf("feishu: error %d: %s", *resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// sendDingTalk posts a markdown message. With a signing secret the
+// webhook gets timestamp (ms) and sign, the base64 HMAC-SHA256 of
+// "timestamp\nsecret" keyed with the secret.
+func (s *Service) sendDingTalk(webhook, secret string, msg Message) error {
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "\n" + secret))
+		u, err := url.Parse(webhook)
+		if err != nil {
+			return fmt.Errorf("dingtalk: invalid webhook: %w", err)
+		}
+		q := u.Query()
+		q.Set("timestamp", timestamp)
+		q.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		u.RawQuery = q.Encode()
+		webhook = u.String()
+	}
+
+	text := fmt.Sprintf("### 【ITAM】%s\n\n**Severity:** %s\n\n%s", msg.Title, msg.Severity.label(), msg.Content)
+	if link := s.link(msg); link != "" {
+		text += fmt.Sprintf("\n\n[View in ITAM](%s)", link)
+	}
+	body := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]interface{}{"title": "【ITAM】" + msg.Title, "text": text},
+	}
+
+	resp, err := s.postIM(webhook, body)
+	if err != nil {
+		return fmt.Errorf("dingtalk: %w", err)
+	}
+	if resp.ErrCode == nil || *resp.ErrCode != 0 {
+		return fmt.Errorf("dingtalk: error %s: %s", codeString(resp.ErrCode), resp.ErrMsg)
+	}
+	return nil
+}
+
+// sendWeChatWork posts a markdown message. WeCom group bots are not
+// signed, the key in the webhook URL is the credential.
+func (s *Service) sendWeChatWork(webhook string, msg Message) error {
+	color := map[Severity]string{SeverityCritical: "warning", SeverityWarning: "warning"}[msg.Severity]
+	if color == "" {
+		color = "info"
+	}
+	text := fmt.Sprintf("### 【ITAM】%s\n> Severity: <font color=\"%s\">%s</font>\n\n%s",
+		msg.Title, color, msg.Severity.label(), msg.Content)
+	if link := s.link(msg); link != "" {
+		text += fmt.Sprintf("\n[View in ITAM](%s)", link)
+	}
+	body := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]interface{}{"content": text},
+	}
+
+	resp, err := s.postIM(webhook, body)
+	if err != nil {
+		return fmt.Errorf("wechat_work: %w", err)
+	}
+	if resp.ErrCode == nil || *resp.ErrCode != 0 {
+		return fmt.Errorf("wechat_work: error %s: %s", codeString(resp.ErrCode), resp.ErrMsg)
+	}
+	return nil
+}
+
+// postIM posts body as JSON and decodes the bot's answer
+func (s *Service) postIM(webhook string, body interface{}) (*imResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	var r imResponse
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("unexpected response: %s", strings.TrimSpace(string(raw)))
+	}
+	return &r, nil
+}
+
+func codeString(code *int) string {
+	if code == nil {
+		return "missing"
+	}
+	return strconv.Itoa(*code)
+}
@@ -0,0 +1,227 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"itam-backend/internal/conf"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBot answers like an IM bot webhook and keeps the last request
+type fakeBot struct {
+	*httptest.Server
+	status int
+	answer string
+	query  url.Values
+	body   map[string]interface{}
+}
+
+func newFakeBot(t *testing.T, answer string) *fakeBot {
+	bot := &fakeBot{status: http.StatusOK, answer: answer}
+	bot.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		raw, _ := io.ReadAll(r.Body)
+		bot.query = r.URL.Query()
+		bot.body = nil
+		if err := json.Unmarshal(raw, &bot.body); err != nil {
+			t.Errorf("request body is not JSON: %s", raw)
+		}
+		w.WriteHeader(bot.status)
+		io.WriteString(w, bot.answer)
+	}))
+	t.Cleanup(bot.Close)
+	return bot
+}
+
+func imService(provider, webhook, secret string) *Service {
+	return NewService(&conf.NotificationConfig{
+		Enable:  true,
+		BaseURL: "https://itam.example.com/",
+		IM:      conf.IMConfig{Provider: provider, Webhook: webhook, Secret: secret},
+	})
+}
+
+var imMessage = Message{
+	Title:    "Asset db-01 went offline",
+	Content:  "Status changed from online to offline",
+	Severity: SeverityCritical,
+	Link:     "/assets/7",
+}
+
+func hmacBase64(key, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// lookup walks nested maps and slices of a decoded JSON body
+func lookup(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[k]
+		case int:
+			s, _ := v.([]interface{})
+			if k >= len(s) {
+				return nil
+			}
+			v = s[k]
+		}
+	}
+	return v
+}
+
+func checkRecent(t *testing.T, timestamp string, unit time.Duration) {
+	t.Helper()
+	n, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp %q is not a number", timestamp)
+	}
+	if d := time.Since(time.Unix(0, n*int64(unit))); d < -time.Minute || d > time.Minute {
+		t.Fatalf("timestamp %s is %v away from now", timestamp, d)
+	}
+}
+
+func TestFeishuSignedCard(t *testing.T) {
+	bot := newFakeBot(t, `{"code":0,"msg":"success"}`)
+	s := imService(ProviderFeishu, bot.URL, "SEC123")
+
+	if err := s.sendIM(imMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp, _ := bot.body["timestamp"].(string)
+	checkRecent(t, timestamp, time.Second)
+	// Feishu signs nothing with the key "timestamp\nsecret"
+	if want := hmacBase64(timestamp+"\nSEC123", ""); bot.body["sign"] != want {
+		t.Fatalf("sign = %v, want %s", bot.body["sign"], want)
+	}
+
+	if bot.body["msg_type"] != "interactive" {
+		t.Fatalf("msg_type = %v", bot.body["msg_type"])
+	}
+	if got := lookup(bot.body, "card", "header", "title", "content"); got != "【ITAM】"+imMessage.Title {
+		t.Fatalf("card title = %v", got)
+	}
+	if got := lookup(bot.body, "card", "header", "template"); got != "red" {
+		t.Fatalf("critical card template = %v, want red", got)
+	}
+	text, _ := lookup(bot.body, "card", "elements", 0, "text", "content").(string)
+	if !strings.Contains(text, "**Severity:** Critical") || !strings.Contains(text, imMessage.Content) {
+		t.Fatalf("card text = %q", text)
+	}
+	if got := lookup(bot.body, "card", "elements", 1, "actions", 0, "url"); got != "https://itam.example.com/assets/7" {
+		t.Fatalf("button url = %v", got)
+	}
+}
+
+func TestFeishuUnsigned(t *testing.T) {
+	bot := newFakeBot(t, `{"code":0}`)
+	if err := imService(ProviderFeishu, bot.URL, "").sendIM(imMessage); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bot.body["sign"]; ok {
+		t.Fatal("unsigned bot got a sign")
+	}
+}
+
+func TestDingTalkSignedMarkdown(t *testing.T) {
+	bot := newFakeBot(t, `{"errcode":0,"errmsg":"ok"}`)
+	s := imService(ProviderDingTalk, bot.URL+"/robot/send?access_token=abc", "SECdt")
+
+	if err := s.sendIM(imMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	if bot.query.Get("access_token") != "abc" {
+		t.Fatalf("access_token lost: %v", bot.query)
+	}
+	timestamp := bot.query.Get("timestamp")
+	checkRecent(t, timestamp, time.Millisecond)
+	// DingTalk signs "timestamp\nsecret" with the secret as key
+	if want := hmacBase64("SECdt", timestamp+"\nSECdt"); bot.query.Get("sign") != want {
+		t.Fatalf("sign = %q, want %q", bot.query.Get("sign"), want)
+	}
+
+	if bot.body["msgtype"] != "markdown" {
+		t.Fatalf("msgtype = %v", bot.body["msgtype"])
+	}
+	if got := lookup(bot.body, "markdown", "title"); got != "【ITAM】"+imMessage.Title {
+		t.Fatalf("title = %v", got)
+	}
+	text, _ := lookup(bot.body, "markdown", "text").(string)
+	for _, want := range []string{"### 【ITAM】" + imMessage.Title, "**Severity:** Critical", imMessage.Content, "[View in ITAM](https://itam.example.com/assets/7)"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text %q lacks %q", text, want)
+		}
+	}
+}
+
+func TestWeChatWorkMarkdown(t *testing.T) {
+	bot := newFakeBot(t, `{"errcode":0,"errmsg":"ok"}`)
+	msg := imMessage
+	msg.Severity = SeverityInfo
+
+	if err := imService(ProviderWeChatWork, bot.URL+"/cgi-bin/webhook/send?key=k1", "ignored").sendIM(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if bot.query.Get("key") != "k1" || bot.query.Get("sign") != "" {
+		t.Fatalf("query = %v, want the key and no signature", bot.query)
+	}
+	if bot.body["msgtype"] != "markdown" {
+		t.Fatalf("msgtype = %v", bot.body["msgtype"])
+	}
+	text, _ := lookup(bot.body, "markdown", "content").(string)
+	for _, want := range []string{"### 【ITAM】" + msg.Title, `<font color="info">Info</font>`, msg.Content, "[View in ITAM](https://itam.example.com/assets/7)"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("content %q lacks %q", text, want)
+		}
+	}
+}
+
+// The bots report most failures with HTTP 200 and an error code
+func TestIMErrorAnswers(t *testing.T) {
+	tests := []struct {
+		provider string
+		status   int
+		answer   string
+		want     string
+	}{
+		{ProviderFeishu, 200, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`, "feishu: error 19021: sign match fail"},
+		{ProviderFeishu, 200, `{"code":9499,"msg":"Bad Request"}`, "feishu: error 9499"},
+		{ProviderDingTalk, 200, `{"errcode":310000,"errmsg":"sign not match"}`, "dingtalk: error 310000: sign not match"},
+		{ProviderDingTalk, 200, `{"ok":true}`, "dingtalk: error missing"},
+		{ProviderWeChatWork, 200, `{"errcode":93000,"errmsg":"invalid webhook url"}`, "wechat_work: error 93000: invalid webhook url"},
+		{ProviderWeChatWork, 200, `{}`, "wechat_work: error missing"},
+		{ProviderDingTalk, 200, `<html>gateway</html>`, "dingtalk: unexpected response"},
+		{ProviderFeishu, 502, `bad gateway`, "feishu: webhook returned status 502: bad gateway"},
+	}
+	for _, tt := range tests {
+		bot := newFakeBot(t, tt.answer)
+		bot.status = tt.status
+		err := imService(tt.provider, bot.URL, "s").sendIM(imMessage)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s answering %d %s: err = %v, want %q", tt.provider, tt.status, tt.answer, err, tt.want)
+		}
+	}
+}
+
+func TestIMUnknownProvider(t *testing.T) {
+	err := imService("slack", "http://127.0.0.1:1", "").sendIM(imMessage)
+	if err == nil || !strings.Contains(err.Error(), "unknown IM provider") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package notification
+
+import (
+	"context"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"strings"
+)
+
+// Severity ranks how urgent a message is, channels use it for colouring
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Message kinds, each has its own email template
+const (
+	KindAssetCreated     = "asset_created"
+	KindAssetDeleted     = "asset_deleted"
+	KindContractExpiring = "contract_expiring"
+	KindContractExpired  = "contract_expired"
+	KindAccountLocked    = "account_locked"
+)
+
+// AllKinds lists every message kind, routing rules and subscriptions
+// match on them
+var AllKinds = []string{
+	KindAssetCreated, KindAssetDeleted,
+	KindContractExpiring, KindContractExpired,
+	KindAccountLocked,
+}
+
+// KindPermission is the permission a user needs to subscribe to kind:
+// reading the assets or contracts it is about, or managing users for
+// account lockouts. Empty for unknown kinds.
+func KindPermission(kind string) string {
+	switch kind {
+	case KindAssetCreated, KindAssetDeleted:
+		return model.PermAssetRead
+	case KindContractExpiring, KindContractExpired:
+		return model.PermContractRead
+	case KindAccountLocked:
+		return model.PermUserWrite
+	default:
+		return ""
+	}
+}
+
+// AllSeverities lists the severities from least to most urgent
+var AllSeverities = []Severity{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// IsValidKind reports whether k is a message kind
+func IsValidKind(k string) bool {
+	for _, kind := range AllKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidSeverity reports whether s is a severity
+func IsValidSeverity(s string) bool {
+	return Severity(s).rank() >= 0
+}
+
+// Message is a notification as composed by the rest of the system,
+// each channel renders it in its own format
+type Message struct {
+	Kind     string
+	Title    string
+	Content  string
+	Severity Severity
+	// Link points back to the object the message is about, either an
+	// absolute URL or a path in the web UI such as "/assets?id=7"
+	Link string
+
+	// TenantID scopes the lookup of Recipients
+	TenantID uint
+	// Recipients name the people to email: usernames, display names (as
+	// kept in the Owner fields) or email addresses
+	Recipients []string
+	// Data holds the objects the kind's templates render, e.g. "Asset"
+	Data        map[string]interface{}
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along by channels that support it
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// rank orders severities by urgency, -1 for unknown ones
+func (s Severity) rank() int {
+	for i, severity := range AllSeverities {
+		if severity == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// label is the severity as shown to people
+func (s Severity) label() string {
+	switch s {
+	case SeverityCritical:
+		return "Critical"
+	case SeverityWarning:
+		return "Warning"
+	default:
+		return "Info"
+	}
+}
+
+// link resolves msg.Link against the web UI address, paths are dropped
+// when that address is not configured
+func (s *Service) link(msg Message) string {
+	if msg.Link == "" || strings.Contains(msg.Link, "://") {
+		return msg.Link
+	}
+	if s.cfg.BaseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.cfg.BaseURL, "/") + "/" + strings.TrimPrefix(msg.Link, "/")
+}
+
+// scope is the tenant scope to look up the message's users and rules in
+func (msg Message) scope() context.Context {
+	if msg.TenantID == 0 {
+		return tenant.WithAll(context.Background())
+	}
+	return tenant.WithTenant(context.Background(), msg.TenantID)
+}
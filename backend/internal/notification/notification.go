@@ -1,91 +1,81 @@
 package notification
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"itam-backend/internal/conf"
+	"itam-backend/internal/model"
 	"log"
 	"net/http"
+	"time"
 )
 
 type Service struct {
-	cfg *conf.NotificationConfig
+	cfg    *conf.NotificationConfig
+	client *http.Client
+	wake   chan struct{}
 }
 
 func NewService(cfg *conf.NotificationConfig) *Service {
 	return &Service{
-		cfg: cfg,
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		wake:   make(chan struct{}, 1),
 	}
 }
 
-// SendAlert sends an alert message to all enabled channels
+// SendAlert queues a warning with the given title and content for all
+// enabled channels
 func (s *Service) SendAlert(title, content string) error {
+	return s.Send(Message{Title: title, Content: content, Severity: SeverityWarning})
+}
+
+// Send queues msg in the outbox for every configured channel. The
+// workers started by Start deliver it, retrying each channel on its own,
+// so an error here means the message could not be stored.
+func (s *Service) Send(msg Message) error {
 	if !s.cfg.Enable {
-		log.Println("Notification disabled, skipping alert:", title)
+		log.Println("Notification disabled, skipping alert:", msg.Title)
 		return nil
 	}
+	return s.enqueue(msg)
+}
 
-	var errs []error
+// Enabled reports whether notifications are switched on
+func (s *Service) Enabled() bool {
+	return s.cfg.Enable
+}
 
-	// 1. Send IM
-	if err := s.sendIM(title, content); err != nil {
-		log.Printf("Failed to send IM: %v", err)
-		errs = append(errs, err)
+// channels lists the channels that are configured
+func (s *Service) channels() []string {
+	var channels []string
+	if s.cfg.IM.Webhook != "" {
+		channels = append(channels, model.NotificationChannelIM)
 	}
-
-	// 2. Send SMS
-	if err := s.sendSMS(content); err != nil {
-		log.Printf("Failed to send SMS: %v", err)
-		errs = append(errs, err)
+	if s.cfg.Email.Host != "" {
+		channels = append(channels, model.NotificationChannelEmail)
 	}
-
-	if len(errs) > 0 {
-		return fmt.Errorf("encountered %d errors while sending notification", len(errs))
+	if s.cfg.SMS.AccessKeyID != "" {
+		channels = append(channels, model.NotificationChannelSMS)
 	}
-	return nil
+	return channels
 }
 
-func (s *Service) sendIM(title, content string) error {
-	cfg := s.cfg.IM
-	if cfg.Webhook == "" {
-		return nil
-	}
-
-	switch cfg.Provider {
-	case "feishu":
-		return s.sendFeishu(cfg.Webhook, title, content)
-	case "dingtalk":
-		// Implement DingTalk logic
-		return fmt.Errorf("dingtalk provider not implemented yet")
-	case "wechat_work":
-		// Implement WeChat Work logic
-		return fmt.Errorf("wechat_work provider not implemented yet")
+// deliver sends msg over one channel, by email to recipient if given
+func (s *Service) deliver(channel, recipient string, msg Message) error {
+	switch channel {
+	case model.NotificationChannelIM:
+		return s.sendIM(msg)
+	case model.NotificationChannelEmail:
+		var to []string
+		if recipient != "" {
+			to = []string{recipient}
+		}
+		return s.sendEmail(msg, to)
+	case model.NotificationChannelSMS:
+		return s.sendSMS(msg.Content)
 	default:
-		return fmt.Errorf("unknown IM provider: %s", cfg.Provider)
-	}
-}
-
-func (s *Service) sendFeishu(webhook, title, content string) error {
-	// Feishu Custom Bot Message Format
-	msg := map[string]interface{}{
-		"msg_type": "text",
-		"content": map[string]interface{}{
-			"text": fmt.Sprintf("【ITAM Alert】%s\n%s", title, content),
-		},
-	}
-
-	payload, _ := json.Marshal(msg)
-	resp, err := http.Post(webhook, "application/json", bytes.NewBuffer(payload))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("feishu webhook returned status: %d", resp.StatusCode)
+		return fmt.Errorf("unknown channel: %s", channel)
 	}
-	return nil
 }
 
 func (s *Service) sendSMS(content string) error {
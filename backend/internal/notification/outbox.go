@@ -0,0 +1,351 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"log"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// batchSize is how many due deliveries one poll picks up
+const batchSize = 50
+
+// enqueue routes msg and stores it in the notifications outbox with a
+// pending delivery per target. Attachments go to their own table so the
+// payload stays small.
+func (s *Service) enqueue(msg Message) error {
+	now := time.Now()
+	route, err := s.Route(msg, now)
+	if err != nil {
+		return fmt.Errorf("notification: cannot route %q: %w", msg.Title, err)
+	}
+	var targets []Target
+	for _, t := range route.Targets {
+		if t.Skipped == "" {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	attachments := msg.Attachments
+	msg.Attachments = nil
+	msg.Data, _ = plain(reflect.ValueOf(msg.Data)).(map[string]interface{})
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("notification: cannot encode %q: %w", msg.Title, err)
+	}
+
+	n := model.Notification{
+		TenantID: msg.TenantID,
+		Kind:     msg.Kind,
+		Title:    msg.Title,
+		Severity: string(msg.Severity),
+		Payload:  string(payload),
+		Status:   model.NotificationStatusPending,
+		Rules:    route.Rules,
+	}
+	ctx := tenant.WithTenant(context.Background(), msg.TenantID)
+	err = data.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&n).Error; err != nil {
+			return err
+		}
+		for _, a := range attachments {
+			file := model.NotificationAttachment{NotificationID: n.ID, Name: a.Name, ContentType: a.ContentType, Data: a.Data}
+			if err := tx.Create(&file).Error; err != nil {
+				return err
+			}
+		}
+		for _, t := range targets {
+			delivery := model.NotificationDelivery{
+				NotificationID: n.ID,
+				Channel:        t.Channel,
+				Recipient:      t.Address,
+				Status:         model.NotificationStatusPending,
+				NextAttemptAt:  &now,
+			}
+			if t.NotBefore != nil {
+				delivery.NextAttemptAt = t.NotBefore
+			}
+			if err := tx.Create(&delivery).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("notification: cannot queue %q: %w", msg.Title, err)
+	}
+	s.Wake()
+	return nil
+}
+
+// Start runs a pool of cfg.Queue.Workers workers delivering the outbox
+// until ctx is done
+func (s *Service) Start(ctx context.Context) {
+	jobs := make(chan model.NotificationDelivery)
+	workers := s.cfg.Queue.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for delivery := range jobs {
+				s.work(&delivery)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		ticker := time.NewTicker(s.cfg.Queue.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.dispatchDue(ctx, jobs)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Wake makes the workers look for due deliveries now
+func (s *Service) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Retry puts the dead-lettered deliveries of a notification back in the
+// queue with a fresh set of attempts, returning how many there were
+func (s *Service) Retry(ctx context.Context, notificationID uint) (int64, error) {
+	db := data.DB.WithContext(ctx)
+	result := db.Model(&model.NotificationDelivery{}).
+		Where("notification_id = ? AND status = ?", notificationID, model.NotificationStatusDead).
+		Updates(map[string]interface{}{
+			"status":          model.NotificationStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		settle(db, notificationID)
+		s.Wake()
+	}
+	return result.RowsAffected, nil
+}
+
+// dispatchDue hands every pending delivery whose time has come to the
+// workers. A delivery can be handed out twice while a worker has yet to
+// claim it; the claim makes sure only one sends it.
+func (s *Service) dispatchDue(ctx context.Context, jobs chan<- model.NotificationDelivery) {
+	db := data.DB.WithContext(tenant.WithAll(ctx))
+	for {
+		var due []model.NotificationDelivery
+		err := db.Where("status = ? AND next_attempt_at <= ?", model.NotificationStatusPending, time.Now()).
+			Order("next_attempt_at").Limit(batchSize).Find(&due).Error
+		if err != nil {
+			log.Printf("Notification: cannot load due deliveries: %v", err)
+			return
+		}
+		for _, delivery := range due {
+			select {
+			case jobs <- delivery:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// work claims the delivery, sends it once and records the outcome
+func (s *Service) work(delivery *model.NotificationDelivery) {
+	db := data.DB.WithContext(tenant.WithAll(context.Background()))
+	if !s.claim(db, delivery) {
+		return
+	}
+	updates := map[string]interface{}{"attempts": delivery.Attempts + 1}
+
+	msg, err := load(db, delivery.NotificationID, delivery.Channel == model.NotificationChannelEmail)
+	switch {
+	case err == nil:
+		err = s.deliver(delivery.Channel, delivery.Recipient, *msg)
+		if err == nil {
+			updates["status"] = model.NotificationStatusSent
+			updates["next_attempt_at"] = nil
+			updates["delivered_at"] = time.Now()
+			updates["last_error"] = ""
+			break
+		}
+		if delivery.Attempts+1 < s.cfg.Queue.MaxAttempts {
+			updates["next_attempt_at"] = time.Now().Add(s.backoff(delivery.Attempts + 1))
+			updates["last_error"] = err.Error()
+			break
+		}
+		fallthrough
+	default:
+		// Deleted notifications and exhausted retries end up dead-lettered
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.New("notification was deleted")
+		}
+		log.Printf("Notification %d: %s delivery dead-lettered after %d attempt(s): %v",
+			delivery.NotificationID, delivery.Channel, delivery.Attempts+1, err)
+		updates["status"] = model.NotificationStatusDead
+		updates["next_attempt_at"] = nil
+		updates["last_error"] = err.Error()
+	}
+	if err := db.Model(delivery).Updates(updates).Error; err != nil {
+		log.Printf("Notification %d: cannot record %s delivery: %v", delivery.NotificationID, delivery.Channel, err)
+		return
+	}
+	settle(db, delivery.NotificationID)
+}
+
+// claim pushes the delivery's next attempt past the running one, so
+// other workers and replicas polling the same table skip it
+func (s *Service) claim(db *gorm.DB, delivery *model.NotificationDelivery) bool {
+	lease := time.Now().Add(2*(s.client.Timeout+s.cfg.Email.Timeout) + time.Minute)
+	result := db.Model(&model.NotificationDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, model.NotificationStatusPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", lease)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// backoff is the delay after the given number of failed attempts:
+// RetryBase, doubled per further attempt, capped at RetryMax
+func (s *Service) backoff(attempts int) time.Duration {
+	delay := s.cfg.Queue.RetryBase
+	for i := 1; i < attempts && delay < s.cfg.Queue.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.Queue.RetryMax {
+		delay = s.cfg.Queue.RetryMax
+	}
+	return delay
+}
+
+// load rebuilds the queued message, with its attachments if asked
+func load(db *gorm.DB, notificationID uint, attachments bool) (*Message, error) {
+	var n model.Notification
+	if err := db.First(&n, notificationID).Error; err != nil {
+		return nil, err
+	}
+	var msg Message
+	if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if attachments {
+		var files []model.NotificationAttachment
+		if err := db.Where("notification_id = ?", n.ID).Order("id").Find(&files).Error; err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			msg.Attachments = append(msg.Attachments, Attachment{Name: f.Name, ContentType: f.ContentType, Data: f.Data})
+		}
+	}
+	return &msg, nil
+}
+
+// settle sums up the channel deliveries in the notification's status:
+// pending while any is, dead if any was dead-lettered, sent otherwise
+func settle(db *gorm.DB, notificationID uint) {
+	var pending, dead int64
+	deliveries := db.Model(&model.NotificationDelivery{}).Where("notification_id = ?", notificationID)
+	if err := deliveries.Session(&gorm.Session{}).Where("status = ?", model.NotificationStatusPending).Count(&pending).Error; err != nil {
+		log.Printf("Notification %d: cannot settle status: %v", notificationID, err)
+		return
+	}
+	if err := deliveries.Session(&gorm.Session{}).Where("status = ?", model.NotificationStatusDead).Count(&dead).Error; err != nil {
+		log.Printf("Notification %d: cannot settle status: %v", notificationID, err)
+		return
+	}
+
+	status := model.NotificationStatusSent
+	if pending > 0 {
+		status = model.NotificationStatusPending
+	} else if dead > 0 {
+		status = model.NotificationStatusDead
+	}
+	db.Model(&model.Notification{}).Where("id = ?", notificationID).Update("status", status)
+}
+
+// plain turns v into maps, slices and scalars that survive the JSON round
+// trip through the outbox and still render in the templates: structs
+// become maps keyed by Go field name, with embedded structs flattened
+// into their parent, and Stringers such as time.Time become their string
+func plain(v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return plain(v.Elem())
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		flatten(v, m)
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = plain(iter.Value())
+		}
+		return m
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = plain(v.Index(i))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+func flatten(v reflect.Value, m map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			flatten(v.Field(i), m)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		m[f.Name] = plain(v.Field(i))
+	}
+}
@@ -0,0 +1,219 @@
+package notification
+
+import (
+	"context"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "itam-notification-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.InitDB(&conf.Config{Database: conf.DatabaseConfig{Driver: "sqlite", DbName: filepath.Join(dir, "itam.db")}})
+}
+
+// queueService sends IM to bot and SMS through the mock provider, which
+// always succeeds
+func queueService(bot *fakeBot) *Service {
+	return NewService(&conf.NotificationConfig{
+		Enable: true,
+		IM:     conf.IMConfig{Provider: ProviderFeishu, Webhook: bot.URL},
+		SMS:    conf.SMSConfig{Provider: "aliyun", AccessKeyID: "key"},
+		Queue: conf.QueueConfig{
+			Workers:      1,
+			MaxAttempts:  3,
+			RetryBase:    time.Minute,
+			RetryMax:     90 * time.Second,
+			PollInterval: time.Minute,
+		},
+	})
+}
+
+// runDue delivers the due deliveries one by one
+func runDue(s *Service) {
+	jobs := make(chan model.NotificationDelivery, batchSize)
+	s.dispatchDue(context.Background(), jobs)
+	close(jobs)
+	for delivery := range jobs {
+		s.work(&delivery)
+	}
+}
+
+func deliveries(t *testing.T) map[string]model.NotificationDelivery {
+	t.Helper()
+	var list []model.NotificationDelivery
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	byChannel := map[string]model.NotificationDelivery{}
+	for _, d := range list {
+		byChannel[d.Channel] = d
+	}
+	return byChannel
+}
+
+func notificationStatus(t *testing.T) string {
+	t.Helper()
+	var n model.Notification
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).First(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n.Status
+}
+
+// makeDue moves the pending deliveries' next attempt into the past
+func makeDue(t *testing.T) {
+	t.Helper()
+	err := data.DB.WithContext(tenant.WithAll(context.Background())).Model(&model.NotificationDelivery{}).
+		Where("status = ?", model.NotificationStatusPending).
+		Update("next_attempt_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkRetryAt(t *testing.T, d model.NotificationDelivery, delay time.Duration) {
+	t.Helper()
+	if d.NextAttemptAt == nil {
+		t.Fatalf("no next attempt after %d failure(s)", d.Attempts)
+	}
+	if got := time.Until(*d.NextAttemptAt); got < delay-5*time.Second || got > delay {
+		t.Fatalf("retry after %d failure(s) in %v, want %v", d.Attempts, got, delay)
+	}
+}
+
+func TestOutboxRetriesEachChannelOnItsOwn(t *testing.T) {
+	setupTestDB(t)
+	bot := newFakeBot(t, `{"code":0,"msg":"success"}`)
+	bot.status = http.StatusBadGateway
+	s := queueService(bot)
+
+	msg := Message{Kind: KindAssetCreated, Title: "db-01 created", Content: "db-01", Severity: SeverityWarning, TenantID: data.DefaultTenantID}
+	if err := s.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failing IM bot does not hold back SMS
+	runDue(s)
+	d := deliveries(t)
+	if len(d) != 2 {
+		t.Fatalf("deliveries = %+v, want im and sms", d)
+	}
+	if sms := d[model.NotificationChannelSMS]; sms.Status != model.NotificationStatusSent || sms.Attempts != 1 || sms.DeliveredAt == nil {
+		t.Fatalf("sms = %+v, want sent on the first attempt", sms)
+	}
+	im := d[model.NotificationChannelIM]
+	if im.Status != model.NotificationStatusPending || im.Attempts != 1 || im.LastError == "" {
+		t.Fatalf("im = %+v, want pending with the error after one attempt", im)
+	}
+	checkRetryAt(t, im, time.Minute)
+	if got := notificationStatus(t); got != model.NotificationStatusPending {
+		t.Fatalf("notification status = %s, want pending", got)
+	}
+
+	// Not due yet, nothing is sent
+	runDue(s)
+	if im := deliveries(t)[model.NotificationChannelIM]; im.Attempts != 1 {
+		t.Fatalf("im attempted %d times before its retry was due", im.Attempts)
+	}
+
+	makeDue(t)
+	runDue(s)
+	im = deliveries(t)[model.NotificationChannelIM]
+	if im.Status != model.NotificationStatusPending || im.Attempts != 2 {
+		t.Fatalf("im = %+v, want pending after two attempts", im)
+	}
+	checkRetryAt(t, im, 90*time.Second)
+
+	// The last attempt dead-letters IM, the sent SMS stays sent
+	makeDue(t)
+	runDue(s)
+	d = deliveries(t)
+	im = d[model.NotificationChannelIM]
+	if im.Status != model.NotificationStatusDead || im.Attempts != 3 || im.NextAttemptAt != nil || im.LastError == "" {
+		t.Fatalf("im = %+v, want dead-lettered after three attempts", im)
+	}
+	if sms := d[model.NotificationChannelSMS]; sms.Status != model.NotificationStatusSent || sms.Attempts != 1 {
+		t.Fatalf("sms = %+v, want sent once", sms)
+	}
+	if got := notificationStatus(t); got != model.NotificationStatusDead {
+		t.Fatalf("notification status = %s, want dead", got)
+	}
+
+	// A manual retry gets fresh attempts for the dead-lettered channel only
+	ctx := tenant.WithAll(context.Background())
+	var n model.Notification
+	data.DB.WithContext(ctx).First(&n)
+	retried, err := s.Retry(ctx, n.ID)
+	if err != nil || retried != 1 {
+		t.Fatalf("Retry = %d, %v, want 1 delivery", retried, err)
+	}
+	if im := deliveries(t)[model.NotificationChannelIM]; im.Status != model.NotificationStatusPending || im.Attempts != 0 {
+		t.Fatalf("im after retry = %+v, want pending with no attempts", im)
+	}
+	if got := notificationStatus(t); got != model.NotificationStatusPending {
+		t.Fatalf("notification status after retry = %s, want pending", got)
+	}
+
+	bot.status = http.StatusOK
+	runDue(s)
+	d = deliveries(t)
+	if im := d[model.NotificationChannelIM]; im.Status != model.NotificationStatusSent || im.Attempts != 1 || im.LastError != "" {
+		t.Fatalf("im = %+v, want sent with the error cleared", im)
+	}
+	if sms := d[model.NotificationChannelSMS]; sms.Attempts != 1 {
+		t.Fatalf("sms was sent again, %d attempts", sms.Attempts)
+	}
+	if got := notificationStatus(t); got != model.NotificationStatusSent {
+		t.Fatalf("notification status = %s, want sent", got)
+	}
+}
+
+func TestOutboxDeadLettersDeletedNotifications(t *testing.T) {
+	setupTestDB(t)
+	bot := newFakeBot(t, `{"code":0,"msg":"success"}`)
+	s := queueService(bot)
+	if err := s.Send(Message{Title: "gone", Severity: SeverityInfo, TenantID: data.DefaultTenantID}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := tenant.WithAll(context.Background())
+	if err := data.DB.WithContext(ctx).Where("1 = 1").Delete(&model.Notification{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	runDue(s)
+	for channel, d := range deliveries(t) {
+		if d.Status != model.NotificationStatusDead || d.Attempts != 1 || d.LastError != "notification was deleted" {
+			t.Fatalf("%s = %+v, want dead-lettered at once", channel, d)
+		}
+	}
+	if bot.body != nil {
+		t.Fatal("deleted notification was sent")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := NewService(&conf.NotificationConfig{Queue: conf.QueueConfig{RetryBase: time.Minute, RetryMax: 10 * time.Minute}})
+	for attempts, want := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		4:  8 * time.Minute,
+		5:  10 * time.Minute,
+		60: 10 * time.Minute,
+	} {
+		if got := s.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
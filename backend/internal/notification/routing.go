@@ -0,0 +1,490 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RuleSubscription marks targets added by a user's own subscription
+const RuleSubscription = "subscription"
+
+// Target is one delivery a routed message gets
+type Target struct {
+	Channel   string     `json:"channel"`
+	Address   string     `json:"address,omitempty"`    // email address, empty for group channels (IM, SMS)
+	Username  string     `json:"username,omitempty"`   // the user the address belongs to, whose preferences apply
+	Rules     []string   `json:"rules,omitempty"`      // rules that selected it, empty for the default route
+	NotBefore *time.Time `json:"not_before,omitempty"` // held back until the user's quiet hours end
+	Skipped   string     `json:"skipped,omitempty"`    // why it is not sent
+	userID    uint
+}
+
+// Route is who a message goes to and how
+type Route struct {
+	Rules   []string `json:"rules"`   // matched rules, empty when the default route applies
+	Targets []Target `json:"targets"` // skipped targets included
+}
+
+// Route works out the deliveries of msg at time now.
+//
+// The tenant's enabled rules are tried by priority. Every matching rule
+// adds its channels and its email recipients, "@owner" standing for
+// msg.Recipients, until one with StopProcessing. When no rule matches,
+// the default route sends to every configured channel and emails
+// msg.Recipients. Email always copies the configured Email.To addresses,
+// and users subscribed to the kind get it by email too.
+//
+// The preferences of the users behind email addresses then drop muted
+// kinds and low severities, and hold non-critical messages back during
+// quiet hours. IM and SMS go to groups, so preferences do not apply.
+func (s *Service) Route(msg Message, now time.Time) (*Route, error) {
+	db := data.DB.WithContext(msg.scope())
+	var rules []model.NotificationRule
+	if err := db.Where("enabled = ?", true).Order("priority, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	r := &router{route: &Route{Rules: []string{}, Targets: []Target{}}, index: map[string]int{}}
+	attrs := attributesOf(msg)
+	var wanted []recipient
+	var emailRules []string
+	emailSelected := false
+	for _, rule := range rules {
+		if !ruleMatches(&rule, msg, attrs) {
+			continue
+		}
+		r.route.Rules = append(r.route.Rules, rule.Name)
+		for _, channel := range rule.Channels {
+			if channel != model.NotificationChannelEmail {
+				r.add(Target{Channel: channel, Rules: []string{rule.Name}})
+				continue
+			}
+			emailSelected = true
+			emailRules = append(emailRules, rule.Name)
+			for _, name := range rule.Recipients {
+				if name == model.OwnerRecipient {
+					for _, owner := range msg.Recipients {
+						wanted = append(wanted, recipient{name: owner, rule: rule.Name})
+					}
+					continue
+				}
+				wanted = append(wanted, recipient{name: name, rule: rule.Name})
+			}
+		}
+		if rule.StopProcessing {
+			break
+		}
+	}
+	if len(r.route.Rules) == 0 {
+		for _, channel := range s.channels() {
+			if channel != model.NotificationChannelEmail {
+				r.add(Target{Channel: channel})
+				continue
+			}
+			emailSelected = true
+			for _, name := range msg.Recipients {
+				wanted = append(wanted, recipient{name: name})
+			}
+		}
+	}
+	if emailSelected {
+		for _, addr := range s.cfg.Email.To {
+			for _, rule := range emailRules {
+				wanted = append(wanted, recipient{name: addr, rule: rule})
+			}
+			if len(emailRules) == 0 {
+				wanted = append(wanted, recipient{name: addr})
+			}
+		}
+	}
+
+	if err := r.resolve(msg, wanted); err != nil {
+		return nil, err
+	}
+	if err := r.subscribe(msg); err != nil {
+		return nil, err
+	}
+	if err := r.applyPreferences(msg, now); err != nil {
+		return nil, err
+	}
+
+	configured := map[string]bool{}
+	for _, channel := range s.channels() {
+		configured[channel] = true
+	}
+	for i := range r.route.Targets {
+		t := &r.route.Targets[i]
+		if t.Skipped == "" && !configured[t.Channel] {
+			t.Skipped = "channel is not configured"
+		}
+	}
+	return r.route, nil
+}
+
+// recipient is an email recipient as named by a rule: a username,
+// display name or address
+type recipient struct {
+	name    string
+	rule    string
+	address bool
+}
+
+// router collects the targets of one message, merging duplicates
+type router struct {
+	route *Route
+	index map[string]int
+}
+
+func (r *router) add(t Target) {
+	key := targetKey(t)
+	if i, ok := r.index[key]; ok {
+		existing := &r.route.Targets[i]
+		for _, rule := range t.Rules {
+			if !contains(existing.Rules, rule) {
+				existing.Rules = append(existing.Rules, rule)
+			}
+		}
+		if existing.userID == 0 {
+			existing.userID, existing.Username = t.userID, t.Username
+		}
+		return
+	}
+	r.index[key] = len(r.route.Targets)
+	r.route.Targets = append(r.route.Targets, t)
+}
+
+// has reports whether t is among the targets already
+func (r *router) has(t Target) bool {
+	_, ok := r.index[targetKey(t)]
+	return ok
+}
+
+func targetKey(t Target) string {
+	key := t.Channel + "\x00" + strings.ToLower(t.Address)
+	if t.Address == "" && t.Username != "" {
+		key += "\x00" + t.Username
+	}
+	return key
+}
+
+// resolve turns the wanted recipients into email targets. Names are
+// matched against active users with an email, addresses against users
+// so that their preferences apply.
+func (r *router) resolve(msg Message, wanted []recipient) error {
+	var names, addrs []string
+	for i := range wanted {
+		wanted[i].name = strings.TrimSpace(wanted[i].name)
+		if wanted[i].name == "" {
+			continue
+		}
+		if a, err := mail.ParseAddress(wanted[i].name); err == nil {
+			wanted[i].name, wanted[i].address = a.Address, true
+			addrs = append(addrs, a.Address)
+			continue
+		}
+		names = append(names, wanted[i].name)
+	}
+
+	var users []model.User
+	if len(names) > 0 || len(addrs) > 0 {
+		err := data.DB.WithContext(msg.scope()).
+			Where("(username IN ? OR display_name IN ? OR email IN ?) AND status = ? AND email <> ''",
+				names, names, addrs, model.UserStatusActive).
+			Find(&users).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, w := range wanted {
+		if w.name == "" {
+			continue
+		}
+		t := Target{Channel: model.NotificationChannelEmail}
+		if w.rule != "" {
+			t.Rules = []string{w.rule}
+		}
+		if w.address {
+			t.Address = w.name
+			for _, u := range users {
+				if strings.EqualFold(u.Email, w.name) {
+					t.Username, t.userID = u.Username, u.ID
+					break
+				}
+			}
+			r.add(t)
+			continue
+		}
+		found := false
+		for _, u := range users {
+			if u.Username == w.name || u.DisplayName == w.name {
+				t.Address, t.Username, t.userID = u.Email, u.Username, u.ID
+				r.add(t)
+				found = true
+			}
+		}
+		if !found {
+			t.Username = w.name
+			t.Skipped = "no active user with an email"
+			r.add(t)
+		}
+	}
+	return nil
+}
+
+// subscribe adds the users who subscribed to msg's kind. A subscription
+// only delivers what the user could read in the API: their role must
+// grant the kind's permission and, for assets and contracts, the object
+// must lie within the role's data scope.
+func (r *router) subscribe(msg Message) error {
+	db := data.DB.WithContext(msg.scope())
+	var prefs []model.NotificationPreference
+	if err := db.Find(&prefs).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	for _, p := range prefs {
+		if contains(p.Subscriptions, "*") || contains(p.Subscriptions, msg.Kind) {
+			ids = append(ids, p.UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var users []model.User
+	if err := db.Where("id IN ? AND status = ? AND email <> ''", ids, model.UserStatusActive).Find(&users).Error; err != nil {
+		return err
+	}
+	roles := map[string]*model.Role{}
+	for _, u := range users {
+		t := Target{
+			Channel:  model.NotificationChannelEmail,
+			Address:  u.Email,
+			Username: u.Username,
+			Rules:    []string{RuleSubscription},
+			userID:   u.ID,
+		}
+		reason, err := subscriberDenied(db, roles, &u, msg)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			// Shown in previews; a user routed to by a rule keeps that delivery
+			if !r.has(t) {
+				t.Skipped = reason
+				r.add(t)
+			}
+			continue
+		}
+		r.add(t)
+	}
+	return nil
+}
+
+// subscriberDenied returns why u may not get msg through a subscription,
+// empty when they may. roles caches the roles looked up so far.
+func subscriberDenied(db *gorm.DB, roles map[string]*model.Role, u *model.User, msg Message) (string, error) {
+	role, ok := roles[u.Role]
+	if !ok {
+		role = &model.Role{}
+		if err := db.Where("name = ?", u.Role).First(role).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return "", err
+			}
+			role = nil
+		}
+		roles[u.Role] = role
+	}
+	perm := KindPermission(msg.Kind)
+	if role == nil || perm == "" || !role.HasPermission(perm) {
+		return "subscriber lacks " + perm, nil
+	}
+
+	orgID, createdBy, ok := objectOf(msg)
+	if !ok {
+		return "", nil
+	}
+	scope := role.DataScopeType
+	if !model.IsValidDataScope(scope) {
+		scope = model.DataScopeSelf
+	}
+	var userOrg uint
+	if u.OrgID != nil {
+		userOrg = *u.OrgID
+	}
+	root, scoped, err := data.ScopeRoot(db, scope, userOrg)
+	if err != nil || !scoped {
+		return "", err
+	}
+	in, err := data.InScope(db, root, u.ID, orgID, createdBy)
+	if err != nil {
+		return "", err
+	}
+	if !in {
+		return "outside the subscriber's data scope", nil
+	}
+	return "", nil
+}
+
+// applyPreferences skips or holds back the email targets of users
+// according to their preferences
+func (r *router) applyPreferences(msg Message, now time.Time) error {
+	var ids []uint
+	for _, t := range r.route.Targets {
+		if t.userID != 0 {
+			ids = append(ids, t.userID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var prefs []model.NotificationPreference
+	if err := data.DB.WithContext(msg.scope()).Where("user_id IN ?", ids).Find(&prefs).Error; err != nil {
+		return err
+	}
+	byUser := map[uint]model.NotificationPreference{}
+	for _, p := range prefs {
+		byUser[p.UserID] = p
+	}
+
+	for i := range r.route.Targets {
+		t := &r.route.Targets[i]
+		p, ok := byUser[t.userID]
+		if t.userID == 0 || !ok || t.Skipped != "" {
+			continue
+		}
+		switch {
+		case contains(p.MutedEventTypes, msg.Kind):
+			t.Skipped = "muted by the user"
+		case p.MinSeverity != "" && msg.Severity.rank() < Severity(p.MinSeverity).rank():
+			t.Skipped = "below the user's minimum severity"
+		case msg.Severity != SeverityCritical:
+			t.NotBefore = QuietUntil(p, now)
+		}
+	}
+	return nil
+}
+
+// QuietUntil returns when the user's quiet hours around now end, nil
+// when now is outside them or none are set
+func QuietUntil(p model.NotificationPreference, now time.Time) *time.Time {
+	start, err1 := ParseClock(p.QuietHoursStart)
+	end, err2 := ParseClock(p.QuietHoursEnd)
+	if err1 != nil || err2 != nil || start == end {
+		return nil
+	}
+	loc := time.Local
+	if p.Timezone != "" {
+		if l, err := time.LoadLocation(p.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	t := now.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	quiet := start <= minute && minute < end
+	if start > end {
+		// Overnight, e.g. 22:00 to 08:00
+		quiet = minute >= start || minute < end
+	}
+	if !quiet {
+		return nil
+	}
+	until := time.Date(t.Year(), t.Month(), t.Day(), end/60, end%60, 0, 0, loc)
+	if !until.After(t) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return &until
+}
+
+// ParseClock parses "HH:MM" into minutes after midnight
+func ParseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || len(h) != 2 || len(m) != 2 || err1 != nil || err2 != nil || hour > 23 || minute > 59 || hour < 0 || minute < 0 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// attributes are the properties of the object a message is about that
+// rules match on
+type attributes struct {
+	assetType, platform, region, contractType string
+}
+
+// objectOf returns the organization and creator of the asset or contract
+// msg is about, ok is false when it is about neither
+func objectOf(msg Message) (orgID *uint, createdBy uint, ok bool) {
+	switch v := msg.Data["Asset"].(type) {
+	case model.Asset:
+		return v.OrgID, v.CreatedBy, true
+	case *model.Asset:
+		return v.OrgID, v.CreatedBy, true
+	}
+	switch v := msg.Data["Contract"].(type) {
+	case model.Contract:
+		return v.OrgID, v.CreatedBy, true
+	case *model.Contract:
+		return v.OrgID, v.CreatedBy, true
+	}
+	return nil, 0, false
+}
+
+func attributesOf(msg Message) attributes {
+	var a attributes
+	switch asset := msg.Data["Asset"].(type) {
+	case model.Asset:
+		a.assetType, a.platform, a.region = asset.Type, asset.Platform, asset.Region
+	case *model.Asset:
+		a.assetType, a.platform, a.region = asset.Type, asset.Platform, asset.Region
+	}
+	switch contract := msg.Data["Contract"].(type) {
+	case model.Contract:
+		a.contractType = contract.Type
+	case *model.Contract:
+		a.contractType = contract.Type
+	}
+	return a
+}
+
+// ruleMatches reports whether every condition of the rule holds for msg;
+// empty conditions hold for anything
+func ruleMatches(rule *model.NotificationRule, msg Message, attrs attributes) bool {
+	return matchAny(rule.EventTypes, msg.Kind) &&
+		matchAny(rule.Severities, string(msg.Severity)) &&
+		matchAny(rule.AssetTypes, attrs.assetType) &&
+		matchAny(rule.Platforms, attrs.platform) &&
+		matchAny(rule.Regions, attrs.region) &&
+		matchAny(rule.ContractTypes, attrs.contractType)
+}
+
+func matchAny(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
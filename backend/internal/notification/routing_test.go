@@ -0,0 +1,282 @@
+package notification
+
+import (
+	"context"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"testing"
+	"time"
+)
+
+func TestQuietUntil(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		start, end, timezone string
+		now                  time.Time
+		want                 time.Time // zero when not quiet
+	}{
+		{"12:00", "14:00", "UTC", at(18, 13, 0), at(18, 14, 0)},
+		{"12:00", "14:00", "UTC", at(18, 12, 0), at(18, 14, 0)},
+		{"12:00", "14:00", "UTC", at(18, 14, 0), time.Time{}},
+		{"12:00", "14:00", "UTC", at(18, 11, 59), time.Time{}},
+		// Overnight windows end the next morning
+		{"22:00", "08:00", "UTC", at(18, 23, 30), at(19, 8, 0)},
+		{"22:00", "08:00", "UTC", at(19, 2, 0), at(19, 8, 0)},
+		{"22:00", "08:00", "UTC", at(18, 12, 0), time.Time{}},
+		// 15:00 UTC is 23:00 in Shanghai, quiet until 08:00 there
+		{"22:00", "08:00", "Asia/Shanghai", at(18, 15, 0), at(19, 0, 0)},
+		{"22:00", "08:00", "Asia/Shanghai", at(18, 23, 30), at(19, 0, 0)},
+		// 01:00 UTC is 09:00 in Shanghai
+		{"22:00", "08:00", "Asia/Shanghai", at(19, 1, 0), time.Time{}},
+		{"09:00", "09:00", "UTC", at(18, 9, 0), time.Time{}},
+		{"", "", "UTC", at(18, 9, 0), time.Time{}},
+		{"25:00", "08:00", "UTC", at(18, 2, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		p := model.NotificationPreference{QuietHoursStart: tt.start, QuietHoursEnd: tt.end, Timezone: tt.timezone}
+		got := QuietUntil(p, tt.now)
+		switch {
+		case tt.want.IsZero() && got != nil:
+			t.Errorf("%s-%s %s at %v: quiet until %v, want not quiet", tt.start, tt.end, tt.timezone, tt.now, got)
+		case !tt.want.IsZero() && (got == nil || !got.Equal(tt.want)):
+			t.Errorf("%s-%s %s at %v: quiet until %v, want %v", tt.start, tt.end, tt.timezone, tt.now, got, tt.want)
+		}
+	}
+}
+
+// routeService has IM and email set up, SMS is not
+func routeService() *Service {
+	return NewService(&conf.NotificationConfig{
+		Enable: true,
+		IM:     conf.IMConfig{Provider: ProviderFeishu, Webhook: "http://127.0.0.1:1"},
+		Email:  conf.EmailConfig{Host: "smtp.example.com", Port: 25, From: "itam@example.com", To: []string{"ops@example.com"}},
+		Queue:  conf.QueueConfig{MaxAttempts: 3, RetryBase: time.Minute, RetryMax: time.Hour},
+	})
+}
+
+func createRecords(t *testing.T, records ...interface{}) {
+	t.Helper()
+	db := data.DB.WithContext(tenant.WithTenant(context.Background(), data.DefaultTenantID))
+	for _, r := range records {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// createRecipients adds alice, who keeps quiet hours at night, bob, who
+// muted new assets, carol, who only wants critical messages, and dave,
+// who has no email
+func createRecipients(t *testing.T) {
+	t.Helper()
+	users := []*model.User{
+		{Username: "alice", DisplayName: "Alice Wang", Email: "alice@example.com", PasswordHash: "x"},
+		{Username: "bob", Email: "bob@example.com", PasswordHash: "x"},
+		{Username: "carol", Email: "carol@example.com", PasswordHash: "x"},
+		{Username: "dave", PasswordHash: "x"},
+	}
+	for _, u := range users {
+		createRecords(t, u)
+	}
+	createRecords(t,
+		&model.NotificationPreference{UserID: users[0].ID, QuietHoursStart: "22:00", QuietHoursEnd: "08:00", Timezone: "UTC"},
+		&model.NotificationPreference{UserID: users[1].ID, MutedEventTypes: model.StringList{KindAssetCreated}},
+		&model.NotificationPreference{UserID: users[2].ID, MinSeverity: string(SeverityCritical)},
+	)
+}
+
+// target finds the target of channel sent to an address or username
+func target(route *Route, channel, who string) *Target {
+	for i, t := range route.Targets {
+		if t.Channel == channel && (t.Address == who || (t.Address == "" && t.Username == who)) {
+			return &route.Targets[i]
+		}
+	}
+	return nil
+}
+
+func checkTarget(t *testing.T, route *Route, channel, who, skipped string, rules ...string) *Target {
+	t.Helper()
+	tg := target(route, channel, who)
+	if tg == nil {
+		t.Fatalf("no %s target %q in %+v", channel, who, route.Targets)
+	}
+	if tg.Skipped != skipped {
+		t.Fatalf("%s target %q skipped = %q, want %q", channel, who, tg.Skipped, skipped)
+	}
+	if len(tg.Rules) != len(rules) {
+		t.Fatalf("%s target %q rules = %v, want %v", channel, who, tg.Rules, rules)
+	}
+	for i := range rules {
+		if tg.Rules[i] != rules[i] {
+			t.Fatalf("%s target %q rules = %v, want %v", channel, who, tg.Rules, rules)
+		}
+	}
+	return tg
+}
+
+func checkRules(t *testing.T, route *Route, want ...string) {
+	t.Helper()
+	if len(route.Rules) != len(want) {
+		t.Fatalf("matched rules = %v, want %v", route.Rules, want)
+	}
+	for i := range want {
+		if route.Rules[i] != want[i] {
+			t.Fatalf("matched rules = %v, want %v", route.Rules, want)
+		}
+	}
+}
+
+func TestRoutePreview(t *testing.T) {
+	setupTestDB(t)
+	createRecipients(t)
+	createRecords(t,
+		&model.NotificationRule{Name: "disabled", Priority: 0, Channels: model.StringList{"email"}, Recipients: model.StringList{"carol"}},
+		&model.NotificationRule{Name: "new-assets", Priority: 1, Enabled: true, EventTypes: model.StringList{KindAssetCreated},
+			Channels: model.StringList{"email", "sms"}, Recipients: model.StringList{model.OwnerRecipient, "bob", "Vendor <ext@partner.com>"}},
+		&model.NotificationRule{Name: "critical-im", Priority: 2, Enabled: true, Severities: model.StringList{string(SeverityCritical)},
+			Channels: model.StringList{"im"}},
+		&model.NotificationRule{Name: "assets-im", Priority: 3, Enabled: true, EventTypes: model.StringList{KindAssetCreated},
+			Channels: model.StringList{"im"}, StopProcessing: true},
+		&model.NotificationRule{Name: "after-stop", Priority: 4, Enabled: true, Channels: model.StringList{"email"}, Recipients: model.StringList{"carol"}},
+	)
+	s := routeService()
+	night := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	msg := Message{
+		Kind:       KindAssetCreated,
+		Title:      "db-01 created",
+		Severity:   SeverityWarning,
+		TenantID:   data.DefaultTenantID,
+		Recipients: []string{"Alice Wang", "dave"},
+	}
+
+	route, err := s.Route(msg, night)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, route, "new-assets", "assets-im")
+	alice := checkTarget(t, route, "email", "alice@example.com", "", "new-assets")
+	if alice.Username != "alice" || alice.NotBefore == nil || !alice.NotBefore.Equal(time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("alice = %+v, want held back until 08:00", alice)
+	}
+	checkTarget(t, route, "email", "dave", "no active user with an email", "new-assets")
+	checkTarget(t, route, "email", "bob@example.com", "muted by the user", "new-assets")
+	if ext := checkTarget(t, route, "email", "ext@partner.com", "", "new-assets"); ext.Username != "" || ext.NotBefore != nil {
+		t.Fatalf("external address = %+v", ext)
+	}
+	checkTarget(t, route, "email", "ops@example.com", "", "new-assets")
+	checkTarget(t, route, "sms", "", "channel is not configured", "new-assets")
+	checkTarget(t, route, "im", "", "", "assets-im")
+	if target(route, "email", "carol@example.com") != nil {
+		t.Fatal("rules after a stopping rule or disabled ones were applied")
+	}
+	if len(route.Targets) != 7 {
+		t.Fatalf("targets = %+v, want 7", route.Targets)
+	}
+
+	// Critical messages ignore quiet hours but not mutes, and targets
+	// selected by several rules are merged
+	msg.Severity = SeverityCritical
+	route, err = s.Route(msg, night)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, route, "new-assets", "critical-im", "assets-im")
+	if alice := checkTarget(t, route, "email", "alice@example.com", "", "new-assets"); alice.NotBefore != nil {
+		t.Fatalf("critical message held back until %v", alice.NotBefore)
+	}
+	checkTarget(t, route, "email", "bob@example.com", "muted by the user", "new-assets")
+	checkTarget(t, route, "im", "", "", "critical-im", "assets-im")
+
+	// Outside quiet hours nothing is held back
+	msg.Severity = SeverityWarning
+	route, err = s.Route(msg, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice := checkTarget(t, route, "email", "alice@example.com", "", "new-assets"); alice.NotBefore != nil {
+		t.Fatalf("held back at noon until %v", alice.NotBefore)
+	}
+}
+
+func TestRouteDefault(t *testing.T) {
+	setupTestDB(t)
+	createRecipients(t)
+	createRecords(t, &model.NotificationRule{Name: "assets-only", Enabled: true, EventTypes: model.StringList{KindAssetCreated},
+		Channels: model.StringList{"sms"}})
+	s := routeService()
+
+	// No rule matches, so every configured channel is used and the
+	// message's own recipients are emailed
+	route, err := s.Route(Message{
+		Kind:       KindContractExpiring,
+		Severity:   SeverityWarning,
+		TenantID:   data.DefaultTenantID,
+		Recipients: []string{"alice", "carol"},
+	}, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRules(t, route)
+	checkTarget(t, route, "im", "", "")
+	checkTarget(t, route, "email", "alice@example.com", "")
+	checkTarget(t, route, "email", "carol@example.com", "below the user's minimum severity")
+	checkTarget(t, route, "email", "ops@example.com", "")
+	if len(route.Targets) != 4 {
+		t.Fatalf("targets = %+v, want im and three emails", route.Targets)
+	}
+}
+
+// Deliveries during quiet hours wait for them to end, skipped targets
+// get none
+func TestEnqueueHoldsBackQuietHours(t *testing.T) {
+	setupTestDB(t)
+	createRecipients(t)
+	s := routeService()
+
+	now := time.Now().UTC()
+	ctx := tenant.WithAll(context.Background())
+	err := data.DB.WithContext(ctx).Model(&model.NotificationPreference{}).Where("quiet_hours_start <> ''").Updates(map[string]interface{}{
+		"quiet_hours_start": now.Add(-time.Hour).Format("15:04"),
+		"quiet_hours_end":   now.Add(time.Hour).Format("15:04"),
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send(Message{
+		Kind:       KindAssetCreated,
+		Title:      "db-01 created",
+		Severity:   SeverityInfo,
+		TenantID:   data.DefaultTenantID,
+		Recipients: []string{"alice", "bob"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var list []model.NotificationDelivery
+	if err := data.DB.WithContext(ctx).Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	byRecipient := map[string]model.NotificationDelivery{}
+	for _, d := range list {
+		byRecipient[d.Channel+" "+d.Recipient] = d
+	}
+	if len(byRecipient) != 3 {
+		t.Fatalf("deliveries = %+v, want im, alice and ops", list)
+	}
+	if _, ok := byRecipient["email bob@example.com"]; ok {
+		t.Fatal("muted recipient got a delivery")
+	}
+	if d := byRecipient["im "]; d.NextAttemptAt == nil || time.Until(*d.NextAttemptAt) > time.Second {
+		t.Fatalf("im delivery due at %v, want now", d.NextAttemptAt)
+	}
+	alice := byRecipient["email alice@example.com"]
+	if alice.NextAttemptAt == nil || time.Until(*alice.NextAttemptAt) < 30*time.Minute {
+		t.Fatalf("alice's delivery due at %v, want after her quiet hours", alice.NextAttemptAt)
+	}
+}
@@ -0,0 +1,274 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"itam-backend/internal/conf"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIssuer is an identity provider serving discovery, a JWKS and a
+// token endpoint that answers with whatever ID token is set
+type fakeIssuer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey // published in the JWKS
+	idToken  string
+	form     map[string]string // last token request
+	jwksHits int
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	iss := &fakeIssuer{t: t, keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                iss.URL,
+			AuthorizationEndpoint: iss.URL + "/authorize",
+			TokenEndpoint:         iss.URL + "/token",
+			JWKSURI:               iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.jwksHits++
+		var set jwkSet
+		for kid, k := range iss.keys {
+			set.Keys = append(set.Keys, jwk{
+				Kty: "RSA", Kid: kid, Use: "sig",
+				N: base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.form = map[string]string{}
+		for k := range r.PostForm {
+			iss.form[k] = r.PostForm.Get(k)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": iss.idToken})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func (iss *fakeIssuer) addKey(kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	iss.mu.Lock()
+	iss.keys[kid] = key
+	iss.mu.Unlock()
+	return key
+}
+
+func (iss *fakeIssuer) removeKey(kid string) {
+	iss.mu.Lock()
+	delete(iss.keys, kid)
+	iss.mu.Unlock()
+}
+
+// sign returns an ID token signed with the key kid, with claims on top
+// of valid defaults for the client "itam"
+func (iss *fakeIssuer) sign(kid string, claims jwt.MapClaims) string {
+	iss.mu.Lock()
+	key := iss.keys[kid]
+	iss.mu.Unlock()
+	all := jwt.MapClaims{
+		"iss":   iss.URL,
+		"aud":   "itam",
+		"sub":   "user-1",
+		"nonce": "n-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, all)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	return raw
+}
+
+func newTestProvider(iss *fakeIssuer) *Provider {
+	return NewProvider(&conf.OIDCConfig{
+		Issuer:      iss.URL,
+		ClientID:    "itam",
+		RedirectURL: "https://itam.example.com/api/v1/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	iss := newFakeIssuer(t)
+	iss.addKey("k1")
+	iss.idToken = iss.sign("k1", jwt.MapClaims{"email": "ann@example.com", "groups": []string{"it", "ops"}})
+	p := newTestProvider(iss)
+
+	claims, err := p.Exchange(context.Background(), "code-1", "verifier-1", "n-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.String("email") != "ann@example.com" {
+		t.Fatalf("claims = %+v", claims)
+	}
+	if got := claims.Strings("groups"); len(got) != 2 || got[0] != "it" || got[1] != "ops" {
+		t.Fatalf("groups = %v", got)
+	}
+	want := map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "code-1",
+		"code_verifier": "verifier-1",
+		"client_id":     "itam",
+		"redirect_uri":  "https://itam.example.com/api/v1/auth/oidc/callback",
+	}
+	for k, v := range want {
+		if iss.form[k] != v {
+			t.Errorf("token request %s = %q, want %q", k, iss.form[k], v)
+		}
+	}
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	iss := newFakeIssuer(t)
+	p := newTestProvider(iss)
+
+	raw, err := p.AuthCodeURL(context.Background(), "st", "nc", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, iss.URL+"/authorize?") {
+		t.Fatalf("url = %s", raw)
+	}
+	for _, want := range []string{"state=st", "nonce=nc", "code_challenge_method=S256", "code_challenge=" + CodeChallenge("verifier-1"), "scope=openid+email"} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("url %s lacks %s", raw, want)
+		}
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	iss := newFakeIssuer(t)
+	iss.addKey("k1")
+	p := newTestProvider(iss)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": iss.URL, "aud": "itam", "sub": "user-1", "nonce": "n-1", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = "k1"
+	forgedRaw, _ := forged.SignedString(other)
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  string
+	}{
+		{"nonce mismatch", iss.sign("k1", nil), "n-other", "nonce mismatch"},
+		{"missing nonce", iss.sign("k1", jwt.MapClaims{"nonce": ""}), "n-1", "nonce mismatch"},
+		{"wrong audience", iss.sign("k1", jwt.MapClaims{"aud": "another-client"}), "n-1", "audience"},
+		{"wrong issuer", iss.sign("k1", jwt.MapClaims{"iss": "https://evil.example.com"}), "n-1", "issuer"},
+		{"expired", iss.sign("k1", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}), "n-1", "expired"},
+		{"missing sub", iss.sign("k1", jwt.MapClaims{"sub": ""}), "n-1", "missing sub"},
+		{"forged signature", forgedRaw, "n-1", "signature"},
+	}
+	for _, tt := range tests {
+		_, err := p.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// HS256 signed with the public key is the classic algorithm confusion
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": iss.URL, "aud": "itam", "sub": "x", "nonce": "n-1", "exp": time.Now().Add(time.Minute).Unix()})
+	hs.Header["kid"] = "k1"
+	hsRaw, _ := hs.SignedString([]byte("secret"))
+	if _, err := p.VerifyIDToken(context.Background(), hsRaw, "n-1"); err == nil {
+		t.Error("HS256 token accepted")
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	iss := newFakeIssuer(t)
+	iss.addKey("k1")
+	p := newTestProvider(iss)
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, iss.sign("k1", nil), "n-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(ctx, iss.sign("k1", nil), "n-1"); err != nil {
+		t.Fatal(err)
+	}
+	if iss.jwksHits != 1 {
+		t.Fatalf("JWKS fetched %d times, want once while the key is cached", iss.jwksHits)
+	}
+
+	// The provider rotates to k2 and retires k1
+	iss.addKey("k2")
+	token := iss.sign("k2", nil)
+	iss.removeKey("k1")
+
+	// Unknown kids do not refetch more than once a minute
+	if _, err := p.VerifyIDToken(ctx, token, "n-1"); err == nil || !strings.Contains(err.Error(), `unknown signing key "k2"`) {
+		t.Fatalf("err = %v, want unknown signing key within a minute of the last fetch", err)
+	}
+	if iss.jwksHits != 1 {
+		t.Fatalf("JWKS fetched %d times, want no refetch within a minute", iss.jwksHits)
+	}
+
+	p.mu.Lock()
+	p.keysAt = time.Now().Add(-2 * time.Minute)
+	p.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, token, "n-1"); err != nil {
+		t.Fatalf("token signed with the rotated key: %v", err)
+	}
+	if iss.jwksHits != 2 {
+		t.Fatalf("JWKS fetched %d times, want a refetch for the new kid", iss.jwksHits)
+	}
+
+	// The retired key is gone from the cache
+	p.mu.Lock()
+	p.keysAt = time.Now()
+	p.mu.Unlock()
+	iss.addKey("k1")
+	if _, err := p.VerifyIDToken(ctx, iss.sign("k1", nil), "n-1"); err == nil {
+		t.Fatal("token signed with the retired key accepted from a stale cache")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	iss := newFakeIssuer(t)
+	p := NewProvider(&conf.OIDCConfig{Issuer: iss.URL + "/", ClientID: "itam"})
+	if _, err := p.Discover(context.Background()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v", err)
+	}
+}
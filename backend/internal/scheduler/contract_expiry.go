@@ -0,0 +1,233 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"itam-backend/internal/audit"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"itam-backend/internal/storage"
+	"itam-backend/internal/tenant"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxAttachmentSize bounds the contract file attached to reminders, mail
+// servers commonly reject messages above 25MB
+const maxAttachmentSize = 10 << 20
+
+// dateLayouts are the EndDate formats accepted from the UI and imports
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+}
+
+// ParseContractDate parses a free-form contract date string in local time
+func ParseContractDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// ContractExpiryScanner periodically alerts on contracts nearing EndDate
+// and flips active contracts past EndDate to expired.
+type ContractExpiryScanner struct {
+	cfg    *conf.ContractConfig
+	notify *notification.Service
+	store  storage.Storage
+}
+
+func NewContractExpiryScanner(cfg *conf.ContractConfig, notify *notification.Service, store storage.Storage) *ContractExpiryScanner {
+	return &ContractExpiryScanner{
+		cfg:    cfg,
+		notify: notify,
+		store:  store,
+	}
+}
+
+// Start runs a scan immediately and then on every interval until ctx is done
+func (s *ContractExpiryScanner) Start(ctx context.Context) {
+	if s.cfg.ExpiryScanInterval <= 0 {
+		log.Println("Contract expiry scanner disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.cfg.ExpiryScanInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Scan(time.Now()); err != nil {
+				log.Printf("Contract expiry scan failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scan checks all active contracts of every tenant against now
+func (s *ContractExpiryScanner) Scan(now time.Time) error {
+	var contracts []model.Contract
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).Where("status = ? AND end_date <> ''", model.ContractStatusActive).Find(&contracts).Error; err != nil {
+		return err
+	}
+
+	thresholds := append([]int(nil), s.cfg.ReminderDays...)
+	sort.Ints(thresholds)
+	today := truncateDay(now)
+
+	for _, contract := range contracts {
+		end, err := ParseContractDate(contract.EndDate)
+		if err != nil {
+			log.Printf("Contract %d (%s): %v", contract.ID, contract.Code, err)
+			continue
+		}
+
+		daysLeft := int(math.Round(truncateDay(end).Sub(today).Hours() / 24))
+		if daysLeft < 0 {
+			if err := s.expire(contract); err != nil {
+				log.Printf("Contract %d: failed to expire: %v", contract.ID, err)
+			}
+			continue
+		}
+
+		// Only the tightest threshold reached is sent, so a contract first seen
+		// 5 days before its end gets the 7-day reminder and not the 30-day one too.
+		for _, threshold := range thresholds {
+			if daysLeft <= threshold {
+				msg := notification.Message{
+					Kind:  notification.KindContractExpiring,
+					Title: "Contract Expiring Soon",
+					Content: fmt.Sprintf("Contract %s (%s) with %s ends on %s, %d day(s) left. Owner: %s.",
+						contract.Name, contract.Code, contract.Vendor, contract.EndDate, daysLeft, contract.Owner),
+					Severity: notification.SeverityWarning,
+					Data:     map[string]interface{}{"DaysLeft": daysLeft},
+				}
+				if err := s.remind(contract, threshold, msg); err != nil {
+					log.Printf("Contract %d: failed to send %d-day reminder: %v", contract.ID, threshold, err)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// expire sends the final notice and then marks the contract expired.
+// Scans only look at active contracts, so the status changes once the
+// notice is queued and recorded, and a failed notice is retried.
+func (s *ContractExpiryScanner) expire(contract model.Contract) error {
+	contract.Status = model.ContractStatusExpired
+	err := s.remind(contract, model.ContractReminderExpired, notification.Message{
+		Kind:  notification.KindContractExpired,
+		Title: "Contract Expired",
+		Content: fmt.Sprintf("Contract %s (%s) with %s ended on %s and has been marked expired. Owner: %s.",
+			contract.Name, contract.Code, contract.Vendor, contract.EndDate, contract.Owner),
+		Severity: notification.SeverityCritical,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.WithValue(tenant.WithAll(context.Background()), audit.ActorKey, audit.Actor{Username: "system"})
+	return data.DB.WithContext(ctx).Model(&contract).Update("status", model.ContractStatusExpired).Error
+}
+
+// remind sends the alert once per contract, end date and threshold
+func (s *ContractExpiryScanner) remind(contract model.Contract, threshold int, msg notification.Message) error {
+	var existing model.ContractReminder
+	err := data.DB.Where("contract_id = ? AND end_date = ? AND threshold_days = ?", contract.ID, contract.EndDate, threshold).
+		First(&existing).Error
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// Not recorded on failure so the next scan retries
+	msg.Link = fmt.Sprintf("/contracts?id=%d", contract.ID)
+	msg.TenantID = contract.TenantID
+	msg.Recipients = []string{contract.Owner}
+	if msg.Data == nil {
+		msg.Data = map[string]interface{}{}
+	}
+	msg.Data["Contract"] = contract
+	if a := s.latestFile(contract); a != nil {
+		msg.Attachments = []notification.Attachment{*a}
+	}
+	if err := s.notify.Send(msg); err != nil {
+		return err
+	}
+
+	return data.DB.Create(&model.ContractReminder{
+		ContractID:    contract.ID,
+		EndDate:       contract.EndDate,
+		ThresholdDays: threshold,
+		SentAt:        time.Now(),
+	}).Error
+}
+
+// latestFile loads the newest file of the contract to attach to its
+// reminders, nil when there is none or it cannot be read
+func (s *ContractExpiryScanner) latestFile(contract model.Contract) *notification.Attachment {
+	ctx := tenant.WithTenant(context.Background(), contract.TenantID)
+	var file model.ContractFile
+	if err := data.DB.WithContext(ctx).Where("contract_id = ?", contract.ID).Order("version desc").First(&file).Error; err != nil {
+		return nil
+	}
+	if file.FileSize > maxAttachmentSize {
+		log.Printf("Contract %d: file %d is too large to attach (%d bytes)", contract.ID, file.ID, file.FileSize)
+		return nil
+	}
+
+	var content []byte
+	var err error
+	switch file.Storage {
+	case "":
+		// Uploads from before storage backends were written straight to disk
+		content, err = os.ReadFile(file.FilePath)
+	case s.store.Name():
+		var rc io.ReadCloser
+		if rc, _, err = s.store.Get(ctx, file.FilePath); err == nil {
+			content, err = io.ReadAll(io.LimitReader(rc, maxAttachmentSize+1))
+			rc.Close()
+		}
+	default:
+		err = fmt.Errorf("kept in %s storage, which is not configured", file.Storage)
+	}
+	if err == nil && int64(len(content)) > maxAttachmentSize {
+		err = errors.New("too large to attach")
+	}
+	if err != nil {
+		log.Printf("Contract %d: cannot attach file %d: %v", contract.ID, file.ID, err)
+		return nil
+	}
+	return &notification.Attachment{Name: file.FileName, ContentType: file.FileType, Data: content}
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/model"
+	"itam-backend/internal/notification"
+	"itam-backend/internal/storage"
+	"itam-backend/internal/tenant"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// failOutbox makes storing notifications fail until the returned func is called
+func failOutbox(t *testing.T) func() {
+	t.Helper()
+	name := "test:fail_outbox"
+	err := data.DB.Callback().Create().Before("gorm:create").Register(name, func(db *gorm.DB) {
+		if db.Statement.Table == "notifications" {
+			db.AddError(errors.New("outbox unavailable"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	restore := func() { once.Do(func() { data.DB.Callback().Create().Remove(name) }) }
+	t.Cleanup(restore)
+	return restore
+}
+
+func TestExpiredNoticeSurvivesFailedSend(t *testing.T) {
+	setupTestDB(t)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	now := time.Now()
+	contract := model.Contract{
+		Name: "Maintenance", Code: "EXP-1", Status: model.ContractStatusActive, Owner: "admin",
+		EndDate: now.AddDate(0, 0, -1).Format("2006-01-02"),
+	}
+	if err := data.DB.WithContext(ctx).Create(&contract).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	notify := notification.NewService(&conf.NotificationConfig{
+		Enable: true,
+		IM:     conf.IMConfig{Provider: notification.ProviderFeishu, Webhook: "http://127.0.0.1:1/hook"},
+	})
+	s := NewContractExpiryScanner(&conf.ContractConfig{ReminderDays: []int{30, 7}}, notify, storage.NewMemoryStorage())
+
+	state := func() (status string, reminders, notices int64) {
+		var c model.Contract
+		data.DB.WithContext(ctx).First(&c, contract.ID)
+		data.DB.Model(&model.ContractReminder{}).Where("contract_id = ? AND threshold_days = ?", contract.ID, model.ContractReminderExpired).Count(&reminders)
+		data.DB.WithContext(ctx).Model(&model.Notification{}).
+			Where("kind = ? AND payload LIKE ?", notification.KindContractExpired, "%EXP-1%").Count(&notices)
+		return c.Status, reminders, notices
+	}
+
+	restore := failOutbox(t)
+	if err := s.Scan(now); err != nil {
+		t.Fatal(err)
+	}
+	if status, reminders, notices := state(); status != model.ContractStatusActive || reminders != 0 || notices != 0 {
+		t.Fatalf("after a failed send: status %s, %d reminder(s), %d notice(s); want still active for a retry", status, reminders, notices)
+	}
+
+	restore()
+	if err := s.Scan(now); err != nil {
+		t.Fatal(err)
+	}
+	if status, reminders, notices := state(); status != model.ContractStatusExpired || reminders != 1 || notices != 1 {
+		t.Fatalf("after the retry: status %s, %d reminder(s), %d notice(s)", status, reminders, notices)
+	}
+
+	// Expired contracts are not scanned again
+	if err := s.Scan(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, notices := state(); notices != 1 {
+		t.Fatalf("%d notices after another scan, want 1", notices)
+	}
+}
+
+// A 0-day reminder on the last day does not stand in for the expired
+// notice the day after
+func TestZeroDayReminderAndExpiredNotice(t *testing.T) {
+	setupTestDB(t)
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	now := time.Now()
+	contract := model.Contract{
+		Name: "Support", Code: "EXP-0", Status: model.ContractStatusActive, Owner: "admin",
+		EndDate: now.Format("2006-01-02"),
+	}
+	if err := data.DB.WithContext(ctx).Create(&contract).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	notify := notification.NewService(&conf.NotificationConfig{
+		Enable: true,
+		IM:     conf.IMConfig{Provider: notification.ProviderFeishu, Webhook: "http://127.0.0.1:1/hook"},
+	})
+	s := NewContractExpiryScanner(&conf.ContractConfig{ReminderDays: []int{0}}, notify, storage.NewMemoryStorage())
+	notices := func(kind string) int64 {
+		var n int64
+		data.DB.WithContext(ctx).Model(&model.Notification{}).Where("kind = ? AND payload LIKE ?", kind, "%EXP-0%").Count(&n)
+		return n
+	}
+
+	if err := s.Scan(now); err != nil {
+		t.Fatal(err)
+	}
+	if n := notices(notification.KindContractExpiring); n != 1 {
+		t.Fatalf("%d 0-day reminder(s) on the last day, want 1", n)
+	}
+
+	if err := s.Scan(now.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if n := notices(notification.KindContractExpired); n != 1 {
+		t.Fatalf("%d expired notice(s) the day after, want 1", n)
+	}
+	var c model.Contract
+	data.DB.WithContext(ctx).First(&c, contract.ID)
+	if c.Status != model.ContractStatusExpired {
+		t.Fatalf("status = %s, want expired", c.Status)
+	}
+}
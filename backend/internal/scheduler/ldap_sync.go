@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"itam-backend/internal/audit"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/identity"
+	"itam-backend/internal/model"
+	"itam-backend/internal/session"
+	"itam-backend/internal/tenant"
+	"log"
+	"time"
+)
+
+// LDAPSync periodically copies directory users into local accounts and,
+// when configured, disables accounts that left the directory.
+type LDAPSync struct {
+	cfg *conf.AuthConfig
+	dir *identity.LDAPDirectory
+}
+
+func NewLDAPSync(cfg *conf.AuthConfig) *LDAPSync {
+	return &LDAPSync{
+		cfg: cfg,
+		dir: identity.NewLDAPDirectory(&cfg.LDAP),
+	}
+}
+
+// Start runs a sync immediately and then on every interval until ctx is done
+func (s *LDAPSync) Start(ctx context.Context) {
+	enabled := false
+	for _, name := range s.cfg.Authenticators {
+		enabled = enabled || name == model.AuthSourceLDAP
+	}
+	if !enabled || s.cfg.LDAP.SyncInterval <= 0 {
+		log.Println("LDAP sync disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.cfg.LDAP.SyncInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Sync(); err != nil {
+				log.Printf("LDAP sync failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sync provisions every directory user and disables LDAP accounts that
+// are no longer listed
+func (s *LDAPSync) Sync() error {
+	ids, err := s.dir.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.WithValue(tenant.WithAll(context.Background()), audit.ActorKey, audit.Actor{Username: "system"})
+	policy := s.dir.Policy()
+	seen := map[string]bool{}
+	synced := 0
+	for _, id := range ids {
+		// Seen even when provisioning fails, so an error never disables anyone
+		seen[id.ExternalID] = true
+		if _, err := identity.Provision(ctx, id, policy); err != nil {
+			if !errors.Is(err, identity.ErrNotProvisioned) {
+				log.Printf("LDAP sync: %s: %v", id.Username, err)
+			}
+			continue
+		}
+		synced++
+	}
+
+	disabled := 0
+	// An empty listing is more likely a bad filter than an empty directory
+	if s.cfg.LDAP.DisableMissing && len(ids) > 0 {
+		var users []model.User
+		if err := data.DB.WithContext(ctx).Where("auth_source = ? AND status = ?", model.AuthSourceLDAP, model.UserStatusActive).Find(&users).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			if seen[user.ExternalID] {
+				continue
+			}
+			if err := data.DB.WithContext(tenant.WithTenant(ctx, user.TenantID)).Model(&user).Update("status", model.UserStatusDisabled).Error; err != nil {
+				log.Printf("LDAP sync: failed to disable %s: %v", user.Username, err)
+				continue
+			}
+			session.RevokeUser(session.Default, user.ID)
+			disabled++
+		}
+	}
+
+	log.Printf("LDAP sync: %d directory user(s), %d synced, %d disabled", len(ids), synced, disabled)
+	return nil
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/ldap"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var setupOnce sync.Once
+
+// setupTestDB opens a fresh SQLite database, seeded like on first start,
+// once for the package's tests
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	setupOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "itam-scheduler-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.InitDB(&conf.Config{Database: conf.DatabaseConfig{Driver: "sqlite", DbName: filepath.Join(dir, "itam.db")}})
+	})
+}
+
+func person(uid string) *ldap.Entry {
+	return &ldap.Entry{DN: "uid=" + uid + ",ou=people,dc=example,dc=com", Attributes: []ldap.Attribute{
+		{Name: "objectClass", Values: []string{"person"}},
+		{Name: "uid", Values: []string{uid}},
+		{Name: "userPassword", Values: []string{uid}},
+	}}
+}
+
+var svcEntry = &ldap.Entry{DN: "cn=svc,dc=example,dc=com", Attributes: []ldap.Attribute{
+	{Name: "cn", Values: []string{"svc"}},
+	{Name: "userPassword", Values: []string{"svc"}},
+}}
+
+func newTestLDAPSync(t *testing.T, srv *ldap.MemoryServer) *LDAPSync {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	return NewLDAPSync(&conf.AuthConfig{
+		Authenticators: []string{model.AuthSourceLocal, model.AuthSourceLDAP},
+		LDAP: conf.LDAPConfig{
+			URL:               "ldap://" + l.Addr().String(),
+			BindDN:            "cn=svc,dc=example,dc=com",
+			BindPassword:      "svc",
+			BaseDN:            "dc=example,dc=com",
+			UsernameAttribute: "uid",
+			AutoProvision:     true,
+			Tenant:            model.DefaultTenantCode,
+			DefaultRole:       "user",
+			SyncFilter:        "(objectClass=person)",
+			DisableMissing:    true,
+		},
+	})
+}
+
+func userStatus(t *testing.T, username string) string {
+	t.Helper()
+	var user model.User
+	if err := data.DB.WithContext(tenant.WithAll(context.Background())).Where("username = ?", username).First(&user).Error; err != nil {
+		t.Fatalf("user %s: %v", username, err)
+	}
+	return user.Status
+}
+
+func TestLDAPSyncDisablesMissingUsers(t *testing.T) {
+	setupTestDB(t)
+	srv := ldap.NewMemoryServer([]*ldap.Entry{svcEntry, person("sync.ann"), person("sync.ben")})
+	s := newTestLDAPSync(t, srv)
+
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sync.ann", "sync.ben"} {
+		if got := userStatus(t, name); got != model.UserStatusActive {
+			t.Fatalf("%s provisioned with status %q", name, got)
+		}
+	}
+
+	// ben leaves the directory
+	srv.SetEntries([]*ldap.Entry{svcEntry, person("sync.ann")})
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := userStatus(t, "sync.ben"); got != model.UserStatusDisabled {
+		t.Fatalf("sync.ben status = %q, want disabled", got)
+	}
+	if got := userStatus(t, "sync.ann"); got != model.UserStatusActive {
+		t.Fatalf("sync.ann status = %q, want active", got)
+	}
+	// Local accounts are never touched
+	if got := userStatus(t, "admin"); got != model.UserStatusActive {
+		t.Fatalf("admin status = %q", got)
+	}
+}
+
+func TestLDAPSyncEmptyListingDisablesNobody(t *testing.T) {
+	setupTestDB(t)
+	srv := ldap.NewMemoryServer([]*ldap.Entry{svcEntry, person("sync.cid")})
+	s := newTestLDAPSync(t, srv)
+
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken sync filter or an emptied OU lists nobody
+	srv.SetEntries([]*ldap.Entry{svcEntry})
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := userStatus(t, "sync.cid"); got != model.UserStatusActive {
+		t.Fatalf("sync.cid status = %q after an empty listing, want active", got)
+	}
+}
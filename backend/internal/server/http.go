@@ -1,27 +1,50 @@
 package server
 
 import (
-	"net/http"
+	"log"
 
 	"github.com/gin-gonic/gin"
 	"itam-backend/internal/conf"
 	"itam-backend/internal/handler"
 	"itam-backend/internal/middleware"
+	"itam-backend/internal/model"
 	"itam-backend/internal/notification"
+	"itam-backend/internal/storage"
+	"itam-backend/internal/webhook"
 )
 
-func NewHTTPServer(c *conf.Config, notify *notification.Service) *gin.Engine {
+func NewHTTPServer(c *conf.Config, notify *notification.Service, store storage.Storage, dispatcher *webhook.Dispatcher) *gin.Engine {
 	if c.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.Default()
+	// ClientIP feeds token allowlists, login throttling and the audit log,
+	// so take X-Forwarded-For only from the configured proxies
+	if err := r.SetTrustedProxies(c.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// Initialize Handlers
 	assetHandler := handler.NewAssetHandler(notify)
-	contractHandler := handler.NewContractHandler()
+	contractHandler := handler.NewContractHandler(&c.Contract, store)
 	interfaceHandler := handler.NewInterfaceHandler()
-	authHandler := handler.NewAuthHandler()
+	userHandler := handler.NewUserHandler()
+	roleHandler := handler.NewRoleHandler()
+	auditHandler := handler.NewAuditHandler()
+	relationHandler := handler.NewAssetRelationHandler()
+	assetTypeHandler := handler.NewAssetTypeHandler()
+	tenantHandler := handler.NewTenantHandler()
+	orgHandler := handler.NewOrganizationHandler()
+	oidcHandler := handler.NewOIDCHandler(&c.Auth.OIDC)
+	lockoutHandler := handler.NewLockoutHandler(&c.Auth.Lockout, notify)
+	mfaHandler := handler.NewMFAHandler(&c.Auth.MFA, lockoutHandler)
+	authHandler := handler.NewAuthHandler(&c.Auth, mfaHandler, lockoutHandler)
+	apiTokenHandler := handler.NewAPITokenHandler(&c.Auth)
+	webhookHandler := handler.NewWebhookHandler(dispatcher)
+	notificationHandler := handler.NewNotificationHandler(notify)
+	notificationRuleHandler := handler.NewNotificationRuleHandler(notify)
+	notificationPreferenceHandler := handler.NewNotificationPreferenceHandler()
 
 	// CORS Middleware
 	r.Use(func(c *gin.Context) {
@@ -49,44 +72,148 @@ func NewHTTPServer(c *conf.Config, notify *notification.Service) *gin.Engine {
 	auth := r.Group("/api/v1/auth")
 	{
 		auth.POST("/login", authHandler.Login)
-		auth.POST("/logout", authHandler.Logout)
+		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/mfa/challenge", mfaHandler.Challenge)
+		auth.POST("/mfa/challenge/setup", mfaHandler.ChallengeSetup)
+		auth.GET("/oidc/login", oidcHandler.Login)
+		auth.GET("/oidc/callback", oidcHandler.Callback)
+		auth.POST("/logout", middleware.OptionalAuthMiddleware(), authHandler.Logout)
 	}
 
 	// Protected API Group
 	api := r.Group("/api/v1")
-	api.Use(middleware.JWTAuthMiddleware())
+	api.Use(middleware.JWTAuthMiddleware(), middleware.TenantContext(), middleware.AuditContext())
+	perm := middleware.RequirePermission
+	platform := middleware.RequirePlatformTenant()
+	interactive := middleware.RejectAPITokens()
 	{
 		// User info
 		api.GET("/user/me", authHandler.GetCurrentUser)
-		api.POST("/user/change-password", authHandler.ChangePassword)
+		api.POST("/user/change-password", interactive, authHandler.ChangePassword)
+		api.GET("/user/sessions", authHandler.GetSessions)
+		api.POST("/auth/logout-all", authHandler.LogoutAll)
+		api.GET("/user/mfa", mfaHandler.GetStatus)
+		api.POST("/user/mfa/setup", interactive, mfaHandler.Setup)
+		api.POST("/user/mfa/enable", interactive, mfaHandler.Enable)
+		api.POST("/user/mfa/disable", interactive, mfaHandler.Disable)
+		api.POST("/user/mfa/recovery-codes", interactive, mfaHandler.RegenerateRecoveryCodes)
+		api.GET("/user/notification-preferences", notificationPreferenceHandler.GetNotificationPreference)
+		api.PUT("/user/notification-preferences", notificationPreferenceHandler.UpdateNotificationPreference)
+
+		// Personal API tokens
+		api.GET("/tokens", interactive, apiTokenHandler.GetTokens)
+		api.POST("/tokens", interactive, apiTokenHandler.CreateToken)
+		api.DELETE("/tokens/:id", interactive, apiTokenHandler.RevokeToken)
+
+		// User management
+		api.GET("/users", perm(model.PermUserRead), userHandler.GetUsers)
+		api.GET("/users/:id", perm(model.PermUserRead), userHandler.GetUser)
+		api.POST("/users", perm(model.PermUserWrite), userHandler.CreateUser)
+		api.PUT("/users/:id", perm(model.PermUserWrite), userHandler.UpdateUser)
+		api.DELETE("/users/:id", perm(model.PermUserWrite), userHandler.DeleteUser)
+		api.POST("/users/:id/enable", perm(model.PermUserWrite), userHandler.EnableUser)
+		api.POST("/users/:id/disable", perm(model.PermUserWrite), userHandler.DisableUser)
+		api.GET("/users/:id/sessions", perm(model.PermUserRead), userHandler.GetUserSessions)
+		api.DELETE("/users/:id/sessions", perm(model.PermUserWrite), userHandler.TerminateUserSessions)
+		api.DELETE("/users/:id/sessions/:sid", perm(model.PermUserWrite), userHandler.TerminateUserSession)
+		api.DELETE("/users/:id/mfa", perm(model.PermUserWrite), userHandler.ResetUserMFA)
+		api.POST("/users/:id/unlock", perm(model.PermUserWrite), lockoutHandler.UnlockUser)
+
+		// Roles & Permissions
+		api.GET("/permissions", perm(model.PermRoleRead), roleHandler.GetPermissions)
+		api.GET("/roles", perm(model.PermRoleRead), roleHandler.GetRoles)
+		api.GET("/roles/:id", perm(model.PermRoleRead), roleHandler.GetRole)
+		api.POST("/roles", platform, perm(model.PermRoleWrite), roleHandler.CreateRole)
+		api.PUT("/roles/:id", platform, perm(model.PermRoleWrite), roleHandler.UpdateRole)
+		api.DELETE("/roles/:id", platform, perm(model.PermRoleWrite), roleHandler.DeleteRole)
+
+		// Organizations
+		api.GET("/organizations", perm(model.PermOrgRead), orgHandler.GetOrganizations)
+		api.GET("/organizations/tree", perm(model.PermOrgRead), orgHandler.GetOrganizationTree)
+		api.GET("/organizations/:id", perm(model.PermOrgRead), orgHandler.GetOrganization)
+		api.POST("/organizations", perm(model.PermOrgWrite), orgHandler.CreateOrganization)
+		api.PUT("/organizations/:id", perm(model.PermOrgWrite), orgHandler.UpdateOrganization)
+		api.POST("/organizations/:id/move", perm(model.PermOrgWrite), orgHandler.MoveOrganization)
+		api.DELETE("/organizations/:id", perm(model.PermOrgWrite), orgHandler.DeleteOrganization)
+
+		// Tenants
+		api.GET("/tenants", platform, perm(model.PermTenantRead), tenantHandler.GetTenants)
+		api.GET("/tenants/:id", platform, perm(model.PermTenantRead), tenantHandler.GetTenant)
+		api.POST("/tenants", platform, perm(model.PermTenantWrite), tenantHandler.CreateTenant)
+		api.PUT("/tenants/:id", platform, perm(model.PermTenantWrite), tenantHandler.UpdateTenant)
+
+		// Audit Logs
+		api.GET("/audit-logs", perm(model.PermAuditRead), auditHandler.GetAuditLogs)
 
 		// Dashboard
-		api.GET("/dashboard/stats", handler.GetDashboardStats)
+		api.GET("/dashboard/stats", perm(model.PermDashboardRead), handler.GetDashboardStats)
 
 		// Assets
-		api.GET("/assets", assetHandler.GetAssets)
-		api.POST("/assets", assetHandler.CreateAsset)
-		api.PUT("/assets/:id", assetHandler.UpdateAsset)
-		api.DELETE("/assets/:id", assetHandler.DeleteAsset)
+		api.GET("/assets", perm(model.PermAssetRead), assetHandler.GetAssets)
+		api.POST("/assets", perm(model.PermAssetWrite), assetHandler.CreateAsset)
+		api.POST("/assets/import", perm(model.PermAssetWrite), assetHandler.ImportAssets)
+		api.GET("/assets/imports", perm(model.PermAssetRead), assetHandler.GetAssetImports)
+		api.GET("/assets/export", perm(model.PermAssetRead), assetHandler.ExportAssets)
+		api.PUT("/assets/:id", perm(model.PermAssetWrite), assetHandler.UpdateAsset)
+		api.DELETE("/assets/:id", perm(model.PermAssetDelete), assetHandler.DeleteAsset)
+		api.GET("/assets/:id/relations", perm(model.PermAssetRead), relationHandler.GetAssetRelations)
+		api.GET("/assets/:id/impact", perm(model.PermAssetRead), relationHandler.GetImpact)
+
+		// Asset Types (custom attribute schemas)
+		api.GET("/attribute-types", perm(model.PermAssetRead), assetTypeHandler.GetAttributeTypes)
+		api.GET("/asset-types", perm(model.PermAssetRead), assetTypeHandler.GetAssetTypes)
+		api.GET("/asset-types/:id", perm(model.PermAssetRead), assetTypeHandler.GetAssetType)
+		api.POST("/asset-types", platform, perm(model.PermAssetTypeWrite), assetTypeHandler.CreateAssetType)
+		api.PUT("/asset-types/:id", platform, perm(model.PermAssetTypeWrite), assetTypeHandler.UpdateAssetType)
+		api.DELETE("/asset-types/:id", platform, perm(model.PermAssetTypeWrite), assetTypeHandler.DeleteAssetType)
+
+		// Asset Relations
+		api.GET("/asset-relations", perm(model.PermAssetRead), relationHandler.GetRelations)
+		api.POST("/asset-relations", perm(model.PermAssetWrite), relationHandler.CreateRelation)
+		api.PUT("/asset-relations/:id", perm(model.PermAssetWrite), relationHandler.UpdateRelation)
+		api.DELETE("/asset-relations/:id", perm(model.PermAssetWrite), relationHandler.DeleteRelation)
 
 		// Contracts
-		api.GET("/contracts", contractHandler.GetContracts)
-		api.GET("/contracts/:id", contractHandler.GetContract)
-		api.POST("/contracts", contractHandler.CreateContract)
-		api.PUT("/contracts/:id", contractHandler.UpdateContract)
-		api.DELETE("/contracts/:id", contractHandler.DeleteContract)
+		api.GET("/contracts", perm(model.PermContractRead), contractHandler.GetContracts)
+		api.GET("/contracts/export", perm(model.PermContractRead), contractHandler.ExportContracts)
+		api.GET("/contracts/:id", perm(model.PermContractRead), contractHandler.GetContract)
+		api.POST("/contracts", perm(model.PermContractWrite), contractHandler.CreateContract)
+		api.PUT("/contracts/:id", perm(model.PermContractWrite), contractHandler.UpdateContract)
+		api.DELETE("/contracts/:id", perm(model.PermContractDelete), contractHandler.DeleteContract)
 
 		// Contract Files
-		api.GET("/contracts/:id/files", contractHandler.GetContractFiles)
-		api.POST("/contracts/:id/files", contractHandler.UploadContractFile)
-		api.GET("/contract-files/:file_id/download", contractHandler.DownloadContractFile)
+		api.GET("/contracts/:id/files", perm(model.PermContractRead), contractHandler.GetContractFiles)
+		api.POST("/contracts/:id/files", perm(model.PermContractWrite), contractHandler.UploadContractFile)
+		api.GET("/contract-files/:file_id/download", perm(model.PermContractRead), contractHandler.DownloadContractFile)
+
+		// Webhooks
+		api.GET("/webhooks/events", perm(model.PermWebhookRead), webhookHandler.GetEventTypes)
+		api.GET("/webhooks", perm(model.PermWebhookRead), webhookHandler.GetWebhooks)
+		api.GET("/webhooks/:id", perm(model.PermWebhookRead), webhookHandler.GetWebhook)
+		api.POST("/webhooks", perm(model.PermWebhookWrite), webhookHandler.CreateWebhook)
+		api.PUT("/webhooks/:id", perm(model.PermWebhookWrite), webhookHandler.UpdateWebhook)
+		api.DELETE("/webhooks/:id", perm(model.PermWebhookWrite), webhookHandler.DeleteWebhook)
+		api.GET("/webhooks/:id/deliveries", perm(model.PermWebhookRead), webhookHandler.GetDeliveries)
+		api.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", perm(model.PermWebhookWrite), webhookHandler.Redeliver)
+
+		// Notifications
+		api.GET("/notifications", perm(model.PermNotificationRead), notificationHandler.GetNotifications)
+		api.GET("/notifications/:id", perm(model.PermNotificationRead), notificationHandler.GetNotification)
+		api.POST("/notifications/:id/retry", perm(model.PermNotificationWrite), notificationHandler.RetryNotification)
+		api.GET("/notification-rules", perm(model.PermNotificationRead), notificationRuleHandler.GetRules)
+		api.GET("/notification-rules/:id", perm(model.PermNotificationRead), notificationRuleHandler.GetRule)
+		api.POST("/notification-rules", perm(model.PermNotificationWrite), notificationRuleHandler.CreateRule)
+		api.PUT("/notification-rules/:id", perm(model.PermNotificationWrite), notificationRuleHandler.UpdateRule)
+		api.DELETE("/notification-rules/:id", perm(model.PermNotificationWrite), notificationRuleHandler.DeleteRule)
+		api.POST("/notification-rules/preview", perm(model.PermNotificationRead), notificationRuleHandler.PreviewRoute)
 
 		// System Interfaces
-		api.GET("/interfaces", interfaceHandler.GetInterfaces)
-		api.GET("/interfaces/:id", interfaceHandler.GetInterface)
-		api.POST("/interfaces", interfaceHandler.CreateInterface)
-		api.PUT("/interfaces/:id", interfaceHandler.UpdateInterface)
-		api.DELETE("/interfaces/:id", interfaceHandler.DeleteInterface)
+		api.GET("/interfaces", perm(model.PermInterfaceRead), interfaceHandler.GetInterfaces)
+		api.GET("/interfaces/export", perm(model.PermInterfaceRead), interfaceHandler.ExportInterfaces)
+		api.GET("/interfaces/:id", perm(model.PermInterfaceRead), interfaceHandler.GetInterface)
+		api.POST("/interfaces", perm(model.PermInterfaceWrite), interfaceHandler.CreateInterface)
+		api.PUT("/interfaces/:id", perm(model.PermInterfaceWrite), interfaceHandler.UpdateInterface)
+		api.DELETE("/interfaces/:id", perm(model.PermInterfaceDelete), interfaceHandler.DeleteInterface)
 
 		// Ping test
 		api.GET("/ping", func(c *gin.Context) {
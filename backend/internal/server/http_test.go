@@ -0,0 +1,36 @@
+package server
+
+import (
+	"itam-backend/internal/conf"
+	"itam-backend/internal/notification"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		want    string
+	}{
+		{nil, "198.51.100.1"},
+		{[]string{"198.51.100.0/24"}, "10.0.0.1"},
+		{[]string{"192.0.2.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := NewHTTPServer(&conf.Config{Server: conf.ServerConfig{TrustedProxies: tt.proxies}},
+			notification.NewService(&conf.NotificationConfig{}), nil, nil)
+		r.GET("/client-ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+		req := httptest.NewRequest(http.MethodGet, "/client-ip", nil)
+		req.RemoteAddr = "198.51.100.1:40000"
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("trusting %v: client %s, want %s", tt.proxies, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in process memory; they are lost on restart
+// and not shared between instances
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	revoked  map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]*Session{},
+		revoked:  map[string]time.Time{},
+	}
+}
+
+func (m *MemoryStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *s
+	m.sessions[s.ID] = &cp
+	return nil
+}
+
+func (m *MemoryStore) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.Expired() {
+		delete(m.sessions, id)
+		return nil, ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (m *MemoryStore) Rotate(s *Session, oldHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.sessions[s.ID]
+	if !ok || cur.Expired() || cur.RefreshHash != oldHash {
+		return false, nil
+	}
+	cp := *s
+	m.sessions[s.ID] = &cp
+	return true, nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemoryStore) ListByUser(userID uint) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []*Session
+	for id, s := range m.sessions {
+		if s.Expired() {
+			delete(m.sessions, id)
+			continue
+		}
+		if s.UserID == userID {
+			cp := *s
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func (m *MemoryStore) Revoke(jti string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, exp := range m.revoked {
+		if now.After(exp) {
+			delete(m.revoked, id)
+		}
+	}
+	m.revoked[jti] = until
+	return nil
+}
+
+func (m *MemoryStore) IsRevoked(jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, ok := m.revoked[jti]
+	return ok && time.Now().Before(until), nil
+}
@@ -0,0 +1,340 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"itam-backend/internal/conf"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const redisPrefix = "itam:"
+
+// RedisStore shares sessions between instances through Redis.
+//
+//	itam:session:<id>              session JSON, expires with the session
+//	itam:refresh:<id>:<hash>       marker consumed by Rotate
+//	itam:user_sessions:<user id>   set of session IDs
+//	itam:revoked:<jti>             revoked access token, expires with the token
+type RedisStore struct {
+	client *redisClient
+}
+
+func NewRedisStore(cfg *conf.RedisConfig) (*RedisStore, error) {
+	client := &redisClient{addr: cfg.Addr, password: cfg.Password, db: cfg.Db}
+	if _, err := client.do("PING"); err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func sessionKey(id string) string {
+	return redisPrefix + "session:" + id
+}
+
+func refreshKey(id, hash string) string {
+	return redisPrefix + "refresh:" + id + ":" + hash
+}
+
+func userSessionsKey(userID uint) string {
+	return redisPrefix + "user_sessions:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+func revokedKey(jti string) string {
+	return redisPrefix + "revoked:" + jti
+}
+
+func ttlMillis(until time.Time) string {
+	return strconv.FormatInt(time.Until(until).Milliseconds(), 10)
+}
+
+func (r *RedisStore) Save(s *Session) error {
+	if s.Expired() {
+		return nil
+	}
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ttl := ttlMillis(s.ExpiresAt)
+	if _, err := r.client.do("SET", sessionKey(s.ID), string(body), "PX", ttl); err != nil {
+		return err
+	}
+	if _, err := r.client.do("SET", refreshKey(s.ID, s.RefreshHash), "1", "PX", ttl); err != nil {
+		return err
+	}
+	if _, err := r.client.do("SADD", userSessionsKey(s.UserID), s.ID); err != nil {
+		return err
+	}
+	_, err = r.client.do("PEXPIRE", userSessionsKey(s.UserID), ttl)
+	return err
+}
+
+func (r *RedisStore) Get(id string) (*Session, error) {
+	reply, err := r.client.do("GET", sessionKey(id))
+	if err != nil {
+		return nil, err
+	}
+	body, ok := reply.(string)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(body), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *RedisStore) Rotate(s *Session, oldHash string) (bool, error) {
+	// Only the caller that deletes the marker may rotate
+	reply, err := r.client.doOnce("DEL", refreshKey(s.ID, oldHash))
+	if err != nil {
+		return false, err
+	}
+	if n, _ := reply.(int64); n != 1 {
+		return false, nil
+	}
+	return true, r.Save(s)
+}
+
+func (r *RedisStore) Delete(id string) error {
+	s, err := r.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := r.client.do("DEL", sessionKey(id), refreshKey(id, s.RefreshHash)); err != nil {
+		return err
+	}
+	_, err = r.client.do("SREM", userSessionsKey(s.UserID), id)
+	return err
+}
+
+func (r *RedisStore) ListByUser(userID uint) ([]*Session, error) {
+	reply, err := r.client.do("SMEMBERS", userSessionsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := reply.([]interface{})
+	var list []*Session
+	for _, v := range ids {
+		id, _ := v.(string)
+		s, err := r.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			r.client.do("SREM", userSessionsKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+func (r *RedisStore) Revoke(jti string, until time.Time) error {
+	if !time.Now().Before(until) {
+		return nil
+	}
+	_, err := r.client.do("SET", revokedKey(jti), "1", "PX", ttlMillis(until))
+	return err
+}
+
+func (r *RedisStore) IsRevoked(jti string) (bool, error) {
+	reply, err := r.client.do("EXISTS", revokedKey(jti))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// redisMaxIdle is the number of idle connections kept for reuse
+const redisMaxIdle = 8
+
+// redisClient is a minimal RESP client, enough for the handful of commands
+// the session store issues. Requests run in parallel on pooled connections.
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do sends a command and returns its reply: string, int64, []interface{}
+// or nil. A command failing on a broken connection is sent once more on a
+// new one, so it must be safe to run twice.
+func (c *redisClient) do(args ...string) (interface{}, error) {
+	return c.exec(args, true)
+}
+
+// doOnce sends a command that must not run twice, such as the DEL whose
+// reply decides who rotates a session. It is never resent: the first
+// attempt may have run even though its reply was lost.
+func (c *redisClient) doOnce(args ...string) (interface{}, error) {
+	return c.exec(args, false)
+}
+
+func (c *redisClient) exec(args []string, retry bool) (interface{}, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.roundTrip(args)
+	if broken(err) {
+		conn.close()
+		if !retry {
+			return nil, err
+		}
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+		if reply, err = conn.roundTrip(args); broken(err) {
+			conn.close()
+			return nil, err
+		}
+	}
+	c.put(conn)
+	return reply, err
+}
+
+// broken reports whether err leaves the connection unusable; error
+// replies from the server do not
+func broken(err error) bool {
+	var rerr redisError
+	return err != nil && !errors.As(err, &rerr)
+}
+
+// get takes an idle connection or dials a new one
+func (c *redisClient) get() (*redisConn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+	return c.dial()
+}
+
+// put returns a healthy connection to the pool
+func (c *redisClient) put(conn *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) >= redisMaxIdle {
+		conn.close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+func (c *redisClient) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", c.addr, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: nc, rd: bufio.NewReader(nc)}
+
+	if c.password != "" {
+		if _, err := conn.roundTrip([]string{"AUTH", c.password}); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.roundTrip([]string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *redisConn) roundTrip(args []string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if err := writeCommand(c.conn, args); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+func (c *redisConn) close() {
+	c.conn.Close()
+}
+
+func writeCommand(w io.Writer, args []string) error {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(a))+"\r\n"...)
+		buf = append(buf, a...)
+		buf = append(buf, "\r\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				var rerr redisError
+				if !errors.As(err, &rerr) {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
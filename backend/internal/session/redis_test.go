@@ -0,0 +1,248 @@
+package session
+
+import (
+	"bufio"
+	"itam-backend/internal/conf"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis speaks enough RESP for the session store, keeping keys in
+// memory. Setting dropAfter makes it run the next command of that name
+// and hang up instead of replying, like a connection lost mid-request.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	strings   map[string]string
+	sets      map[string]map[string]bool
+	expires   map[string]time.Time
+	calls     map[string]int
+	dropAfter string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		ln:      ln,
+		strings: map[string]string{},
+		sets:    map[string]map[string]bool{},
+		expires: map[string]time.Time{},
+		calls:   map[string]int{},
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		cmd, err := readReply(rd)
+		if err != nil {
+			return
+		}
+		items, _ := cmd.([]interface{})
+		args := make([]string, len(items))
+		for i, v := range items {
+			args[i], _ = v.(string)
+		}
+		reply, drop := f.exec(args)
+		if drop {
+			return
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[name]
+}
+
+func (f *fakeRedis) drop(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dropAfter = name
+}
+
+// live reports whether key exists, dropping it once expired
+func (f *fakeRedis) live(key string) bool {
+	if exp, ok := f.expires[key]; ok && !time.Now().Before(exp) {
+		delete(f.strings, key)
+		delete(f.sets, key)
+		delete(f.expires, key)
+	}
+	_, isString := f.strings[key]
+	_, isSet := f.sets[key]
+	return isString || isSet
+}
+
+func (f *fakeRedis) exec(args []string) (reply string, drop bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := strings.ToUpper(args[0])
+	f.calls[name]++
+	if f.dropAfter == name {
+		f.dropAfter = ""
+		drop = true
+	}
+	integer := func(n int) string { return ":" + strconv.Itoa(n) + "\r\n" }
+	bulk := func(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+	switch name {
+	case "PING", "AUTH", "SELECT":
+		return "+OK\r\n", drop
+	case "SET":
+		f.strings[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n", drop
+	case "GET":
+		if !f.live(args[1]) {
+			return "$-1\r\n", drop
+		}
+		return bulk(f.strings[args[1]]), drop
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if f.live(key) {
+				n++
+				if name == "DEL" {
+					delete(f.strings, key)
+					delete(f.sets, key)
+					delete(f.expires, key)
+				}
+			}
+		}
+		return integer(n), drop
+	case "SADD", "SREM":
+		if !f.live(args[1]) {
+			f.sets[args[1]] = map[string]bool{}
+		}
+		n := 0
+		for _, m := range args[2:] {
+			if f.sets[args[1]][m] != (name == "SADD") {
+				n++
+			}
+			if name == "SADD" {
+				f.sets[args[1]][m] = true
+			} else {
+				delete(f.sets[args[1]], m)
+			}
+		}
+		return integer(n), drop
+	case "SMEMBERS":
+		f.live(args[1])
+		out := "*" + strconv.Itoa(len(f.sets[args[1]])) + "\r\n"
+		for m := range f.sets[args[1]] {
+			out += bulk(m)
+		}
+		return out, drop
+	case "PEXPIRE":
+		if !f.live(args[1]) {
+			return integer(0), drop
+		}
+		ms, _ := strconv.Atoi(args[2])
+		f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return integer(1), drop
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n", drop
+}
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *fakeRedis) {
+	t.Helper()
+	f := newFakeRedis(t)
+	store, err := NewRedisStore(&conf.RedisConfig{Addr: f.ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, f
+}
+
+func TestRedisStore(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	testStore(t, store)
+}
+
+func TestRedisRotateIsNotResent(t *testing.T) {
+	store, f := newTestRedisStore(t)
+	s := testSession(1, "first")
+	if err := store.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// The marker is deleted but the reply lost: resending the DEL would
+	// find nothing and report the refresh token as reused, or, racing
+	// another refresh, let both rotate
+	f.drop("DEL")
+	next := *s
+	next.RefreshHash = "second"
+	if ok, err := store.Rotate(&next, "first"); err == nil || ok {
+		t.Fatalf("rotate over a lost connection: %v, %v; want an error", ok, err)
+	}
+	if n := f.count("DEL"); n != 1 {
+		t.Fatalf("DEL sent %d times", n)
+	}
+}
+
+func TestRedisRetriesReads(t *testing.T) {
+	store, f := newTestRedisStore(t)
+	s := testSession(1, "first")
+	if err := store.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	f.drop("GET")
+	if _, err := store.Get(s.ID); err != nil {
+		t.Fatalf("get over a lost connection: %v", err)
+	}
+	if n := f.count("GET"); n != 2 {
+		t.Fatalf("GET sent %d times, want 2", n)
+	}
+}
+
+func TestRedisRunsRequestsInParallel(t *testing.T) {
+	store, _ := newTestRedisStore(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := testSession(uint(i%3), "hash")
+			if err := store.Save(s); err != nil {
+				t.Error(err)
+				return
+			}
+			if got, err := store.Get(s.ID); err != nil || got.ID != s.ID {
+				t.Errorf("get %s: %v", s.ID, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(store.client.idle); n == 0 || n > redisMaxIdle {
+		t.Fatalf("%d idle connections", n)
+	}
+}
@@ -0,0 +1,117 @@
+// Package session keeps the server-side state behind JWT access tokens:
+// refresh-token sessions and the revocation list of access token IDs (jti).
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"itam-backend/internal/conf"
+	"log"
+	"time"
+)
+
+// ErrNotFound is returned when a session does not exist or has expired
+var ErrNotFound = errors.New("session not found")
+
+// Session is one login of a user. The refresh token is only stored as a
+// hash; every refresh rotates it and replaces the session's access token.
+type Session struct {
+	ID              string    `json:"id"`
+	UserID          uint      `json:"user_id"`
+	TenantID        uint      `json:"tenant_id"`
+	IP              string    `json:"ip"`
+	UserAgent       string    `json:"user_agent"`
+	RefreshHash     string    `json:"refresh_hash"`
+	AccessID        string    `json:"access_id"`         // jti of the current access token
+	AccessExpiresAt time.Time `json:"access_expires_at"` // revocation entries can be dropped after this
+	CreatedAt       time.Time `json:"created_at"`
+	RefreshedAt     time.Time `json:"refreshed_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the refresh token of the session has expired
+func (s *Session) Expired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// Store persists sessions and revoked access token IDs
+type Store interface {
+	// Save creates or replaces a session until its ExpiresAt
+	Save(s *Session) error
+	// Get returns the session or ErrNotFound
+	Get(id string) (*Session, error)
+	// Rotate replaces the session only if its refresh hash is still
+	// oldHash, so a refresh token can be used exactly once
+	Rotate(s *Session, oldHash string) (bool, error)
+	// Delete removes a session, deleting a missing session is not an error
+	Delete(id string) error
+	// ListByUser returns the live sessions of a user
+	ListByUser(userID uint) ([]*Session, error)
+	// Revoke rejects the access token with the given jti until it expires
+	Revoke(jti string, until time.Time) error
+	// IsRevoked reports whether the access token jti was revoked
+	IsRevoked(jti string) (bool, error)
+}
+
+// Default is the store used by the auth middleware and handlers
+var Default Store = NewMemoryStore()
+
+// Init selects the session store from the configuration. The in-process
+// store is used unless auth.session_store is "redis".
+func Init(cfg *conf.Config) {
+	switch cfg.Auth.SessionStore {
+	case "", "memory":
+		Default = NewMemoryStore()
+	case "redis":
+		store, err := NewRedisStore(&cfg.Redis)
+		if err != nil {
+			log.Fatalf("Failed to connect to redis session store: %v", err)
+		}
+		Default = store
+		log.Printf("Session store: redis at %s", cfg.Redis.Addr)
+	default:
+		log.Fatalf("Unknown auth.session_store %q", cfg.Auth.SessionStore)
+	}
+}
+
+// NewID returns a random identifier for sessions, token IDs and secrets
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("session: crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// HashSecret hashes a refresh token secret for storage
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// RevokeSession deletes a session and revokes its current access token
+func RevokeSession(store Store, s *Session) error {
+	if s.AccessID != "" && time.Now().Before(s.AccessExpiresAt) {
+		if err := store.Revoke(s.AccessID, s.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return store.Delete(s.ID)
+}
+
+// RevokeUser ends all sessions of a user and returns how many were ended
+func RevokeUser(store Store, userID uint) (int, error) {
+	sessions, err := store.ListByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range sessions {
+		if err := RevokeSession(store, s); err != nil {
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
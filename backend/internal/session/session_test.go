@@ -0,0 +1,93 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func testSession(userID uint, hash string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:              NewID(),
+		UserID:          userID,
+		RefreshHash:     hash,
+		AccessID:        NewID(),
+		AccessExpiresAt: now.Add(time.Minute),
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(time.Hour),
+	}
+}
+
+// testStore checks the behavior every Store shares
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	s := testSession(7, "first")
+	if err := store.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get(s.ID); err != nil || got.RefreshHash != "first" {
+		t.Fatalf("get: %+v, %v", got, err)
+	}
+	if _, err := store.Get(NewID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get of a missing session: %v", err)
+	}
+
+	// A refresh hash rotates exactly once
+	next := *s
+	next.RefreshHash = "second"
+	if ok, err := store.Rotate(&next, "first"); err != nil || !ok {
+		t.Fatalf("rotate: %v, %v", ok, err)
+	}
+	if ok, err := store.Rotate(&next, "first"); err != nil || ok {
+		t.Fatalf("rotate with a spent hash: %v, %v", ok, err)
+	}
+	if got, _ := store.Get(s.ID); got == nil || got.RefreshHash != "second" {
+		t.Fatalf("after rotation: %+v", got)
+	}
+
+	other := testSession(7, "other")
+	expired := testSession(7, "expired")
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	for _, s := range []*Session{other, expired, testSession(8, "someone else")} {
+		if err := store.Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if list, err := store.ListByUser(7); err != nil || len(list) != 2 {
+		t.Fatalf("list: %d sessions, %v; want 2", len(list), err)
+	}
+
+	// Revoking the user ends the sessions and their access tokens
+	if n, err := RevokeUser(store, 7); err != nil || n != 2 {
+		t.Fatalf("revoke user: %d, %v", n, err)
+	}
+	if list, _ := store.ListByUser(7); len(list) != 0 {
+		t.Fatalf("%d sessions left", len(list))
+	}
+	if _, err := store.Get(s.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get after revocation: %v", err)
+	}
+	for _, jti := range []string{s.AccessID, other.AccessID} {
+		if revoked, err := store.IsRevoked(jti); err != nil || !revoked {
+			t.Fatalf("access token %s revoked: %v, %v", jti, revoked, err)
+		}
+	}
+	if err := store.Delete(s.ID); err != nil {
+		t.Fatalf("delete of a missing session: %v", err)
+	}
+
+	if err := store.Revoke("stale", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := store.IsRevoked("stale"); revoked {
+		t.Fatal("expired revocation still applies")
+	}
+	if revoked, _ := store.IsRevoked(NewID()); revoked {
+		t.Fatal("unknown token revoked")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+}
+
+// MemoryStorage keeps objects in memory, for development and testing
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: map[string]memoryObject{}}
+}
+
+func (s *MemoryStorage) Name() string { return DriverMemory }
+
+func (s *MemoryStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(b)) != size {
+		return fmt.Errorf("storage: read %d bytes, expected %d", len(b), size)
+	}
+	s.mu.Lock()
+	s.objects[key] = memoryObject{data: b, contentType: contentType}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	s.mu.RLock()
+	o, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(o.data)), &Object{Size: int64(len(o.data)), ContentType: o.contentType}, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.objects, key)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package storage keeps uploaded files on the local disk or in
+// S3-compatible object storage, so that replicas share them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"itam-backend/internal/conf"
+	"strings"
+)
+
+// Backend names, recorded with every stored file
+const (
+	DriverLocal  = "local"
+	DriverS3     = "s3"
+	DriverMemory = "memory"
+)
+
+// ErrNotFound is returned for keys that hold no object
+var ErrNotFound = errors.New("storage: object not found")
+
+// Object describes a stored object
+type Object struct {
+	Size        int64
+	ContentType string
+}
+
+// Storage stores objects under slash-separated keys such as
+// "contracts/1/7/v2_offer.pdf"
+type Storage interface {
+	// Name returns the backend name, one of the Driver constants
+	Name() string
+	// Put stores size bytes read from r under key, replacing any object there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object under key, the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete removes the object under key, missing objects are not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the backend selected by cfg.Driver
+func New(cfg *conf.StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case DriverLocal, "":
+		return NewLocalStorage(cfg.Local.Root)
+	case DriverS3:
+		return NewS3Storage(&cfg.S3)
+	case DriverMemory:
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q, expected local, s3 or memory", cfg.Driver)
+	}
+}
+
+// checkKey rejects keys that could step outside the storage root
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	valid := []string{
+		"a",
+		"contracts/1/7/v2_offer.pdf",
+		"contracts/1/7/..pdf",
+		"contracts/1/7/名称 with spaces.pdf",
+	}
+	for _, key := range valid {
+		if err := checkKey(key); err != nil {
+			t.Errorf("checkKey(%q) = %v", key, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/etc/passwd",
+		"..",
+		"../secret",
+		"contracts/../../secret",
+		"contracts/1/..",
+		"contracts/./1",
+		"contracts//1",
+		"contracts/1/",
+		`contracts\..\..\secret`,
+		"contracts/1/a\x00.pdf",
+	}
+	for _, key := range invalid {
+		if err := checkKey(key); err == nil {
+			t.Errorf("checkKey(%q) accepted", key)
+		}
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "files")
+	s, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "contracts/1/7/v1_offer.pdf"
+
+	if err := s.Put(ctx, key, strings.NewReader("first"), 5, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	// Replacing keeps only the new content
+	if err := s.Put(ctx, key, strings.NewReader("second"), 6, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	rc, obj, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "second" || obj.Size != 6 || obj.ContentType != "application/pdf" {
+		t.Fatalf("got %q, %+v", b, obj)
+	}
+	if _, err := os.Stat(filepath.Join(root, "contracts", "1", "7", "v1_offer.pdf")); err != nil {
+		t.Fatalf("object not below the root: %v", err)
+	}
+
+	// A short body fails and leaves the stored object and no temp files
+	if err := s.Put(ctx, key, strings.NewReader("abc"), 10, ""); err == nil {
+		t.Fatal("short write accepted")
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "contracts", "1", "7"))
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %d entries after a failed put, want 1", len(entries))
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get after delete: err = %v", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting a missing object: %v", err)
+	}
+}
+
+func TestLocalStorageStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLocalStorage(filepath.Join(dir, "files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "../secret", strings.NewReader("gone"), 4, ""); err == nil {
+		t.Fatal("put outside the root accepted")
+	}
+	if _, _, err := s.Get(ctx, "../secret"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("get outside the root: err = %v", err)
+	}
+	if err := s.Delete(ctx, "../secret"); err == nil {
+		t.Fatal("delete outside the root accepted")
+	}
+	if b, _ := os.ReadFile(secret); string(b) != "keep" {
+		t.Fatalf("file outside the root now holds %q", b)
+	}
+}
@@ -0,0 +1,174 @@
+// Package tenant confines every GORM statement on a tenant-scoped table
+// (any model with a tenant_id column) to the tenant of the current request.
+//
+// The scope travels in the statement context, so handlers must use
+// data.DB.WithContext(c). A statement on a scoped table without a scope
+// fails instead of silently reading or writing across tenants; background
+// jobs that legitimately span tenants use WithAll.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Key is the context key holding the Scope of the current request
+const Key = "tenantScope"
+
+// Column is the column that marks a table as tenant-scoped
+const Column = "tenant_id"
+
+// ErrNoScope is returned for statements on scoped tables without a Scope
+var ErrNoScope = errors.New("tenant: no tenant scope on statement")
+
+// ErrUpsert is returned for upserts that update on conflict within a
+// tenant scope; the conflicting row may belong to another tenant
+var ErrUpsert = errors.New("tenant: upsert could overwrite another tenant's row")
+
+// Scope restricts statements to one tenant, or to none when All is set
+type Scope struct {
+	TenantID uint
+	All      bool
+}
+
+// WithTenant returns ctx restricted to tenantID
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, Key, Scope{TenantID: tenantID})
+}
+
+// WithAll returns ctx allowed to read and write every tenant.
+// Rows created under it must carry their tenant_id explicitly.
+func WithAll(ctx context.Context) context.Context {
+	return context.WithValue(ctx, Key, Scope{All: true})
+}
+
+// FromContext returns the scope stored in ctx, if any
+func FromContext(ctx context.Context) (Scope, bool) {
+	if ctx == nil {
+		return Scope{}, false
+	}
+	scope, ok := ctx.Value(Key).(Scope)
+	return scope, ok
+}
+
+// Register installs the tenant callbacks on db; they run before any other
+// callback so audit snapshots and the like only ever see scoped rows.
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("*").Register("tenant:query", restrict); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register("tenant:row", restrict); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register("tenant:update", beforeUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("*").Register("tenant:delete", restrict); err != nil {
+		return err
+	}
+	return cb.Create().Before("*").Register("tenant:create", beforeCreate)
+}
+
+// scoped returns the tenant field and scope when the statement needs confining
+func scoped(db *gorm.DB) (*schema.Field, Scope, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, Scope{}, false
+	}
+	field := db.Statement.Schema.LookUpField(Column)
+	if field == nil {
+		return nil, Scope{}, false
+	}
+	scope, ok := FromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(fmt.Errorf("%w: %s", ErrNoScope, db.Statement.Table))
+		return nil, Scope{}, false
+	}
+	if scope.All {
+		return nil, scope, false
+	}
+	return field, scope, true
+}
+
+func restrict(db *gorm.DB) {
+	if _, scope, ok := scoped(db); ok {
+		addWhere(db, scope.TenantID)
+	}
+}
+
+func beforeUpdate(db *gorm.DB) {
+	_, scope, ok := scoped(db)
+	if !ok {
+		return
+	}
+	addWhere(db, scope.TenantID)
+	// Pin the column so a bound request body cannot move the row elsewhere
+	db.Statement.SetColumn(Column, scope.TenantID, true)
+}
+
+func beforeCreate(db *gorm.DB) {
+	field, scope, ok := scoped(db)
+	if !ok {
+		if scope.All {
+			requireTenant(db)
+		}
+		return
+	}
+	// Save turns an update that matched no row, such as one aimed at another
+	// tenant's ID, into an upsert whose conflict update would overwrite it
+	if c, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && (onConflict.UpdateAll || len(onConflict.DoUpdates) > 0) {
+			db.AddError(fmt.Errorf("%w: %s", ErrUpsert, db.Statement.Table))
+			return
+		}
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := field.Set(db.Statement.Context, reflect.Indirect(rv.Index(i)), scope.TenantID); err != nil {
+				db.AddError(err)
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(db.Statement.Context, rv, scope.TenantID); err != nil {
+			db.AddError(err)
+		}
+	}
+}
+
+// requireTenant rejects unscoped creates that leave tenant_id empty
+func requireTenant(db *gorm.DB) {
+	field := db.Statement.Schema.LookUpField(Column)
+	if field == nil {
+		return
+	}
+	check := func(v reflect.Value) {
+		if _, isZero := field.ValueOf(db.Statement.Context, v); isZero {
+			db.AddError(fmt.Errorf("tenant: %s row created without tenant_id", db.Statement.Table))
+		}
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			check(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		check(rv)
+	}
+}
+
+func addWhere(db *gorm.DB, tenantID uint) {
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: Column}, Value: tenantID},
+	}})
+}
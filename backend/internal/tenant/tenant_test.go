@@ -0,0 +1,206 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+type item struct {
+	ID       uint
+	TenantID uint
+	Name     string
+}
+
+// global has no tenant_id column and is never scoped
+type global struct {
+	ID   uint
+	Name string
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(WithAll(context.Background())).AutoMigrate(&item{}, &global{}); err != nil {
+		t.Fatal(err)
+	}
+	all := db.WithContext(WithAll(context.Background()))
+	for _, it := range []item{{TenantID: 1, Name: "a1"}, {TenantID: 1, Name: "a2"}, {TenantID: 2, Name: "b1"}} {
+		if err := all.Create(&it).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func tenantDB(db *gorm.DB, id uint) *gorm.DB {
+	return db.WithContext(WithTenant(context.Background(), id))
+}
+
+func TestQueryIsConfinedToTenant(t *testing.T) {
+	db := openDB(t)
+
+	var items []item
+	if err := tenantDB(db, 1).Order("id").Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Name != "a1" || items[1].Name != "a2" {
+		t.Fatalf("tenant 1 sees %+v", items)
+	}
+
+	// Another tenant's row is not found by ID either
+	var other item
+	err := tenantDB(db, 1).First(&other, 3).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("reading tenant 2's row from tenant 1: err = %v, row = %+v", err, other)
+	}
+
+	var count int64
+	if err := tenantDB(db, 2).Model(&item{}).Count(&count).Error; err != nil || count != 1 {
+		t.Fatalf("tenant 2 count = %d, err = %v", count, err)
+	}
+}
+
+func TestUpdateIsConfinedToTenant(t *testing.T) {
+	db := openDB(t)
+
+	result := tenantDB(db, 1).Model(&item{}).Where("id = ?", 3).Update("name", "hijacked")
+	if result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("updating tenant 2's row from tenant 1: affected %d, err = %v", result.RowsAffected, result.Error)
+	}
+	result = tenantDB(db, 1).Model(&item{}).Where("1 = 1").Update("name", "renamed")
+	if result.Error != nil || result.RowsAffected != 2 {
+		t.Fatalf("bulk update in tenant 1: affected %d, err = %v", result.RowsAffected, result.Error)
+	}
+
+	var b item
+	db.WithContext(WithAll(context.Background())).First(&b, 3)
+	if b.Name != "b1" {
+		t.Fatalf("tenant 2's row was changed to %q", b.Name)
+	}
+}
+
+func TestUpdatePinsTenantID(t *testing.T) {
+	db := openDB(t)
+
+	// A bound request body trying to move the row to another tenant
+	it := item{ID: 1, TenantID: 2, Name: "moved"}
+	if err := tenantDB(db, 1).Save(&it).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tenantDB(db, 1).Model(&item{ID: 2}).Updates(map[string]interface{}{"tenant_id": 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []item
+	db.WithContext(WithAll(context.Background())).Order("id").Find(&rows)
+	if rows[0].TenantID != 1 || rows[0].Name != "moved" {
+		t.Fatalf("saved row = %+v, want tenant 1 and the new name", rows[0])
+	}
+	if rows[1].TenantID != 1 {
+		t.Fatalf("updated row = %+v, want tenant 1", rows[1])
+	}
+}
+
+func TestSaveCannotUpsertAcrossTenants(t *testing.T) {
+	db := openDB(t)
+
+	// A bound request body retargeting the save at tenant 2's row: the
+	// update matches nothing and Save falls back to an upsert
+	it := item{ID: 3, Name: "stolen"}
+	if err := tenantDB(db, 1).Save(&it).Error; !errors.Is(err, ErrUpsert) {
+		t.Fatalf("saving tenant 2's ID from tenant 1: err = %v", err)
+	}
+	err := tenantDB(db, 1).Clauses(clause.OnConflict{UpdateAll: true}).Create(&item{ID: 3, Name: "stolen"}).Error
+	if !errors.Is(err, ErrUpsert) {
+		t.Fatalf("upserting tenant 2's ID from tenant 1: err = %v", err)
+	}
+
+	var b item
+	db.WithContext(WithAll(context.Background())).First(&b, 3)
+	if b.TenantID != 2 || b.Name != "b1" {
+		t.Fatalf("tenant 2's row became %+v", b)
+	}
+
+	// Inserts that ignore conflicts cannot touch the other row
+	if err := tenantDB(db, 1).Clauses(clause.OnConflict{DoNothing: true}).Create(&item{Name: "a3"}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteIsConfinedToTenant(t *testing.T) {
+	db := openDB(t)
+
+	result := tenantDB(db, 1).Delete(&item{}, 3)
+	if result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("deleting tenant 2's row from tenant 1: affected %d, err = %v", result.RowsAffected, result.Error)
+	}
+	result = tenantDB(db, 2).Where("1 = 1").Delete(&item{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		t.Fatalf("bulk delete in tenant 2: affected %d, err = %v", result.RowsAffected, result.Error)
+	}
+
+	var count int64
+	db.WithContext(WithAll(context.Background())).Model(&item{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("%d rows left, want tenant 1's 2", count)
+	}
+}
+
+func TestCreateSetsTenant(t *testing.T) {
+	db := openDB(t)
+
+	it := item{TenantID: 2, Name: "new"}
+	if err := tenantDB(db, 1).Create(&it).Error; err != nil {
+		t.Fatal(err)
+	}
+	if it.TenantID != 1 {
+		t.Fatalf("created under tenant 1 with tenant_id %d", it.TenantID)
+	}
+
+	err := db.WithContext(WithAll(context.Background())).Create(&item{Name: "orphan"}).Error
+	if err == nil {
+		t.Fatal("creating without tenant_id under WithAll succeeded")
+	}
+}
+
+func TestNoScopeFails(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	var items []item
+	if err := db.WithContext(ctx).Find(&items).Error; !errors.Is(err, ErrNoScope) {
+		t.Fatalf("query without scope: err = %v", err)
+	}
+	if err := db.WithContext(ctx).Model(&item{}).Where("id = ?", 1).Update("name", "x").Error; !errors.Is(err, ErrNoScope) {
+		t.Fatalf("update without scope: err = %v", err)
+	}
+	if err := db.WithContext(ctx).Delete(&item{}, 1).Error; !errors.Is(err, ErrNoScope) {
+		t.Fatalf("delete without scope: err = %v", err)
+	}
+	if err := db.WithContext(ctx).Create(&item{TenantID: 1, Name: "x"}).Error; !errors.Is(err, ErrNoScope) {
+		t.Fatalf("create without scope: err = %v", err)
+	}
+
+	// Tables without a tenant_id column need no scope
+	if err := db.WithContext(ctx).Create(&global{Name: "g"}).Error; err != nil {
+		t.Fatalf("unscoped table: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package throttle slows down repeated failures, such as password
+// guessing, with an exponentially growing delay per key.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneSize is the number of tracked keys above which stale ones are
+// dropped on the next failure
+const pruneSize = 10000
+
+type entry struct {
+	failures int
+	last     time.Time
+}
+
+// Backoff counts failures per key in memory. After the free failures
+// every further one doubles the wait, from base up to max; failures older
+// than window are forgotten.
+type Backoff struct {
+	mu      sync.Mutex
+	base    time.Duration
+	max     time.Duration
+	window  time.Duration
+	entries map[string]*entry
+}
+
+func New(base, max, window time.Duration) *Backoff {
+	return &Backoff{
+		base:    base,
+		max:     max,
+		window:  window,
+		entries: map[string]*entry{},
+	}
+}
+
+// Wait returns how long key must wait before its next attempt, allowing
+// free failures without delay
+func (b *Backoff) Wait(key string, free int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.get(key, now)
+	if e == nil || e.failures <= free || b.base <= 0 {
+		return 0
+	}
+	delay := b.base
+	for i := free + 1; i < e.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	if b.max > 0 && delay > b.max {
+		delay = b.max
+	}
+	if wait := e.last.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail records a failure of key
+func (b *Backoff) Fail(key string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) > pruneSize {
+		for k, e := range b.entries {
+			if b.stale(e, now) {
+				delete(b.entries, k)
+			}
+		}
+	}
+	e := b.get(key, now)
+	if e == nil {
+		e = &entry{}
+		b.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+}
+
+// Reset forgets the failures of key
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	delete(b.entries, key)
+	b.mu.Unlock()
+}
+
+func (b *Backoff) get(key string, now time.Time) *entry {
+	e := b.entries[key]
+	if e != nil && b.stale(e, now) {
+		delete(b.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (b *Backoff) stale(e *entry, now time.Time) bool {
+	return b.window > 0 && now.Sub(e.last) > b.window
+}
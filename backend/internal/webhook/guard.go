@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// errRedirect is returned for endpoints answering with a redirect; the
+// target was checked, the redirect location would not be
+var errRedirect = errors.New("endpoint redirected, redirects are not followed")
+
+// deniedNetworks are internal ranges the net.IP predicates miss: "this
+// network", which Linux connects to locally, and the carrier-grade NAT
+// shared space that cloud providers use for internal services
+var deniedNetworks = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10")
+
+// guard keeps deliveries away from the server's own network: loopback,
+// private, link-local, unspecified and deniedNetworks addresses are
+// refused unless an allowed network contains them
+type guard struct {
+	allowed []*net.IPNet
+}
+
+func newGuard(cidrs []string) (*guard, error) {
+	g := &guard{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: invalid allowed network %q: %w", cidr, err)
+		}
+		g.allowed = append(g.allowed, network)
+	}
+	return g, nil
+}
+
+// permits reports whether ip may be connected to
+func (g *guard) permits(ip net.IP) bool {
+	for _, network := range g.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// control runs after name resolution, right before each connection, so a
+// host name that resolves to a public address when the webhook is saved
+// and to an internal one later is still caught
+func (g *guard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !g.permits(ip) {
+		return fmt.Errorf("webhook: address %s is not allowed", host)
+	}
+	return nil
+}
+
+// client returns an HTTP client that only connects to permitted
+// addresses, bypasses proxies, whose address would be checked instead,
+// and does not follow redirects
+func (g *guard) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: g.control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errRedirect
+		},
+	}
+}
+
+// CheckURL resolves the host of a webhook URL and reports an error when
+// any of its addresses is refused, so misconfigured subscriptions are
+// rejected when saved rather than failing on every delivery
+func (d *Dispatcher) CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !d.guard.permits(ip) {
+			return fmt.Errorf("address %s is not allowed", host)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !d.guard.permits(addr.IP) {
+			return fmt.Errorf("%s resolves to %s which is not allowed", host, addr.IP)
+		}
+	}
+	return nil
+}
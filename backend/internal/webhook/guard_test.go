@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGuardPermits(t *testing.T) {
+	g, err := newGuard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		// "This network", which Linux connects to locally
+		{"0.1.2.3", false},
+		{"0.255.255.255", false},
+		{"1.0.0.1", true},
+		// Carrier-grade NAT shared space
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"::ffff:100.100.100.200", false},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+	}
+	for _, tt := range tests {
+		if got := g.permits(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("permits(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestGuardAllowedNetworks(t *testing.T) {
+	g, err := newGuard([]string{"10.0.5.0/24", "100.64.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"10.0.5.7":    true,
+		"10.0.6.7":    false,
+		"100.64.3.4":  true,
+		"100.65.3.4":  false,
+		"127.0.0.1":   false,
+		"8.8.8.8":     true,
+		"0.0.0.0":     false,
+		"100.127.0.1": false,
+	} {
+		if got := g.permits(net.ParseIP(ip)); got != want {
+			t.Errorf("permits(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if _, err := newGuard([]string{"10.0.0.0"}); err == nil {
+		t.Fatal("accepted an allowed network without a prefix length")
+	}
+}
@@ -0,0 +1,306 @@
+// Package webhook delivers domain events to the URLs tenants subscribe,
+// signed with HMAC-SHA256 and retried with exponential backoff. Every
+// delivery is kept in webhook_deliveries as the delivery log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/event"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderEvent     = "X-ITAM-Event"
+	HeaderDelivery  = "X-ITAM-Delivery"
+	HeaderTimestamp = "X-ITAM-Timestamp"
+	HeaderSignature = "X-ITAM-Signature"
+)
+
+// maxResponseBody bounds the response kept in the delivery log
+const maxResponseBody = 2 << 10
+
+// batchSize is how many due deliveries one poll picks up
+const batchSize = 50
+
+// Sign returns the X-ITAM-Signature value for a payload sent at
+// timestamp (unix seconds): "sha256=" and the hex HMAC-SHA256 of
+// "timestamp.payload" keyed with the webhook secret. Receivers compute
+// the same and should reject stale timestamps.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher queues a delivery for every subscription matching a
+// published event and works the queue in the background
+type Dispatcher struct {
+	cfg    *conf.WebhookConfig
+	guard  *guard
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewDispatcher(cfg *conf.WebhookConfig) (*Dispatcher, error) {
+	g, err := newGuard(cfg.AllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	return &Dispatcher{
+		cfg:    cfg,
+		guard:  g,
+		client: g.client(cfg.Timeout),
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Start subscribes to the event bus and runs a pool of cfg.Workers
+// workers delivering due deliveries until ctx is done
+func (d *Dispatcher) Start(ctx context.Context) {
+	event.Subscribe(d.enqueue)
+
+	jobs := make(chan model.WebhookDelivery)
+	workers := d.cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for delivery := range jobs {
+				d.work(&delivery)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			d.dispatchDue(ctx, jobs)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// enqueue records a pending delivery for each active subscription to
+// the event. It runs on the publishing request, so only writes rows.
+func (d *Dispatcher) enqueue(e event.Event) {
+	ctx := tenant.WithTenant(context.Background(), e.TenantID)
+	var hooks []model.Webhook
+	if err := data.DB.WithContext(ctx).Where("active = ?", true).Find(&hooks).Error; err != nil {
+		log.Printf("Webhook: cannot load subscriptions for %s: %v", e.Type, err)
+		return
+	}
+
+	var payload []byte
+	now := time.Now()
+	for _, hook := range hooks {
+		if !event.Matches(hook.Events, e.Type) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(e); err != nil {
+				log.Printf("Webhook: cannot encode event %s %s: %v", e.Type, e.ID, err)
+				return
+			}
+		}
+		delivery := model.WebhookDelivery{
+			TenantID:      e.TenantID,
+			WebhookID:     hook.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryStatusPending,
+			NextAttemptAt: &now,
+		}
+		if err := data.DB.WithContext(ctx).Create(&delivery).Error; err != nil {
+			log.Printf("Webhook %d: cannot queue %s %s: %v", hook.ID, e.Type, e.ID, err)
+		}
+	}
+	if payload != nil {
+		d.Wake()
+	}
+}
+
+// Redeliver queues a fresh delivery with the payload of an earlier one
+func (d *Dispatcher) Redeliver(ctx context.Context, old *model.WebhookDelivery) (*model.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := model.WebhookDelivery{
+		TenantID:      old.TenantID,
+		WebhookID:     old.WebhookID,
+		EventID:       old.EventID,
+		EventType:     old.EventType,
+		Payload:       old.Payload,
+		Status:        model.DeliveryStatusPending,
+		NextAttemptAt: &now,
+	}
+	if err := data.DB.WithContext(ctx).Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	d.Wake()
+	return &delivery, nil
+}
+
+// Wake makes the workers look for due deliveries now
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchDue hands every pending delivery whose time has come to the
+// workers. A delivery can be handed out twice while a worker has yet to
+// claim it; the claim makes sure only one posts it.
+func (d *Dispatcher) dispatchDue(ctx context.Context, jobs chan<- model.WebhookDelivery) {
+	db := data.DB.WithContext(tenant.WithAll(ctx))
+	for {
+		var due []model.WebhookDelivery
+		err := db.Where("status = ? AND next_attempt_at <= ?", model.DeliveryStatusPending, time.Now()).
+			Order("next_attempt_at").Limit(batchSize).Find(&due).Error
+		if err != nil {
+			log.Printf("Webhook: cannot load due deliveries: %v", err)
+			return
+		}
+		for _, delivery := range due {
+			select {
+			case jobs <- delivery:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// work claims the delivery and attempts it
+func (d *Dispatcher) work(delivery *model.WebhookDelivery) {
+	db := data.DB.WithContext(tenant.WithAll(context.Background()))
+	if d.claim(db, delivery) {
+		d.attempt(db, delivery)
+	}
+}
+
+// claim pushes the delivery's next attempt past the running one, so
+// other replicas polling the same table skip it
+func (d *Dispatcher) claim(db *gorm.DB, delivery *model.WebhookDelivery) bool {
+	lease := time.Now().Add(2*d.cfg.Timeout + time.Minute)
+	result := db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, model.DeliveryStatusPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", lease)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// attempt posts the delivery once and records the outcome
+func (d *Dispatcher) attempt(db *gorm.DB, delivery *model.WebhookDelivery) {
+	updates := map[string]interface{}{"attempts": delivery.Attempts + 1}
+
+	var hook model.Webhook
+	err := db.First(&hook, delivery.WebhookID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = errors.New("webhook was deleted")
+	case err == nil && !hook.Active:
+		err = errors.New("webhook is disabled")
+	case err == nil:
+		start := time.Now()
+		var status int
+		var body string
+		status, body, err = d.post(&hook, delivery)
+		updates["duration_ms"] = time.Since(start).Milliseconds()
+		updates["response_status"] = status
+		updates["response_body"] = body
+		if err == nil {
+			updates["status"] = model.DeliveryStatusSucceeded
+			updates["next_attempt_at"] = nil
+			updates["delivered_at"] = time.Now()
+			updates["error"] = ""
+			db.Model(delivery).Updates(updates)
+			return
+		}
+		if delivery.Attempts+1 < d.cfg.MaxAttempts {
+			next := time.Now().Add(d.backoff(delivery.Attempts + 1))
+			updates["next_attempt_at"] = next
+			updates["error"] = err.Error()
+			db.Model(delivery).Updates(updates)
+			return
+		}
+	}
+
+	// Deleted or disabled subscriptions and exhausted retries end here
+	log.Printf("Webhook %d: delivery %d of %s failed: %v", delivery.WebhookID, delivery.ID, delivery.EventType, err)
+	updates["status"] = model.DeliveryStatusFailed
+	updates["next_attempt_at"] = nil
+	updates["error"] = err.Error()
+	db.Model(delivery).Updates(updates)
+}
+
+// post sends the payload, any 2xx answer counts as delivered
+func (d *Dispatcher) post(hook *model.Webhook, delivery *model.WebhookDelivery) (int, string, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ITAM-Webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, string(body), fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// backoff is the delay after the given number of failed attempts:
+// RetryBase, doubled per further attempt, capped at RetryMax
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.RetryBase
+	for i := 1; i < attempts && delay < d.cfg.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > d.cfg.RetryMax {
+		delay = d.cfg.RetryMax
+	}
+	return delay
+}
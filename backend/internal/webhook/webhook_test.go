@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"itam-backend/internal/conf"
+	"itam-backend/internal/data"
+	"itam-backend/internal/event"
+	"itam-backend/internal/model"
+	"itam-backend/internal/tenant"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "itam-webhook-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.InitDB(&conf.Config{Database: conf.DatabaseConfig{Driver: "sqlite", DbName: filepath.Join(dir, "itam.db")}})
+}
+
+func TestDispatcherDeliversInParallel(t *testing.T) {
+	setupTestDB(t)
+	const workers = 4
+
+	// Every request waits for the others, so a serial dispatcher never
+	// has more than one in flight
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+		all      = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		if peak == workers {
+			select {
+			case <-all:
+			default:
+				close(all)
+			}
+		}
+		mu.Unlock()
+
+		select {
+		case <-all:
+		case <-time.After(2 * time.Second):
+		}
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	ctx := tenant.WithTenant(context.Background(), data.DefaultTenantID)
+	hook := model.Webhook{TenantID: data.DefaultTenantID, Name: "pool", URL: srv.URL, Secret: "s3cret",
+		Events: model.StringList{event.AssetCreated}, Active: true}
+	if err := data.DB.WithContext(ctx).Create(&hook).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDispatcher(&conf.WebhookConfig{Timeout: 10 * time.Second, MaxAttempts: 1, RetryBase: time.Minute,
+		RetryMax: time.Hour, PollInterval: time.Hour, Workers: workers, AllowedNetworks: []string{"127.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(runCtx)
+	for i := 0; i < workers; i++ {
+		event.Publish(ctx, event.AssetCreated, data.DefaultTenantID, map[string]int{"id": i})
+	}
+
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		var delivered int64
+		data.DB.WithContext(ctx).Model(&model.WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", hook.ID, model.DeliveryStatusSucceeded).Count(&delivered)
+		if delivered == workers {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d deliveries succeeded", delivered, workers)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != workers {
+		t.Fatalf("at most %d deliveries in flight, want %d", peak, workers)
+	}
+}
@@ -0,0 +1,284 @@
+// Package xlsx reads and writes the subset of Office Open XML spreadsheets
+// needed for tabular import/export: one sheet of plain string/number cells.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaxColumns is the number of columns a worksheet can have, A to XFD
+const MaxColumns = 16384
+
+// maxPartSize caps how much a single part of the package may inflate to,
+// so a small upload cannot decompress into gigabytes of XML
+const maxPartSize = 64 << 20
+
+// ErrTooLarge is returned for packages with a part that inflates past the limit
+var ErrTooLarge = fmt.Errorf("xlsx: file content exceeds %dMB uncompressed", maxPartSize>>20)
+
+type xmlWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xmlRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xmlRichText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt xmlRichText) String() string {
+	if len(rt.R) == 0 {
+		return rt.T
+	}
+	var sb strings.Builder
+	sb.WriteString(rt.T)
+	for _, r := range rt.R {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xmlSST struct {
+	Items []xmlRichText `xml:"si"`
+}
+
+type xmlCell struct {
+	Ref    string      `xml:"r,attr"`
+	Type   string      `xml:"t,attr"`
+	Value  string      `xml:"v"`
+	Inline xmlRichText `xml:"is"`
+}
+
+type xmlRow struct {
+	Cells []xmlCell `xml:"c"`
+}
+
+// ReadRows returns the cell text of the first worksheet, row by row.
+// Empty cells inside a row are returned as "" so columns stay aligned.
+func ReadRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst xmlSST
+		if err := decodeFile(f, &sst); err != nil {
+			return nil, fmt.Errorf("read shared strings: %w", err)
+		}
+		shared = make([]string, len(sst.Items))
+		for i, si := range sst.Items {
+			shared[i] = si.String()
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet %s not found", sheetPath)
+	}
+	rc, err := openPart(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var rows [][]string
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read worksheet: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xmlRow
+		if err := dec.DecodeElement(&row, &start); err != nil {
+			return nil, fmt.Errorf("read worksheet: %w", err)
+		}
+
+		if len(row.Cells) > MaxColumns {
+			return nil, fmt.Errorf("row has more than %d cells", MaxColumns)
+		}
+		var values []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+			values = append(values, cellText(c, shared))
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func cellText(c xmlCell, shared []string) string {
+	switch c.Type {
+	case "s":
+		idx, err := strconv.Atoi(strings.TrimSpace(c.Value))
+		if err != nil || idx < 0 || idx >= len(shared) {
+			return ""
+		}
+		return shared[idx]
+	case "inlineStr":
+		return c.Inline.String()
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return c.Value
+	}
+}
+
+// firstSheetPath resolves the part name of the first sheet listed in the workbook
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	wbFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("not an xlsx file: xl/workbook.xml missing")
+	}
+	var wb xmlWorkbook
+	if err := decodeFile(wbFile, &wb); err != nil {
+		return "", fmt.Errorf("read workbook: %w", err)
+	}
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback, nil
+	}
+	var rels xmlRelationships
+	if err := decodeFile(relsFile, &rels); err != nil {
+		return "", fmt.Errorf("read workbook relationships: %w", err)
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == wb.Sheets[0].RID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return fallback, nil
+}
+
+func decodeFile(f *zip.File, v interface{}) error {
+	rc, err := openPart(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// openPart opens a package part for reading, failing with ErrTooLarge
+// once more than maxPartSize bytes come out of it whatever its header says
+func openPart(f *zip.File) (io.ReadCloser, error) {
+	if f.UncompressedSize64 > maxPartSize {
+		return nil, ErrTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &limitedPart{rc: rc, left: maxPartSize}, nil
+}
+
+type limitedPart struct {
+	rc   io.ReadCloser
+	left int64
+}
+
+func (p *limitedPart) Read(b []byte) (int, error) {
+	if p.left <= 0 {
+		// Anything beyond the limit means the part is too large
+		var one [1]byte
+		if n, _ := p.rc.Read(one[:]); n > 0 {
+			return 0, ErrTooLarge
+		}
+		return p.rc.Read(b)
+	}
+	if int64(len(b)) > p.left {
+		b = b[:p.left]
+	}
+	n, err := p.rc.Read(b)
+	p.left -= int64(n)
+	return n, err
+}
+
+func (p *limitedPart) Close() error { return p.rc.Close() }
+
+// columnIndex converts a cell reference such as "AB12" to a 0-based column
+// index, refusing columns past XFD
+func columnIndex(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		n++
+		if col > MaxColumns {
+			return 0, fmt.Errorf("cell reference %q is past the last column XFD", ref)
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// ColumnName converts a 0-based column index to its letter name, e.g. 27 -> "AB"
+func ColumnName(idx int) string {
+	name := ""
+	for idx >= 0 {
+		name = string(rune('A'+idx%26)) + name
+		idx = idx/26 - 1
+	}
+	return name
+}
@@ -0,0 +1,55 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriterKeepsFormulasAsText(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formula := `=HYPERLINK("http://evil.example.com","x")`
+	if err := w.WriteRow([]interface{}{"name", "amount"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{formula, -3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]interface{}{"@SUM(A1:A9)", nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, err := zr.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(sheet)
+	// Text is an inline string, never a formula element
+	if strings.Contains(string(raw), "<f>") {
+		t.Fatalf("sheet holds a formula: %s", raw)
+	}
+	if !strings.Contains(string(raw), `<c r="A2" t="inlineStr">`) || !strings.Contains(string(raw), `<c r="B2"><v>-3</v></c>`) {
+		t.Fatalf("sheet = %s", raw)
+	}
+
+	rows, err := ReadRows(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][0] != formula || rows[1][1] != "-3" || rows[2][0] != "@SUM(A1:A9)" {
+		t.Fatalf("rows = %q", rows)
+	}
+}